@@ -8,6 +8,8 @@ require (
 	github.com/golang/mock v1.6.0
 	github.com/golangci/golangci-lint v1.40.1
 	github.com/jstemmer/go-junit-report v0.9.1
+	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.1.0
+	google.golang.org/protobuf v1.26.0
 	mvdan.cc/gofumpt v0.1.1
 	sigs.k8s.io/controller-tools v0.6.2
 )
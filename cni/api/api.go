@@ -35,3 +35,25 @@ func (a *AzureCNIState) PrintResult() error {
 
 	return nil
 }
+
+// GCResult lists the pod interfaces a CNI GC command removed, or would remove in a dry run.
+type GCResult struct {
+	DryRun            bool
+	RemovedInterfaces []PodNetworkInterfaceInfo
+}
+
+func (g *GCResult) PrintResult() error {
+	b, err := json.MarshalIndent(g, "", "    ")
+	if err != nil {
+		log.Errorf("Failed to marshall Azure CNI GC result, err:%v.\n", err)
+	}
+
+	// write result to stdout to be captured by caller
+	_, err = os.Stdout.Write(b)
+	if err != nil {
+		log.Printf("Failed to write response to stdout %v", err)
+		return err
+	}
+
+	return nil
+}
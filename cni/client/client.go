@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -19,6 +20,7 @@ const (
 
 type Client interface {
 	GetEndpointState() (*api.AzureCNIState, error)
+	GC(nwCfg *cni.NetworkConfig) (*api.GCResult, error)
 }
 
 var _ (Client) = (*client)(nil)
@@ -53,6 +55,30 @@ func (c *client) GetEndpointState() (*api.AzureCNIState, error) {
 	return state, nil
 }
 
+// GC removes the endpoints of the network which are not in the valid attachments of the network config.
+func (c *client) GC(nwCfg *cni.NetworkConfig) (*api.GCResult, error) {
+	cmd := c.exec.Command(azureVnetExecutable)
+
+	envs := os.Environ()
+	cmdenv := fmt.Sprintf("%s=%s", cni.Cmd, cni.CmdGC)
+	log.Printf("Setting cmd to %s", cmdenv)
+	envs = append(envs, cmdenv)
+	cmd.SetEnv(envs)
+	cmd.SetStdin(bytes.NewReader(nwCfg.Serialize()))
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Azure CNI bin with err: [%w], output: [%s]", err, string(output))
+	}
+
+	result := &api.GCResult{}
+	if err := json.Unmarshal(output, result); err != nil {
+		return nil, fmt.Errorf("failed to decode response from Azure CNI when collecting stale endpoints: [%w], response from CNI: [%s]", err, string(output))
+	}
+
+	return result, nil
+}
+
 func (c *client) GetVersion() (*semver.Version, error) {
 	cmd := c.exec.Command(azureVnetExecutable, "-v")
 
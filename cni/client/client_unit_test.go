@@ -5,6 +5,7 @@ package client
 import (
 	"testing"
 
+	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/api"
 	testutils "github.com/Azure/azure-container-networking/test/utils"
 	ver "github.com/hashicorp/go-version"
@@ -32,6 +33,27 @@ func TestGetState(t *testing.T) {
 	require.Equal(t, res, state)
 }
 
+func TestGC(t *testing.T) {
+	calls := []testutils.TestCmd{
+		{Cmd: []string{"/opt/cni/bin/azure-vnet"}, Stdout: `{"DryRun":true,"RemovedInterfaces":[{"PodName":"tunnelfront-5d96f9b987-65xbn","PodNamespace":"kube-system","PodEndpointID":"6e688597-eth0","ContainerID":"6e688597eafb97c83c84e402cc72b299bfb8aeb02021e4c99307a037352c0bed","IPAddresses":[{"IP":"10.241.0.13","Mask":"//8AAA=="}]}]}`},
+	}
+
+	fakeexec := testutils.GetFakeExecWithScripts(calls)
+
+	c := New(fakeexec)
+	result, err := c.GC(&cni.NetworkConfig{Name: "azure", GCDryRun: true})
+	require.NoError(t, err)
+
+	res := &api.GCResult{
+		DryRun: true,
+		RemovedInterfaces: []api.PodNetworkInterfaceInfo{
+			testGetPodNetworkInterfaceInfo("6e688597-eth0", "tunnelfront-5d96f9b987-65xbn", "kube-system", "6e688597eafb97c83c84e402cc72b299bfb8aeb02021e4c99307a037352c0bed", "10.241.0.13/16"),
+		},
+	}
+
+	require.Equal(t, res, result)
+}
+
 func TestGetVersion(t *testing.T) {
 	calls := []testutils.TestCmd{
 		{Cmd: []string{"/opt/cni/bin/azure-vnet", "-v"}, Stdout: `Azure CNI Version v1.4.0-2-g984c5a5e-dirty`},
@@ -12,12 +12,14 @@ const (
 	Cmd = "CNI_COMMAND"
 	// CmdAdd - CNI ADD command.
 	CmdAdd = "ADD"
-	// CmdGet - CNI GET command.
-	CmdGet = "GET"
+	// CmdCheck - CNI CHECK command.
+	CmdCheck = "CHECK"
 	// CmdDel - CNI DEL command.
 	CmdDel = "DEL"
 	// CmdUpdate - CNI UPDATE command.
 	CmdUpdate = "UPDATE"
+	// CmdGC - CNI GC command, which removes the attachments of a network which the runtime no longer knows about.
+	CmdGC = "GC"
 	// CmdVersion - CNI VERSION command.
 	CmdVersion = "VERSION"
 
@@ -25,7 +27,9 @@ const (
 	CmdGetEndpointsState = "GET_ENDPOINT_STATE"
 
 	// CNI errors.
-	ErrRuntime = 100
+	ErrInvalidNetworkConfig        = 4
+	ErrInvalidEnvironmentVariables = 7
+	ErrRuntime                     = 100
 
 	// DefaultVersion is the CNI version used when no version is specified in a network config file.
 	defaultVersion = "0.2.0"
@@ -37,7 +41,7 @@ var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0"}
 // CNI contract.
 type PluginApi interface {
 	Add(args *cniSkel.CmdArgs) error
-	Get(args *cniSkel.CmdArgs) error
+	Check(args *cniSkel.CmdArgs) error
 	Delete(args *cniSkel.CmdArgs) error
 	Update(args *cniSkel.CmdArgs) error
 }
@@ -261,8 +261,8 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
-// Get handles CNI Get commands.
-func (plugin *ipamPlugin) Get(args *cniSkel.CmdArgs) error {
+// Check handles CNI check commands.
+func (plugin *ipamPlugin) Check(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
@@ -5,6 +5,8 @@ package cni
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/network/policy"
@@ -14,6 +16,13 @@ import (
 
 const (
 	PolicyStr string = "Policy"
+
+	// NetworkAttachmentsAnnotation is the pod annotation which lists the network attachments of the pod, in the
+	// same JSON format as the networkAttachments CNI arg.
+	NetworkAttachmentsAnnotation = "kubernetes.azure.com/network-attachments"
+
+	// Prefix of the names of secondary interfaces which are not named by their network attachment.
+	attachmentIfNamePrefix = "net"
 )
 
 // KVPair represents a K-V pair of a json object.
@@ -29,9 +38,21 @@ type PortMapping struct {
 	HostIp        string `json:"hostIP,omitempty"`
 }
 
+// BandwidthConfig is set by the runtime when the plugin has the bandwidth capability. Rates are in bits per second
+// and bursts are in bits.
+type BandwidthConfig struct {
+	IngressRate  uint64 `json:"ingressRate,omitempty"`
+	IngressBurst uint64 `json:"ingressBurst,omitempty"`
+	EgressRate   uint64 `json:"egressRate,omitempty"`
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`
+}
+
 type RuntimeConfig struct {
 	PortMappings []PortMapping    `json:"portMappings,omitempty"`
 	DNS          RuntimeDNSConfig `json:"dns,omitempty"`
+	Bandwidth    *BandwidthConfig `json:"bandwidth,omitempty"`
+	// PodAnnotations is set by containerd when the plugin has the io.kubernetes.cri.pod-annotations capability.
+	PodAnnotations map[string]string `json:"io.kubernetes.cri.pod-annotations,omitempty"`
 }
 
 // https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/dockershim/network/cni/cni.go#L104
@@ -76,6 +97,64 @@ type NetworkConfig struct {
 	DNS            cniTypes.DNS  `json:"dns,omitempty"`
 	RuntimeConfig  RuntimeConfig `json:"runtimeConfig,omitempty"`
 	AdditionalArgs []KVPair      `json:"AdditionalArgs,omitempty"`
+	// ValidAttachments is set by the runtime in GC commands. Attachments of the network which are not in it are removed.
+	// It is nil if the runtime did not set it, and empty if no attachment is valid, so it is not omitted when empty.
+	ValidAttachments []Attachment `json:"cni.dev/valid-attachments"`
+	// GCDryRun reports the attachments a GC command would remove without removing them.
+	GCDryRun bool `json:"gcDryRun,omitempty"`
+	// Tuning sets sysctls and interface settings in the network namespace of the container.
+	Tuning *TuningConfig `json:"tuning,omitempty"`
+	// AttachmentNetworks are the networks network attachments can attach secondary interfaces to.
+	AttachmentNetworks []AttachmentNetwork `json:"attachmentNetworks,omitempty"`
+	// Args are the CNI args of the network configuration, see
+	// https://github.com/containernetworking/cni/blob/master/CONVENTIONS.md#args-in-network-config
+	Args struct {
+		CNI struct {
+			NetworkAttachments []NetworkAttachment `json:"networkAttachments,omitempty"`
+		} `json:"cni,omitempty"`
+	} `json:"args,omitempty"`
+}
+
+// AttachmentNetwork is a network which network attachments can attach to. They are only listed in the network
+// configuration, so that pods cannot create networks on other host interfaces.
+type AttachmentNetwork struct {
+	Name   string `json:"name"`
+	Master string `json:"master,omitempty"`
+	Ipam   struct {
+		Type   string `json:"type,omitempty"`
+		Subnet string `json:"subnet,omitempty"`
+	} `json:"ipam,omitempty"`
+}
+
+// NetworkAttachment attaches a secondary interface of the pod to a network. The interface gets its addresses from
+// its own IPAM and only has the routes of the attachment. Master is set from the attachment network, it is not
+// read from the attachment.
+type NetworkAttachment struct {
+	Network string `json:"network"`
+	IfName  string `json:"interface,omitempty"`
+	Master  string `json:"-"`
+	Ipam    struct {
+		Type   string `json:"type,omitempty"`
+		Subnet string `json:"subnet,omitempty"`
+	} `json:"ipam,omitempty"`
+	Routes []cniTypes.Route `json:"routes,omitempty"`
+}
+
+// Attachment identifies a container interface attached to a network.
+type Attachment struct {
+	ContainerID string `json:"containerID"`
+	IfName      string `json:"ifname"`
+}
+
+// TuningConfig sets sysctls and interface settings in the network namespace of the container. Only the sysctls in
+// AllowedSysctls can be set, or those in the default allow list if it is empty. The tuning pod annotation is only
+// read if AllowPodAnnotation is set.
+type TuningConfig struct {
+	Sysctls            map[string]string `json:"sysctls,omitempty"`
+	MTU                int               `json:"mtu,omitempty"`
+	TxQueueLen         int               `json:"txQueueLen,omitempty"`
+	AllowedSysctls     []string          `json:"allowedSysctls,omitempty"`
+	AllowPodAnnotation bool              `json:"allowPodAnnotation,omitempty"`
 }
 
 type K8SPodEnvArgs struct {
@@ -83,6 +162,11 @@ type K8SPodEnvArgs struct {
 	K8S_POD_NAMESPACE          cniTypes.UnmarshallableString `json:"K8S_POD_NAMESPACE,omitempty"`
 	K8S_POD_NAME               cniTypes.UnmarshallableString `json:"K8S_POD_NAME,omitempty"`
 	K8S_POD_INFRA_CONTAINER_ID cniTypes.UnmarshallableString `json:"K8S_POD_INFRA_CONTAINER_ID,omitempty"`
+	// Tuning of the pod, see TuningConfig. SYSCTLS is a comma separated list of name:value pairs, in which commas
+	// and backslashes of the values are escaped with a backslash.
+	SYSCTLS    cniTypes.UnmarshallableString `json:"SYSCTLS,omitempty"`
+	MTU        cniTypes.UnmarshallableString `json:"MTU,omitempty"`
+	TXQUEUELEN cniTypes.UnmarshallableString `json:"TXQUEUELEN,omitempty"`
 }
 
 // ParseCniArgs unmarshals cni arguments.
@@ -128,6 +212,67 @@ func GetPoliciesFromNwCfg(kvp []KVPair) []policy.Policy {
 	return policies
 }
 
+// GetNetworkAttachments returns the network attachments of the pod from the CNI args, followed by those from the pod
+// annotation. Attachments without an interface name are named net1, net2 and so on. ifName is the name of the
+// primary interface, which attachments must not reuse. Attachments can only attach to the attachment networks of the
+// network configuration, which set their master interface and IPAM.
+func GetNetworkAttachments(nwCfg *NetworkConfig, ifName string) ([]NetworkAttachment, error) {
+	attachments := append([]NetworkAttachment{}, nwCfg.Args.CNI.NetworkAttachments...)
+
+	if annotation := nwCfg.RuntimeConfig.PodAnnotations[NetworkAttachmentsAnnotation]; annotation != "" {
+		var annotated []NetworkAttachment
+		if err := json.Unmarshal([]byte(annotation), &annotated); err != nil {
+			return nil, fmt.Errorf("Invalid %s annotation: %v", NetworkAttachmentsAnnotation, err)
+		}
+
+		attachments = append(attachments, annotated...)
+	}
+
+	networks := make(map[string]*AttachmentNetwork, len(nwCfg.AttachmentNetworks))
+	for i := range nwCfg.AttachmentNetworks {
+		networks[nwCfg.AttachmentNetworks[i].Name] = &nwCfg.AttachmentNetworks[i]
+	}
+
+	ifNames := map[string]bool{ifName: true}
+	for i := range attachments {
+		attachment := &attachments[i]
+		if attachment.Network == "" {
+			return nil, fmt.Errorf("Network attachment %d has no network", i)
+		}
+
+		network, ok := networks[attachment.Network]
+		if !ok || attachment.Network == nwCfg.Name {
+			return nil, fmt.Errorf("Network attachment %d attaches to network %s, which is not an attachment network", i, attachment.Network)
+		}
+
+		// the IPAM of the attachment network overrides the one of the attachment
+		attachment.Master = network.Master
+		if network.Ipam.Type != "" {
+			attachment.Ipam.Type = network.Ipam.Type
+		}
+		if network.Ipam.Subnet != "" {
+			attachment.Ipam.Subnet = network.Ipam.Subnet
+		}
+
+		if attachment.IfName == "" {
+			attachment.IfName = fmt.Sprintf("%s%d", attachmentIfNamePrefix, i+1)
+		}
+
+		if ifNames[attachment.IfName] {
+			return nil, fmt.Errorf("Network attachment %d reuses interface %s", i, attachment.IfName)
+		}
+		ifNames[attachment.IfName] = true
+
+		if attachment.Ipam.Subnet != "" {
+			if _, _, err := net.ParseCIDR(attachment.Ipam.Subnet); err != nil {
+				return nil, fmt.Errorf("Network attachment %d has invalid subnet %s", i, attachment.Ipam.Subnet)
+			}
+		}
+	}
+
+	return attachments, nil
+}
+
 // Serialize marshals a network configuration to bytes.
 func (nwcfg *NetworkConfig) Serialize() []byte {
 	bytes, _ := json.Marshal(nwcfg)
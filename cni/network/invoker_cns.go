@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cns"
@@ -19,6 +20,12 @@ import (
 
 const (
 	cnsPort = 10090
+	// maxIPRequestRetries bounds how many times IP requests CNS rejected with a retriable code are retried
+	maxIPRequestRetries = 5
+	// defaultIPRequestRetryAfter is how long to wait before retrying, when CNS does not ask for a delay
+	defaultIPRequestRetryAfter = time.Second
+	// maxIPRequestRetryAfter bounds how long to wait before each retry, so the retries fit in the CNI ADD timeout
+	maxIPRequestRetryAfter = 3 * time.Second
 )
 
 type CNSIPAMInvoker struct {
@@ -27,7 +34,7 @@ type CNSIPAMInvoker struct {
 	cnsClient    *cnsclient.CNSClient
 }
 
-type IPv4ResultInfo struct {
+type IPResultInfo struct {
 	podIPAddress       string
 	ncSubnetPrefix     uint8
 	ncPrimaryIP        string
@@ -37,8 +44,12 @@ type IPv4ResultInfo struct {
 	hostGateway        string
 }
 
-func NewCNSInvoker(podName, namespace string) (*CNSIPAMInvoker, error) {
-	cnsURL := "http://localhost:" + strconv.Itoa(cnsPort)
+// NewCNSInvoker creates an invoker of the CNS IPAM at cnsURL, which may be a unix:// socket URL. An empty cnsURL
+// connects to CNS on its default local port.
+func NewCNSInvoker(podName, namespace, cnsURL string) (*CNSIPAMInvoker, error) {
+	if cnsURL == "" {
+		cnsURL = "http://localhost:" + strconv.Itoa(cnsPort)
+	}
 	cnsClient, err := cnsclient.InitCnsClient(cnsURL, defaultRequestTimeout)
 
 	return &CNSIPAMInvoker{
@@ -48,12 +59,13 @@ func NewCNSInvoker(podName, namespace string) (*CNSIPAMInvoker, error) {
 	}, err
 }
 
-// Add uses the requestipconfig API in cns, and returns ipv4 and a nil ipv6 as CNS doesn't support IPv6 yet
+// Add uses the requestipconfig API in cns, and returns the ipv4 result and, for dual-stack pods, the ipv6 result
 func (invoker *CNSIPAMInvoker) Add(nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs, hostSubnetPrefix *net.IPNet, options map[string]interface{}) (*cniTypesCurr.Result, *cniTypesCurr.Result, error) {
 	// Parse Pod arguments.
 	podInfo := cns.KubernetesPodInfo{
-		PodName:      invoker.podName,
-		PodNamespace: invoker.podNamespace,
+		PodName:       invoker.podName,
+		PodNamespace:  invoker.podNamespace,
+		PodSubnetName: nwCfg.RuntimeConfig.PodAnnotations[cns.PodSubnetNameAnnotation],
 	}
 	orchestratorContext, err := json.Marshal(podInfo)
 	if err != nil {
@@ -67,36 +79,94 @@ func (invoker *CNSIPAMInvoker) Add(nwCfg *cni.NetworkConfig, args *cniSkel.CmdAr
 	}
 
 	log.Printf("Requesting IP for pod %+v using ipconfig %+v", podInfo, ipconfig)
-	response, err := invoker.cnsClient.RequestIPAddress(&ipconfig)
+	response, err := requestIPAddressWithRetry(&ipconfig, invoker.cnsClient.RequestIPAddress, time.Sleep)
 	if err != nil {
 		log.Printf("Failed to get IP address from CNS with error %v, response: %v", err, response)
 		return nil, nil, err
 	}
 
-	info := IPv4ResultInfo{
-		podIPAddress:       response.PodIpInfo.PodIPConfig.IPAddress,
-		ncSubnetPrefix:     response.PodIpInfo.NetworkContainerPrimaryIPConfig.IPSubnet.PrefixLength,
-		ncPrimaryIP:        response.PodIpInfo.NetworkContainerPrimaryIPConfig.IPSubnet.IPAddress,
-		ncGatewayIPAddress: response.PodIpInfo.NetworkContainerPrimaryIPConfig.GatewayIPAddress,
-		hostSubnet:         response.PodIpInfo.HostPrimaryIPInfo.Subnet,
-		hostPrimaryIP:      response.PodIpInfo.HostPrimaryIPInfo.PrimaryIP,
-		hostGateway:        response.PodIpInfo.HostPrimaryIPInfo.Gateway,
+	// CNS versions without dual-stack support only return PodIpInfo
+	podIPInfoList := response.PodIPInfoList
+	if len(podIPInfoList) == 0 {
+		podIPInfoList = []cns.PodIpInfo{response.PodIpInfo}
+	}
+
+	var result, resultV6 *cniTypesCurr.Result
+	for i := range podIPInfoList {
+		info := IPResultInfo{
+			podIPAddress:       podIPInfoList[i].PodIPConfig.IPAddress,
+			ncSubnetPrefix:     podIPInfoList[i].NetworkContainerPrimaryIPConfig.IPSubnet.PrefixLength,
+			ncPrimaryIP:        podIPInfoList[i].NetworkContainerPrimaryIPConfig.IPSubnet.IPAddress,
+			ncGatewayIPAddress: podIPInfoList[i].NetworkContainerPrimaryIPConfig.GatewayIPAddress,
+			hostSubnet:         podIPInfoList[i].HostPrimaryIPInfo.Subnet,
+			hostPrimaryIP:      podIPInfoList[i].HostPrimaryIPInfo.PrimaryIP,
+			hostGateway:        podIPInfoList[i].HostPrimaryIPInfo.Gateway,
+		}
+
+		log.Printf("[cni-invoker-cns] Received info %+v for pod %v", info, podInfo)
+
+		if ip := net.ParseIP(info.podIPAddress); ip != nil && ip.To4() == nil {
+			if resultV6, err = getIPv6Result(info); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if result, err = getIPv4Result(nwCfg, hostSubnetPrefix, options, info); err != nil {
+			return nil, nil, err
+		}
 	}
 
+	if result == nil {
+		return nil, nil, fmt.Errorf("No IPv4 address in response from CNS: %+v", response)
+	}
+
+	if resultV6 != nil {
+		// the ipv6 default route is programmed in the container along with the ipv4 routes
+		result.Routes = append(result.Routes, resultV6.Routes...)
+	}
+
+	return result, resultV6, nil
+}
+
+// requestIPAddressWithRetry requests IPs from CNS with request. Requests CNS rejected with a retriable code, because
+// it is handling too many requests or the pool has no free IPs while it scales up, are retried after the delay CNS
+// asks for, up to maxIPRequestRetries times.
+func requestIPAddressWithRetry(
+	ipconfig *cns.IPConfigRequest,
+	request func(*cns.IPConfigRequest) (*cns.IPConfigResponse, error),
+	sleep func(time.Duration),
+) (*cns.IPConfigResponse, error) {
+	for retry := 0; ; retry++ {
+		response, err := request(ipconfig)
+		if err == nil || response == nil || !response.Response.ReturnCode.IsRetriable() || retry == maxIPRequestRetries {
+			return response, err
+		}
+
+		retryAfter := time.Duration(response.RetryAfterInMs) * time.Millisecond
+		if retryAfter <= 0 {
+			retryAfter = defaultIPRequestRetryAfter
+		} else if retryAfter > maxIPRequestRetryAfter {
+			retryAfter = maxIPRequestRetryAfter
+		}
+		log.Printf("[cni-invoker-cns] CNS returned %s, retrying IP request in %v: %v", response.Response.ReturnCode, retryAfter, err)
+		sleep(retryAfter)
+	}
+}
+
+func getIPv4Result(nwCfg *cni.NetworkConfig, hostSubnetPrefix *net.IPNet, options map[string]interface{}, info IPResultInfo) (*cniTypesCurr.Result, error) {
 	// set the NC Primary IP in options
 	options[network.SNATIPKey] = info.ncPrimaryIP
 
-	log.Printf("[cni-invoker-cns] Received info %+v for pod %v", info, podInfo)
-
 	ncgw := net.ParseIP(info.ncGatewayIPAddress)
 	if ncgw == nil {
-		return nil, nil, fmt.Errorf("Gateway address %v from response is invalid", info.ncGatewayIPAddress)
+		return nil, fmt.Errorf("Gateway address %v from response is invalid", info.ncGatewayIPAddress)
 	}
 
 	// set result ipconfig from CNS Response Body
 	ip, ncipnet, err := net.ParseCIDR(info.podIPAddress + "/" + fmt.Sprint(info.ncSubnetPrefix))
 	if ip == nil {
-		return nil, nil, fmt.Errorf("Unable to parse IP from response: %v with err %v", info.podIPAddress, err)
+		return nil, fmt.Errorf("Unable to parse IP from response: %v with err %v", info.podIPAddress, err)
 	}
 
 	// construct ipnet for result
@@ -122,16 +192,45 @@ func (invoker *CNSIPAMInvoker) Add(nwCfg *cni.NetworkConfig, args *cniSkel.CmdAr
 	}
 
 	// set subnet prefix for host vm
-	err = setHostOptions(nwCfg, hostSubnetPrefix, ncipnet, options, info)
-	if err != nil {
-		return nil, nil, err
+	if err = setHostOptions(nwCfg, hostSubnetPrefix, ncipnet, options, info); err != nil {
+		return nil, err
 	}
 
-	// first result is ipv4, second is ipv6, SWIFT doesn't currently support IPv6
-	return result, nil, nil
+	return result, nil
+}
+
+func getIPv6Result(info IPResultInfo) (*cniTypesCurr.Result, error) {
+	ncgw := net.ParseIP(info.ncGatewayIPAddress)
+	if ncgw == nil {
+		return nil, fmt.Errorf("IPv6 gateway address %v from response is invalid", info.ncGatewayIPAddress)
+	}
+
+	ip, ncipnet, err := net.ParseCIDR(info.podIPAddress + "/" + fmt.Sprint(info.ncSubnetPrefix))
+	if ip == nil {
+		return nil, fmt.Errorf("Unable to parse IPv6 from response: %v with err %v", info.podIPAddress, err)
+	}
+
+	return &cniTypesCurr.Result{
+		IPs: []*cniTypesCurr.IPConfig{
+			{
+				Version: "6",
+				Address: net.IPNet{
+					IP:   ip,
+					Mask: ncipnet.Mask,
+				},
+				Gateway: ncgw,
+			},
+		},
+		Routes: []*cniTypes.Route{
+			{
+				Dst: network.Ipv6DefaultRouteDstPrefix,
+				GW:  ncgw,
+			},
+		},
+	}, nil
 }
 
-func setHostOptions(nwCfg *cni.NetworkConfig, hostSubnetPrefix *net.IPNet, ncSubnetPrefix *net.IPNet, options map[string]interface{}, info IPv4ResultInfo) error {
+func setHostOptions(nwCfg *cni.NetworkConfig, hostSubnetPrefix *net.IPNet, ncSubnetPrefix *net.IPNet, options map[string]interface{}, info IPResultInfo) error {
 	// get the name of the primary IP address
 	_, hostIPNet, err := net.ParseCIDR(info.hostSubnet)
 	if err != nil {
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/require"
+)
+
+var errIPRequestFailed = errors.New("ip request failed")
+
+// fakeIPRequests returns the responses in order, failing the ones with a return code other than Success.
+func fakeIPRequests(responses ...cns.IPConfigResponse) (func(*cns.IPConfigRequest) (*cns.IPConfigResponse, error), *int) {
+	calls := 0
+	return func(*cns.IPConfigRequest) (*cns.IPConfigResponse, error) {
+		response := responses[calls]
+		calls++
+		if response.Response.ReturnCode != types.Success {
+			return &response, errIPRequestFailed
+		}
+		return &response, nil
+	}, &calls
+}
+
+func TestRequestIPAddressWithRetry(t *testing.T) {
+	throttled := cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.RequestThrottled}, RetryAfterInMs: 500}
+	noFreeIPs := cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.NoFreeIPs}, RetryAfterInMs: 60000}
+	noHint := cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.NoFreeIPs}}
+	success := cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.Success}}
+
+	request, calls := fakeIPRequests(throttled, noFreeIPs, noHint, success)
+	var waits []time.Duration
+	response, err := requestIPAddressWithRetry(&cns.IPConfigRequest{}, request, func(d time.Duration) { waits = append(waits, d) })
+	require.NoError(t, err)
+	require.Equal(t, types.Success, response.Response.ReturnCode)
+	require.Equal(t, 4, *calls)
+	// the delay CNS asks for is bounded, and defaulted when CNS does not ask for one
+	require.Equal(t, []time.Duration{500 * time.Millisecond, maxIPRequestRetryAfter, defaultIPRequestRetryAfter}, waits)
+}
+
+func TestRequestIPAddressWithRetryGivesUp(t *testing.T) {
+	responses := make([]cns.IPConfigResponse, maxIPRequestRetries+1)
+	for i := range responses {
+		responses[i] = cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.RequestThrottled}}
+	}
+	request, calls := fakeIPRequests(responses...)
+	_, err := requestIPAddressWithRetry(&cns.IPConfigRequest{}, request, func(time.Duration) {})
+	require.ErrorIs(t, err, errIPRequestFailed)
+	require.Equal(t, maxIPRequestRetries+1, *calls)
+
+	// other failures are not retried
+	request, calls = fakeIPRequests(cns.IPConfigResponse{Response: cns.Response{ReturnCode: types.FailedToAllocateIPConfig}})
+	_, err = requestIPAddressWithRetry(&cns.IPConfigRequest{}, request, func(time.Duration) {
+		t.Fatal("Expected no retry of a failure which is not retriable")
+	})
+	require.ErrorIs(t, err, errIPRequestFailed)
+	require.Equal(t, 1, *calls)
+}
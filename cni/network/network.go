@@ -6,11 +6,13 @@ package network
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,10 +36,8 @@ import (
 )
 
 const (
-	dockerNetworkOption = "com.docker.network.generic"
-	opModeTransparent   = "transparent"
-	// Supported IP version. Currently support only IPv4
-	ipVersion             = "4"
+	dockerNetworkOption   = "com.docker.network.generic"
+	opModeTransparent     = "transparent"
 	ipamV6                = "azure-vnet-ipamv6"
 	defaultRequestTimeout = 15 * time.Second
 )
@@ -308,20 +308,14 @@ func addNatIPV6SubnetInfo(nwCfg *cni.NetworkConfig,
 // Add handles CNI add commands.
 func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	var (
-		result           *cniTypesCurr.Result
-		resultV6         *cniTypesCurr.Result
-		azIpamResult     *cniTypesCurr.Result
-		err              error
-		vethName         string
-		nwCfg            *cni.NetworkConfig
-		epInfo           *network.EndpointInfo
-		iface            *cniTypesCurr.Interface
-		subnetPrefix     net.IPNet
-		cnsNetworkConfig *cns.GetNetworkContainerResponse
-		enableInfraVnet  bool
-		enableSnatForDns bool
-		nwDNSInfo        network.DNSInfo
-		cniMetric        telemetry.AIMetric
+		result            *cniTypesCurr.Result
+		resultV6          *cniTypesCurr.Result
+		err               error
+		nwCfg             *cni.NetworkConfig
+		iface             *cniTypesCurr.Interface
+		attachments       []cni.NetworkAttachment
+		attachmentResults []*cniTypesCurr.Result
+		cniMetric         telemetry.AIMetric
 	)
 
 	startTime := time.Now()
@@ -338,13 +332,6 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 
 	log.Printf("[cni-net] Read network configuration %+v.", nwCfg)
 
-	// Temporary if block to determing whether we disable SNAT on host (for multi-tenant scenario only)
-	if nwCfg.MultiTenancy {
-		if enableSnatForDns, nwCfg.EnableSnatOnHost, err = determineSnat(); err != nil {
-			return err
-		}
-	}
-
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
 	plugin.setCNIReportDetails(nwCfg, CNI_ADD, "")
 
@@ -372,6 +359,15 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			result.IPs = append(result.IPs, resultV6.IPs...)
 		}
 
+		// With more than one interface, each address names the interface it is assigned to.
+		if len(attachmentResults) > 0 {
+			setIPInterface(result.IPs, len(result.Interfaces)-1)
+		}
+
+		for i, attachmentResult := range attachmentResults {
+			appendAttachmentResult(result, attachments[i].IfName, attachmentResult)
+		}
+
 		addSnatInterface(nwCfg, result)
 		// Convert result to the requested CNI version.
 		res, vererr := result.GetAsVersion(nwCfg.CNIVersion)
@@ -388,10 +384,73 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		log.Printf("[cni-net] ADD command completed with result:%+v err:%v.", result, err)
 	}()
 
+	// Parse the network attachments before adding any interface, so that invalid ones fail without side effects.
+	if attachments, err = cni.GetNetworkAttachments(nwCfg, args.IfName); err != nil {
+		err = plugin.Errorf("Failed to parse network attachments: %v", err)
+		return err
+	}
+
+	// Merge the tuning of the pod into the network configuration, so that invalid tuning fails without side effects.
+	if nwCfg.Tuning, err = cni.GetTuning(nwCfg, args.Args); err != nil {
+		err = plugin.Error(err)
+		return err
+	}
+
+	if len(attachments) > 0 && (nwCfg.ExecutionMode == string(Baremetal) || nwCfg.Mode == opModeTransparent) {
+		err = plugin.Errorf("Network attachments are not supported in %s %s mode", nwCfg.ExecutionMode, nwCfg.Mode)
+		return err
+	}
+
+	// CNS allocates the addresses of a pod by pod name, so each interface of the pod would be given the same addresses.
+	for i := range attachments {
+		if getAttachmentIpamType(nwCfg, &attachments[i]) == network.AzureCNS {
+			err = plugin.Errorf("Network attachment %s cannot use the %s IPAM, which only allocates addresses to the primary interface",
+				attachments[i].IfName, network.AzureCNS)
+			return err
+		}
+	}
+
+	// The attachments are recorded on the endpoint of the primary interface, which is created first, so that DEL
+	// deletes them even if it does not get the same network configuration or pod annotations.
+	nwCfg.Args.CNI.NetworkAttachments = attachments
+
+	if result, resultV6, err = plugin.addInterface(args, nwCfg, nil); err != nil {
+		return err
+	}
+
+	attachmentResults, err = plugin.addAttachments(args, nwCfg, attachments)
+	return err
+}
+
+// addInterface adds the container interface args.IfName to the network of the network configuration. The network
+// is created if it does not exist. Attachment is the network attachment of secondary interfaces, nil for the primary.
+func (plugin *netPlugin) addInterface(
+	args *cniSkel.CmdArgs,
+	nwCfg *cni.NetworkConfig,
+	attachment *cni.NetworkAttachment,
+) (result *cniTypesCurr.Result, resultV6 *cniTypesCurr.Result, err error) {
+	var (
+		azIpamResult     *cniTypesCurr.Result
+		vethName         string
+		epInfo           *network.EndpointInfo
+		subnetPrefix     net.IPNet
+		cnsNetworkConfig *cns.GetNetworkContainerResponse
+		enableInfraVnet  bool
+		enableSnatForDns bool
+		nwDNSInfo        network.DNSInfo
+	)
+
+	// Temporary if block to determing whether we disable SNAT on host (for multi-tenant scenario only)
+	if nwCfg.MultiTenancy {
+		if enableSnatForDns, nwCfg.EnableSnatOnHost, err = determineSnat(); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Parse Pod arguments.
 	k8sPodName, k8sNamespace, err := plugin.getPodInfo(args.Args)
 	if err != nil {
-		return err
+		return result, resultV6, err
 	}
 
 	plugin.report.ContainerName = k8sPodName + ":" + k8sNamespace
@@ -400,14 +459,14 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	if len(k8sContainerID) == 0 {
 		errMsg := "Container ID not specified in CNI Args"
 		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		return nil, nil, plugin.Errorf(errMsg)
 	}
 
 	k8sIfName := args.IfName
 	if len(k8sIfName) == 0 {
 		errMsg := "Interfacename not specified in CNI Args"
 		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		return nil, nil, plugin.Errorf(errMsg)
 	}
 
 	log.Printf("Execution mode :%s", nwCfg.ExecutionMode)
@@ -420,7 +479,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			result = convertNnsToCniResult(res, args.IfName, k8sPodName, "AddContainerNetworking")
 		}
 
-		return err
+		return result, resultV6, err
 	}
 
 	if nwCfg.MultiTenancy {
@@ -439,7 +498,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	result, cnsNetworkConfig, subnetPrefix, azIpamResult, err = GetMultiTenancyCNIResult(enableInfraVnet, nwCfg, plugin, k8sPodName, k8sNamespace, args.IfName)
 	if err != nil {
 		log.Printf("GetMultiTenancyCNIResult failed with error %v", err)
-		return err
+		return result, resultV6, err
 	}
 
 	defer func() {
@@ -454,7 +513,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	networkId, err := getNetworkName(k8sPodName, k8sNamespace, args.IfName, nwCfg)
 	if err != nil {
 		log.Printf("[cni-net] Failed to extract network name from network config. error: %v", err)
-		return err
+		return result, resultV6, err
 	}
 
 	endpointId := GetEndpointID(args)
@@ -475,22 +534,22 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 				log.Printf("handleConsecutiveAdd failed with error %v", errConsAdd)
 				result = resultConsAdd
 				err = errConsAdd
-				return err
+				return result, resultV6, err
 			}
 
 			if resultConsAdd != nil {
 				result = resultConsAdd
-				return nil
+				return result, resultV6, nil
 			}
 		}
 	}
 
 	switch nwCfg.Ipam.Type {
 	case network.AzureCNS:
-		plugin.ipamInvoker, err = NewCNSInvoker(k8sPodName, k8sNamespace)
+		plugin.ipamInvoker, err = NewCNSInvoker(k8sPodName, k8sNamespace, nwCfg.CNSUrl)
 		if err != nil {
 			log.Printf("[cni-net] Creating network %v, failed with err %v", networkId, err)
-			return err
+			return result, resultV6, err
 		}
 	default:
 		plugin.ipamInvoker = NewAzureIpamInvoker(plugin, &nwInfo)
@@ -505,7 +564,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		if !nwCfg.MultiTenancy {
 			result, resultV6, err = plugin.ipamInvoker.Add(nwCfg, args, &subnetPrefix, options)
 			if err != nil {
-				return err
+				return result, resultV6, err
 			}
 
 			defer func() {
@@ -531,7 +590,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		masterIfName := plugin.findMasterInterface(nwCfg, &subnetPrefix)
 		if masterIfName == "" {
 			err = plugin.Errorf("Failed to find the master interface")
-			return err
+			return result, resultV6, err
 		}
 		log.Printf("[cni-net] Found master interface %v.", masterIfName)
 
@@ -539,20 +598,20 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		err = plugin.nm.AddExternalInterface(masterIfName, subnetPrefix.String())
 		if err != nil {
 			err = plugin.Errorf("Failed to add external interface: %v", err)
-			return err
+			return result, resultV6, err
 		}
 
 		nwDNSInfo, err = getNetworkDNSSettings(nwCfg, result, k8sNamespace)
 		if err != nil {
 			err = plugin.Errorf("Failed to getDNSSettings: %v", err)
-			return err
+			return result, resultV6, err
 		}
 
 		log.Printf("[cni-net] nwDNSInfo: %v", nwDNSInfo)
 		// Update subnet prefix for multi-tenant scenario
 		if err = updateSubnetPrefix(cnsNetworkConfig, &subnetPrefix); err != nil {
 			err = plugin.Errorf("Failed to updateSubnetPrefix: %v", err)
-			return err
+			return result, resultV6, err
 		}
 
 		// Create the network.
@@ -583,7 +642,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		if len(result.IPs) > 0 {
 			_, podnetwork, err := net.ParseCIDR(result.IPs[0].Address.String())
 			if err != nil {
-				return err
+				return result, resultV6, err
 			}
 
 			nwInfo.PodSubnet = network.SubnetInfo{
@@ -601,7 +660,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		err = plugin.nm.CreateNetwork(&nwInfo)
 		if err != nil {
 			err = plugin.Errorf("Failed to create network: %v", err)
-			return err
+			return result, resultV6, err
 		}
 
 		log.Printf("[cni-net] Created network %v with subnet %v.", networkId, subnetPrefix.String())
@@ -611,7 +670,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			log.Printf("[cni-net] Found network %v with subnet %v.", networkId, nwInfo.Subnets[0].Prefix.String())
 			result, resultV6, err = plugin.ipamInvoker.Add(nwCfg, args, &subnetPrefix, nwInfo.Options)
 			if err != nil {
-				return err
+				return result, resultV6, err
 			}
 
 			nwInfo.IPAMType = nwCfg.Ipam.Type
@@ -636,7 +695,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	epDNSInfo, err := getEndpointDNSSettings(nwCfg, result, k8sNamespace)
 	if err != nil {
 		err = plugin.Errorf("Failed to getEndpointDNSSettings: %v", err)
-		return err
+		return result, resultV6, err
 	}
 
 	if nwCfg.IPV6Mode == network.IPV6Nat {
@@ -645,7 +704,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		ipv6Policy, err = addIPV6EndpointPolicy(nwInfo)
 		if err != nil {
 			err = plugin.Errorf("Failed to set ipv6 endpoint policy: %v", err)
-			return err
+			return result, resultV6, err
 		}
 
 		policies = append(policies, ipv6Policy)
@@ -675,6 +734,10 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	epPolicies := getPoliciesFromRuntimeCfg(nwCfg)
 
 	epInfo.Policies = append(epInfo.Policies, epPolicies...)
+	epInfo.PortMappings = getPortMappingsFromRuntimeCfg(nwCfg)
+	epInfo.Bandwidth = getBandwidthFromRuntimeCfg(nwCfg)
+	epInfo.Tuning = getTuningFromNwCfg(nwCfg)
+	epInfo.NetworkAttachments = getNetworkAttachmentInfos(nwCfg)
 
 	// Populate addresses.
 	for _, ipconfig := range result.IPs {
@@ -687,6 +750,11 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		}
 	}
 
+	// Secondary interfaces only have the routes of their network attachment, the default route is on the primary.
+	if attachment != nil {
+		setAttachmentRoutes(result, attachment)
+	}
+
 	// Populate routes.
 	for _, route := range result.Routes {
 		epInfo.Routes = append(epInfo.Routes, network.RouteInfo{Dst: route.Dst, Gw: route.GW})
@@ -715,53 +783,195 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	err = plugin.nm.CreateEndpoint(networkId, epInfo)
 	if err != nil {
 		err = plugin.Errorf("Failed to create endpoint: %v", err)
-		return err
+		return result, resultV6, err
 	}
 
 	msg := fmt.Sprintf("CNI ADD succeeded : CNI Version %+v, IP:%+v, Interfaces:%+v, vlanid: %v, podname %v, namespace %v",
 		result.CNIVersion, result.IPs, result.Interfaces, epInfo.Data[network.VlanIDKey], k8sPodName, k8sNamespace)
 	plugin.setCNIReportDetails(nwCfg, CNI_ADD, msg)
 
-	return nil
+	return result, resultV6, nil
+}
+
+// addAttachments adds the secondary interfaces of the network attachments of the pod and returns their results.
+// If one of them fails, the primary interface is deleted again, along with the attachments recorded on it.
+func (plugin *netPlugin) addAttachments(
+	args *cniSkel.CmdArgs,
+	nwCfg *cni.NetworkConfig,
+	attachments []cni.NetworkAttachment,
+) ([]*cniTypesCurr.Result, error) {
+	var results []*cniTypesCurr.Result
+
+	for i := range attachments {
+		attachmentArgs, attachmentNwCfg := getAttachmentConfig(args, nwCfg, &attachments[i])
+
+		log.Printf("[cni-net] Adding interface %v to network %v.", attachmentArgs.IfName, attachmentNwCfg.Name)
+		result, resultV6, err := plugin.addInterface(attachmentArgs, attachmentNwCfg, &attachments[i])
+		if err != nil {
+			if er := plugin.deleteInterface(args, nwCfg); er != nil {
+				log.Printf("[cni-net] Failed to delete interface %v after adding network attachments failed: %v.", args.IfName, er)
+			}
+
+			return nil, err
+		}
+
+		if resultV6 != nil {
+			result.IPs = append(result.IPs, resultV6.IPs...)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// deleteAttachments deletes the secondary interfaces of the network attachments of the pod, in reverse order.
+// Failures are logged, so that one interface which cannot be deleted does not leak the others.
+func (plugin *netPlugin) deleteAttachments(args *cniSkel.CmdArgs, nwCfg *cni.NetworkConfig, attachments []cni.NetworkAttachment) {
+	for i := len(attachments) - 1; i >= 0; i-- {
+		attachmentArgs, attachmentNwCfg := getAttachmentConfig(args, nwCfg, &attachments[i])
+
+		log.Printf("[cni-net] Deleting interface %v from network %v.", attachmentArgs.IfName, attachmentNwCfg.Name)
+		if err := plugin.deleteInterface(attachmentArgs, attachmentNwCfg); err != nil {
+			log.Printf("[cni-net] Failed to delete interface %v: %v.", attachmentArgs.IfName, err)
+		}
+	}
+}
+
+// getAttachmentConfig returns the CNI args and network configuration of the secondary interface of a network
+// attachment. Settings of the primary interface, like multitenancy, port mappings and SNAT, are not inherited.
+func getAttachmentConfig(
+	args *cniSkel.CmdArgs,
+	nwCfg *cni.NetworkConfig,
+	attachment *cni.NetworkAttachment,
+) (*cniSkel.CmdArgs, *cni.NetworkConfig) {
+	attachmentNwCfg := *nwCfg
+	attachmentNwCfg.Name = attachment.Network
+	attachmentNwCfg.Master = attachment.Master
+	attachmentNwCfg.Bridge = ""
+	attachmentNwCfg.MultiTenancy = false
+	attachmentNwCfg.EnableSnatOnHost = false
+	attachmentNwCfg.IPV6Mode = ""
+	attachmentNwCfg.PodNamespaceForDualNetwork = nil
+	attachmentNwCfg.IPsToRouteViaHost = nil
+	attachmentNwCfg.AdditionalArgs = nil
+	attachmentNwCfg.Args.CNI.NetworkAttachments = nil
+	attachmentNwCfg.RuntimeConfig.PortMappings = nil
+	attachmentNwCfg.RuntimeConfig.Bandwidth = nil
+	attachmentNwCfg.Tuning = nil
+
+	attachmentNwCfg.Ipam.Type = getAttachmentIpamType(nwCfg, attachment)
+	attachmentNwCfg.Ipam.Subnet = attachment.Ipam.Subnet
+	attachmentNwCfg.Ipam.Address = ""
+
+	annotations := make(map[string]string)
+	for key, value := range nwCfg.RuntimeConfig.PodAnnotations {
+		annotations[key] = value
+	}
+	delete(annotations, cni.NetworkAttachmentsAnnotation)
+	delete(annotations, cni.TuningAnnotation)
+	attachmentNwCfg.RuntimeConfig.PodAnnotations = annotations
+
+	attachmentArgs := *args
+	attachmentArgs.IfName = attachment.IfName
+	attachmentArgs.StdinData = attachmentNwCfg.Serialize()
+
+	return &attachmentArgs, &attachmentNwCfg
+}
+
+// getAttachmentIpamType returns the IPAM of the secondary interface of a network attachment, which defaults to the
+// IPAM of the primary network.
+func getAttachmentIpamType(nwCfg *cni.NetworkConfig, attachment *cni.NetworkAttachment) string {
+	if attachment.Ipam.Type != "" {
+		return attachment.Ipam.Type
+	}
+	return nwCfg.Ipam.Type
+}
+
+// getNetworkAttachmentInfos returns the network attachments of the network configuration, as recorded on the
+// endpoint of the primary interface.
+func getNetworkAttachmentInfos(nwCfg *cni.NetworkConfig) []network.NetworkAttachmentInfo {
+	var infos []network.NetworkAttachmentInfo
+	for i := range nwCfg.Args.CNI.NetworkAttachments {
+		attachment := &nwCfg.Args.CNI.NetworkAttachments[i]
+		infos = append(infos, network.NetworkAttachmentInfo{
+			Network:  attachment.Network,
+			IfName:   attachment.IfName,
+			Master:   attachment.Master,
+			IPAMType: getAttachmentIpamType(nwCfg, attachment),
+			Subnet:   attachment.Ipam.Subnet,
+		})
+	}
+	return infos
+}
+
+// getEndpointNetworkAttachments returns the network attachments recorded on the endpoint of the primary interface.
+func getEndpointNetworkAttachments(epInfo *network.EndpointInfo) []cni.NetworkAttachment {
+	var attachments []cni.NetworkAttachment
+	for _, info := range epInfo.NetworkAttachments {
+		attachment := cni.NetworkAttachment{
+			Network: info.Network,
+			IfName:  info.IfName,
+			Master:  info.Master,
+		}
+		attachment.Ipam.Type = info.IPAMType
+		attachment.Ipam.Subnet = info.Subnet
+		attachments = append(attachments, attachment)
+	}
+	return attachments
 }
 
-// Get handles CNI Get commands.
-func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
+// setAttachmentRoutes replaces the routes IPAM returned for a secondary interface with the routes of its network
+// attachment. Routes without a gateway are routed via the gateway of the interface.
+func setAttachmentRoutes(result *cniTypesCurr.Result, attachment *cni.NetworkAttachment) {
+	var gateway net.IP
+	if len(result.IPs) > 0 {
+		gateway = result.IPs[0].Gateway
+	}
+
+	result.Routes = nil
+	for _, route := range attachment.Routes {
+		if route.GW == nil {
+			route.GW = gateway
+		}
+
+		result.Routes = append(result.Routes, &cniTypes.Route{Dst: route.Dst, GW: route.GW})
+	}
+}
+
+// appendAttachmentResult appends the secondary interface of a network attachment, its addresses and its routes to
+// the result of the pod.
+func appendAttachmentResult(result *cniTypesCurr.Result, ifName string, attachmentResult *cniTypesCurr.Result) {
+	result.Interfaces = append(result.Interfaces, &cniTypesCurr.Interface{Name: ifName})
+	setIPInterface(attachmentResult.IPs, len(result.Interfaces)-1)
+	result.IPs = append(result.IPs, attachmentResult.IPs...)
+	result.Routes = append(result.Routes, attachmentResult.Routes...)
+}
+
+// setIPInterface sets the index of the interface in the result that the addresses are assigned to.
+func setIPInterface(ips []*cniTypesCurr.IPConfig, index int) {
+	for _, ip := range ips {
+		if ip.Interface == nil {
+			ip.Interface = cniTypesCurr.Int(index)
+		}
+	}
+}
+
+// Check handles CNI check commands. It verifies that the data plane of the endpoint matches its state.
+func (plugin *netPlugin) Check(args *cniSkel.CmdArgs) error {
 	var (
-		result       cniTypesCurr.Result
 		err          error
 		nwCfg        *cni.NetworkConfig
 		epInfo       *network.EndpointInfo
-		iface        *cniTypesCurr.Interface
 		k8sPodName   string
 		k8sNamespace string
 		networkId    string
 	)
 
-	log.Printf("[cni-net] Processing GET command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
+	log.Printf("[cni-net] Processing CHECK command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 
-	defer func() {
-		// Add Interfaces to result.
-		iface = &cniTypesCurr.Interface{
-			Name: args.IfName,
-		}
-		result.Interfaces = append(result.Interfaces, iface)
-
-		// Convert result to the requested CNI version.
-		res, vererr := result.GetAsVersion(nwCfg.CNIVersion)
-		if vererr != nil {
-			log.Printf("GetAsVersion failed with error %v", vererr)
-			plugin.Error(vererr)
-		}
-
-		if err == nil && res != nil {
-			// Output the result to stdout.
-			res.Print()
-		}
-
-		log.Printf("[cni-net] GET command completed with result:%+v err:%v.", result, err)
-	}()
+	defer func() { log.Printf("[cni-net] CHECK command completed with err:%v.", err) }()
 
 	// Parse network configuration from stdin.
 	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
@@ -785,60 +995,62 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 
 	// Initialize values from network config.
 	if networkId, err = getNetworkName(k8sPodName, k8sNamespace, args.IfName, nwCfg); err != nil {
-		// TODO: Ideally we should return from here only.
-		log.Printf("[cni-net] Failed to extract network name from network config. error: %v", err)
+		err = plugin.Errorf("Failed to extract network name from network config: %v", err)
+		return err
 	}
 
 	endpointId := GetEndpointID(args)
 
 	// Query the network.
 	if _, err = plugin.nm.GetNetworkInfo(networkId); err != nil {
-		plugin.Errorf("Failed to query network: %v", err)
+		err = plugin.Errorf("Failed to query network %v: %v", networkId, err)
 		return err
 	}
 
 	// Query the endpoint.
-	if epInfo, err = plugin.nm.GetEndpointInfo(networkId, endpointId); err != nil {
-		plugin.Errorf("Failed to query endpoint: %v", err)
+	if epInfo, err = plugin.nm.GetEndpointInfo(networkId, endpointId); err != nil || epInfo == nil {
+		err = plugin.Errorf("Failed to query endpoint %v: %v", endpointId, err)
 		return err
 	}
 
-	for _, ipAddresses := range epInfo.IPAddresses {
-		ipConfig := &cniTypesCurr.IPConfig{
-			Version:   ipVersion,
-			Interface: &epInfo.IfIndex,
-			Address:   ipAddresses,
+	// Check the data plane of the endpoint.
+	driftErr := &network.EndpointDriftError{EndpointID: endpointId}
+	if err = plugin.nm.CheckEndpoint(networkId, endpointId, args.Netns, args.IfName); err != nil {
+		var epDriftErr *network.EndpointDriftError
+		if !errors.As(err, &epDriftErr) {
+			err = plugin.Errorf("Failed to check endpoint %v: %v", endpointId, err)
+			return err
 		}
 
-		if epInfo.Gateways != nil {
-			ipConfig.Gateway = epInfo.Gateways[0]
+		driftErr.Drift = append(driftErr.Drift, epDriftErr.Drift...)
+	}
+
+	// SWIFT SNAT rules are created with the network, so they are not part of the endpoint state.
+	if nwCfg.Ipam.Type == network.AzureCNS {
+		drift, snatErr := checkSwiftSnatRules(epInfo.IPAddresses)
+		if snatErr != nil {
+			err = plugin.Errorf("Failed to check SNAT rules of endpoint %v: %v", endpointId, snatErr)
+			return err
 		}
 
-		result.IPs = append(result.IPs, ipConfig)
+		driftErr.Drift = append(driftErr.Drift, drift...)
 	}
 
-	for _, route := range epInfo.Routes {
-		result.Routes = append(result.Routes, &cniTypes.Route{Dst: route.Dst, GW: route.Gw})
+	if len(driftErr.Drift) > 0 {
+		err = plugin.Error(driftErr)
+		return err
 	}
 
-	result.DNS.Nameservers = epInfo.DNS.Servers
-	result.DNS.Domain = epInfo.DNS.Suffix
-
 	return nil
 }
 
 // Delete handles CNI delete commands.
 func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 	var (
-		err          error
-		nwCfg        *cni.NetworkConfig
-		k8sPodName   string
-		k8sNamespace string
-		networkId    string
-		nwInfo       network.NetworkInfo
-		epInfo       *network.EndpointInfo
-		cniMetric    telemetry.AIMetric
-		msg          string
+		err        error
+		nwCfg      *cni.NetworkConfig
+		k8sPodName string
+		cniMetric  telemetry.AIMetric
 	)
 
 	startTime := time.Now()
@@ -859,7 +1071,7 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 	log.Printf("[cni-net] Read network configuration %+v.", nwCfg)
 
 	// Parse Pod arguments.
-	if k8sPodName, k8sNamespace, err = plugin.getPodInfo(args.Args); err != nil {
+	if k8sPodName, _, err = plugin.getPodInfo(args.Args); err != nil {
 		log.Printf("[cni-net] Failed to get POD info due to error: %v", err)
 	}
 
@@ -893,9 +1105,30 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 		cnsclient.InitCnsClient(nwCfg.CNSUrl, defaultRequestTimeout)
 	}
 
+	// schedule send metric before attempting delete
+	defer sendMetricFunc()
+	err = plugin.deleteInterface(args, nwCfg)
+	return err
+}
+
+// deleteInterface deletes the endpoint of the container interface args.IfName from the network of the network
+// configuration and releases its addresses. The secondary interfaces of the network attachments recorded on the
+// endpoint are deleted first. It succeeds if the network or the endpoint do not exist, to comply with the CNI spec.
+func (plugin *netPlugin) deleteInterface(args *cniSkel.CmdArgs, nwCfg *cni.NetworkConfig) error {
+	var (
+		err       error
+		networkId string
+		nwInfo    network.NetworkInfo
+		epInfo    *network.EndpointInfo
+		msg       string
+	)
+
+	// Pod info is optional to delete the endpoint, the errors were logged when the command was parsed.
+	k8sPodName, k8sNamespace, _ := plugin.getPodInfo(args.Args)
+
 	switch nwCfg.Ipam.Type {
 	case network.AzureCNS:
-		plugin.ipamInvoker, err = NewCNSInvoker(k8sPodName, k8sNamespace)
+		plugin.ipamInvoker, err = NewCNSInvoker(k8sPodName, k8sNamespace, nwCfg.CNSUrl)
 		if err != nil {
 			log.Printf("[cni-net] Creating network %v failed with err %v.", networkId, err)
 			return err
@@ -955,8 +1188,35 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
-	// schedule send metric before attempting delete
-	defer sendMetricFunc()
+	// The secondary interfaces are deleted first, so that they are not leaked if deleting the primary one fails.
+	if attachments := getEndpointNetworkAttachments(epInfo); len(attachments) > 0 {
+		// deleting the attachments selects their IPAM invoker
+		ipamInvoker := plugin.ipamInvoker
+		plugin.deleteAttachments(args, nwCfg, attachments)
+		plugin.ipamInvoker = ipamInvoker
+	}
+
+	if err = plugin.deleteEndpoint(networkId, endpointId, nwInfo, epInfo, nwCfg, args); err != nil {
+		return err
+	}
+
+	msg = fmt.Sprintf("CNI DEL succeeded : Released ip %+v podname %v namespace %v", nwCfg.Ipam.Address, k8sPodName, k8sNamespace)
+	plugin.setCNIReportDetails(nwCfg, CNI_DEL, msg)
+
+	return err
+}
+
+// deleteEndpoint deletes the endpoint and releases its addresses.
+func (plugin *netPlugin) deleteEndpoint(
+	networkId string,
+	endpointId string,
+	nwInfo network.NetworkInfo,
+	epInfo *network.EndpointInfo,
+	nwCfg *cni.NetworkConfig,
+	args *cniSkel.CmdArgs,
+) error {
+	var err error
+
 	// Delete the endpoint.
 	if err = plugin.nm.DeleteEndpoint(networkId, endpointId); err != nil {
 		err = plugin.Errorf("Failed to delete endpoint: %v", err)
@@ -983,12 +1243,148 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 		}
 	}
 
-	msg = fmt.Sprintf("CNI DEL succeeded : Released ip %+v podname %v namespace %v", nwCfg.Ipam.Address, k8sPodName, k8sNamespace)
-	plugin.setCNIReportDetails(nwCfg, CNI_DEL, msg)
-
 	return err
 }
 
+// GC handles CNI GC commands. It removes the endpoints of the network which are not in the valid attachments of
+// the runtime, along with their veths and rules, and releases their addresses.
+func (plugin *netPlugin) GC(args *cniSkel.CmdArgs) (*api.GCResult, error) {
+	var (
+		err    error
+		nwCfg  *cni.NetworkConfig
+		nwInfo network.NetworkInfo
+		failed []string
+	)
+
+	log.Printf("[cni-net] Processing GC command with args {Path:%v, StdinData:%s}.", args.Path, args.StdinData)
+
+	defer func() {
+		log.Printf("[cni-net] GC command completed with err:%v.", err)
+	}()
+
+	// Parse network configuration from stdin.
+	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
+		err = plugin.Errorf("Failed to parse network configuration: %v", err)
+		return nil, err
+	}
+
+	// a runtime which does not set the valid attachments would otherwise remove every endpoint
+	if nwCfg.ValidAttachments == nil {
+		err = plugin.Errorf("Valid attachments are not set, an empty list must be set to remove every endpoint")
+		return nil, err
+	}
+
+	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
+
+	if nwCfg.MultiTenancy {
+		// Initialize CNSClient
+		cnsclient.InitCnsClient(nwCfg.CNSUrl, defaultRequestTimeout)
+	}
+
+	result := &api.GCResult{DryRun: nwCfg.GCDryRun}
+
+	// Networks which are named after the NC of a pod are not collected.
+	networkId := nwCfg.Name
+	if nwInfo, err = plugin.nm.GetNetworkInfo(networkId); err != nil {
+		// There is nothing to collect if the network does not exist.
+		log.Printf("[cni-net] Failed to query network %v: %v", networkId, err)
+		err = nil
+		return result, nil
+	}
+
+	eps, err := plugin.nm.GetAllEndpoints(networkId)
+	if err == store.ErrStoreEmpty {
+		err = nil
+		return result, nil
+	} else if err != nil {
+		err = plugin.Errorf("Failed to get endpoints of network %v: %v", networkId, err)
+		return nil, err
+	}
+
+	for _, epInfo := range staleEndpoints(eps, nwCfg.ValidAttachments) {
+		info := api.PodNetworkInterfaceInfo{
+			PodName:       epInfo.PODName,
+			PodNamespace:  epInfo.PODNameSpace,
+			PodEndpointId: epInfo.Id,
+			ContainerID:   epInfo.ContainerID,
+			IPAddresses:   epInfo.IPAddresses,
+		}
+
+		if nwCfg.GCDryRun {
+			log.Printf("[cni-net] Dry run, not removing stale endpoint %v of pod %v/%v.", epInfo.Id, epInfo.PODNameSpace, epInfo.PODName)
+			result.RemovedInterfaces = append(result.RemovedInterfaces, info)
+			continue
+		}
+
+		log.Printf("[cni-net] Removing stale endpoint %v of pod %v/%v.", epInfo.Id, epInfo.PODNameSpace, epInfo.PODName)
+
+		// the IPAM invokers release addresses for the container and interface of the endpoint
+		epArgs := &cniSkel.CmdArgs{
+			ContainerID: epInfo.ContainerID,
+			Netns:       epInfo.NetNsPath,
+			IfName:      endpointIfName(epInfo.Id),
+			StdinData:   args.StdinData,
+		}
+
+		switch nwCfg.Ipam.Type {
+		case network.AzureCNS:
+			plugin.ipamInvoker, err = NewCNSInvoker(epInfo.PODName, epInfo.PODNameSpace, nwCfg.CNSUrl)
+			if err != nil {
+				err = plugin.Errorf("Failed to create CNS IPAM invoker: %v", err)
+				return result, err
+			}
+		default:
+			plugin.ipamInvoker = NewAzureIpamInvoker(plugin, &nwInfo)
+		}
+
+		if epErr := plugin.deleteEndpoint(networkId, epInfo.Id, nwInfo, epInfo, nwCfg, epArgs); epErr != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", epInfo.Id, epErr))
+			continue
+		}
+
+		result.RemovedInterfaces = append(result.RemovedInterfaces, info)
+	}
+
+	if len(failed) > 0 {
+		err = plugin.Errorf("Failed to remove %d stale endpoints: %s", len(failed), strings.Join(failed, "; "))
+		return result, err
+	}
+
+	return result, nil
+}
+
+// staleEndpoints returns the endpoints which are not in the valid attachments, ordered by ID.
+func staleEndpoints(eps map[string]*network.EndpointInfo, validAttachments []cni.Attachment) []*network.EndpointInfo {
+	validEndpointIds := make(map[string]bool, len(validAttachments))
+	validContainerIds := make(map[string]bool, len(validAttachments))
+	for _, attachment := range validAttachments {
+		validEndpointIds[GetEndpointID(&cniSkel.CmdArgs{ContainerID: attachment.ContainerID, IfName: attachment.IfName})] = true
+		validContainerIds[attachment.ContainerID] = true
+	}
+
+	var stale []*network.EndpointInfo
+	for _, epInfo := range eps {
+		if validEndpointIds[epInfo.Id] || validContainerIds[epInfo.ContainerID] {
+			continue
+		}
+
+		stale = append(stale, epInfo)
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Id < stale[j].Id })
+	return stale
+}
+
+// endpointIfName returns the container interface name the endpoint was added for. Endpoint IDs are the truncated
+// container ID and the interface name, see network.ConstructEndpointID.
+func endpointIfName(endpointId string) string {
+	if i := strings.Index(endpointId, "-"); i >= 0 {
+		return endpointId[i+1:]
+	}
+
+	return ""
+}
+
 // Update handles CNI update commands.
 // Update is only supported for multitenancy and to update routes.
 func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
@@ -1,11 +1,14 @@
 package network
 
 import (
+	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/policy"
@@ -123,6 +126,53 @@ func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
 	return nil
 }
 
+// getPortMappingsFromRuntimeCfg returns the port mappings of the endpoint from network config.
+func getPortMappingsFromRuntimeCfg(nwCfg *cni.NetworkConfig) []network.PortMapping {
+	var portMappings []network.PortMapping
+	for _, mapping := range nwCfg.RuntimeConfig.PortMappings {
+		portMappings = append(portMappings, network.PortMapping{
+			HostPort:      mapping.HostPort,
+			ContainerPort: mapping.ContainerPort,
+			Protocol:      mapping.Protocol,
+			HostIP:        mapping.HostIp,
+		})
+	}
+
+	log.Printf("[net] Port mappings: %+v", portMappings)
+	return portMappings
+}
+
+// getBandwidthFromRuntimeCfg returns the traffic rate limits of the endpoint from network config.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthInfo {
+	bw := nwCfg.RuntimeConfig.Bandwidth
+	if bw == nil {
+		return nil
+	}
+
+	log.Printf("[net] Bandwidth: %+v", *bw)
+	return &network.BandwidthInfo{
+		IngressRate:  bw.IngressRate,
+		IngressBurst: bw.IngressBurst,
+		EgressRate:   bw.EgressRate,
+		EgressBurst:  bw.EgressBurst,
+	}
+}
+
+// getTuningFromNwCfg returns the sysctls and interface settings of the endpoint from network config.
+func getTuningFromNwCfg(nwCfg *cni.NetworkConfig) *network.TuningInfo {
+	tuning := nwCfg.Tuning
+	if tuning == nil {
+		return nil
+	}
+
+	log.Printf("[net] Tuning: %+v", *tuning)
+	return &network.TuningInfo{
+		Sysctls:    tuning.Sysctls,
+		MTU:        tuning.MTU,
+		TxQueueLen: tuning.TxQueueLen,
+	}
+}
+
 func addIPV6EndpointPolicy(nwInfo network.NetworkInfo) (policy.Policy, error) {
 	return policy.Policy{}, nil
 }
@@ -134,3 +184,63 @@ func updateSubnetPrefix(cnsNetworkConfig *cns.GetNetworkContainerResponse, subne
 func getNetworkName(podName, podNs, ifName string, nwCfg *cni.NetworkConfig) (string, error) {
 	return nwCfg.Name, nil
 }
+
+// checkSwiftSnatRules checks that traffic from each IPv4 address of the endpoint to Azure DNS and IMDS is SNATed
+// by the SWIFT chain.
+func checkSwiftSnatRules(ipAddresses []net.IPNet) ([]string, error) {
+	if !iptables.RuleExists(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift) {
+		return []string{fmt.Sprintf("iptables %s chain does not jump to the %s chain", iptables.Postrouting, iptables.Swift)}, nil
+	}
+
+	rules, err := iptables.GetChainRules(iptables.V4, iptables.Nat, iptables.Swift)
+	if err != nil {
+		return nil, err
+	}
+
+	return missingSwiftSnatRules(rules, ipAddresses), nil
+}
+
+// missingSwiftSnatRules describes each IPv4 address which is not SNATed to Azure DNS or IMDS by the SWIFT rules.
+func missingSwiftSnatRules(rules []string, ipAddresses []net.IPNet) []string {
+	var drift []string
+
+	for _, ipAddr := range ipAddresses {
+		if ipAddr.IP.To4() == nil {
+			continue
+		}
+
+		for _, dst := range []string{iptables.AzureDNS, iptables.AzureIMDS} {
+			if !swiftSnatRuleExists(rules, ipAddr.IP, dst) {
+				drift = append(drift, fmt.Sprintf("iptables %s rule to %s for %s is missing", iptables.Snat, dst, ipAddr.IP.String()))
+			}
+		}
+	}
+
+	return drift
+}
+
+// swiftSnatRuleExists returns true if one of the rules SNATs traffic from a source subnet containing the IP
+// address to the destination.
+func swiftSnatRuleExists(rules []string, ip net.IP, dst string) bool {
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		var src *net.IPNet
+		dstMatches, snat := false, false
+		for i := 0; i < len(fields)-1; i++ {
+			switch fields[i] {
+			case "-s":
+				_, src, _ = net.ParseCIDR(fields[i+1])
+			case "-d":
+				dstMatches = strings.TrimSuffix(fields[i+1], "/32") == dst
+			case "-j":
+				snat = fields[i+1] == iptables.Snat
+			}
+		}
+
+		if snat && dstMatches && src != nil && src.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,25 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingSwiftSnatRules(t *testing.T) {
+	rules := []string{
+		"-A SWIFT -s 10.240.0.0/16 -d 169.254.169.254/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 80 -j SNAT --to-source 10.224.0.4",
+		"-A SWIFT -s 10.240.0.0/16 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 10.240.0.4",
+	}
+
+	podIP := net.IPNet{IP: net.ParseIP("10.240.0.10"), Mask: net.CIDRMask(16, 32)}
+	require.Empty(t, missingSwiftSnatRules(rules, []net.IPNet{podIP}))
+
+	otherIP := net.IPNet{IP: net.ParseIP("10.241.0.10"), Mask: net.CIDRMask(16, 32)}
+	require.Equal(t, []string{
+		"iptables SNAT rule to 168.63.129.16 for 10.241.0.10 is missing",
+		"iptables SNAT rule to 169.254.169.254 for 10.241.0.10 is missing",
+	}, missingSwiftSnatRules(rules[:1], []net.IPNet{otherIP}))
+	require.Equal(t, []string{"iptables SNAT rule to 168.63.129.16 for 10.240.0.10 is missing"}, missingSwiftSnatRules(rules[:1], []net.IPNet{podIP}))
+}
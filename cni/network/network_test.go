@@ -13,6 +13,8 @@ import (
 	"github.com/Azure/azure-container-networking/nns"
 	"github.com/Azure/azure-container-networking/telemetry"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
 	"github.com/stretchr/testify/require"
 )
 
@@ -138,3 +140,303 @@ func TestEndpointsWithEmptyState(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 0, len(state.ContainerInterfaces))
 }
+
+func TestCheckReportsEndpointDrift(t *testing.T) {
+	plugin, mockNetworkManager := getTestResources()
+
+	nwCfg := cni.NetworkConfig{
+		Name:       "test-nwcfg",
+		CNIVersion: "0.4.0",
+		Type:       "azure-vnet",
+		Mode:       "bridge",
+	}
+	args := &cniSkel.CmdArgs{
+		ContainerID: "test-container",
+		Netns:       "/var/run/netns/test",
+		IfName:      "eth0",
+		Args:        "K8S_POD_NAME=test-pod;K8S_POD_NAMESPACE=test-pod-namespace",
+		StdinData:   nwCfg.Serialize(),
+	}
+
+	err := plugin.Check(args)
+	require.Error(t, err, "the network does not exist")
+
+	require.NoError(t, mockNetworkManager.CreateNetwork(&acnnetwork.NetworkInfo{Id: nwCfg.Name}))
+	mockNetworkManager.TestEndpointInfoMap[GetEndpointID(args)] = getTestEndpoint("test-pod", "test-pod-namespace", "10.0.0.4/24", GetEndpointID(args), args.ContainerID)
+	require.NoError(t, plugin.Check(args))
+
+	mockNetworkManager.TestCheckEndpointErr = &acnnetwork.EndpointDriftError{
+		EndpointID: GetEndpointID(args),
+		Drift:      []string{"IP address 10.0.0.4/24 is not assigned to eth0"},
+	}
+	err = plugin.Check(args)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "IP address 10.0.0.4/24 is not assigned to eth0")
+}
+
+func TestGCRemovesStaleEndpoints(t *testing.T) {
+	plugin, mockNetworkManager := getTestResources()
+	networkid := "azure"
+	require.NoError(t, mockNetworkManager.CreateNetwork(&acnnetwork.NetworkInfo{Id: networkid}))
+
+	valid := &acnnetwork.EndpointInfo{Id: "3f813b02-eth0", ContainerID: "3f813b029429b4e41a09ab33b6f6d365d2ed704017524c78d1d0dece33cdaf46"}
+	stale := &acnnetwork.EndpointInfo{Id: "6e688597-eth0", ContainerID: "6e688597eafb97c83c84e402cc72b299bfb8aeb02021e4c99307a037352c0bed", PODName: "stale-pod"}
+	require.NoError(t, mockNetworkManager.CreateEndpoint(networkid, valid))
+	require.NoError(t, mockNetworkManager.CreateEndpoint(networkid, stale))
+
+	nwCfg := cni.NetworkConfig{
+		Name:             networkid,
+		CNIVersion:       "0.4.0",
+		Type:             "azure-vnet",
+		ValidAttachments: []cni.Attachment{{ContainerID: valid.ContainerID, IfName: "eth0"}},
+		GCDryRun:         true,
+	}
+
+	// dry runs report the stale endpoint without removing it
+	result, err := plugin.GC(&cniSkel.CmdArgs{StdinData: nwCfg.Serialize()})
+	require.NoError(t, err)
+	require.True(t, result.DryRun)
+	require.Len(t, result.RemovedInterfaces, 1)
+	require.Equal(t, stale.Id, result.RemovedInterfaces[0].PodEndpointId)
+	require.Len(t, mockNetworkManager.TestEndpointInfoMap, 2)
+
+	nwCfg.GCDryRun = false
+	result, err = plugin.GC(&cniSkel.CmdArgs{StdinData: nwCfg.Serialize()})
+	require.NoError(t, err)
+	require.Len(t, result.RemovedInterfaces, 1)
+	require.Equal(t, "stale-pod", result.RemovedInterfaces[0].PodName)
+	require.Contains(t, mockNetworkManager.TestEndpointInfoMap, valid.Id)
+	require.NotContains(t, mockNetworkManager.TestEndpointInfoMap, stale.Id)
+
+	// only an empty list marks every endpoint as stale
+	nwCfg.ValidAttachments = nil
+	_, err = plugin.GC(&cniSkel.CmdArgs{StdinData: nwCfg.Serialize()})
+	require.Error(t, err)
+	require.Contains(t, mockNetworkManager.TestEndpointInfoMap, valid.Id)
+	_, err = plugin.GC(&cniSkel.CmdArgs{StdinData: []byte(`{"name":"azure","cniVersion":"0.4.0","type":"azure-vnet"}`)})
+	require.Error(t, err)
+	require.Contains(t, mockNetworkManager.TestEndpointInfoMap, valid.Id)
+
+	nwCfg.ValidAttachments = []cni.Attachment{}
+	result, err = plugin.GC(&cniSkel.CmdArgs{StdinData: nwCfg.Serialize()})
+	require.NoError(t, err)
+	require.Len(t, result.RemovedInterfaces, 1)
+	require.NotContains(t, mockNetworkManager.TestEndpointInfoMap, valid.Id)
+}
+
+func TestGetNetworkAttachments(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{Name: "azure"}
+	nwCfg.AttachmentNetworks = []cni.AttachmentNetwork{{Name: "storage", Master: "eth1"}, {Name: "backend"}}
+	nwCfg.AttachmentNetworks[0].Ipam.Subnet = "10.2.0.0/16"
+	nwCfg.Args.CNI.NetworkAttachments = []cni.NetworkAttachment{{Network: "storage", IfName: "storage0"}}
+	nwCfg.RuntimeConfig.PodAnnotations = map[string]string{
+		cni.NetworkAttachmentsAnnotation: `[{"network":"backend","master":"eth0","ipam":{"type":"azure-vnet-ipam","subnet":"10.1.0.0/16"},"routes":[{"dst":"10.1.0.0/16"}]}]`,
+	}
+
+	attachments, err := cni.GetNetworkAttachments(nwCfg, "eth0")
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+	require.Equal(t, "storage0", attachments[0].IfName)
+	require.Equal(t, "eth1", attachments[0].Master, "the master is set by the attachment network")
+	require.Equal(t, "10.2.0.0/16", attachments[0].Ipam.Subnet)
+	require.Equal(t, "backend", attachments[1].Network)
+	require.Equal(t, "net2", attachments[1].IfName)
+	require.Empty(t, attachments[1].Master, "the master is not read from the annotation")
+	require.Equal(t, "10.1.0.0/16", attachments[1].Ipam.Subnet)
+	require.Equal(t, "10.1.0.0/16", attachments[1].Routes[0].Dst.String())
+
+	// pods can only attach to the attachment networks of the network configuration
+	nwCfg.RuntimeConfig.PodAnnotations[cni.NetworkAttachmentsAnnotation] = `[{"network":"other"}]`
+	_, err = cni.GetNetworkAttachments(nwCfg, "eth0")
+	require.Error(t, err)
+	nwCfg.RuntimeConfig.PodAnnotations[cni.NetworkAttachmentsAnnotation] = `[{"network":"azure"}]`
+	_, err = cni.GetNetworkAttachments(nwCfg, "eth0")
+	require.Error(t, err, "attachments must not attach to the primary network")
+	delete(nwCfg.RuntimeConfig.PodAnnotations, cni.NetworkAttachmentsAnnotation)
+
+	nwCfg.Args.CNI.NetworkAttachments[0].IfName = "eth0"
+	_, err = cni.GetNetworkAttachments(nwCfg, "eth0")
+	require.Error(t, err, "attachments must not reuse the primary interface")
+
+	nwCfg.Args.CNI.NetworkAttachments[0] = cni.NetworkAttachment{IfName: "storage0"}
+	_, err = cni.GetNetworkAttachments(nwCfg, "eth0")
+	require.Error(t, err, "attachments must have a network")
+}
+
+func TestAddRejectsNetworkAttachmentsWithCNSIpam(t *testing.T) {
+	plugin, mockNetworkManager := getTestResources()
+
+	nwCfg := cni.NetworkConfig{
+		Name:       "azure",
+		CNIVersion: "0.4.0",
+		Type:       "azure-vnet",
+		Mode:       "bridge",
+	}
+	nwCfg.Ipam.Type = "azure-cns"
+	nwCfg.AttachmentNetworks = []cni.AttachmentNetwork{{Name: "storage"}}
+	nwCfg.RuntimeConfig.PodAnnotations = map[string]string{
+		cni.NetworkAttachmentsAnnotation: `[{"network":"storage"}]`,
+	}
+	args := &cniSkel.CmdArgs{
+		ContainerID: "test-container",
+		Netns:       "/var/run/netns/test",
+		IfName:      "eth0",
+		Args:        "K8S_POD_NAME=test-pod;K8S_POD_NAMESPACE=test-pod-namespace",
+		StdinData:   nwCfg.Serialize(),
+	}
+
+	// the attachment inherits the CNS IPAM of the primary network
+	err := plugin.Add(args)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "azure-cns")
+	require.Empty(t, mockNetworkManager.TestEndpointInfoMap)
+}
+
+func TestGetNetworkAttachmentInfos(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{Name: "azure"}
+	nwCfg.Ipam.Type = "azure-vnet-ipam"
+	nwCfg.Args.CNI.NetworkAttachments = []cni.NetworkAttachment{{Network: "storage", IfName: "net1", Master: "eth1"}}
+	nwCfg.Args.CNI.NetworkAttachments[0].Ipam.Subnet = "10.1.0.0/16"
+
+	infos := getNetworkAttachmentInfos(nwCfg)
+	require.Equal(t, []acnnetwork.NetworkAttachmentInfo{
+		{Network: "storage", IfName: "net1", Master: "eth1", IPAMType: "azure-vnet-ipam", Subnet: "10.1.0.0/16"},
+	}, infos)
+
+	attachments := getEndpointNetworkAttachments(&acnnetwork.EndpointInfo{NetworkAttachments: infos})
+	require.Len(t, attachments, 1)
+	require.Equal(t, "storage", attachments[0].Network)
+	require.Equal(t, "net1", attachments[0].IfName)
+	require.Equal(t, "eth1", attachments[0].Master)
+	require.Equal(t, "azure-vnet-ipam", attachments[0].Ipam.Type)
+	require.Equal(t, "10.1.0.0/16", attachments[0].Ipam.Subnet)
+}
+
+func TestAppendAttachmentResult(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	attachment := &cni.NetworkAttachment{Network: "backend", IfName: "net1", Routes: []cniTypes.Route{{Dst: *subnet}}}
+
+	ip, ipnet, _ := net.ParseCIDR("10.1.2.4/24")
+	ipnet.IP = ip
+	attachmentResult := &cniTypesCurr.Result{
+		IPs:    []*cniTypesCurr.IPConfig{{Version: "4", Address: *ipnet, Gateway: net.ParseIP("10.1.2.1")}},
+		Routes: []*cniTypes.Route{{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, GW: net.ParseIP("10.1.2.1")}},
+	}
+
+	// the default route from IPAM is replaced by the routes of the attachment, via the gateway of the interface
+	setAttachmentRoutes(attachmentResult, attachment)
+	require.Len(t, attachmentResult.Routes, 1)
+	require.Equal(t, "10.1.0.0/16", attachmentResult.Routes[0].Dst.String())
+	require.Equal(t, "10.1.2.1", attachmentResult.Routes[0].GW.String())
+
+	result := &cniTypesCurr.Result{
+		Interfaces: []*cniTypesCurr.Interface{{Name: "eth0"}},
+		IPs:        []*cniTypesCurr.IPConfig{{Version: "4"}},
+	}
+	setIPInterface(result.IPs, 0)
+	appendAttachmentResult(result, attachment.IfName, attachmentResult)
+	require.Len(t, result.Interfaces, 2)
+	require.Equal(t, "net1", result.Interfaces[1].Name)
+	require.Len(t, result.IPs, 2)
+	require.Equal(t, 0, *result.IPs[0].Interface)
+	require.Equal(t, 1, *result.IPs[1].Interface)
+	require.Len(t, result.Routes, 1)
+}
+
+func TestDeleteRemovesNetworkAttachments(t *testing.T) {
+	plugin, mockNetworkManager := getTestResources()
+
+	nwCfg := cni.NetworkConfig{
+		Name:       "azure",
+		CNIVersion: "0.4.0",
+		Type:       "azure-vnet",
+		Mode:       "bridge",
+	}
+	args := &cniSkel.CmdArgs{
+		ContainerID: "test-container",
+		Netns:       "/var/run/netns/test",
+		IfName:      "eth0",
+		Args:        "K8S_POD_NAME=test-pod;K8S_POD_NAMESPACE=test-pod-namespace",
+		StdinData:   nwCfg.Serialize(),
+	}
+	attachmentArgs := *args
+	attachmentArgs.IfName = "net1"
+
+	// the attachments are deleted from the endpoint state, DEL does not get the pod annotations
+	for _, networkid := range []string{"azure", "storage"} {
+		require.NoError(t, mockNetworkManager.CreateNetwork(&acnnetwork.NetworkInfo{Id: networkid}))
+	}
+	require.NoError(t, mockNetworkManager.CreateEndpoint("azure", &acnnetwork.EndpointInfo{
+		Id:                 GetEndpointID(args),
+		NetworkAttachments: []acnnetwork.NetworkAttachmentInfo{{Network: "storage", IfName: "net1"}},
+	}))
+	require.NoError(t, mockNetworkManager.CreateEndpoint("storage", &acnnetwork.EndpointInfo{Id: GetEndpointID(&attachmentArgs)}))
+
+	require.NoError(t, plugin.Delete(args))
+	require.Empty(t, mockNetworkManager.TestEndpointInfoMap)
+}
+
+func TestGetTuning(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{
+		Name:   "azure",
+		Tuning: &cni.TuningConfig{Sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1"}, MTU: 1500},
+	}
+	nwCfg.RuntimeConfig.PodAnnotations = map[string]string{
+		cni.TuningAnnotation: `{"sysctls":{"net.ipv4.tcp_keepalive_time":"600"},"mtu":1400}`,
+	}
+
+	// the annotation is ignored unless the network configuration allows it
+	tuning, err := cni.GetTuning(nwCfg, "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"net.ipv4.tcp_syncookies": "1"}, tuning.Sysctls)
+	require.Equal(t, 1500, tuning.MTU)
+
+	// CNI args override the annotation, which overrides the network configuration
+	nwCfg.Tuning.AllowPodAnnotation = true
+	tuning, err = cni.GetTuning(nwCfg, "K8S_POD_NAME=test-pod;K8S_POD_NAMESPACE=test-pod-namespace;SYSCTLS=net.ipv4.tcp_keepalive_time:300;TXQUEUELEN=500")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"net.ipv4.tcp_syncookies": "1", "net.ipv4.tcp_keepalive_time": "300"}, tuning.Sysctls)
+	require.Equal(t, 1400, tuning.MTU)
+	require.Equal(t, 500, tuning.TxQueueLen)
+
+	tuning, err = cni.GetTuning(&cni.NetworkConfig{Name: "azure"}, "K8S_POD_NAME=test-pod;K8S_POD_NAMESPACE=test-pod-namespace")
+	require.NoError(t, err)
+	require.Nil(t, tuning)
+
+	// sysctls which are not allowed are invalid network configuration, or invalid CNI args
+	nwCfg.RuntimeConfig.PodAnnotations[cni.TuningAnnotation] = `{"sysctls":{"net.ipv4.ip_forward":"1"}}`
+	_, err = cni.GetTuning(nwCfg, "")
+	require.Error(t, err)
+	require.Equal(t, uint(cni.ErrInvalidNetworkConfig), err.(*cniTypes.Error).Code)
+
+	delete(nwCfg.RuntimeConfig.PodAnnotations, cni.TuningAnnotation)
+	_, err = cni.GetTuning(nwCfg, "SYSCTLS=kernel.shmmax:1")
+	require.Error(t, err)
+	require.Equal(t, uint(cni.ErrInvalidEnvironmentVariables), err.(*cniTypes.Error).Code)
+
+	// only the safe sysctls of Kubernetes are allowed by default
+	_, err = cni.GetTuning(nwCfg, "SYSCTLS=net.core.somaxconn:2048")
+	require.Error(t, err)
+	_, err = cni.GetTuning(nwCfg, "SYSCTLS=net.ipv4.tcp_tw_reuse:1")
+	require.Error(t, err)
+
+	// commas in values are escaped
+	tuning, err = cni.GetTuning(nwCfg, `SYSCTLS=net.ipv4.ip_local_reserved_ports:8080\,9090,net.ipv4.tcp_fin_timeout:30`)
+	require.NoError(t, err)
+	require.Equal(t, "8080,9090", tuning.Sysctls["net.ipv4.ip_local_reserved_ports"])
+	require.Equal(t, "30", tuning.Sysctls["net.ipv4.tcp_fin_timeout"])
+
+	_, err = cni.GetTuning(nwCfg, `SYSCTLS=net.ipv4.tcp_fin_timeout:30\`)
+	require.Error(t, err, "the escape is unfinished")
+
+	_, err = cni.GetTuning(nwCfg, "MTU=10")
+	require.Error(t, err, "the MTU is out of range")
+
+	// the network configuration can replace the allow list, but pods cannot
+	nwCfg.Tuning.AllowedSysctls = []string{"net.ipv4.tcp_syncookies", "net.ipv4.ip_forward"}
+	nwCfg.RuntimeConfig.PodAnnotations[cni.TuningAnnotation] = `{"sysctls":{"net.ipv4.ip_forward":"1"},"allowedSysctls":["net.ipv4.tcp_keepalive_time"]}`
+	_, err = cni.GetTuning(nwCfg, "")
+	require.NoError(t, err)
+	_, err = cni.GetTuning(nwCfg, "SYSCTLS=net.ipv4.tcp_keepalive_time:300")
+	require.Error(t, err)
+}
@@ -105,6 +105,11 @@ func addSnatForDNS(gwIPString string, epInfo *network.EndpointInfo, result *cniT
 func addInfraRoutes(azIpamResult *cniTypesCurr.Result, result *cniTypesCurr.Result, epInfo *network.EndpointInfo) {
 }
 
+// checkSwiftSnatRules is a dummy function for Windows platform, where HNS owns the SNAT policies.
+func checkSwiftSnatRules(ipAddresses []net.IPNet) ([]string, error) {
+	return nil, nil
+}
+
 func setNetworkOptions(cnsNwConfig *cns.GetNetworkContainerResponse, nwInfo *network.NetworkInfo) {
 	if cnsNwConfig != nil && cnsNwConfig.MultiTenancyInfo.ID != 0 {
 		log.Printf("Setting Network Options")
@@ -286,6 +291,21 @@ func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
 	return policies
 }
 
+// getPortMappingsFromRuntimeCfg is a dummy function for Windows platform, where port mappings are HNS policies.
+func getPortMappingsFromRuntimeCfg(nwCfg *cni.NetworkConfig) []network.PortMapping {
+	return nil
+}
+
+// getBandwidthFromRuntimeCfg is a dummy function for Windows platform, where bandwidth shaping is not supported.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthInfo {
+	return nil
+}
+
+// getTuningFromNwCfg is a dummy function for Windows platform, where tuning is not supported.
+func getTuningFromNwCfg(nwCfg *cni.NetworkConfig) *network.TuningInfo {
+	return nil
+}
+
 func addIPV6EndpointPolicy(nwInfo network.NetworkInfo) (policy.Policy, error) {
 	var eppolicy policy.Policy
 
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cni/api"
 	"github.com/Azure/azure-container-networking/cni/network"
 	"github.com/Azure/azure-container-networking/common"
 	acn "github.com/Azure/azure-container-networking/common"
@@ -124,6 +125,29 @@ func handleIfCniUpdate(update func(*skel.CmdArgs) error) (bool, error) {
 	return isupdate, nil
 }
 
+// handleGC removes the endpoints which are not in the valid attachments from stdin, and prints the removed endpoints.
+func handleGC(gc func(*skel.CmdArgs) (*api.GCResult, error)) error {
+	_, cmdArgs, err := getCmdArgsFromEnv()
+	if err != nil {
+		log.Printf("Received error while retrieving cmds from environment: %+v", err)
+		return err
+	}
+
+	if err = validateConfig(cmdArgs.StdinData); err != nil {
+		log.Printf("Failed to handle CNI GC, err:%v.", err)
+		return err
+	}
+
+	result, err := gc(cmdArgs)
+	if result != nil {
+		if printErr := result.PrintResult(); printErr != nil {
+			log.Errorf("Failed to print GC result to stdout with err %v\n", printErr)
+		}
+	}
+
+	return err
+}
+
 // Main is the entry point for CNI network plugin.
 func main() {
 	startTime := time.Now()
@@ -186,30 +210,20 @@ func main() {
 			cniReport.VMUptime = upTime.Format("2006-01-02 15:04:05")
 		}
 
-		// CNI Acquires lock
-		if err = netPlugin.Plugin.InitializeKeyValueStore(&config); err != nil {
-			log.Errorf("Failed to initialize key-value store of network plugin, err:%v.\n", err)
+		// CNI opens the store without locking it. The network manager locks the store only while it changes the
+		// state, and locks networks and endpoints while it changes their data plane, so invocations run in parallel.
+		if err = netPlugin.Plugin.OpenKeyValueStore(&config); err != nil {
+			log.Errorf("Failed to open key-value store of network plugin, err:%v.\n", err)
 			tb := telemetry.NewTelemetryBuffer()
 			if tberr := tb.Connect(); tberr == nil {
 				reportPluginError(reportManager, tb, err)
 				tb.Close()
 			}
 
-			if isSafe, _ := netPlugin.Plugin.IsSafeToRemoveLock(name); isSafe {
-				log.Printf("[CNI] Removing lock file as process holding lock exited")
-				if errUninit := netPlugin.Plugin.UninitializeKeyValueStore(true); errUninit != nil {
-					log.Errorf("Failed to uninitialize key-value store of network plugin, err:%v.\n", errUninit)
-				}
-			}
-
 			return
 		}
 
 		defer func() {
-			if errUninit := netPlugin.Plugin.UninitializeKeyValueStore(false); errUninit != nil {
-				log.Errorf("Failed to uninitialize key-value store of network plugin, err:%v.\n", errUninit)
-			}
-
 			if recover() != nil {
 				os.Exit(1)
 			}
@@ -217,10 +231,33 @@ func main() {
 
 		// Start telemetry process if not already started. This should be done inside lock, otherwise multiple process
 		// end up creating/killing telemetry process results in undesired state.
+		if err = netPlugin.Plugin.Store.Lock(true); err != nil {
+			log.Errorf("Failed to lock key-value store of network plugin, err:%v.\n", err)
+			tb := telemetry.NewTelemetryBuffer()
+			if tberr := tb.Connect(); tberr == nil {
+				reportPluginError(reportManager, tb, err)
+				tb.Close()
+			}
+
+			if isSafe, _ := netPlugin.Plugin.IsSafeToRemoveLock(name); isSafe {
+				log.Printf("[CNI] Removing lock file as process holding lock exited")
+				if errUninit := netPlugin.Plugin.UninitializeKeyValueStore(true); errUninit != nil {
+					log.Errorf("Failed to uninitialize key-value store of network plugin, err:%v.\n", errUninit)
+				}
+			}
+
+			return
+		}
+
 		tb = telemetry.NewTelemetryBuffer()
 		tb.ConnectToTelemetryService(telemetryNumRetries, telemetryWaitTimeInMilliseconds)
 		defer tb.Close()
 
+		if err = netPlugin.Plugin.Store.Unlock(false); err != nil {
+			log.Errorf("Failed to unlock key-value store of network plugin, err:%v.\n", err)
+			return
+		}
+
 		netPlugin.SetCNIReport(cniReport, tb)
 
 		t := time.Now()
@@ -248,6 +285,18 @@ func main() {
 
 			return
 		}
+
+		// nonstandard for the CNI spec version of the plugin, used to remove stale endpoints
+		if cniCmd == cni.CmdGC {
+			err = handleGC(netPlugin.GC)
+			netPlugin.Stop()
+			if err != nil {
+				reportPluginError(reportManager, tb, err)
+				panic("network plugin gc fatal error")
+			}
+
+			return
+		}
 	}
 
 	handled, err := handleIfCniUpdate(netPlugin.Update)
@@ -263,11 +312,6 @@ func main() {
 
 	netPlugin.Stop()
 
-	// release cni lock
-	if errUninit := netPlugin.Plugin.UninitializeKeyValueStore(false); errUninit != nil {
-		log.Errorf("Failed to uninitialize key-value store of network plugin, err:%v.\n", errUninit)
-	}
-
 	executionTimeMs := time.Since(startTime).Milliseconds()
 
 	if err != nil {
@@ -79,7 +79,7 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	pluginInfo := cniVers.PluginSupports(supportedVersions...)
 
 	// Parse args and call the appropriate cmd handler.
-	cniErr := cniSkel.PluginMainWithError(api.Add, api.Get, api.Delete, pluginInfo, plugin.version)
+	cniErr := cniSkel.PluginMainWithError(api.Add, api.Check, api.Delete, pluginInfo, plugin.version)
 	if cniErr != nil {
 		cniErr.Print()
 		return cniErr
@@ -148,8 +148,8 @@ func (plugin *Plugin) Errorf(format string, args ...interface{}) *cniTypes.Error
 	return plugin.Error(fmt.Errorf(format, args...))
 }
 
-// Initialize key-value store
-func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error {
+// Open key-value store without locking it, for plugins which lock the store only while they change their state.
+func (plugin *Plugin) OpenKeyValueStore(config *common.PluginConfig) error {
 	// Create the key value store.
 	if plugin.Store == nil {
 		var err error
@@ -163,14 +163,23 @@ func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error
 		removeLockFileAfterReboot(plugin)
 	}
 
+	config.Store = plugin.Store
+
+	return nil
+}
+
+// Initialize key-value store
+func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error {
+	if err := plugin.OpenKeyValueStore(config); err != nil {
+		return err
+	}
+
 	// Acquire store lock.
 	if err := plugin.Store.Lock(true); err != nil {
 		log.Printf("[cni] Failed to lock store: %v.", err)
 		return err
 	}
 
-	config.Store = plugin.Store
-
 	return nil
 }
 
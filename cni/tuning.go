@@ -0,0 +1,212 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// TuningAnnotation is the pod annotation which tunes the network namespace of the pod, in the same JSON format
+	// as the tuning section of the network configuration.
+	TuningAnnotation = "kubernetes.azure.com/tuning"
+
+	// Bounds of the MTU and the transmit queue length of the container interface.
+	minTuningMTU        = 68
+	maxTuningMTU        = 65535
+	maxTuningTxQueueLen = 1 << 20
+)
+
+// defaultAllowedSysctls are the sysctls pods can set by default, the safe sysctls of Kubernetes which are namespaced
+// by the network namespace of the pod, so they do not affect the host or other pods.
+var defaultAllowedSysctls = []string{
+	"net.ipv4.ip_local_port_range",
+	"net.ipv4.ip_local_reserved_ports",
+	"net.ipv4.ip_unprivileged_port_start",
+	"net.ipv4.ping_group_range",
+	"net.ipv4.tcp_fin_timeout",
+	"net.ipv4.tcp_keepalive_intvl",
+	"net.ipv4.tcp_keepalive_probes",
+	"net.ipv4.tcp_keepalive_time",
+	"net.ipv4.tcp_rmem",
+	"net.ipv4.tcp_syncookies",
+	"net.ipv4.tcp_wmem",
+}
+
+// GetTuning returns the tuning of the pod. The tuning of the network configuration is overridden by the tuning pod
+// annotation, if the network configuration allows it, which is overridden by the CNI args. Invalid tuning is returned
+// as a CNI error with the code of its source.
+func GetTuning(nwCfg *NetworkConfig, args string) (*TuningConfig, error) {
+	tuning := &TuningConfig{Sysctls: make(map[string]string)}
+	allowedSysctls := defaultAllowedSysctls
+	allowPodAnnotation := false
+
+	if nwCfg.Tuning != nil {
+		mergeTuning(tuning, nwCfg.Tuning)
+		if len(nwCfg.Tuning.AllowedSysctls) > 0 {
+			allowedSysctls = nwCfg.Tuning.AllowedSysctls
+		}
+		allowPodAnnotation = nwCfg.Tuning.AllowPodAnnotation
+	}
+
+	// the annotation is not checked by the sysctl admission of Kubernetes, so it is ignored unless allowed
+	if annotation := nwCfg.RuntimeConfig.PodAnnotations[TuningAnnotation]; annotation != "" && allowPodAnnotation {
+		var annotated TuningConfig
+		if err := json.Unmarshal([]byte(annotation), &annotated); err != nil {
+			return nil, newTuningError(ErrInvalidNetworkConfig, "Invalid %s annotation: %v", TuningAnnotation, err)
+		}
+
+		mergeTuning(tuning, &annotated)
+	}
+
+	if err := validateTuning(tuning, allowedSysctls); err != nil {
+		return nil, newTuningError(ErrInvalidNetworkConfig, "Invalid tuning: %v", err)
+	}
+
+	argsTuning, err := parseTuningArgs(args)
+	if err == nil {
+		mergeTuning(tuning, argsTuning)
+		err = validateTuning(tuning, allowedSysctls)
+	}
+
+	if err != nil {
+		return nil, newTuningError(ErrInvalidEnvironmentVariables, "Invalid tuning in CNI args: %v", err)
+	}
+
+	if len(tuning.Sysctls) == 0 && tuning.MTU == 0 && tuning.TxQueueLen == 0 {
+		return nil, nil
+	}
+
+	return tuning, nil
+}
+
+// mergeTuning overrides the settings of the tuning with those set by the override. The allow list is not merged,
+// so that pods cannot extend it.
+func mergeTuning(tuning *TuningConfig, override *TuningConfig) {
+	for name, value := range override.Sysctls {
+		tuning.Sysctls[name] = value
+	}
+
+	if override.MTU != 0 {
+		tuning.MTU = override.MTU
+	}
+
+	if override.TxQueueLen != 0 {
+		tuning.TxQueueLen = override.TxQueueLen
+	}
+}
+
+// parseTuningArgs parses the tuning in the CNI args.
+func parseTuningArgs(args string) (*TuningConfig, error) {
+	tuning := &TuningConfig{}
+
+	podCfg, err := ParseCniArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if sysctls := string(podCfg.SYSCTLS); sysctls != "" {
+		tuning.Sysctls = make(map[string]string)
+		pairs, err := splitEscaped(sysctls, ',')
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sysctl := range pairs {
+			nameValue := strings.SplitN(sysctl, ":", 2)
+			if len(nameValue) != 2 {
+				return nil, fmt.Errorf("sysctl %q is not a name:value pair", sysctl)
+			}
+
+			tuning.Sysctls[strings.TrimSpace(nameValue[0])] = nameValue[1]
+		}
+	}
+
+	if mtu := string(podCfg.MTU); mtu != "" {
+		if tuning.MTU, err = strconv.Atoi(mtu); err != nil {
+			return nil, fmt.Errorf("MTU %q is not a number", mtu)
+		}
+	}
+
+	if txQueueLen := string(podCfg.TXQUEUELEN); txQueueLen != "" {
+		if tuning.TxQueueLen, err = strconv.Atoi(txQueueLen); err != nil {
+			return nil, fmt.Errorf("transmit queue length %q is not a number", txQueueLen)
+		}
+	}
+
+	return tuning, nil
+}
+
+// splitEscaped splits s at each sep which is not escaped with a backslash, and unescapes the parts. A backslash
+// escapes the character after it, so `\,` is a comma in a part and `\\` a backslash.
+func splitEscaped(s string, sep byte) ([]string, error) {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return nil, fmt.Errorf("%q ends with an unfinished escape", s)
+			}
+			part.WriteByte(s[i])
+		case sep:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+
+	return append(parts, part.String()), nil
+}
+
+// validateTuning checks that the sysctls are allowed and that the interface settings are in range.
+func validateTuning(tuning *TuningConfig, allowedSysctls []string) error {
+	for name, value := range tuning.Sysctls {
+		if !isSysctlAllowed(name, allowedSysctls) {
+			return fmt.Errorf("sysctl %s is not allowed", name)
+		}
+
+		if value == "" || strings.ContainsAny(value, "\n\x00") {
+			return fmt.Errorf("sysctl %s has invalid value %q", name, value)
+		}
+	}
+
+	if tuning.MTU != 0 && (tuning.MTU < minTuningMTU || tuning.MTU > maxTuningMTU) {
+		return fmt.Errorf("MTU %d is not between %d and %d", tuning.MTU, minTuningMTU, maxTuningMTU)
+	}
+
+	if tuning.TxQueueLen < 0 || tuning.TxQueueLen > maxTuningTxQueueLen {
+		return fmt.Errorf("transmit queue length %d is not between 0 and %d", tuning.TxQueueLen, maxTuningTxQueueLen)
+	}
+
+	return nil
+}
+
+// isSysctlAllowed returns whether the sysctl is in the allow list. Sysctls are only allowed below net, which is
+// namespaced by the network namespace of the container.
+func isSysctlAllowed(name string, allowedSysctls []string) bool {
+	if !strings.HasPrefix(name, "net.") || strings.Contains(name, "/") || strings.Contains(name, "..") {
+		return false
+	}
+
+	for _, allowed := range allowedSysctls {
+		if name == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTuningError creates a CNI error with the code.
+func newTuningError(code uint, format string, args ...interface{}) error {
+	return &cniTypes.Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
@@ -1,6 +1,7 @@
 package cns
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -26,6 +27,11 @@ const (
 	DebugIPAddresses                         = "/debug/ipaddresses"
 	DebugPodContext                          = "/debug/podcontext"
 	DebugRestData                            = "/debug/restdata"
+	DebugIPLeaks                             = "/debug/ipleaks"
+	DebugConfig                              = "/debug/config"
+	WatchIPConfigs                           = "/network/watchipconfigs"
+	ExportStateSnapshot                      = "/network/snapshot/export"
+	ImportStateSnapshot                      = "/network/snapshot/import"
 )
 
 // NetworkContainer Prefixes
@@ -72,6 +78,8 @@ const (
 	PendingRelease IPConfigState = "PendingRelease"
 	// PendingProgramming IPConfigState for pending programming IPs.
 	PendingProgramming IPConfigState = "PendingProgramming"
+	// Cooldown IPConfigState for released IPs which are held back from reuse for the IP cooldown.
+	Cooldown IPConfigState = "Cooldown"
 )
 
 // ChannelMode :- CNS channel modes
@@ -99,6 +107,7 @@ type CreateNetworkContainerRequest struct {
 	AllowHostToNCCommunication bool
 	AllowNCToHostCommunication bool
 	EndpointPolicies           []NetworkContainerRequestPolicies
+	SubnetName                 string `json:",omitempty"` // Subnet of the NC, which pods select with the PodSubnetNameAnnotation.
 }
 
 // NetworkContainerRequestPolicies - specifies policies associated with create network request
@@ -120,7 +129,7 @@ var ErrDuplicateIP = errors.New("duplicate IP detected in CNS initialization")
 // PodInfoByIPProvider to be implemented by initializers which provide a map
 // of PodInfos by IP.
 type PodInfoByIPProvider interface {
-	PodInfoByIP() (map[string]PodInfo, error)
+	PodInfoByIP(ctx context.Context) (map[string]PodInfo, error)
 }
 
 var _ PodInfoByIPProvider = (PodInfoByIPProviderFunc)(nil)
@@ -128,11 +137,11 @@ var _ PodInfoByIPProvider = (PodInfoByIPProviderFunc)(nil)
 // PodInfoByIPProviderFunc functional type which implements PodInfoByIPProvider.
 // Allows one-off functional implementations of the PodInfoByIPProvider
 // interface when a custom type definition is not necessary.
-type PodInfoByIPProviderFunc func() (map[string]PodInfo, error)
+type PodInfoByIPProviderFunc func(ctx context.Context) (map[string]PodInfo, error)
 
 // PodInfoByIP implements PodInfoByIPProvider on PodInfByIPProviderFunc.
-func (f PodInfoByIPProviderFunc) PodInfoByIP() (map[string]PodInfo, error) {
-	return f()
+func (f PodInfoByIPProviderFunc) PodInfoByIP(ctx context.Context) (map[string]PodInfo, error) {
+	return f(ctx)
 }
 
 var GlobalPodInfoScheme podInfoScheme
@@ -159,13 +168,20 @@ type PodInfo interface {
 	Name() string
 	// Namespace is the orchestrator pod namespace.
 	Namespace() string
+	// SubnetName is the subnet the pod selected to draw its IPs from, if any.
+	SubnetName() string
 	// OrchestratorContext is a JSON KubernetesPodInfo
 	OrchestratorContext() (json.RawMessage, error)
 }
 
+// PodSubnetNameAnnotation is the pod annotation which selects the subnet, and so the network
+// containers, a pod draws its IPs from. CNI passes it to CNS as the KubernetesPodInfo PodSubnetName.
+const PodSubnetNameAnnotation = "kubernetes.azure.com/pod-subnet-name"
+
 type KubernetesPodInfo struct {
-	PodName      string
-	PodNamespace string
+	PodName       string
+	PodNamespace  string
+	PodSubnetName string `json:",omitempty"`
 }
 
 var _ PodInfo = (*podInfo)(nil)
@@ -206,6 +222,10 @@ func (p *podInfo) Namespace() string {
 	return p.PodNamespace
 }
 
+func (p *podInfo) SubnetName() string {
+	return p.PodSubnetName
+}
+
 func (p *podInfo) OrchestratorContext() (json.RawMessage, error) {
 	jsonContext, err := json.Marshal(p.KubernetesPodInfo)
 	if err != nil {
@@ -345,6 +365,22 @@ type PodIpInfo struct {
 	HostPrimaryIPInfo               HostIPInfo
 }
 
+// IPFamily is the address family of an IP in the CNS IPAM pool.
+type IPFamily string
+
+const (
+	IPv4Family IPFamily = "ipv4"
+	IPv6Family IPFamily = "ipv6"
+)
+
+// GetIPFamily returns the address family of the ip address.
+func GetIPFamily(ipAddress string) IPFamily {
+	if ip := net.ParseIP(ipAddress); ip != nil && ip.To4() == nil {
+		return IPv6Family
+	}
+	return IPv4Family
+}
+
 // DeleteNetworkContainerRequest specifies the details about the request to delete a specifc network container.
 type HostIPInfo struct {
 	Gateway   string
@@ -365,9 +401,14 @@ func (i IPConfigRequest) String() string {
 }
 
 // IPConfigResponse is used in CNS IPAM mode as a response to CNI ADD
+// PodIPInfoList has one entry per address family allocated to the pod, IPv4 first.
+// PodIpInfo is the first entry of PodIPInfoList, kept for clients which only support a single IP.
+// RetryAfterInMs is how long the caller should wait before retrying a request which failed with a retriable code.
 type IPConfigResponse struct {
-	PodIpInfo PodIpInfo
-	Response  Response
+	PodIpInfo      PodIpInfo
+	PodIPInfoList  []PodIpInfo
+	Response       Response
+	RetryAfterInMs int `json:",omitempty"`
 }
 
 // GetIPAddressesRequest is used in CNS IPAM mode to get the states of IPConfigs
@@ -388,10 +429,55 @@ type GetIPAddressStatusResponse struct {
 	Response              Response
 }
 
-// GetPodContextResponse is used in CNS Client debug mode to get mapping of Orchestrator Context to Pod IP UUID
+// GetPodContextResponse is used in CNS Client debug mode to get mapping of Orchestrator Context to Pod IP UUIDs
+// PodContextList maps each pod to the UUIDs of its IPs, one per address family, IPv4 first.
+// PodContext maps each pod to the first UUID in PodContextList, kept for clients which only support a single IP.
 type GetPodContextResponse struct {
-	PodContext map[string]string
-	Response   Response
+	PodContext     map[string]string
+	PodContextList map[string][]string
+	Response       Response
+}
+
+// GetIPLeaksResponse is used in CNS Client debug mode to get the state of the IP leak detector
+type GetIPLeaksResponse struct {
+	IPAMLeakDetector IPAMLeakDetectorStateSnapshot
+	Response         Response
+}
+
+// IPConfigEventType is the kind of change to an IPConfig reported by the watch API.
+type IPConfigEventType string
+
+const (
+	IPConfigAdded        IPConfigEventType = "Added"
+	IPConfigStateChanged IPConfigEventType = "StateChanged"
+	IPConfigDeleted      IPConfigEventType = "Deleted"
+)
+
+// IPConfigEvent is a single change to an IPConfig. Revision increases by one for every event CNS emits.
+// PreviousState is only set for StateChanged events, and IPConfig holds the IPConfig after the change
+// (or before it, for Deleted events).
+type IPConfigEvent struct {
+	Revision      int64
+	Type          IPConfigEventType
+	PreviousState IPConfigState `json:",omitempty"`
+	IPConfig      IPConfigurationStatus
+}
+
+// WatchIPConfigsRequest is used to watch for changes to IPConfigs after Revision.
+// A Revision of 0 requests a snapshot of every IPConfig as Added events, to start watching from.
+// CNS holds the request for up to TimeoutInSecs until there is at least one event.
+type WatchIPConfigsRequest struct {
+	Revision      int64
+	TimeoutInSecs int `json:",omitempty"`
+}
+
+// WatchIPConfigsResponse holds the events after the requested revision, and the revision to watch from next.
+// The response code is WatchRevisionCompacted when the requested revision is no longer retained and the
+// watcher must start again from a snapshot.
+type WatchIPConfigsResponse struct {
+	Revision int64
+	Events   []IPConfigEvent
+	Response Response
 }
 
 // IPAddressState Only used in the GetIPConfig API to return IP's that match a filter
@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/types"
@@ -44,8 +45,11 @@ type HTTPService interface {
 	GetAvailableIPConfigs() []IPConfigurationStatus
 	GetAllocatedIPConfigs() []IPConfigurationStatus
 	GetPendingReleaseIPConfigs() []IPConfigurationStatus
+	GetCooldownIPConfigs() []IPConfigurationStatus
 	GetPodIPConfigState() map[string]IPConfigurationStatus
+	GetDefaultSubnetNCIDs() map[string]struct{}
 	MarkIPAsPendingRelease(numberToMark int) (map[string]IPConfigurationStatus, error)
+	ReleaseLeakedIPConfig(ipconfig IPConfigurationStatus) error
 }
 
 // This is used for KubernetesCRD orchestrator Type where NC has multiple ips.
@@ -56,6 +60,10 @@ type IPConfigurationStatus struct {
 	IPAddress string
 	State     IPConfigState
 	PodInfo   PodInfo
+	// CooldownStartTime is when the IP was released into Cooldown.
+	CooldownStartTime time.Time
+	// LastStateTransitionTime is when the IP entered its current State.
+	LastStateTransitionTime time.Time
 }
 
 func (i IPConfigurationStatus) String() string {
@@ -92,7 +100,17 @@ func (i *IPConfigurationStatus) UnmarshalJSON(b []byte) error {
 			return err
 		}
 	}
-	if s, ok := m["PodInfo"]; ok {
+	if s, ok := m["CooldownStartTime"]; ok {
+		if err := json.Unmarshal(s, &(i.CooldownStartTime)); err != nil {
+			return err
+		}
+	}
+	if s, ok := m["LastStateTransitionTime"]; ok {
+		if err := json.Unmarshal(s, &(i.LastStateTransitionTime)); err != nil {
+			return err
+		}
+	}
+	if s, ok := m["PodInfo"]; ok && string(s) != "null" {
 		pi, err := UnmarshalPodInfo(s)
 		if err != nil {
 			return err
@@ -227,6 +245,27 @@ type IpamPoolMonitorStateSnapshot struct {
 	CachedNNC                v1alpha.NodeNetworkConfig
 }
 
+type IPAMLeakDetector interface {
+	Start(ctx context.Context, leakDetectorRefreshMilliseconds int) error
+	GetStateSnapshot() IPAMLeakDetectorStateSnapshot
+}
+
+// IPAMLeakDetectorStateSnapshot struct to expose state values for IPAMLeakDetector struct
+type IPAMLeakDetectorStateSnapshot struct {
+	LastReconcileTime time.Time
+	GracePeriod       time.Duration
+	SuspectedLeaks    []SuspectedIPLeak
+	ReleasedIPCount   int
+}
+
+// SuspectedIPLeak is an Allocated IP whose pod was not found in the pod source.
+// FirstSeen is when the IP was first found to be orphaned, the IP is released
+// once it has stayed orphaned for the grace period.
+type SuspectedIPLeak struct {
+	IPConfig  IPConfigurationStatus
+	FirstSeen time.Time
+}
+
 // Response describes generic response from CNS.
 type Response struct {
 	ReturnCode types.ResponseCode
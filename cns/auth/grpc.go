@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcVerb is the verb denied gRPC calls are counted with.
+const grpcVerb = "GRPC"
+
+// peerAuthInfo is the AuthInfo of gRPC connections over a unix socket.
+type peerAuthInfo struct {
+	credentials.CommonAuthInfo
+	creds *PeerCredentials
+}
+
+func (peerAuthInfo) AuthType() string {
+	return "unix"
+}
+
+// peerTransportCredentials records the peer credentials of gRPC connections over a unix socket. It does not
+// secure the connections, so clients connect without transport security.
+type peerTransportCredentials struct{}
+
+// NewTransportCredentials creates gRPC server transport credentials which record the peer credentials of unix
+// socket connections, for the identity of their callers.
+func NewTransportCredentials() credentials.TransportCredentials {
+	return peerTransportCredentials{}
+}
+
+func (peerTransportCredentials) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, peerAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}, nil
+}
+
+func (peerTransportCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info := peerAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if creds, err := peerCredentials(unixConn); err == nil {
+			info.creds = creds
+		}
+	}
+	// callers without peer credentials are treated as anonymous
+	return conn, info, nil
+}
+
+func (peerTransportCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "unix"}
+}
+
+func (c peerTransportCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerTransportCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// IdentityFromContext returns the identity of the caller of a gRPC call with ctx.
+func IdentityFromContext(ctx context.Context) Identity {
+	var identity Identity
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(peerAuthInfo); ok {
+			identity.PeerCredentials = info.creds
+		}
+	}
+	return identity
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor which only calls the handlers of methods the caller is allowed
+// to call. Paths maps the full gRPC method names to the paths of the policy, so that the same rules apply to the
+// REST and gRPC APIs. Methods which are not in paths are authorized by their full method name. Denied calls are
+// logged, counted, and fail with PermissionDenied.
+func (p *Policy) UnaryServerInterceptor(paths map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		path, ok := paths[info.FullMethod]
+		if !ok {
+			path = info.FullMethod
+		}
+
+		identity := IdentityFromContext(ctx)
+		if p.Allowed(identity, path) {
+			return handler(ctx, req)
+		}
+
+		deniedRequests.WithLabelValues(path, grpcVerb).Inc()
+		logger.Errorf("[auth] Denied %s %s to caller %s", grpcVerb, info.FullMethod, identity)
+		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("caller %s is not allowed to call %s", identity, path))
+	}
+}
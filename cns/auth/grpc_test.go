@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	p := newTestPolicy(t)
+	interceptor := p.UnaryServerInterceptor(map[string]string{"/azure.cns.v1.CNS/ReleaseIPAddress": cns.ReleaseIPConfig})
+	info := &grpc.UnaryServerInfo{FullMethod: "/azure.cns.v1.CNS/ReleaseIPAddress"}
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return "released", nil
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: peerAuthInfo{creds: kubelet.PeerCredentials}})
+	resp, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "released", resp)
+
+	denied := testutil.ToFloat64(deniedRequests.WithLabelValues(cns.ReleaseIPConfig, grpcVerb))
+	_, err = interceptor(context.Background(), nil, info, handler)
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, err.Error(), "anonymous")
+	assert.Equal(t, denied+1, testutil.ToFloat64(deniedRequests.WithLabelValues(cns.ReleaseIPConfig, grpcVerb)))
+
+	// methods without a path are authorized by their method name
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/azure.cns.v1.CNS/DeleteNetworkContainer"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
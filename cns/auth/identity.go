@@ -0,0 +1,74 @@
+// Package auth identifies the callers of the CNS REST API and authorizes them to call its paths.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PeerCredentials are the credentials of the process on the other end of a unix socket.
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Identity is what is known about the caller of a request.
+type Identity struct {
+	// PeerCredentials are set for callers connected over a unix socket.
+	PeerCredentials *PeerCredentials
+	// CertificateSubject is the subject common name of the verified client certificate of callers connected over mTLS.
+	CertificateSubject string
+}
+
+// Anonymous is true when nothing is known about the caller.
+func (i Identity) Anonymous() bool {
+	return i.PeerCredentials == nil && i.CertificateSubject == ""
+}
+
+func (i Identity) String() string {
+	var parts []string
+	if i.PeerCredentials != nil {
+		parts = append(parts, fmt.Sprintf("uid=%d gid=%d pid=%d", i.PeerCredentials.UID, i.PeerCredentials.GID, i.PeerCredentials.PID))
+	}
+	if i.CertificateSubject != "" {
+		parts = append(parts, "cert="+i.CertificateSubject)
+	}
+	if len(parts) == 0 {
+		return "anonymous"
+	}
+	return strings.Join(parts, " ")
+}
+
+type peerCredentialsKey struct{}
+
+// ConnContext records the peer credentials of unix socket connections in the context of their requests.
+// It is set as the ConnContext of the listener serving the API.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	unixConn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	creds, err := peerCredentials(unixConn)
+	if err != nil {
+		// the caller is treated as anonymous
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredentialsKey{}, creds)
+}
+
+// IdentityFromRequest returns the identity of the caller of r.
+func IdentityFromRequest(r *http.Request) Identity {
+	var identity Identity
+	if creds, ok := r.Context().Value(peerCredentialsKey{}).(*PeerCredentials); ok {
+		identity.PeerCredentials = creds
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		identity.CertificateSubject = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return identity
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var deniedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_requests_denied_total",
+		Help: "Number of requests denied by the auth policy, by endpoint and verb.",
+	},
+	[]string{"url", "verb"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		deniedRequests,
+	)
+}
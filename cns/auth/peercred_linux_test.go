@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnContextRecordsPeerCredentials(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cns.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := http.Server{
+		ConnContext: ConnContext,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := IdentityFromRequest(r)
+			if identity.PeerCredentials == nil {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, "%d %d %d", identity.PeerCredentials.UID, identity.PeerCredentials.GID, identity.PeerCredentials.PID)
+		}),
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Get("http://cns/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d %d %d", os.Getuid(), os.Getgid(), os.Getpid()), string(body))
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package auth
+
+import (
+	"errors"
+	"net"
+)
+
+var errPeerCredentialsUnsupported = errors.New("unix socket peer credentials are not supported on windows")
+
+func peerCredentials(conn *net.UnixConn) (*PeerCredentials, error) {
+	return nil, errPeerCredentialsUnsupported
+}
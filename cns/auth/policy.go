@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+)
+
+const (
+	identityAnyCaller  = "*"
+	identityAnonymous  = "anonymous"
+	identityUIDPrefix  = "uid:"
+	identityGIDPrefix  = "gid:"
+	identityCertPrefix = "cert:"
+)
+
+// Policy authorizes callers to call paths, by the rules of the AuthSettings in the CNS configuration.
+type Policy struct {
+	rules []rule
+}
+
+type rule struct {
+	identities []func(Identity) bool
+	paths      []string
+}
+
+// NewPolicy creates a policy allowing calls by the rules.
+func NewPolicy(rules []configuration.AuthPolicyRule) (*Policy, error) {
+	p := &Policy{}
+	for i := range rules {
+		r := rule{paths: rules[i].Paths}
+		for _, identity := range rules[i].Identities {
+			match, err := identityMatcher(identity)
+			if err != nil {
+				return nil, fmt.Errorf("invalid identity in auth policy rule %d: %w", i, err)
+			}
+			r.identities = append(r.identities, match)
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+func identityMatcher(identity string) (func(Identity) bool, error) {
+	switch {
+	case identity == identityAnyCaller:
+		return func(Identity) bool { return true }, nil
+	case identity == identityAnonymous:
+		return Identity.Anonymous, nil
+	case strings.HasPrefix(identity, identityUIDPrefix):
+		uid, err := strconv.ParseUint(strings.TrimPrefix(identity, identityUIDPrefix), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid in %s: %w", identity, err)
+		}
+		return func(i Identity) bool {
+			return i.PeerCredentials != nil && i.PeerCredentials.UID == uint32(uid)
+		}, nil
+	case strings.HasPrefix(identity, identityGIDPrefix):
+		gid, err := strconv.ParseUint(strings.TrimPrefix(identity, identityGIDPrefix), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid in %s: %w", identity, err)
+		}
+		return func(i Identity) bool {
+			return i.PeerCredentials != nil && i.PeerCredentials.GID == uint32(gid)
+		}, nil
+	case strings.HasPrefix(identity, identityCertPrefix) && len(identity) > len(identityCertPrefix):
+		subject := strings.TrimPrefix(identity, identityCertPrefix)
+		return func(i Identity) bool {
+			return i.CertificateSubject == subject
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown identity %s", identity) //nolint:goerr113
+	}
+}
+
+func (r *rule) appliesTo(identity Identity) bool {
+	for _, match := range r.identities {
+		if match(identity) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) allows(path string) bool {
+	for _, allowed := range r.paths {
+		if allowed == path || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(path, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed is true if any rule for the identity allows the path.
+func (p *Policy) Allowed(identity Identity, path string) bool {
+	for i := range p.rules {
+		if p.rules[i].appliesTo(identity) && p.rules[i].allows(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns a handler which only calls next for callers allowed to call path. Denied calls are logged,
+// counted, and answered with 403 Forbidden and an Unauthorized return code.
+func (p *Policy) Authorize(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := IdentityFromRequest(r)
+		if p.Allowed(identity, path) {
+			next(w, r)
+			return
+		}
+
+		deniedRequests.WithLabelValues(path, r.Method).Inc()
+		logger.Errorf("[auth] Denied %s %s to caller %s", r.Method, path, identity)
+
+		resp := cns.Response{
+			ReturnCode: types.Unauthorized,
+			Message:    fmt.Sprintf("caller %s is not allowed to call %s", identity, path),
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(&resp); err != nil {
+			logger.Errorf("[auth] Failed to encode response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+}
+
+var (
+	root    = Identity{PeerCredentials: &PeerCredentials{PID: 1, UID: 0, GID: 0}}
+	kubelet = Identity{PeerCredentials: &PeerCredentials{PID: 2, UID: 1000, GID: 2000}}
+	dnc     = Identity{CertificateSubject: "dnc.azure.com"}
+	nobody  = Identity{}
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := NewPolicy([]configuration.AuthPolicyRule{
+		{Identities: []string{"uid:0"}, Paths: []string{"*"}},
+		{Identities: []string{"gid:2000"}, Paths: []string{cns.RequestIPConfig, cns.ReleaseIPConfig}},
+		{Identities: []string{"cert:dnc.azure.com"}, Paths: []string{cns.CreateOrUpdateNetworkContainer, cns.V2Prefix + "/network/*"}},
+		{Identities: []string{"anonymous"}, Paths: []string{"/debug/*"}},
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestNewPolicyRejectsInvalidIdentities(t *testing.T) {
+	for _, identity := range []string{"", "root", "uid:-1", "gid:abc", "cert:"} {
+		_, err := NewPolicy([]configuration.AuthPolicyRule{{Identities: []string{identity}, Paths: []string{"*"}}})
+		assert.Error(t, err, identity)
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	p := newTestPolicy(t)
+
+	tests := []struct {
+		identity Identity
+		path     string
+		allowed  bool
+	}{
+		{identity: root, path: cns.UnpublishNetworkContainer, allowed: true},
+		{identity: kubelet, path: cns.RequestIPConfig, allowed: true},
+		{identity: kubelet, path: cns.DeleteNetworkContainer, allowed: false},
+		{identity: dnc, path: cns.CreateOrUpdateNetworkContainer, allowed: true},
+		{identity: dnc, path: cns.V2Prefix + cns.DeleteNetworkContainer, allowed: true},
+		{identity: dnc, path: cns.DeleteNetworkContainer, allowed: false},
+		{identity: nobody, path: cns.DebugIPAddresses, allowed: true},
+		{identity: nobody, path: cns.ReleaseIPConfig, allowed: false},
+		// callers with credentials are not anonymous
+		{identity: kubelet, path: cns.DebugIPAddresses, allowed: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, p.Allowed(tt.identity, tt.path), "%s calling %s", tt.identity, tt.path)
+	}
+
+	anyone, err := NewPolicy([]configuration.AuthPolicyRule{{Identities: []string{"*"}, Paths: []string{cns.ReleaseIPConfig}}})
+	require.NoError(t, err)
+	assert.True(t, anyone.Allowed(nobody, cns.ReleaseIPConfig))
+	assert.True(t, anyone.Allowed(dnc, cns.ReleaseIPConfig))
+	assert.False(t, anyone.Allowed(dnc, cns.RequestIPConfig))
+}
+
+func TestIdentityFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, cns.RequestIPConfig, nil)
+	assert.True(t, IdentityFromRequest(r).Anonymous())
+
+	creds := &PeerCredentials{PID: 10, UID: 1000, GID: 2000}
+	r = r.WithContext(context.WithValue(r.Context(), peerCredentialsKey{}, creds))
+	assert.Equal(t, Identity{PeerCredentials: creds}, IdentityFromRequest(r))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "dnc.azure.com"}}
+	r = httptest.NewRequest(http.MethodPost, cns.RequestIPConfig, nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	assert.True(t, IdentityFromRequest(r).Anonymous(), "unverified certificates do not identify the caller")
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	assert.Equal(t, dnc, IdentityFromRequest(r))
+}
+
+func TestAuthorize(t *testing.T) {
+	p := newTestPolicy(t)
+	handler := p.Authorize(cns.ReleaseIPConfig, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, cns.ReleaseIPConfig, nil)
+	r = r.WithContext(context.WithValue(r.Context(), peerCredentialsKey{}, kubelet.PeerCredentials))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	denied := testutil.ToFloat64(deniedRequests.WithLabelValues(cns.ReleaseIPConfig, http.MethodPost))
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, cns.ReleaseIPConfig, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var resp cns.Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.Unauthorized, resp.ReturnCode)
+	assert.Contains(t, resp.Message, "anonymous")
+	assert.Equal(t, denied+1, testutil.ToFloat64(deniedRequests.WithLabelValues(cns.ReleaseIPConfig, http.MethodPost)))
+}
@@ -1,6 +1,7 @@
 package cnireconciler
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Azure/azure-container-networking/cni/api"
@@ -22,7 +23,7 @@ func newCNIPodInfoProvider(exec exec.Interface) (cns.PodInfoByIPProvider, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to invoke CNI client.GetEndpointState(): %w", err)
 	}
-	return cns.PodInfoByIPProviderFunc(func() (map[string]cns.PodInfo, error) {
+	return cns.PodInfoByIPProviderFunc(func(context.Context) (map[string]cns.PodInfo, error) {
 		return cniStateToPodInfoByIP(state)
 	}), nil
 }
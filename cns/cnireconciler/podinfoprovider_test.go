@@ -1,6 +1,7 @@
 package cnireconciler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -54,7 +55,7 @@ func TestNewCNIPodInfoProvider(t *testing.T) {
 				return
 			}
 			assert.NoError(t, err)
-			podInfoByIP, _ := got.PodInfoByIP()
+			podInfoByIP, _ := got.PodInfoByIP(context.Background())
 			assert.Equal(t, tt.want, podInfoByIP)
 		})
 	}
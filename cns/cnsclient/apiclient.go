@@ -7,8 +7,9 @@ import (
 
 // APIClient interface to update cns state
 type APIClient interface {
-	ReconcileNCState(nc *cns.CreateNetworkContainerRequest, pods map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error
+	ReconcileNCState(ncs []cns.CreateNetworkContainerRequest, pods map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error
 	CreateOrUpdateNC(nc cns.CreateNetworkContainerRequest) error
+	SetNodeNCs(ncs []cns.CreateNetworkContainerRequest) error
 	UpdateIPAMPoolMonitor(scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec)
 	GetNC(nc cns.GetNetworkContainerRequest) (cns.GetNetworkContainerResponse, error)
 	DeleteNC(nc cns.DeleteNetworkContainerRequest) error
@@ -1,7 +1,9 @@
 package cnsclient
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
@@ -12,11 +14,16 @@ import (
 )
 
 const (
-	getCmdArg       = "get"
-	getPodCmdArg    = "getPodContexts"
-	getInMemoryData = "getInMemory"
-	envCNSIPAddress = "CNSIpAddress"
-	envCNSPort      = "CNSPort"
+	getCmdArg        = "get"
+	getPodCmdArg     = "getPodContexts"
+	getInMemoryData  = "getInMemory"
+	getIPLeaksCmdArg = "getIPLeaks"
+	getConfigCmdArg  = "getConfig"
+	exportSnapshot   = "exportSnapshot"
+	importSnapshot   = "importSnapshot"
+	validateSnapshot = "validateSnapshot"
+	envCNSIPAddress  = "CNSIpAddress"
+	envCNSPort       = "CNSPort"
 )
 
 func HandleCNSClientCommands(cmd, arg string) error {
@@ -35,6 +42,16 @@ func HandleCNSClientCommands(cmd, arg string) error {
 		return getPodCmd(cnsClient)
 	case strings.EqualFold(getInMemoryData, cmd):
 		return getInMemory(cnsClient)
+	case strings.EqualFold(getIPLeaksCmdArg, cmd):
+		return getIPLeaks(cnsClient)
+	case strings.EqualFold(getConfigCmdArg, cmd):
+		return getConfig(cnsClient)
+	case strings.EqualFold(exportSnapshot, cmd):
+		return exportSnapshotCmd(cnsClient, arg)
+	case strings.EqualFold(importSnapshot, cmd):
+		return importSnapshotCmd(cnsClient, arg, false)
+	case strings.EqualFold(validateSnapshot, cmd):
+		return importSnapshotCmd(cnsClient, arg, true)
 	default:
 		return fmt.Errorf("No debug cmd supplied, options are: %v", getCmdArg)
 	}
@@ -56,11 +73,15 @@ func getCmd(client *CNSClient, arg string) error {
 	case cns.PendingProgramming:
 		states = append(states, cns.PendingProgramming)
 
+	case cns.Cooldown:
+		states = append(states, cns.Cooldown)
+
 	default:
 		states = append(states, cns.Allocated)
 		states = append(states, cns.Available)
 		states = append(states, cns.PendingRelease)
 		states = append(states, cns.PendingProgramming)
+		states = append(states, cns.Cooldown)
 	}
 
 	addr, err := client.GetIPAddressesMatchingStates(states...)
@@ -93,10 +114,10 @@ func getPodCmd(client *CNSClient) error {
 	return nil
 }
 
-func printPodContext(podContext map[string]string) {
+func printPodContext(podContext map[string][]string) {
 	i := 1
-	for orchContext, podID := range podContext {
-		fmt.Println(i, " ", orchContext, " : ", podID)
+	for orchContext, podIPIDs := range podContext {
+		fmt.Println(i, " ", orchContext, " : ", podIPIDs)
 		i++
 	}
 }
@@ -116,3 +137,86 @@ func printInMemoryStruct(data restserver.HTTPRestServiceData) {
 	fmt.Println("PodIPConfigState: ", data.PodIPConfigState)
 	fmt.Println("IPAMPoolMonitor: ", data.IPAMPoolMonitor)
 }
+
+func getIPLeaks(client *CNSClient) error {
+	leakDetector, err := client.GetIPLeaks()
+	if err != nil {
+		return err
+	}
+
+	printIPLeaks(leakDetector)
+	return nil
+}
+
+func printIPLeaks(leakDetector cns.IPAMLeakDetectorStateSnapshot) {
+	fmt.Println("LastReconcileTime: ", leakDetector.LastReconcileTime)
+	fmt.Println("GracePeriod: ", leakDetector.GracePeriod)
+	fmt.Println("ReleasedIPCount: ", leakDetector.ReleasedIPCount)
+	for i, leak := range leakDetector.SuspectedLeaks {
+		fmt.Println(i+1, " ", leak.IPConfig, " first seen: ", leak.FirstSeen)
+	}
+}
+
+func getConfig(client *CNSClient) error {
+	resp, err := client.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	printConfig(resp)
+	return nil
+}
+
+func printConfig(resp restserver.GetConfigResponse) {
+	config, _ := json.MarshalIndent(resp.Config, "", "  ")
+	fmt.Println("Config: ", string(config))
+	fmt.Println("Path: ", resp.ReloadStatus.Path)
+	fmt.Println("LastReloadTime: ", resp.ReloadStatus.LastReloadTime)
+	fmt.Println("LastReloadError: ", resp.ReloadStatus.LastReloadError)
+	fmt.Println("RestartRequired: ", resp.ReloadStatus.RestartRequired)
+}
+
+// exportSnapshotCmd writes a snapshot of the CNS state to the file at path, or to stdout if no path is given.
+func exportSnapshotCmd(client *CNSClient, path string) error {
+	snapshot, err := client.ExportStateSnapshot()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	if err := ioutil.WriteFile(path, b, 0o600); err != nil {
+		return err
+	}
+	fmt.Println("Exported snapshot with checksum", snapshot.Checksum, "to", path)
+	return nil
+}
+
+// importSnapshotCmd validates the snapshot in the file at path against the NodeNetworkConfig of the node, and
+// restores the CNS state from it unless validateOnly is set.
+func importSnapshotCmd(client *CNSClient, path string, validateOnly bool) error {
+	if path == "" {
+		return fmt.Errorf("No snapshot file supplied")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snapshot restserver.StateSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return fmt.Errorf("Failed to parse snapshot %s: %w", path, err)
+	}
+	msg, err := client.ImportStateSnapshot(snapshot, validateOnly)
+	if err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	return nil
+}
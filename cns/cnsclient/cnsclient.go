@@ -2,9 +2,12 @@ package cnsclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -21,28 +24,67 @@ type CNSClient struct {
 }
 
 const (
-	defaultCnsURL   = "http://localhost:10090"
+	defaultCnsURL = "http://localhost:10090"
+	unixScheme    = "unix"
+	// unixSocketHost is the host of requests to CNS on a unix socket, which only needs to be a valid URL host.
+	unixSocketHost  = "localhost"
 	contentTypeJSON = "application/json"
+	// watchTimeout is how long CNS holds each watch request when there are no changes.
+	watchTimeout = 30 * time.Second
 )
 
 var cnsClient *CNSClient
 
-// InitCnsClient initializes new cns client and returns the object
+// InitCnsClient initializes new cns client and returns the object. The url is either the http(s) URL of CNS, or
+// unix:///path/to/socket for CNS listening on a unix socket.
 func InitCnsClient(url string, requestTimeout time.Duration) (*CNSClient, error) {
 	if cnsClient == nil {
 		if url == "" {
 			url = defaultCnsURL
 		}
 
-		cnsClient = &CNSClient{
-			connectionURL: url,
+		client, err := newCNSClient(url, requestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		cnsClient = client
+	}
+
+	return cnsClient, nil
+}
+
+func newCNSClient(cnsURL string, requestTimeout time.Duration) (*CNSClient, error) {
+	u, err := url.Parse(cnsURL)
+	if err != nil {
+		return nil, &CNSClientError{types.InvalidParameter, errors.Wrapf(err, "invalid CNS url %s", cnsURL)}
+	}
+
+	if u.Scheme != unixScheme {
+		return &CNSClient{
+			connectionURL: cnsURL,
 			httpc: http.Client{
 				Timeout: requestTimeout,
 			},
-		}
+		}, nil
 	}
 
-	return cnsClient, nil
+	socketPath := u.Host + u.Path
+	if socketPath == "" {
+		return nil, &CNSClientError{types.InvalidParameter, errors.Errorf("CNS url %s has no socket path", cnsURL)}
+	}
+
+	return &CNSClient{
+		connectionURL: "http://" + unixSocketHost,
+		httpc: http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, unixScheme, socketPath)
+				},
+			},
+		},
+	}, nil
 }
 
 // GetCnsClient returns the cns client object
@@ -339,7 +381,7 @@ func (cnsClient *CNSClient) GetIPAddressesMatchingStates(stateFilter ...cns.IPCo
 		return resp.IPConfigurationStatus, err
 	}
 
-	res, err = http.Post(url, contentTypeJSON, &body)
+	res, err = cnsClient.httpc.Post(url, contentTypeJSON, &body)
 	if err != nil {
 		log.Errorf("[Azure CNSClient] HTTP Post returned error %v", err.Error())
 		return resp.IPConfigurationStatus, err
@@ -368,7 +410,7 @@ func (cnsClient *CNSClient) GetIPAddressesMatchingStates(stateFilter ...cns.IPCo
 }
 
 // GetPodOrchestratorContext calls GetPodIpOrchestratorContext API on CNS
-func (cnsClient *CNSClient) GetPodOrchestratorContext() (map[string]string, error) {
+func (cnsClient *CNSClient) GetPodOrchestratorContext() (map[string][]string, error) {
 	var (
 		resp cns.GetPodContextResponse
 		err  error
@@ -378,10 +420,10 @@ func (cnsClient *CNSClient) GetPodOrchestratorContext() (map[string]string, erro
 	url := cnsClient.connectionURL + cns.DebugPodContext
 	log.Printf("GetPodIPOrchestratorContext url %v", url)
 
-	res, err = http.Get(url)
+	res, err = cnsClient.httpc.Get(url)
 	if err != nil {
 		log.Errorf("[Azure CNSClient] GetPodIPOrchestratorContext HTTP Get returned error %v", err.Error())
-		return resp.PodContext, err
+		return resp.PodContextList, err
 	}
 
 	defer res.Body.Close()
@@ -389,21 +431,68 @@ func (cnsClient *CNSClient) GetPodOrchestratorContext() (map[string]string, erro
 	if res.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("[Azure CNSClient] GetPodIPOrchestratorContext invalid http status code: %v", res.StatusCode)
 		log.Errorf(errMsg)
-		return resp.PodContext, fmt.Errorf(errMsg)
+		return resp.PodContextList, fmt.Errorf(errMsg)
 	}
 
 	err = json.NewDecoder(res.Body).Decode(&resp)
 	if err != nil {
 		log.Errorf("[Azure CNSClient] Error received while parsing GetPodContext response resp:%v err:%v", res.Body, err.Error())
-		return resp.PodContext, err
+		return resp.PodContextList, err
 	}
 
 	if resp.Response.ReturnCode != 0 {
 		log.Errorf("[Azure CNSClient] GetPodContext received error response :%v", resp.Response.Message)
-		return resp.PodContext, fmt.Errorf(resp.Response.Message)
+		return resp.PodContextList, fmt.Errorf(resp.Response.Message)
+	}
+
+	// CNS versions without dual-stack IPAM only return a single IP per pod
+	if resp.PodContextList == nil && resp.PodContext != nil {
+		resp.PodContextList = make(map[string][]string, len(resp.PodContext))
+		for podInterfaceKey, ipID := range resp.PodContext {
+			resp.PodContextList[podInterfaceKey] = []string{ipID}
+		}
+	}
+
+	return resp.PodContextList, err
+}
+
+// GetIPLeaks gets the IPs suspected leaked by the IPAM leak detector for debugging purpose
+func (cnsClient *CNSClient) GetIPLeaks() (cns.IPAMLeakDetectorStateSnapshot, error) {
+	var (
+		resp cns.GetIPLeaksResponse
+		err  error
+		res  *http.Response
+	)
+
+	url := cnsClient.connectionURL + cns.DebugIPLeaks
+	log.Printf("GetIPLeaks url %v", url)
+
+	res, err = cnsClient.httpc.Get(url)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] GetIPLeaks HTTP Get returned error %v", err.Error())
+		return resp.IPAMLeakDetector, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("[Azure CNSClient] GetIPLeaks invalid http status code: %v", res.StatusCode)
+		log.Errorf(errMsg)
+		return resp.IPAMLeakDetector, fmt.Errorf(errMsg)
 	}
 
-	return resp.PodContext, err
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing GetIPLeaks response resp:%v err:%v", res.Body, err.Error())
+		return resp.IPAMLeakDetector, err
+	}
+
+	if resp.Response.ReturnCode != 0 {
+		log.Errorf("[Azure CNSClient] GetIPLeaks received error response :%v", resp.Response.Message)
+		return resp.IPAMLeakDetector, fmt.Errorf(resp.Response.Message)
+	}
+
+	return resp.IPAMLeakDetector, err
 }
 
 // GetHTTPServiceData gets all public in-memory struct details for debugging purpose
@@ -417,7 +506,7 @@ func (cnsClient *CNSClient) GetHTTPServiceData() (restserver.GetHTTPServiceDataR
 	url := cnsClient.connectionURL + cns.DebugRestData
 	log.Printf("GetHTTPServiceStruct url %v", url)
 
-	res, err = http.Get(url)
+	res, err = cnsClient.httpc.Get(url)
 	if err != nil {
 		log.Errorf("[Azure CNSClient] HTTP Get returned error %v", err.Error())
 		return resp, err
@@ -444,3 +533,216 @@ func (cnsClient *CNSClient) GetHTTPServiceData() (restserver.GetHTTPServiceDataR
 
 	return resp, err
 }
+
+// GetConfig gets the active CNS config and the result of the last reload of the config file for debugging purpose
+func (cnsClient *CNSClient) GetConfig() (restserver.GetConfigResponse, error) {
+	var (
+		resp restserver.GetConfigResponse
+		err  error
+		res  *http.Response
+	)
+
+	url := cnsClient.connectionURL + cns.DebugConfig
+	log.Printf("GetConfig url %v", url)
+
+	res, err = cnsClient.httpc.Get(url)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] GetConfig HTTP Get returned error %v", err.Error())
+		return resp, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("[Azure CNSClient] GetConfig invalid http status code: %v", res.StatusCode)
+		log.Errorf(errMsg)
+		return resp, fmt.Errorf(errMsg)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing GetConfig response resp:%v err:%v", res.Body, err.Error())
+		return resp, err
+	}
+
+	if resp.Response.ReturnCode != 0 {
+		log.Errorf("[Azure CNSClient] GetConfig received error response :%v", resp.Response.Message)
+		return resp, fmt.Errorf(resp.Response.Message)
+	}
+
+	return resp, err
+}
+
+// ExportStateSnapshot gets a snapshot of the NC and IP state of CNS for debugging purpose
+func (cnsClient *CNSClient) ExportStateSnapshot() (restserver.StateSnapshot, error) {
+	var (
+		resp restserver.GetStateSnapshotResponse
+		err  error
+		res  *http.Response
+	)
+
+	url := cnsClient.connectionURL + cns.ExportStateSnapshot
+	log.Printf("ExportStateSnapshot url %v", url)
+
+	res, err = cnsClient.httpc.Get(url)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] ExportStateSnapshot HTTP Get returned error %v", err.Error())
+		return resp.Snapshot, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("[Azure CNSClient] ExportStateSnapshot invalid http status code: %v", res.StatusCode)
+		log.Errorf(errMsg)
+		return resp.Snapshot, fmt.Errorf(errMsg)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing ExportStateSnapshot response err:%v", err.Error())
+		return resp.Snapshot, err
+	}
+
+	if resp.Response.ReturnCode != 0 {
+		log.Errorf("[Azure CNSClient] ExportStateSnapshot received error response :%v", resp.Response.Message)
+		return resp.Snapshot, fmt.Errorf(resp.Response.Message)
+	}
+
+	return resp.Snapshot, err
+}
+
+// ImportStateSnapshot validates the snapshot against the NodeNetworkConfig of the node and, unless validateOnly is
+// set, restores the NC and IP state of CNS from it. It returns the result message of CNS.
+func (cnsClient *CNSClient) ImportStateSnapshot(snapshot restserver.StateSnapshot, validateOnly bool) (string, error) {
+	var (
+		resp restserver.Response
+		err  error
+		res  *http.Response
+		body bytes.Buffer
+	)
+
+	url := cnsClient.connectionURL + cns.ImportStateSnapshot
+	log.Printf("ImportStateSnapshot url %v", url)
+
+	payload := &restserver.ImportStateSnapshotRequest{
+		Snapshot:     snapshot,
+		ValidateOnly: validateOnly,
+	}
+
+	err = json.NewEncoder(&body).Encode(payload)
+	if err != nil {
+		log.Errorf("encoding json failed with %v", err)
+		return "", err
+	}
+
+	res, err = cnsClient.httpc.Post(url, contentTypeJSON, &body)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] ImportStateSnapshot HTTP Post returned error %v", err.Error())
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("[Azure CNSClient] ImportStateSnapshot invalid http status code: %v", res.StatusCode)
+		log.Errorf(errMsg)
+		return "", fmt.Errorf(errMsg)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing ImportStateSnapshot response err:%v", err.Error())
+		return "", err
+	}
+
+	if resp.ReturnCode != 0 {
+		log.Errorf("[Azure CNSClient] ImportStateSnapshot received error response :%v", resp.Message)
+		return "", fmt.Errorf(resp.Message)
+	}
+
+	return resp.Message, err
+}
+
+// WatchIPConfigs calls onEvent for every change to IPConfigs after revision, until ctx is done or a request fails.
+// A revision of 0 starts with a snapshot of every IPConfig as Added events. If CNS no longer retains the revision,
+// the watch starts again from a snapshot. It returns the last revision seen, to resume watching from.
+func (cnsClient *CNSClient) WatchIPConfigs(ctx context.Context, revision int64, onEvent func(cns.IPConfigEvent)) (int64, error) {
+	url := cnsClient.connectionURL + cns.WatchIPConfigs
+	log.Printf("WatchIPConfigs url %v from revision %d", url, revision)
+
+	// requests are held by CNS for up to watchTimeout, so they need longer than the client request timeout.
+	httpc := http.Client{Transport: cnsClient.httpc.Transport, Timeout: cnsClient.httpc.Timeout + watchTimeout}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return revision, err
+		}
+
+		resp, err := cnsClient.watchIPConfigs(ctx, &httpc, url, revision)
+		if err != nil {
+			if ctx.Err() != nil {
+				return revision, ctx.Err()
+			}
+			return revision, err
+		}
+
+		switch resp.Response.ReturnCode {
+		case types.Success:
+		case types.WatchRevisionCompacted:
+			log.Printf("[Azure CNSClient] WatchIPConfigs revision %d is compacted, restarting from a snapshot: %s", revision, resp.Response.Message)
+			revision = 0
+			continue
+		default:
+			log.Errorf("[Azure CNSClient] WatchIPConfigs received error response :%v", resp.Response.Message)
+			return revision, &CNSClientError{resp.Response.ReturnCode, errors.New(resp.Response.Message)}
+		}
+
+		for _, event := range resp.Events {
+			onEvent(event)
+		}
+		revision = resp.Revision
+	}
+}
+
+func (cnsClient *CNSClient) watchIPConfigs(ctx context.Context, httpc *http.Client, url string, revision int64) (*cns.WatchIPConfigsResponse, error) {
+	var body bytes.Buffer
+
+	payload := &cns.WatchIPConfigsRequest{
+		Revision:      revision,
+		TimeoutInSecs: int(watchTimeout.Seconds()),
+	}
+
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		log.Errorf("encoding json failed with %v", err)
+		return nil, &CNSClientError{types.UnexpectedError, err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return nil, &CNSClientError{types.UnexpectedError, err}
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	res, err := httpc.Do(req)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] WatchIPConfigs HTTP Post returned error %v", err.Error())
+		return nil, &CNSClientError{types.UnexpectedError, err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("[Azure CNSClient] WatchIPConfigs invalid http status code: %v", res.StatusCode)
+		log.Errorf(errMsg)
+		return nil, &CNSClientError{types.UnexpectedError, errors.New(errMsg)}
+	}
+
+	var resp cns.WatchIPConfigsResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing WatchIPConfigs response resp:%v err:%v", res.Body, err.Error())
+		return nil, &CNSClientError{types.UnexpectedError, err}
+	}
+
+	return &resp, nil
+}
@@ -2,12 +2,15 @@ package cnsclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
@@ -15,6 +18,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/common"
+	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/fakes"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/restserver"
@@ -24,7 +28,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var svc *restserver.HTTPRestService
+var (
+	svc *restserver.HTTPRestService
+	// unixSocketPath is the unix socket the test server also serves on.
+	unixSocketPath string
+)
 
 const (
 	primaryIp           = "10.0.0.5"
@@ -128,7 +136,11 @@ func TestMain(m *testing.M) {
 	}
 
 	logger.InitLogger(logName, 0, 0, tmpLogDir+"/")
-	config := common.ServiceConfig{}
+	unixSocketPath = filepath.Join(tmpLogDir, "cns.sock")
+	config := common.ServiceConfig{
+		UnixSocketPath: unixSocketPath,
+		UnixSocketMode: 0o600,
+	}
 
 	httpRestService, err := restserver.NewHTTPRestService(&config, fakes.NewFakeImdsClient(), fakes.NewFakeNMAgentClient())
 	svc = httpRestService.(*restserver.HTTPRestService)
@@ -391,3 +403,151 @@ func TestCNSClientDebugAPI(t *testing.T) {
 	t.Logf("PodIPConfigState: %+v", inmemory.HTTPRestServiceData.PodIPConfigState)
 	t.Logf("IPAMPoolMonitor: %+v", inmemory.HTTPRestServiceData.IPAMPoolMonitor)
 }
+
+func TestCNSClientGetConfig(t *testing.T) {
+	cnsClient, _ := InitCnsClient("", 2*time.Second)
+
+	if _, err := cnsClient.GetConfig(); err == nil {
+		t.Fatalf("Expected error getting the config when CNS is not watching it")
+	}
+
+	configPath := filepath.Join(t.TempDir(), "cns_config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"ChannelMode": "CRD"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	svc.ConfigWatcher = configuration.NewWatcher(configPath, configuration.CNSConfig{ChannelMode: cns.CRD, LogLevel: "debug"})
+	defer func() { svc.ConfigWatcher = nil }()
+
+	resp, err := cnsClient.GetConfig()
+	if err != nil {
+		t.Fatalf("Get config failed with %+v", err)
+	}
+	if resp.Config.ChannelMode != cns.CRD || resp.Config.LogLevel != "debug" || resp.ReloadStatus.Path != configPath {
+		t.Fatalf("Unexpected config %+v, reload status %+v", resp.Config, resp.ReloadStatus)
+	}
+}
+
+func TestCNSClientWatchIPConfigs(t *testing.T) {
+	desiredIpAddress := "10.0.0.7"
+	cnsClient, _ := InitCnsClient("", 2*time.Second)
+
+	// use a separate NC, as the other tests leave IPs of testNcId1 allocated
+	req := cns.CreateNetworkContainerRequest{
+		NetworkContainerType: dockerContainerType,
+		NetworkContainerid:   "testWatchNcId",
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet:         cns.IPSubnet{IPAddress: primaryIp, PrefixLength: subnetPrfixLength},
+			DNSServers:       dnsservers,
+			GatewayIPAddress: gatewayIp,
+		},
+		SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
+			uuid.New().String(): {IPAddress: desiredIpAddress, NCVersion: -1},
+		},
+		Version: "-1",
+	}
+	if returnCode := svc.CreateOrUpdateNetworkContainerInternal(req); returnCode != 0 {
+		t.Fatalf("Failed to createNetworkContainerRequest, req: %+v, err: %d", req, returnCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan cns.IPConfigEvent, 100)
+	done := make(chan error)
+	go func() {
+		_, err := cnsClient.WatchIPConfigs(ctx, 0, func(event cns.IPConfigEvent) {
+			events <- event
+		})
+		done <- err
+	}()
+
+	// the watch starts with a snapshot, which includes the added IP
+	waitForEvent := func(match func(cns.IPConfigEvent) bool) {
+		t.Helper()
+		for {
+			select {
+			case event := <-events:
+				if match(event) {
+					return
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for watch event")
+			}
+		}
+	}
+	waitForEvent(func(event cns.IPConfigEvent) bool {
+		return event.Type == cns.IPConfigAdded && event.IPConfig.IPAddress == desiredIpAddress
+	})
+
+	podInfo := cns.NewPodInfo("", "", "testwatchpod", "testpodnamespace")
+	orchestratorContext, err := json.Marshal(podInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cnsClient.RequestIPAddress(&cns.IPConfigRequest{DesiredIPAddress: desiredIpAddress, OrchestratorContext: orchestratorContext})
+	if err != nil {
+		t.Fatalf("get IP from CNS failed with %+v", err)
+	}
+
+	waitForEvent(func(event cns.IPConfigEvent) bool {
+		return event.Type == cns.IPConfigStateChanged && event.IPConfig.IPAddress == desiredIpAddress &&
+			event.PreviousState == cns.Available && event.IPConfig.State == cns.Allocated
+	})
+
+	err = cnsClient.ReleaseIPAddress(&cns.IPConfigRequest{DesiredIPAddress: desiredIpAddress, OrchestratorContext: orchestratorContext})
+	if err != nil {
+		t.Fatalf("Expected to not fail when releasing IP reservation found with context: %+v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected the watch to stop when cancelled, err: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the watch to stop when cancelled")
+	}
+}
+
+func TestCNSClientOnUnixSocket(t *testing.T) {
+	info, err := os.Stat(unixSocketPath)
+	if err != nil {
+		t.Fatalf("Expected CNS to listen on unix socket %s: %+v", unixSocketPath, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected a unix socket with mode 0600, got %v", info.Mode())
+	}
+
+	unixClient, err := newCNSClient("unix://"+unixSocketPath, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create CNS client on unix socket: %+v", err)
+	}
+
+	unixData, err := unixClient.GetHTTPServiceData()
+	if err != nil {
+		t.Fatalf("Expected to get HTTP service data over the unix socket: %+v", err)
+	}
+
+	// the TCP endpoint keeps serving the same API alongside the unix socket
+	tcpClient, err := newCNSClient(defaultCnsURL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create CNS client: %+v", err)
+	}
+	tcpData, err := tcpClient.GetHTTPServiceData()
+	if err != nil {
+		t.Fatalf("Expected to get HTTP service data over TCP: %+v", err)
+	}
+	if !reflect.DeepEqual(unixData, tcpData) {
+		t.Fatalf("Expected the same data over both endpoints, got %+v and %+v", unixData, tcpData)
+	}
+}
+
+func TestNewCNSClientRejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"unix://", "http://[::1"} {
+		if _, err := newCNSClient(url, time.Second); err == nil {
+			t.Errorf("Expected an error for CNS url %s", url)
+		}
+	}
+}
@@ -26,17 +26,28 @@ func (client *Client) CreateOrUpdateNC(ncRequest cns.CreateNetworkContainerReque
 	return nil
 }
 
+// SetNodeNCs deletes the NCs which are not in ncRequests, the NCs of the NodeNetworkConfig status
+func (client *Client) SetNodeNCs(ncRequests []cns.CreateNetworkContainerRequest) error {
+	returnCode := client.RestService.SetNodeNetworkContainersInternal(ncRequests)
+
+	if returnCode != 0 {
+		return fmt.Errorf("Failed to delete the NCs which are not in the NodeNetworkConfig, errorCode: %d", returnCode)
+	}
+
+	return nil
+}
+
 // UpdateIPAMPoolMonitor updates IPAM pool monitor.
 func (client *Client) UpdateIPAMPoolMonitor(scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) {
 	client.RestService.IPAMPoolMonitor.Update(scalar, spec)
 }
 
 // ReconcileNCState initializes cns state
-func (client *Client) ReconcileNCState(ncRequest *cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
-	returnCode := client.RestService.ReconcileNCState(ncRequest, podInfoByIP, scalar, spec)
+func (client *Client) ReconcileNCState(ncRequests []cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
+	returnCode := client.RestService.ReconcileNCState(ncRequests, podInfoByIP, scalar, spec)
 
 	if returnCode != 0 {
-		return fmt.Errorf("Failed to Reconcile ncState: ncRequest %+v, podInfoMap: %+v, errorCode: %d", *ncRequest, podInfoByIP, returnCode)
+		return fmt.Errorf("Failed to Reconcile ncState: ncRequests %+v, podInfoMap: %+v, errorCode: %d", ncRequests, podInfoByIP, returnCode)
 	}
 
 	return nil
@@ -0,0 +1,183 @@
+package cnsgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/cnsclient"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/log"
+	cnsv1 "github.com/Azure/azure-container-networking/proto/cns/v1"
+	"google.golang.org/grpc"
+)
+
+// Client connects to the CNS gRPC API on a unix socket. It implements the same operations as cnsclient.CNSClient,
+// and reports failed CNS responses as a *cnsclient.CNSClientError carrying the CNS return code.
+type Client struct {
+	conn           *grpc.ClientConn
+	client         cnsv1.CNSClient
+	requestTimeout time.Duration
+}
+
+// NewClient creates a client for the CNS gRPC API served on socketPath. The connection is made lazily on the first call.
+func NewClient(socketPath string, requestTimeout time.Duration) (*Client, error) {
+	conn, err := grpc.Dial("unix://"+socketPath, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection to %s: %w", socketPath, err)
+	}
+	return &Client{
+		conn:           conn,
+		client:         cnsv1.NewCNSClient(conn),
+		requestTimeout: requestTimeout,
+	}, nil
+}
+
+// Close closes the connection to CNS.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.requestTimeout)
+}
+
+func responseError(resp cns.Response) error {
+	if resp.ReturnCode == types.Success {
+		return nil
+	}
+	//nolint:goerr113
+	return &cnsclient.CNSClientError{Code: resp.ReturnCode, Err: errors.New(resp.Message)}
+}
+
+// RequestIPAddress requests IPs for the pod in ipconfig, releasing them again if the request fails.
+func (c *Client) RequestIPAddress(ipconfig *cns.IPConfigRequest) (*cns.IPConfigResponse, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			if er := c.ReleaseIPAddress(ipconfig); er != nil {
+				log.Errorf("failed to release IP address [%v] after failed add [%v]", er, err)
+			}
+		}
+	}()
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var resp *cnsv1.IPConfigResponse
+	if resp, err = c.client.RequestIPAddress(ctx, ipConfigRequestToProto(ipconfig)); err != nil {
+		log.Errorf("[Azure CNSClient] gRPC RequestIPAddress returned error %v", err)
+		return nil, err
+	}
+
+	response := ipConfigResponseFromProto(resp)
+	if err = responseError(response.Response); err != nil {
+		log.Errorf("[Azure CNSClient] RequestIPAddress received error response :%v", response.Response.Message)
+		return response, err
+	}
+
+	return response, nil
+}
+
+// ReleaseIPAddress releases the IPs of the pod in ipconfig.
+func (c *Client) ReleaseIPAddress(ipconfig *cns.IPConfigRequest) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	log.Printf("Releasing ipconfig %s", ipconfig)
+	resp, err := c.client.ReleaseIPAddress(ctx, ipConfigRequestToProto(ipconfig))
+	if err != nil {
+		log.Errorf("[Azure CNSClient] gRPC ReleaseIPAddress returned error %v", err)
+		return err
+	}
+
+	response := responseFromProto(resp.GetResponse())
+	if err = responseError(response); err != nil {
+		log.Errorf("[Azure CNSClient] ReleaseIPAddress received error response :%v", response.Message)
+		return err
+	}
+
+	return nil
+}
+
+// GetIPAddressesMatchingStates returns the IPs in any of the states.
+func (c *Client) GetIPAddressesMatchingStates(stateFilter ...cns.IPConfigState) ([]cns.IPConfigurationStatus, error) {
+	if len(stateFilter) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	req := &cnsv1.GetIPAddressesRequest{}
+	for _, state := range stateFilter {
+		req.IpConfigStateFilter = append(req.IpConfigStateFilter, string(state))
+	}
+
+	resp, err := c.client.GetIPAddressesMatchingStates(ctx, req)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] gRPC GetIPAddressesMatchingStates returned error %v", err)
+		return nil, err
+	}
+
+	if err = responseError(responseFromProto(resp.GetResponse())); err != nil {
+		log.Errorf("[Azure CNSClient] GetIPAddressesMatchingStates received error response :%v", resp.GetResponse().GetMessage())
+		return nil, err
+	}
+
+	ipConfigs := make([]cns.IPConfigurationStatus, 0, len(resp.GetIpConfigurationStatus()))
+	for _, status := range resp.GetIpConfigurationStatus() {
+		ipConfig, err := ipConfigurationStatusFromProto(status)
+		if err != nil {
+			return nil, err
+		}
+		ipConfigs = append(ipConfigs, ipConfig)
+	}
+
+	return ipConfigs, nil
+}
+
+// CreateOrUpdateNC creates or updates a network container.
+func (c *Client) CreateOrUpdateNC(ncRequest cns.CreateNetworkContainerRequest) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := c.client.CreateOrUpdateNetworkContainer(ctx, createNetworkContainerRequestToProto(ncRequest))
+	if err != nil {
+		return err
+	}
+
+	return responseError(responseFromProto(resp.GetResponse()))
+}
+
+// GetNC returns the network container.
+func (c *Client) GetNC(req cns.GetNetworkContainerRequest) (cns.GetNetworkContainerResponse, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := c.client.GetNetworkContainer(ctx, &cnsv1.GetNetworkContainerRequest{
+		NetworkContainerId:  req.NetworkContainerid,
+		OrchestratorContext: req.OrchestratorContext,
+	})
+	if err != nil {
+		return cns.GetNetworkContainerResponse{}, err
+	}
+
+	response := getNetworkContainerResponseFromProto(resp)
+	return response, responseError(response.Response)
+}
+
+// DeleteNC deletes the network container.
+func (c *Client) DeleteNC(req cns.DeleteNetworkContainerRequest) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := c.client.DeleteNetworkContainer(ctx, &cnsv1.DeleteNetworkContainerRequest{NetworkContainerId: req.NetworkContainerid})
+	if err != nil {
+		return err
+	}
+
+	return responseError(responseFromProto(resp.GetResponse()))
+}
@@ -0,0 +1,232 @@
+package cnsgrpc
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/cnsclient"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+}
+
+// fakeService records the requests it receives and answers with the configured responses.
+type fakeService struct {
+	ipConfigResponse cns.IPConfigResponse
+	releaseResponse  cns.Response
+	releasedRequests []cns.IPConfigRequest
+	ipConfigs        []cns.IPConfigurationStatus
+	ncs              map[string]cns.CreateNetworkContainerRequest
+}
+
+func (f *fakeService) RequestIPConfigInternal(req cns.IPConfigRequest) (cns.IPConfigResponse, types.ResponseCode) {
+	return f.ipConfigResponse, f.ipConfigResponse.Response.ReturnCode
+}
+
+func (f *fakeService) ReleaseIPConfigInternal(req cns.IPConfigRequest) cns.Response {
+	f.releasedRequests = append(f.releasedRequests, req)
+	return f.releaseResponse
+}
+
+func (f *fakeService) GetIPConfigsMatchingStates(states ...cns.IPConfigState) []cns.IPConfigurationStatus {
+	var matching []cns.IPConfigurationStatus
+	for _, ipConfig := range f.ipConfigs {
+		for _, state := range states {
+			if ipConfig.State == state {
+				matching = append(matching, ipConfig)
+			}
+		}
+	}
+	return matching
+}
+
+func (f *fakeService) CreateOrUpdateNetworkContainerInternal(req cns.CreateNetworkContainerRequest) types.ResponseCode {
+	f.ncs[req.NetworkContainerid] = req
+	return types.Success
+}
+
+func (f *fakeService) GetNetworkContainerInternal(req cns.GetNetworkContainerRequest) (cns.GetNetworkContainerResponse, types.ResponseCode) {
+	nc, ok := f.ncs[req.NetworkContainerid]
+	if !ok {
+		return cns.GetNetworkContainerResponse{Response: cns.Response{ReturnCode: types.UnknownContainerID, Message: "not found"}}, types.UnknownContainerID
+	}
+	return cns.GetNetworkContainerResponse{
+		NetworkContainerID: nc.NetworkContainerid,
+		IPConfiguration:    nc.IPConfiguration,
+		Routes:             nc.Routes,
+	}, types.Success
+}
+
+func (f *fakeService) DeleteNetworkContainerInternal(req cns.DeleteNetworkContainerRequest) types.ResponseCode {
+	if _, ok := f.ncs[req.NetworkContainerid]; !ok {
+		return types.UnknownContainerID
+	}
+	delete(f.ncs, req.NetworkContainerid)
+	return types.Success
+}
+
+func newTestClient(t *testing.T, service Service) *Client {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "cns.sock")
+	server := NewServer(service, socketPath, 0o660, nil)
+	require.NoError(t, server.Start())
+	t.Cleanup(server.Stop)
+
+	client, err := NewClient(socketPath, 5*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func newTestIPConfigRequest(t *testing.T) *cns.IPConfigRequest {
+	t.Helper()
+
+	orchestratorContext, err := json.Marshal(cns.KubernetesPodInfo{PodName: "pod", PodNamespace: "default"})
+	require.NoError(t, err)
+	return &cns.IPConfigRequest{
+		PodInterfaceID:      "pod-eth0",
+		InfraContainerID:    "infra",
+		OrchestratorContext: orchestratorContext,
+	}
+}
+
+func TestRequestIPAddress(t *testing.T) {
+	podIPInfoList := []cns.PodIpInfo{
+		{
+			PodIPConfig: cns.IPSubnet{IPAddress: "10.0.0.4", PrefixLength: 24},
+			NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+				IPSubnet:         cns.IPSubnet{IPAddress: "10.0.0.1", PrefixLength: 24},
+				DNSServers:       []string{"168.63.129.16"},
+				GatewayIPAddress: "10.0.0.1",
+			},
+			HostPrimaryIPInfo: cns.HostIPInfo{Gateway: "10.240.0.1", PrimaryIP: "10.240.0.4", Subnet: "10.240.0.0/16"},
+		},
+		{
+			PodIPConfig: cns.IPSubnet{IPAddress: "fd00::4", PrefixLength: 64},
+			NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+				IPSubnet:         cns.IPSubnet{IPAddress: "fd00::1", PrefixLength: 64},
+				GatewayIPAddress: "fd00::1",
+			},
+		},
+	}
+	service := &fakeService{ipConfigResponse: cns.IPConfigResponse{PodIPInfoList: podIPInfoList}}
+	client := newTestClient(t, service)
+
+	resp, err := client.RequestIPAddress(newTestIPConfigRequest(t))
+	require.NoError(t, err)
+	assert.Equal(t, podIPInfoList, resp.PodIPInfoList)
+	assert.Equal(t, podIPInfoList[0], resp.PodIpInfo)
+	assert.Empty(t, service.releasedRequests)
+}
+
+func TestRequestIPAddressFailureReleases(t *testing.T) {
+	service := &fakeService{ipConfigResponse: cns.IPConfigResponse{
+		Response: cns.Response{ReturnCode: types.FailedToAllocateIPConfig, Message: "no more free IPs"},
+	}}
+	client := newTestClient(t, service)
+
+	req := newTestIPConfigRequest(t)
+	_, err := client.RequestIPAddress(req)
+	require.Error(t, err)
+
+	var clientErr *cnsclient.CNSClientError
+	require.ErrorAs(t, err, &clientErr)
+	assert.Equal(t, types.FailedToAllocateIPConfig, clientErr.Code)
+
+	require.Len(t, service.releasedRequests, 1)
+	assert.Equal(t, req.InfraContainerID, service.releasedRequests[0].InfraContainerID)
+	assert.Equal(t, req.PodInterfaceID, service.releasedRequests[0].PodInterfaceID)
+	assert.JSONEq(t, string(req.OrchestratorContext), string(service.releasedRequests[0].OrchestratorContext))
+}
+
+func TestRequestIPAddressRetryAfter(t *testing.T) {
+	service := &fakeService{ipConfigResponse: cns.IPConfigResponse{
+		Response:       cns.Response{ReturnCode: types.RequestThrottled, Message: "too many IP requests"},
+		RetryAfterInMs: 500,
+	}}
+	client := newTestClient(t, service)
+
+	resp, err := client.RequestIPAddress(newTestIPConfigRequest(t))
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, types.RequestThrottled, resp.Response.ReturnCode)
+	assert.Equal(t, 500, resp.RetryAfterInMs)
+}
+
+func TestGetIPAddressesMatchingStates(t *testing.T) {
+	cooldownStart := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	allocated := cns.IPConfigurationStatus{
+		NCID:                    "nc",
+		ID:                      "allocated",
+		IPAddress:               "10.0.0.4",
+		State:                   cns.Allocated,
+		PodInfo:                 cns.NewPodInfo("infra", "pod-eth0", "pod", "default"),
+		LastStateTransitionTime: cooldownStart.Add(-time.Minute),
+	}
+	cooldown := cns.IPConfigurationStatus{
+		NCID:                    "nc",
+		ID:                      "cooldown",
+		IPAddress:               "10.0.0.5",
+		State:                   cns.Cooldown,
+		CooldownStartTime:       cooldownStart,
+		LastStateTransitionTime: cooldownStart,
+	}
+	service := &fakeService{ipConfigs: []cns.IPConfigurationStatus{
+		allocated,
+		cooldown,
+		{NCID: "nc", ID: "available", IPAddress: "10.0.0.6", State: cns.Available},
+	}}
+	client := newTestClient(t, service)
+
+	ipConfigs, err := client.GetIPAddressesMatchingStates(cns.Allocated, cns.Cooldown)
+	require.NoError(t, err)
+	assert.Equal(t, []cns.IPConfigurationStatus{allocated, cooldown}, ipConfigs)
+}
+
+func TestNetworkContainerCRUD(t *testing.T) {
+	service := &fakeService{ncs: map[string]cns.CreateNetworkContainerRequest{}}
+	client := newTestClient(t, service)
+
+	ncRequest := cns.CreateNetworkContainerRequest{
+		Version:              "1",
+		NetworkContainerType: cns.Docker,
+		NetworkContainerid:   "nc",
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet:         cns.IPSubnet{IPAddress: "10.0.0.1", PrefixLength: 24},
+			GatewayIPAddress: "10.0.0.1",
+		},
+		SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
+			"uuid": {IPAddress: "10.0.0.4", NCVersion: 1},
+		},
+		MultiTenancyInfo: cns.MultiTenancyInfo{EncapType: "Vlan", ID: 10},
+		CnetAddressSpace: []cns.IPSubnet{{IPAddress: "10.1.0.0", PrefixLength: 16}},
+		Routes:           []cns.Route{{IPAddress: "10.2.0.0/16", GatewayIPAddress: "10.0.0.1"}},
+		EndpointPolicies: []cns.NetworkContainerRequestPolicies{
+			{Type: "ACLPolicy", EndpointType: "APIPA", Settings: json.RawMessage(`{"Action":"Allow"}`)},
+		},
+		SubnetName: "subnet1",
+	}
+	require.NoError(t, client.CreateOrUpdateNC(ncRequest))
+	assert.Equal(t, ncRequest, service.ncs[ncRequest.NetworkContainerid])
+
+	nc, err := client.GetNC(cns.GetNetworkContainerRequest{NetworkContainerid: ncRequest.NetworkContainerid})
+	require.NoError(t, err)
+	assert.Equal(t, ncRequest.NetworkContainerid, nc.NetworkContainerID)
+	assert.Equal(t, ncRequest.IPConfiguration, nc.IPConfiguration)
+	assert.Equal(t, ncRequest.Routes, nc.Routes)
+
+	require.NoError(t, client.DeleteNC(cns.DeleteNetworkContainerRequest{NetworkContainerid: ncRequest.NetworkContainerid}))
+
+	_, err = client.GetNC(cns.GetNetworkContainerRequest{NetworkContainerid: ncRequest.NetworkContainerid})
+	assert.True(t, cnsclient.IsNotFound(err))
+	assert.True(t, cnsclient.IsNotFound(client.DeleteNC(cns.DeleteNetworkContainerRequest{NetworkContainerid: ncRequest.NetworkContainerid})))
+}
@@ -0,0 +1,319 @@
+package cnsgrpc
+
+import (
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	cnsv1 "github.com/Azure/azure-container-networking/proto/cns/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The conversions below map the CNS contract types to their gRPC messages and back, field by field.
+
+func responseToProto(r cns.Response) *cnsv1.Response {
+	return &cnsv1.Response{ReturnCode: int32(r.ReturnCode), Message: r.Message}
+}
+
+func responseFromProto(r *cnsv1.Response) cns.Response {
+	return cns.Response{ReturnCode: types.ResponseCode(r.GetReturnCode()), Message: r.GetMessage()}
+}
+
+func ipSubnetToProto(s cns.IPSubnet) *cnsv1.IPSubnet {
+	return &cnsv1.IPSubnet{IpAddress: s.IPAddress, PrefixLength: uint32(s.PrefixLength)}
+}
+
+func ipSubnetFromProto(s *cnsv1.IPSubnet) cns.IPSubnet {
+	return cns.IPSubnet{IPAddress: s.GetIpAddress(), PrefixLength: uint8(s.GetPrefixLength())}
+}
+
+func ipSubnetsToProto(subnets []cns.IPSubnet) []*cnsv1.IPSubnet {
+	if subnets == nil {
+		return nil
+	}
+	out := make([]*cnsv1.IPSubnet, len(subnets))
+	for i := range subnets {
+		out[i] = ipSubnetToProto(subnets[i])
+	}
+	return out
+}
+
+func ipSubnetsFromProto(subnets []*cnsv1.IPSubnet) []cns.IPSubnet {
+	if subnets == nil {
+		return nil
+	}
+	out := make([]cns.IPSubnet, len(subnets))
+	for i := range subnets {
+		out[i] = ipSubnetFromProto(subnets[i])
+	}
+	return out
+}
+
+func ipConfigurationToProto(c cns.IPConfiguration) *cnsv1.IPConfiguration {
+	return &cnsv1.IPConfiguration{
+		IpSubnet:         ipSubnetToProto(c.IPSubnet),
+		DnsServers:       c.DNSServers,
+		GatewayIpAddress: c.GatewayIPAddress,
+	}
+}
+
+func ipConfigurationFromProto(c *cnsv1.IPConfiguration) cns.IPConfiguration {
+	return cns.IPConfiguration{
+		IPSubnet:         ipSubnetFromProto(c.GetIpSubnet()),
+		DNSServers:       c.GetDnsServers(),
+		GatewayIPAddress: c.GetGatewayIpAddress(),
+	}
+}
+
+func routesToProto(routes []cns.Route) []*cnsv1.Route {
+	if routes == nil {
+		return nil
+	}
+	out := make([]*cnsv1.Route, len(routes))
+	for i := range routes {
+		out[i] = &cnsv1.Route{
+			IpAddress:        routes[i].IPAddress,
+			GatewayIpAddress: routes[i].GatewayIPAddress,
+			InterfaceToUse:   routes[i].InterfaceToUse,
+		}
+	}
+	return out
+}
+
+func routesFromProto(routes []*cnsv1.Route) []cns.Route {
+	if routes == nil {
+		return nil
+	}
+	out := make([]cns.Route, len(routes))
+	for i := range routes {
+		out[i] = cns.Route{
+			IPAddress:        routes[i].GetIpAddress(),
+			GatewayIPAddress: routes[i].GetGatewayIpAddress(),
+			InterfaceToUse:   routes[i].GetInterfaceToUse(),
+		}
+	}
+	return out
+}
+
+func multiTenancyInfoToProto(m cns.MultiTenancyInfo) *cnsv1.MultiTenancyInfo {
+	return &cnsv1.MultiTenancyInfo{EncapType: m.EncapType, Id: int64(m.ID)}
+}
+
+func multiTenancyInfoFromProto(m *cnsv1.MultiTenancyInfo) cns.MultiTenancyInfo {
+	return cns.MultiTenancyInfo{EncapType: m.GetEncapType(), ID: int(m.GetId())}
+}
+
+func ipConfigRequestToProto(req *cns.IPConfigRequest) *cnsv1.IPConfigRequest {
+	return &cnsv1.IPConfigRequest{
+		DesiredIpAddress:    req.DesiredIPAddress,
+		PodInterfaceId:      req.PodInterfaceID,
+		InfraContainerId:    req.InfraContainerID,
+		OrchestratorContext: req.OrchestratorContext,
+	}
+}
+
+func ipConfigRequestFromProto(req *cnsv1.IPConfigRequest) cns.IPConfigRequest {
+	return cns.IPConfigRequest{
+		DesiredIPAddress:    req.GetDesiredIpAddress(),
+		PodInterfaceID:      req.GetPodInterfaceId(),
+		InfraContainerID:    req.GetInfraContainerId(),
+		OrchestratorContext: req.GetOrchestratorContext(),
+	}
+}
+
+func podIPInfoToProto(info cns.PodIpInfo) *cnsv1.PodIPInfo {
+	return &cnsv1.PodIPInfo{
+		PodIpConfig:                     ipSubnetToProto(info.PodIPConfig),
+		NetworkContainerPrimaryIpConfig: ipConfigurationToProto(info.NetworkContainerPrimaryIPConfig),
+		HostPrimaryIpInfo: &cnsv1.HostIPInfo{
+			Gateway:   info.HostPrimaryIPInfo.Gateway,
+			PrimaryIp: info.HostPrimaryIPInfo.PrimaryIP,
+			Subnet:    info.HostPrimaryIPInfo.Subnet,
+		},
+	}
+}
+
+func podIPInfoFromProto(info *cnsv1.PodIPInfo) cns.PodIpInfo {
+	return cns.PodIpInfo{
+		PodIPConfig:                     ipSubnetFromProto(info.GetPodIpConfig()),
+		NetworkContainerPrimaryIPConfig: ipConfigurationFromProto(info.GetNetworkContainerPrimaryIpConfig()),
+		HostPrimaryIPInfo: cns.HostIPInfo{
+			Gateway:   info.GetHostPrimaryIpInfo().GetGateway(),
+			PrimaryIP: info.GetHostPrimaryIpInfo().GetPrimaryIp(),
+			Subnet:    info.GetHostPrimaryIpInfo().GetSubnet(),
+		},
+	}
+}
+
+func ipConfigResponseToProto(resp cns.IPConfigResponse) *cnsv1.IPConfigResponse {
+	out := &cnsv1.IPConfigResponse{
+		Response:     responseToProto(resp.Response),
+		RetryAfterMs: int32(resp.RetryAfterInMs),
+	}
+	for i := range resp.PodIPInfoList {
+		out.PodIpInfoList = append(out.PodIpInfoList, podIPInfoToProto(resp.PodIPInfoList[i]))
+	}
+	return out
+}
+
+func ipConfigResponseFromProto(resp *cnsv1.IPConfigResponse) *cns.IPConfigResponse {
+	out := &cns.IPConfigResponse{
+		Response:       responseFromProto(resp.GetResponse()),
+		RetryAfterInMs: int(resp.GetRetryAfterMs()),
+	}
+	for _, info := range resp.GetPodIpInfoList() {
+		out.PodIPInfoList = append(out.PodIPInfoList, podIPInfoFromProto(info))
+	}
+	if len(out.PodIPInfoList) > 0 {
+		out.PodIpInfo = out.PodIPInfoList[0]
+	}
+	return out
+}
+
+func ipConfigurationStatusToProto(status cns.IPConfigurationStatus) (*cnsv1.IPConfigurationStatus, error) {
+	out := &cnsv1.IPConfigurationStatus{
+		NcId:      status.NCID,
+		Id:        status.ID,
+		IpAddress: status.IPAddress,
+		State:     string(status.State),
+	}
+	if status.PodInfo != nil {
+		orchestratorContext, err := status.PodInfo.OrchestratorContext()
+		if err != nil {
+			return nil, err
+		}
+		out.PodInfo = &cnsv1.PodInfo{
+			InfraContainerId:    status.PodInfo.InfraContainerID(),
+			InterfaceId:         status.PodInfo.InterfaceID(),
+			OrchestratorContext: orchestratorContext,
+		}
+	}
+	if !status.CooldownStartTime.IsZero() {
+		out.CooldownStartTime = timestamppb.New(status.CooldownStartTime)
+	}
+	if !status.LastStateTransitionTime.IsZero() {
+		out.LastStateTransitionTime = timestamppb.New(status.LastStateTransitionTime)
+	}
+	return out, nil
+}
+
+func ipConfigurationStatusFromProto(status *cnsv1.IPConfigurationStatus) (cns.IPConfigurationStatus, error) {
+	out := cns.IPConfigurationStatus{
+		NCID:      status.GetNcId(),
+		ID:        status.GetId(),
+		IPAddress: status.GetIpAddress(),
+		State:     cns.IPConfigState(status.GetState()),
+	}
+	if podInfo := status.GetPodInfo(); podInfo != nil {
+		var err error
+		out.PodInfo, err = cns.NewPodInfoFromIPConfigRequest(cns.IPConfigRequest{
+			PodInterfaceID:      podInfo.GetInterfaceId(),
+			InfraContainerID:    podInfo.GetInfraContainerId(),
+			OrchestratorContext: podInfo.GetOrchestratorContext(),
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	if status.GetCooldownStartTime() != nil {
+		out.CooldownStartTime = status.GetCooldownStartTime().AsTime()
+	}
+	if status.GetLastStateTransitionTime() != nil {
+		out.LastStateTransitionTime = status.GetLastStateTransitionTime().AsTime()
+	}
+	return out, nil
+}
+
+func createNetworkContainerRequestToProto(req cns.CreateNetworkContainerRequest) *cnsv1.CreateNetworkContainerRequest {
+	out := &cnsv1.CreateNetworkContainerRequest{
+		Version:                    req.Version,
+		NetworkContainerType:       req.NetworkContainerType,
+		NetworkContainerId:         req.NetworkContainerid,
+		PrimaryInterfaceIdentifier: req.PrimaryInterfaceIdentifier,
+		AuthorizationToken:         req.AuthorizationToken,
+		LocalIpConfiguration:       ipConfigurationToProto(req.LocalIPConfiguration),
+		OrchestratorContext:        req.OrchestratorContext,
+		IpConfiguration:            ipConfigurationToProto(req.IPConfiguration),
+		MultiTenancyInfo:           multiTenancyInfoToProto(req.MultiTenancyInfo),
+		CnetAddressSpace:           ipSubnetsToProto(req.CnetAddressSpace),
+		Routes:                     routesToProto(req.Routes),
+		AllowHostToNcCommunication: req.AllowHostToNCCommunication,
+		AllowNcToHostCommunication: req.AllowNCToHostCommunication,
+		SubnetName:                 req.SubnetName,
+	}
+	if req.SecondaryIPConfigs != nil {
+		out.SecondaryIpConfigs = make(map[string]*cnsv1.SecondaryIPConfig, len(req.SecondaryIPConfigs))
+		for id, ipconfig := range req.SecondaryIPConfigs {
+			out.SecondaryIpConfigs[id] = &cnsv1.SecondaryIPConfig{IpAddress: ipconfig.IPAddress, NcVersion: int64(ipconfig.NCVersion)}
+		}
+	}
+	for _, policy := range req.EndpointPolicies {
+		out.EndpointPolicies = append(out.EndpointPolicies, &cnsv1.NetworkContainerRequestPolicies{
+			Type:         policy.Type,
+			EndpointType: policy.EndpointType,
+			Settings:     policy.Settings,
+		})
+	}
+	return out
+}
+
+func createNetworkContainerRequestFromProto(req *cnsv1.CreateNetworkContainerRequest) cns.CreateNetworkContainerRequest {
+	out := cns.CreateNetworkContainerRequest{
+		Version:                    req.GetVersion(),
+		NetworkContainerType:       req.GetNetworkContainerType(),
+		NetworkContainerid:         req.GetNetworkContainerId(),
+		PrimaryInterfaceIdentifier: req.GetPrimaryInterfaceIdentifier(),
+		AuthorizationToken:         req.GetAuthorizationToken(),
+		LocalIPConfiguration:       ipConfigurationFromProto(req.GetLocalIpConfiguration()),
+		OrchestratorContext:        req.GetOrchestratorContext(),
+		IPConfiguration:            ipConfigurationFromProto(req.GetIpConfiguration()),
+		MultiTenancyInfo:           multiTenancyInfoFromProto(req.GetMultiTenancyInfo()),
+		CnetAddressSpace:           ipSubnetsFromProto(req.GetCnetAddressSpace()),
+		Routes:                     routesFromProto(req.GetRoutes()),
+		AllowHostToNCCommunication: req.GetAllowHostToNcCommunication(),
+		AllowNCToHostCommunication: req.GetAllowNcToHostCommunication(),
+		SubnetName:                 req.GetSubnetName(),
+	}
+	if req.GetSecondaryIpConfigs() != nil {
+		out.SecondaryIPConfigs = make(map[string]cns.SecondaryIPConfig, len(req.GetSecondaryIpConfigs()))
+		for id, ipconfig := range req.GetSecondaryIpConfigs() {
+			out.SecondaryIPConfigs[id] = cns.SecondaryIPConfig{IPAddress: ipconfig.GetIpAddress(), NCVersion: int(ipconfig.GetNcVersion())}
+		}
+	}
+	for _, policy := range req.GetEndpointPolicies() {
+		out.EndpointPolicies = append(out.EndpointPolicies, cns.NetworkContainerRequestPolicies{
+			Type:         policy.GetType(),
+			EndpointType: policy.GetEndpointType(),
+			Settings:     policy.GetSettings(),
+		})
+	}
+	return out
+}
+
+func getNetworkContainerResponseToProto(resp cns.GetNetworkContainerResponse) *cnsv1.GetNetworkContainerResponse {
+	return &cnsv1.GetNetworkContainerResponse{
+		NetworkContainerId:         resp.NetworkContainerID,
+		IpConfiguration:            ipConfigurationToProto(resp.IPConfiguration),
+		Routes:                     routesToProto(resp.Routes),
+		CnetAddressSpace:           ipSubnetsToProto(resp.CnetAddressSpace),
+		MultiTenancyInfo:           multiTenancyInfoToProto(resp.MultiTenancyInfo),
+		PrimaryInterfaceIdentifier: resp.PrimaryInterfaceIdentifier,
+		LocalIpConfiguration:       ipConfigurationToProto(resp.LocalIPConfiguration),
+		Response:                   responseToProto(resp.Response),
+		AllowHostToNcCommunication: resp.AllowHostToNCCommunication,
+		AllowNcToHostCommunication: resp.AllowNCToHostCommunication,
+	}
+}
+
+func getNetworkContainerResponseFromProto(resp *cnsv1.GetNetworkContainerResponse) cns.GetNetworkContainerResponse {
+	return cns.GetNetworkContainerResponse{
+		NetworkContainerID:         resp.GetNetworkContainerId(),
+		IPConfiguration:            ipConfigurationFromProto(resp.GetIpConfiguration()),
+		Routes:                     routesFromProto(resp.GetRoutes()),
+		CnetAddressSpace:           ipSubnetsFromProto(resp.GetCnetAddressSpace()),
+		MultiTenancyInfo:           multiTenancyInfoFromProto(resp.GetMultiTenancyInfo()),
+		PrimaryInterfaceIdentifier: resp.GetPrimaryInterfaceIdentifier(),
+		LocalIPConfiguration:       ipConfigurationFromProto(resp.GetLocalIpConfiguration()),
+		Response:                   responseFromProto(resp.GetResponse()),
+		AllowHostToNCCommunication: resp.GetAllowHostToNcCommunication(),
+		AllowNCToHostCommunication: resp.GetAllowNcToHostCommunication(),
+	}
+}
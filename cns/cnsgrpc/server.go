@@ -0,0 +1,159 @@
+package cnsgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/auth"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	cnsv1 "github.com/Azure/azure-container-networking/proto/cns/v1"
+	"google.golang.org/grpc"
+)
+
+// Service is the CNS state served over gRPC. It is implemented by restserver.HTTPRestService, so both APIs
+// share the same state and validation.
+type Service interface {
+	RequestIPConfigInternal(req cns.IPConfigRequest) (cns.IPConfigResponse, types.ResponseCode)
+	ReleaseIPConfigInternal(req cns.IPConfigRequest) cns.Response
+	GetIPConfigsMatchingStates(states ...cns.IPConfigState) []cns.IPConfigurationStatus
+	CreateOrUpdateNetworkContainerInternal(req cns.CreateNetworkContainerRequest) types.ResponseCode
+	GetNetworkContainerInternal(req cns.GetNetworkContainerRequest) (cns.GetNetworkContainerResponse, types.ResponseCode)
+	DeleteNetworkContainerInternal(req cns.DeleteNetworkContainerRequest) types.ResponseCode
+}
+
+// methodPaths maps the gRPC methods to the paths of the equivalent REST API, so that one auth policy applies to both.
+var methodPaths = map[string]string{
+	"/azure.cns.v1.CNS/RequestIPAddress":               cns.RequestIPConfig,
+	"/azure.cns.v1.CNS/ReleaseIPAddress":               cns.ReleaseIPConfig,
+	"/azure.cns.v1.CNS/GetIPAddressesMatchingStates":   cns.DebugIPAddresses,
+	"/azure.cns.v1.CNS/CreateOrUpdateNetworkContainer": cns.CreateOrUpdateNetworkContainer,
+	"/azure.cns.v1.CNS/GetNetworkContainer":            cns.GetNetworkContainerByOrchestratorContext,
+	"/azure.cns.v1.CNS/DeleteNetworkContainer":         cns.DeleteNetworkContainer,
+}
+
+// Server serves the CNS gRPC API on a unix socket.
+type Server struct {
+	cnsv1.UnimplementedCNSServer
+	service    Service
+	socketPath string
+	socketMode os.FileMode
+	grpcServer *grpc.Server
+}
+
+var _ cnsv1.CNSServer = (*Server)(nil)
+
+// NewServer creates a gRPC server for the service which listens on socketPath, created with socketMode, once
+// started. Calls are only handled for callers the authorizer allows, if it is not nil.
+func NewServer(service Service, socketPath string, socketMode os.FileMode, authorizer *auth.Policy) *Server {
+	opts := []grpc.ServerOption{grpc.Creds(auth.NewTransportCredentials())}
+	if authorizer != nil {
+		opts = append(opts, grpc.UnaryInterceptor(authorizer.UnaryServerInterceptor(methodPaths)))
+	}
+
+	s := &Server{
+		service:    service,
+		socketPath: socketPath,
+		socketMode: socketMode,
+		grpcServer: grpc.NewServer(opts...),
+	}
+	cnsv1.RegisterCNSServer(s.grpcServer, s)
+	return s
+}
+
+// Start listens on the unix socket, replacing any socket left behind by a previous run, and serves in the background.
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.socketPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create socket directory for %s: %w", s.socketPath, err)
+	}
+
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", s.socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.socketPath, err)
+	}
+
+	if err := os.Chmod(s.socketPath, s.socketMode); err != nil {
+		listener.Close()
+		os.Remove(s.socketPath)
+		return fmt.Errorf("failed to set mode %v on %s: %w", s.socketMode, s.socketPath, err)
+	}
+
+	logger.Printf("[grpc] Listening on %s with mode %v", s.socketPath, s.socketMode)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			logger.Errorf("[grpc] Server stopped serving: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully stops the server and closes the socket.
+func (s *Server) Stop() {
+	s.grpcServer.GracefulStop()
+	logger.Printf("[grpc] Stopped listening on %s", s.socketPath)
+}
+
+func (s *Server) RequestIPAddress(ctx context.Context, in *cnsv1.IPConfigRequest) (*cnsv1.IPConfigResponse, error) {
+	req := ipConfigRequestFromProto(in)
+	resp, _ := s.service.RequestIPConfigInternal(req)
+	logger.ResponseEx("[grpc] RequestIPAddress", req, resp, resp.Response.ReturnCode, nil)
+	return ipConfigResponseToProto(resp), nil
+}
+
+func (s *Server) ReleaseIPAddress(ctx context.Context, in *cnsv1.IPConfigRequest) (*cnsv1.ReleaseIPAddressResponse, error) {
+	req := ipConfigRequestFromProto(in)
+	resp := s.service.ReleaseIPConfigInternal(req)
+	logger.ResponseEx("[grpc] ReleaseIPAddress", req, resp, resp.ReturnCode, nil)
+	return &cnsv1.ReleaseIPAddressResponse{Response: responseToProto(resp)}, nil
+}
+
+func (s *Server) GetIPAddressesMatchingStates(ctx context.Context, in *cnsv1.GetIPAddressesRequest) (*cnsv1.GetIPAddressesResponse, error) {
+	states := make([]cns.IPConfigState, len(in.GetIpConfigStateFilter()))
+	for i, state := range in.GetIpConfigStateFilter() {
+		states[i] = cns.IPConfigState(state)
+	}
+
+	resp := &cnsv1.GetIPAddressesResponse{Response: responseToProto(cns.Response{ReturnCode: types.Success})}
+	for _, status := range s.service.GetIPConfigsMatchingStates(states...) {
+		out, err := ipConfigurationStatusToProto(status)
+		if err != nil {
+			resp.IpConfigurationStatus = nil
+			resp.Response = responseToProto(cns.Response{ReturnCode: types.UnexpectedError, Message: err.Error()})
+			break
+		}
+		resp.IpConfigurationStatus = append(resp.IpConfigurationStatus, out)
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateOrUpdateNetworkContainer(ctx context.Context, in *cnsv1.CreateNetworkContainerRequest) (*cnsv1.CreateNetworkContainerResponse, error) {
+	req := createNetworkContainerRequestFromProto(in)
+	returnCode := s.service.CreateOrUpdateNetworkContainerInternal(req)
+	logger.ResponseEx("[grpc] CreateOrUpdateNetworkContainer", req, returnCode, returnCode, nil)
+	return &cnsv1.CreateNetworkContainerResponse{Response: responseToProto(cns.Response{ReturnCode: returnCode})}, nil
+}
+
+func (s *Server) GetNetworkContainer(ctx context.Context, in *cnsv1.GetNetworkContainerRequest) (*cnsv1.GetNetworkContainerResponse, error) {
+	req := cns.GetNetworkContainerRequest{
+		NetworkContainerid:  in.GetNetworkContainerId(),
+		OrchestratorContext: in.GetOrchestratorContext(),
+	}
+	resp, returnCode := s.service.GetNetworkContainerInternal(req)
+	logger.ResponseEx("[grpc] GetNetworkContainer", req, resp, returnCode, nil)
+	return getNetworkContainerResponseToProto(resp), nil
+}
+
+func (s *Server) DeleteNetworkContainer(ctx context.Context, in *cnsv1.DeleteNetworkContainerRequest) (*cnsv1.DeleteNetworkContainerResponse, error) {
+	req := cns.DeleteNetworkContainerRequest{NetworkContainerid: in.GetNetworkContainerId()}
+	returnCode := s.service.DeleteNetworkContainerInternal(req)
+	logger.ResponseEx("[grpc] DeleteNetworkContainer", req, returnCode, returnCode, nil)
+	return &cnsv1.DeleteNetworkContainerResponse{Response: responseToProto(cns.Response{ReturnCode: returnCode})}, nil
+}
@@ -0,0 +1,47 @@
+package cnsgrpc
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/auth"
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerAuthorizesPeerCredentials(t *testing.T) {
+	// the test process may request IPs but not release them
+	policy, err := auth.NewPolicy([]configuration.AuthPolicyRule{
+		{Identities: []string{"uid:" + strconv.Itoa(os.Getuid())}, Paths: []string{cns.RequestIPConfig}},
+	})
+	require.NoError(t, err)
+
+	service := &fakeService{}
+	socketPath := filepath.Join(t.TempDir(), "cns.sock")
+	server := NewServer(service, socketPath, 0o600, policy)
+	require.NoError(t, server.Start())
+	t.Cleanup(server.Stop)
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	client, err := NewClient(socketPath, 5*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = client.RequestIPAddress(newTestIPConfigRequest(t))
+	require.NoError(t, err)
+
+	err = client.ReleaseIPAddress(newTestIPConfigRequest(t))
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Empty(t, service.releasedRequests)
+}
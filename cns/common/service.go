@@ -5,6 +5,7 @@ package common
 
 import (
 	"errors"
+	"os"
 
 	"github.com/Azure/azure-container-networking/cns/logger"
 	acn "github.com/Azure/azure-container-networking/common"
@@ -38,8 +39,12 @@ type ServiceConfig struct {
 	Listener    *acn.Listener
 	ErrChan     chan<- error
 	Store       store.KeyValueStore
+	IPAMStore   store.IncrementalKeyValueStore
 	ChannelMode string
 	TlsSettings tls.TlsSettings
+	// UnixSocketPath is a unix socket to serve the API on alongside the listener's endpoint, when set.
+	UnixSocketPath string
+	UnixSocketMode os.FileMode
 }
 
 // NewService creates a new Service object.
@@ -3,9 +3,11 @@ package configuration
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -18,17 +20,26 @@ const (
 )
 
 type CNSConfig struct {
+	AuthSettings                AuthSettings
 	ChannelMode                 string
+	GRPCSettings                GRPCSettings
+	IPAMLeakDetectorSettings    IPAMLeakDetectorSettings
+	IPAMPoolMonitorSettings     IPAMPoolMonitorSettings
+	IPCooldownInSecs            int
+	IPRequestLimitSettings      IPRequestLimitSettings
 	InitializeFromCNI           bool
+	LogLevel                    string
 	ManagedSettings             ManagedSettings
 	MetricsBindAddress          string
 	SyncHostNCTimeoutMs         time.Duration
 	SyncHostNCVersionIntervalMs time.Duration
 	TLSCertificatePath          string
+	TLSClientCAPath             string
 	TLSEndpoint                 string
 	TLSPort                     string
 	TLSSubjectName              string
 	TelemetrySettings           TelemetrySettings
+	UnixSocketSettings          UnixSocketSettings
 	UseHTTPS                    bool
 	WireserverIP                string
 }
@@ -58,6 +69,99 @@ type TelemetrySettings struct {
 	SnapshotIntervalInMins int
 }
 
+const (
+	// ThresholdStrategy scales the pool when the free IP count crosses the static
+	// request/release thresholds derived from the NNC Scaler.
+	ThresholdStrategy = "Threshold"
+	// RateStrategy scales the pool ahead of demand based on the observed allocation rate.
+	RateStrategy = "Rate"
+)
+
+type IPAMPoolMonitorSettings struct {
+	// Scaling strategy used by the pool monitor, ThresholdStrategy (default) or RateStrategy.
+	ScalingStrategy string
+	// Sliding window over which the Rate strategy measures the IP allocation rate
+	RateWindowInSecs int
+	// How far ahead of the observed demand the Rate strategy requests IPs
+	RateLookaheadInSecs int
+	// How long free IPs must stay above the release threshold before the Rate strategy releases them
+	ReleaseHoldInSecs int
+	// How often the pool monitor reconciles the pool
+	RefreshIntervalInMs int
+}
+
+type IPAMLeakDetectorSettings struct {
+	// How often Allocated IPs are compared against the pods on the node
+	RefreshIntervalInSecs int
+	// How long an Allocated IP must stay without a pod before it is released
+	GracePeriodInSecs int
+	// Release suspected leaks once they are past the grace period. Without it they are only reported
+	EnableRelease bool
+}
+
+type IPRequestLimitSettings struct {
+	// How many IP requests are handled at once, 0 for no limit
+	MaxConcurrentRequests int
+	// How many IP requests may wait for one of the MaxConcurrentRequests to finish, before more are rejected
+	MaxQueuedRequests int
+	// How long IP requests wait for one of the MaxConcurrentRequests to finish, before they are rejected
+	QueueTimeoutInMs int
+	// How long callers are asked to wait before retrying rejected IP requests and requests which found no free IPs
+	RetryAfterInMs int
+}
+
+type GRPCSettings struct {
+	// Serve the gRPC API alongside the REST API
+	Enable bool
+	// Unix socket the gRPC API is served on
+	SocketPath string
+	// Octal file mode of the socket, which controls who can connect to it
+	FileMode string
+}
+
+// Mode returns the file mode of the socket.
+func (s GRPCSettings) Mode() (os.FileMode, error) {
+	return parseSocketFileMode(s.FileMode)
+}
+
+type UnixSocketSettings struct {
+	// Serve the REST API on a unix socket, alongside the TCP and TLS endpoints
+	Enable bool
+	// Unix socket the REST API is served on
+	SocketPath string
+	// Octal file mode of the socket, which controls who can connect to it
+	FileMode string
+}
+
+// Mode returns the file mode of the socket.
+func (s UnixSocketSettings) Mode() (os.FileMode, error) {
+	return parseSocketFileMode(s.FileMode)
+}
+
+func parseSocketFileMode(fileMode string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(fileMode, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("invalid unix socket file mode %q", fileMode) //nolint:goerr113
+	}
+	return os.FileMode(mode), nil
+}
+
+type AuthSettings struct {
+	// Only allow callers of the REST API to call the paths their identity is allowed by Policy
+	Enable bool
+	// Rules allowing callers to call paths. A call is allowed if any rule for the caller allows the path
+	Policy []AuthPolicyRule
+}
+
+type AuthPolicyRule struct {
+	// Callers the rule applies to: "uid:<uid>" or "gid:<gid>" for callers on a unix socket,
+	// "cert:<subject common name>" for callers with a client certificate, "anonymous" for any other caller,
+	// or "*" for all callers
+	Identities []string
+	// Paths the callers may call. A path ending with "*" allows all paths starting with it
+	Paths []string
+}
+
 type ManagedSettings struct {
 	PrivateEndpoint           string
 	InfrastructureNetworkID   string
@@ -65,21 +169,31 @@ type ManagedSettings struct {
 	NodeSyncIntervalInSeconds int
 }
 
-// This functions reads cns config file and save it in a structure
-func ReadConfig() (CNSConfig, error) {
-	var cnsConfig CNSConfig
-
+// ConfigPath returns the path of the cns config file, which is set by the CNS_CONFIGURATION_PATH env or
+// next to the CNS executable.
+func ConfigPath() (string, error) {
 	// Check if env set for config path otherwise use default path
 	configpath, found := os.LookupEnv("CNS_CONFIGURATION_PATH")
 	if !found {
 		dir, err := common.GetExecutableDirectory()
 		if err != nil {
 			logger.Errorf("[Configuration] Failed to find exe dir:%v", err)
-			return cnsConfig, err
+			return "", err
 		}
 
 		configpath = filepath.Join(dir, defaultConfigName)
 	}
+	return configpath, nil
+}
+
+// This functions reads cns config file and save it in a structure
+func ReadConfig() (CNSConfig, error) {
+	var cnsConfig CNSConfig
+
+	configpath, err := ConfigPath()
+	if err != nil {
+		return cnsConfig, err
+	}
 
 	logger.Printf("[Configuration] Config path:%s", configpath)
 
@@ -127,16 +241,86 @@ func setManagedSettingDefaults(managedSettings *ManagedSettings) {
 	}
 }
 
+// set ipam pool monitor setting defaults
+func setIPAMPoolMonitorSettingDefaults(poolMonitorSettings *IPAMPoolMonitorSettings) {
+	if poolMonitorSettings.ScalingStrategy == "" {
+		poolMonitorSettings.ScalingStrategy = ThresholdStrategy
+	}
+
+	if poolMonitorSettings.RateWindowInSecs == 0 {
+		poolMonitorSettings.RateWindowInSecs = 60
+	}
+
+	if poolMonitorSettings.RateLookaheadInSecs == 0 {
+		poolMonitorSettings.RateLookaheadInSecs = 30
+	}
+
+	if poolMonitorSettings.ReleaseHoldInSecs == 0 {
+		poolMonitorSettings.ReleaseHoldInSecs = 300
+	}
+
+	if poolMonitorSettings.RefreshIntervalInMs == 0 {
+		poolMonitorSettings.RefreshIntervalInMs = 1000
+	}
+}
+
+func setIPAMLeakDetectorSettingDefaults(leakDetectorSettings *IPAMLeakDetectorSettings) {
+	if leakDetectorSettings.RefreshIntervalInSecs == 0 {
+		leakDetectorSettings.RefreshIntervalInSecs = 60
+	}
+
+	if leakDetectorSettings.GracePeriodInSecs == 0 {
+		leakDetectorSettings.GracePeriodInSecs = 300
+	}
+}
+
+func setIPRequestLimitSettingDefaults(ipRequestLimitSettings *IPRequestLimitSettings) {
+	if ipRequestLimitSettings.QueueTimeoutInMs == 0 {
+		ipRequestLimitSettings.QueueTimeoutInMs = 5000
+	}
+
+	if ipRequestLimitSettings.RetryAfterInMs == 0 {
+		ipRequestLimitSettings.RetryAfterInMs = 1000
+	}
+}
+
+func setGRPCSettingDefaults(grpcSettings *GRPCSettings) {
+	if grpcSettings.SocketPath == "" {
+		grpcSettings.SocketPath = "/var/run/azure-cns/grpc.sock"
+	}
+	if grpcSettings.FileMode == "" {
+		grpcSettings.FileMode = "0660"
+	}
+}
+
+func setUnixSocketSettingDefaults(unixSocketSettings *UnixSocketSettings) {
+	if unixSocketSettings.SocketPath == "" {
+		unixSocketSettings.SocketPath = "/var/run/azure-cns/cns.sock"
+	}
+	if unixSocketSettings.FileMode == "" {
+		unixSocketSettings.FileMode = "0660"
+	}
+}
+
 // SetCNSConfigDefaults set default values of CNS config if not specified
 func SetCNSConfigDefaults(config *CNSConfig) {
 	setTelemetrySettingDefaults(&config.TelemetrySettings)
 	setManagedSettingDefaults(&config.ManagedSettings)
+	setIPAMPoolMonitorSettingDefaults(&config.IPAMPoolMonitorSettings)
+	setIPAMLeakDetectorSettingDefaults(&config.IPAMLeakDetectorSettings)
+	setIPRequestLimitSettingDefaults(&config.IPRequestLimitSettings)
+	setGRPCSettingDefaults(&config.GRPCSettings)
+	setUnixSocketSettingDefaults(&config.UnixSocketSettings)
 	if config.ChannelMode == "" {
 		config.ChannelMode = cns.Direct
 	}
 	if config.MetricsBindAddress == "" {
 		config.MetricsBindAddress = ":9090"
 	}
-	config.SyncHostNCVersionIntervalMs = 1000
-	config.SyncHostNCTimeoutMs = 500
+	if config.SyncHostNCVersionIntervalMs == 0 {
+		config.SyncHostNCVersionIntervalMs = 1000
+	}
+	if config.SyncHostNCTimeoutMs == 0 {
+		config.SyncHostNCTimeoutMs = 500
+	}
 }
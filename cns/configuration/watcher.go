@@ -0,0 +1,180 @@
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+// ReloadStatus is the result of the last reload of the cns config file.
+type ReloadStatus struct {
+	Path            string
+	LastReloadTime  time.Time
+	LastReloadError string
+	// Top level settings which changed in the config file, but only take effect when CNS restarts
+	RestartRequired []string
+}
+
+// Watcher watches the cns config file and applies the settings which can change while CNS is running:
+// the log level, the telemetry toggles, the SyncHostNCVersion interval and timeout and the pool monitor
+// refresh interval. Other settings in the file are ignored until CNS restarts.
+type Watcher struct {
+	path string
+
+	mu       sync.RWMutex
+	active   CNSConfig
+	content  []byte
+	status   ReloadStatus
+	handlers []func(CNSConfig)
+}
+
+// NewWatcher creates a watcher of the config file at path, for CNS started with the active config.
+func NewWatcher(path string, active CNSConfig) *Watcher {
+	w := &Watcher{
+		path:   path,
+		active: active,
+		status: ReloadStatus{Path: path},
+	}
+	// the file was read when CNS started, so the current content is not a change
+	if content, err := ioutil.ReadFile(path); err == nil {
+		w.content = content
+	}
+	return w
+}
+
+// Active returns the config CNS is running with.
+func (w *Watcher) Active() CNSConfig {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.active
+}
+
+// Status returns the result of the last reload.
+func (w *Watcher) Status() ReloadStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status
+}
+
+// OnReload registers handler to be called with the active config when a reload changes it.
+func (w *Watcher) OnReload(handler func(CNSConfig)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, handler)
+}
+
+// Start checks the config file for changes every interval, until ctx is done.
+func (w *Watcher) Start(ctx context.Context, interval time.Duration) {
+	logger.Printf("[Configuration] Watching config file %s for changes", w.path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Reload(); err != nil {
+				logger.Errorf("[Configuration] Failed to reload config file %s: %v", w.path, err)
+			}
+		}
+	}
+}
+
+// Reload reads the config file and applies the settings which can change while CNS is running, if the file
+// changed since it was last read. An invalid file is not applied, and it is not retried until it changes again.
+func (w *Watcher) Reload() error {
+	content, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read config file")
+	}
+
+	w.mu.Lock()
+	if bytes.Equal(content, w.content) {
+		w.mu.Unlock()
+		return nil
+	}
+	w.content = content
+	w.status.LastReloadTime = time.Now()
+
+	next, err := parseConfig(content)
+	if err != nil {
+		w.status.LastReloadError = err.Error()
+		w.mu.Unlock()
+		return err
+	}
+
+	active, restartRequired := applyReloadable(w.active, next)
+	changed := !reflect.DeepEqual(active, w.active)
+	w.active = active
+	w.status.LastReloadError = ""
+	w.status.RestartRequired = restartRequired
+	handlers := append([]func(CNSConfig){}, w.handlers...)
+	w.mu.Unlock()
+
+	if len(restartRequired) > 0 {
+		logger.Printf("[Configuration] Changes to %v only take effect when CNS restarts", restartRequired)
+	}
+	if !changed {
+		return nil
+	}
+
+	logger.Printf("[Configuration] Reloaded config :%+v", active)
+	for _, handler := range handlers {
+		handler(active)
+	}
+	return nil
+}
+
+// parseConfig parses the content of a config file, and validates the settings which can change while CNS is
+// running.
+func parseConfig(content []byte) (CNSConfig, error) {
+	var config CNSConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, errors.Wrap(err, "failed to parse config file")
+	}
+	SetCNSConfigDefaults(&config)
+
+	switch config.LogLevel {
+	case "", common.OptLogLevelInfo, common.OptLogLevelDebug:
+	default:
+		return config, fmt.Errorf("invalid LogLevel %q, must be %s or %s", config.LogLevel, common.OptLogLevelInfo, common.OptLogLevelDebug) //nolint:goerr113
+	}
+	if config.SyncHostNCVersionIntervalMs < 0 || config.SyncHostNCTimeoutMs < 0 {
+		return config, errors.New("SyncHostNCVersionIntervalMs and SyncHostNCTimeoutMs must be positive")
+	}
+	if config.IPAMPoolMonitorSettings.RefreshIntervalInMs < 0 {
+		return config, errors.New("IPAMPoolMonitorSettings.RefreshIntervalInMs must be positive")
+	}
+	return config, nil
+}
+
+// applyReloadable copies the settings which can change while CNS is running from next to active. It returns the
+// new active config and the names of the top level settings which differ in next, but only take effect when CNS
+// restarts.
+func applyReloadable(active, next CNSConfig) (CNSConfig, []string) {
+	active.LogLevel = next.LogLevel
+	active.SyncHostNCVersionIntervalMs = next.SyncHostNCVersionIntervalMs
+	active.SyncHostNCTimeoutMs = next.SyncHostNCTimeoutMs
+	active.TelemetrySettings.DisableTrace = next.TelemetrySettings.DisableTrace
+	active.TelemetrySettings.DisableMetric = next.TelemetrySettings.DisableMetric
+	active.TelemetrySettings.DisableEvent = next.TelemetrySettings.DisableEvent
+	active.IPAMPoolMonitorSettings.RefreshIntervalInMs = next.IPAMPoolMonitorSettings.RefreshIntervalInMs
+
+	var restartRequired []string
+	activeValue, nextValue := reflect.ValueOf(active), reflect.ValueOf(next)
+	for i := 0; i < activeValue.NumField(); i++ {
+		if !reflect.DeepEqual(activeValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			restartRequired = append(restartRequired, activeValue.Type().Field(i).Name)
+		}
+	}
+	return active, restartRequired
+}
@@ -0,0 +1,155 @@
+package configuration
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+}
+
+func newTestWatcher(t *testing.T, content string) (*Watcher, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), defaultConfigName)
+	writeConfig(t, path, content)
+
+	active, err := parseConfig([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	return NewWatcher(path, active), path
+}
+
+func TestWatcherAppliesReloadableSettings(t *testing.T) {
+	w, path := newTestWatcher(t, `{"ChannelMode": "CRD", "SyncHostNCVersionIntervalMs": 1000}`)
+
+	var reloaded []CNSConfig
+	w.OnReload(func(config CNSConfig) {
+		reloaded = append(reloaded, config)
+	})
+
+	// the file CNS started with is not a change
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Expected no error reloading unchanged config, got %v", err)
+	}
+	if len(reloaded) != 0 {
+		t.Fatalf("Expected no reload of unchanged config, got %+v", reloaded)
+	}
+
+	writeConfig(t, path, `{
+		"ChannelMode": "Direct",
+		"LogLevel": "debug",
+		"SyncHostNCVersionIntervalMs": 5000,
+		"TelemetrySettings": {"DisableTrace": true, "HeartBeatIntervalInMins": 5},
+		"IPAMPoolMonitorSettings": {"RefreshIntervalInMs": 250}
+	}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Expected no error reloading config, got %v", err)
+	}
+	if len(reloaded) != 1 {
+		t.Fatalf("Expected one reload, got %+v", reloaded)
+	}
+
+	active := w.Active()
+	if !reflect.DeepEqual(reloaded[0], active) {
+		t.Fatalf("Expected handler to be called with the active config %+v, got %+v", active, reloaded[0])
+	}
+	if active.LogLevel != "debug" || active.SyncHostNCVersionIntervalMs != 5000 ||
+		!active.TelemetrySettings.DisableTrace || active.IPAMPoolMonitorSettings.RefreshIntervalInMs != 250 {
+		t.Fatalf("Expected reloadable settings to be applied, got %+v", active)
+	}
+	// settings which need a restart keep the values CNS started with
+	if active.ChannelMode != cns.CRD || active.TelemetrySettings.HeartBeatIntervalInMins != 30 {
+		t.Fatalf("Expected ChannelMode and HeartBeatIntervalInMins not to change, got %+v", active)
+	}
+
+	status := w.Status()
+	if status.Path != path || status.LastReloadTime.IsZero() || status.LastReloadError != "" {
+		t.Fatalf("Unexpected reload status %+v", status)
+	}
+	if !reflect.DeepEqual(status.RestartRequired, []string{"ChannelMode", "TelemetrySettings"}) {
+		t.Fatalf("Expected ChannelMode and TelemetrySettings to require a restart, got %v", status.RestartRequired)
+	}
+}
+
+func TestWatcherRejectsInvalidConfig(t *testing.T) {
+	w, path := newTestWatcher(t, `{"SyncHostNCVersionIntervalMs": 1000}`)
+	started := w.Active()
+
+	reloads := 0
+	w.OnReload(func(CNSConfig) {
+		reloads++
+	})
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not json", content: `{"SyncHostNCVersionIntervalMs": `},
+		{name: "unknown log level", content: `{"LogLevel": "verbose"}`},
+		{name: "negative interval", content: `{"SyncHostNCVersionIntervalMs": -1}`},
+		{name: "negative pool monitor refresh", content: `{"IPAMPoolMonitorSettings": {"RefreshIntervalInMs": -1}}`},
+	}
+	for _, tt := range tests {
+		writeConfig(t, path, tt.content)
+		if err := w.Reload(); err == nil {
+			t.Fatalf("%s: expected error reloading invalid config", tt.name)
+		}
+		if w.Status().LastReloadError == "" {
+			t.Fatalf("%s: expected the reload error in the status", tt.name)
+		}
+		// an invalid file is not retried until it changes
+		if err := w.Reload(); err != nil {
+			t.Fatalf("%s: expected unchanged invalid config to be skipped, got %v", tt.name, err)
+		}
+	}
+
+	if reloads != 0 || !reflect.DeepEqual(started, w.Active()) {
+		t.Fatalf("Expected invalid configs not to be applied, got %d reloads and %+v", reloads, w.Active())
+	}
+
+	writeConfig(t, path, `{"SyncHostNCVersionIntervalMs": 2000}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Expected no error reloading valid config, got %v", err)
+	}
+	if reloads != 1 || w.Active().SyncHostNCVersionIntervalMs != 2000 || w.Status().LastReloadError != "" {
+		t.Fatalf("Expected valid config to be applied, got %d reloads and %+v", reloads, w.Status())
+	}
+}
+
+func TestWatcherStart(t *testing.T) {
+	w, path := newTestWatcher(t, `{"SyncHostNCTimeoutMs": 500}`)
+	reloaded := make(chan CNSConfig, 1)
+	w.OnReload(func(config CNSConfig) {
+		reloaded <- config
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Start(ctx, 10*time.Millisecond)
+
+	writeConfig(t, path, `{"SyncHostNCTimeoutMs": 100}`)
+	select {
+	case config := <-reloaded:
+		if config.SyncHostNCTimeoutMs != 100 {
+			t.Fatalf("Expected SyncHostNCTimeoutMs to be reloaded, got %+v", config)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the config file change to be reloaded")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -62,6 +63,7 @@ type IPStateManager struct {
 	AvailableIPConfigState      map[string]cns.IPConfigurationStatus
 	AllocatedIPConfigState      map[string]cns.IPConfigurationStatus
 	PendingReleaseIPConfigState map[string]cns.IPConfigurationStatus
+	CooldownIPConfigState       map[string]cns.IPConfigurationStatus
 	AvailableIPIDStack          StringStack
 	sync.RWMutex
 }
@@ -72,6 +74,7 @@ func NewIPStateManager() IPStateManager {
 		AvailableIPConfigState:      make(map[string]cns.IPConfigurationStatus),
 		AllocatedIPConfigState:      make(map[string]cns.IPConfigurationStatus),
 		PendingReleaseIPConfigState: make(map[string]cns.IPConfigurationStatus),
+		CooldownIPConfigState:       make(map[string]cns.IPConfigurationStatus),
 		AvailableIPIDStack:          StringStack{},
 	}
 }
@@ -90,6 +93,8 @@ func (ipm *IPStateManager) AddIPConfigs(ipconfigs []cns.IPConfigurationStatus) {
 			ipm.AllocatedIPConfigState[ipconfig.ID] = ipconfig
 		case cns.PendingRelease:
 			ipm.PendingReleaseIPConfigState[ipconfig.ID] = ipconfig
+		case cns.Cooldown:
+			ipm.CooldownIPConfigState[ipconfig.ID] = ipconfig
 		}
 	}
 }
@@ -249,6 +254,14 @@ func (fake *HTTPServiceFake) GetPendingReleaseIPConfigs() []cns.IPConfigurationS
 	return ipconfigs
 }
 
+func (fake *HTTPServiceFake) GetCooldownIPConfigs() []cns.IPConfigurationStatus {
+	ipconfigs := []cns.IPConfigurationStatus{}
+	for _, ipconfig := range fake.IPStateManager.CooldownIPConfigState {
+		ipconfigs = append(ipconfigs, ipconfig)
+	}
+	return ipconfigs
+}
+
 // Return union of all state maps
 func (fake *HTTPServiceFake) GetPodIPConfigState() map[string]cns.IPConfigurationStatus {
 	ipconfigs := make(map[string]cns.IPConfigurationStatus)
@@ -261,14 +274,31 @@ func (fake *HTTPServiceFake) GetPodIPConfigState() map[string]cns.IPConfiguratio
 	for key, val := range fake.IPStateManager.PendingReleaseIPConfigState {
 		ipconfigs[key] = val
 	}
+	for key, val := range fake.IPStateManager.CooldownIPConfigState {
+		ipconfigs[key] = val
+	}
 	return ipconfigs
 }
 
+// The fake has a single subnet, so all of its NCs are in the default subnet.
+func (fake *HTTPServiceFake) GetDefaultSubnetNCIDs() map[string]struct{} {
+	return nil
+}
+
 // TODO: Populate on scale down
 func (fake *HTTPServiceFake) MarkIPAsPendingRelease(numberToMark int) (map[string]cns.IPConfigurationStatus, error) {
 	return fake.IPStateManager.MarkIPAsPendingRelease(numberToMark)
 }
 
+func (fake *HTTPServiceFake) ReleaseLeakedIPConfig(leaked cns.IPConfigurationStatus) error {
+	ipconfig, ok := fake.IPStateManager.AllocatedIPConfigState[leaked.ID]
+	if !ok || ipconfig.PodInfo == nil || leaked.PodInfo == nil || ipconfig.PodInfo.Key() != leaked.PodInfo.Key() {
+		return fmt.Errorf("ipconfig %s is no longer allocated to pod %+v", leaked.ID, leaked.PodInfo)
+	}
+	_, err := fake.IPStateManager.ReleaseIPConfig(leaked.ID)
+	return err
+}
+
 func (fake *HTTPServiceFake) GetOption(string) interface{} {
 	return nil
 }
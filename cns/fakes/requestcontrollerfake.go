@@ -16,6 +16,7 @@ type RequestControllerFake struct {
 	fakecns   *HTTPServiceFake
 	cachedCRD v1alpha.NodeNetworkConfig
 	ip        net.IP
+	StatusReporterFake
 }
 
 func NewRequestControllerFake(cnsService *HTTPServiceFake, scalar v1alpha.Scaler, subnetAddressSpace string, numberOfIPConfigs int) *RequestControllerFake {
@@ -79,6 +80,10 @@ func (rc *RequestControllerFake) IsStarted() bool {
 	return true
 }
 
+func (rc *RequestControllerFake) GetNodeNetworkConfig(context.Context) (*v1alpha.NodeNetworkConfig, error) {
+	return rc.cachedCRD.DeepCopy(), nil
+}
+
 func (rc *RequestControllerFake) UpdateCRDSpec(_ context.Context, desiredSpec v1alpha.NodeNetworkConfigSpec) error {
 	rc.cachedCRD.Spec = desiredSpec
 	return nil
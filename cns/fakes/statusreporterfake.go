@@ -0,0 +1,54 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/cns/singletenantcontroller"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ singletenantcontroller.StatusReporter = (*StatusReporterFake)(nil)
+
+// StatusReporterFake keeps the conditions and pod Events reported to it.
+type StatusReporterFake struct {
+	sync.Mutex
+	Conditions []metav1.Condition
+	PodEvents  []PodEventFake
+}
+
+// PodEventFake is an Event recorded on a pod.
+type PodEventFake struct {
+	PodName      string
+	PodNamespace string
+	EventType    string
+	Reason       string
+	Message      string
+}
+
+func (s *StatusReporterFake) SetCondition(_ context.Context, condition metav1.Condition) error {
+	s.Lock()
+	defer s.Unlock()
+	meta.SetStatusCondition(&s.Conditions, condition)
+	return nil
+}
+
+// Condition returns the condition of the type, or nil if it was not set.
+func (s *StatusReporterFake) Condition(conditionType string) *metav1.Condition {
+	s.Lock()
+	defer s.Unlock()
+	return meta.FindStatusCondition(s.Conditions, conditionType)
+}
+
+func (s *StatusReporterFake) RecordPodEvent(podName, podNamespace, eventType, reason, message string) {
+	s.Lock()
+	defer s.Unlock()
+	s.PodEvents = append(s.PodEvents, PodEventFake{
+		PodName:      podName,
+		PodNamespace: podNamespace,
+		EventType:    eventType,
+		Reason:       reason,
+		Message:      message,
+	})
+}
@@ -13,6 +13,8 @@ var (
 	StatePendingProgramming = ipConfigStatePredicate(cns.PendingProgramming)
 	// StatePendingRelease is a preset filter for cns.PendingRelease.
 	StatePendingRelease = ipConfigStatePredicate(cns.PendingRelease)
+	// StateCooldown is a preset filter for cns.Cooldown.
+	StateCooldown = ipConfigStatePredicate(cns.Cooldown)
 )
 
 var filters = map[cns.IPConfigState]IPConfigStatePredicate{
@@ -20,6 +22,7 @@ var filters = map[cns.IPConfigState]IPConfigStatePredicate{
 	cns.Available:          StateAvailable,
 	cns.PendingProgramming: StatePendingProgramming,
 	cns.PendingRelease:     StatePendingRelease,
+	cns.Cooldown:           StateCooldown,
 }
 
 // ipConfigStatePredicate returns a predicate function that compares an IPConfigurationStatus.State to
@@ -8,8 +8,8 @@ import (
 )
 
 const (
-	hostQueryURL                     = "http://168.63.129.16/machine/plugins?comp=nmagent&type=getinterfaceinfov1"
-	hostQueryURLForProgrammedVersion = "http://168.63.129.16/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/%s/networkContainers/%s/authenticationToken/%s/api-version/%s"
+	hostQueryURLFmt                     = "http://%s/machine/plugins?comp=nmagent&type=getinterfaceinfov1"
+	hostQueryURLForProgrammedVersionFmt = "http://%s/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/%s/networkContainers/%s/authenticationToken/%s/api-version/%s"
 )
 
 // ImdsClient can be used to connect to VM Host agent in Azure.
@@ -12,13 +12,14 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/nmagentclient"
 )
 
 // GetNetworkContainerInfoFromHost retrieves the programmed version of network container from Host.
 func (imdsClient *ImdsClient) GetNetworkContainerInfoFromHost(networkContainerID string, primaryAddress string, authToken string, apiVersion string) (*ContainerVersion, error) {
 	logger.Printf("[Azure CNS] GetNetworkContainerInfoFromHost")
-	queryURL := fmt.Sprintf(hostQueryURLForProgrammedVersion,
-		primaryAddress, networkContainerID, authToken, apiVersion)
+	queryURL := fmt.Sprintf(hostQueryURLForProgrammedVersionFmt,
+		nmagentclient.WireserverIP, primaryAddress, networkContainerID, authToken, apiVersion)
 
 	logger.Printf("[Azure CNS] Going to query Azure Host for container version @\n %v\n", queryURL)
 	jsonResponse, err := http.Get(queryURL)
@@ -49,7 +50,7 @@ func (imdsClient *ImdsClient) GetPrimaryInterfaceInfoFromHost() (*InterfaceInfo,
 	logger.Printf("[Azure CNS] GetPrimaryInterfaceInfoFromHost")
 
 	interfaceInfo := &InterfaceInfo{}
-	resp, err := http.Get(hostQueryURL)
+	resp, err := http.Get(fmt.Sprintf(hostQueryURLFmt, nmagentclient.WireserverIP))
 	if err != nil {
 		return nil, err
 	}
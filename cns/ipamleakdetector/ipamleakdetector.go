@@ -0,0 +1,155 @@
+package ipamleakdetector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+)
+
+// IPAMLeakDetector periodically compares the Allocated IPs in CNS against the pods known to a
+// PodInfoByIPProvider. An Allocated IP whose pod is not found is suspected leaked, and is released
+// once it has stayed orphaned for the grace period. The grace period covers pods which have an IP
+// allocated but are not yet visible to the provider, such as pods whose status has not been updated.
+type IPAMLeakDetector struct {
+	httpService     cns.HTTPService
+	podInfoProvider cns.PodInfoByIPProvider
+	gracePeriod     time.Duration
+	dryRun          bool
+	now             func() time.Time
+	mu              sync.RWMutex
+	// suspectedLeaks is keyed by IP config ID
+	suspectedLeaks    map[string]cns.SuspectedIPLeak
+	lastReconcileTime time.Time
+	releasedIPCount   int
+}
+
+// NewIPAMLeakDetector creates a leak detector which releases IPs orphaned for longer than gracePeriod.
+// If dryRun is set, suspected leaks are only reported and never released.
+func NewIPAMLeakDetector(httpService cns.HTTPService, podInfoProvider cns.PodInfoByIPProvider, gracePeriod time.Duration, dryRun bool) *IPAMLeakDetector {
+	logger.Printf("NewIPAMLeakDetector: Create IPAM Leak Detector")
+	return &IPAMLeakDetector{
+		httpService:     httpService,
+		podInfoProvider: podInfoProvider,
+		gracePeriod:     gracePeriod,
+		dryRun:          dryRun,
+		now:             time.Now,
+		suspectedLeaks:  make(map[string]cns.SuspectedIPLeak),
+	}
+}
+
+func (ld *IPAMLeakDetector) Start(ctx context.Context, leakDetectorRefreshMilliseconds int) error {
+	logger.Printf("[ipam-leak-detector] Starting CNS IPAM Leak Detector")
+
+	ticker := time.NewTicker(time.Duration(leakDetectorRefreshMilliseconds) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("[ipam-leak-detector] CNS IPAM Leak Detector received cancellation signal")
+		case <-ticker.C:
+			if err := ld.Reconcile(ctx); err != nil {
+				ipamLeakDetectorFailures.Inc()
+				logger.Errorf("[ipam-leak-detector] Reconcile failed with err %v", err)
+			}
+		}
+	}
+}
+
+// Reconcile updates the suspected leaks and releases the ones past the grace period.
+func (ld *IPAMLeakDetector) Reconcile(ctx context.Context) error {
+	// IPs allocated after the pods are listed look orphaned until the next round, which the grace period covers
+	podInfoByIP, err := ld.podInfoProvider.PodInfoByIP(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get pods from provider: %w", err)
+	}
+
+	// a pod can hold IPs which the provider doesn't key it by, such as the IPv6 IP of a dual-stack pod,
+	// so an IP is only orphaned if neither the IP nor its pod is known
+	livePods := make(map[string]struct{}, len(podInfoByIP))
+	for _, podInfo := range podInfoByIP {
+		livePods[podKey(podInfo)] = struct{}{}
+	}
+
+	now := ld.now()
+	allocated := ld.httpService.GetAllocatedIPConfigs()
+
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	suspectedLeaks := make(map[string]cns.SuspectedIPLeak)
+	var expired []cns.IPConfigurationStatus
+	for _, ipconfig := range allocated {
+		if ipconfig.PodInfo == nil {
+			continue
+		}
+		if _, ok := podInfoByIP[ipconfig.IPAddress]; ok {
+			continue
+		}
+		if _, ok := livePods[podKey(ipconfig.PodInfo)]; ok {
+			continue
+		}
+
+		leak, ok := ld.suspectedLeaks[ipconfig.ID]
+		if !ok || leak.IPConfig.PodInfo.Key() != ipconfig.PodInfo.Key() {
+			logger.Printf("[ipam-leak-detector] IP %s allocated to pod %s is suspected leaked", ipconfig.IPAddress, ipconfig.PodInfo.Key())
+			leak = cns.SuspectedIPLeak{FirstSeen: now}
+		}
+		leak.IPConfig = ipconfig
+		suspectedLeaks[ipconfig.ID] = leak
+
+		if !ld.dryRun && now.Sub(leak.FirstSeen) >= ld.gracePeriod {
+			expired = append(expired, ipconfig)
+		}
+	}
+
+	for _, ipconfig := range expired {
+		if err := ld.httpService.ReleaseLeakedIPConfig(ipconfig); err != nil {
+			logger.Errorf("[ipam-leak-detector] Failed to release leaked IP %s: %v", ipconfig.IPAddress, err)
+			continue
+		}
+		logger.Printf("[ipam-leak-detector] Released leaked IP %s allocated to pod %s", ipconfig.IPAddress, ipconfig.PodInfo.Key())
+		delete(suspectedLeaks, ipconfig.ID)
+		ld.releasedIPCount++
+		ipamReleasedLeakedIPCount.Inc()
+	}
+
+	ld.suspectedLeaks = suspectedLeaks
+	ld.lastReconcileTime = now
+	ipamSuspectedLeakedIPCount.Set(float64(len(suspectedLeaks)))
+
+	return nil
+}
+
+// GetStateSnapshot returns the suspected leaks sorted by the order they were first seen.
+func (ld *IPAMLeakDetector) GetStateSnapshot() cns.IPAMLeakDetectorStateSnapshot {
+	ld.mu.RLock()
+	defer ld.mu.RUnlock()
+
+	suspectedLeaks := make([]cns.SuspectedIPLeak, 0, len(ld.suspectedLeaks))
+	for _, leak := range ld.suspectedLeaks {
+		suspectedLeaks = append(suspectedLeaks, leak)
+	}
+	sort.Slice(suspectedLeaks, func(i, j int) bool {
+		if suspectedLeaks[i].FirstSeen.Equal(suspectedLeaks[j].FirstSeen) {
+			return suspectedLeaks[i].IPConfig.IPAddress < suspectedLeaks[j].IPConfig.IPAddress
+		}
+		return suspectedLeaks[i].FirstSeen.Before(suspectedLeaks[j].FirstSeen)
+	})
+
+	return cns.IPAMLeakDetectorStateSnapshot{
+		LastReconcileTime: ld.lastReconcileTime,
+		GracePeriod:       ld.gracePeriod,
+		SuspectedLeaks:    suspectedLeaks,
+		ReleasedIPCount:   ld.releasedIPCount,
+	}
+}
+
+func podKey(podInfo cns.PodInfo) string {
+	return podInfo.Namespace() + "/" + podInfo.Name()
+}
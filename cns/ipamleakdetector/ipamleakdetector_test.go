@@ -0,0 +1,131 @@
+package ipamleakdetector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/fakes"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gracePeriod = 5 * time.Minute
+
+var (
+	liveV4 = cns.IPConfigurationStatus{
+		ID:        "live-v4",
+		IPAddress: "10.0.0.1",
+		State:     cns.Allocated,
+		PodInfo:   cns.NewPodInfo("live-infra", "live-eth0", "live", "default"),
+	}
+	liveV6 = cns.IPConfigurationStatus{
+		ID:        "live-v6",
+		IPAddress: "fd00::1",
+		State:     cns.Allocated,
+		PodInfo:   cns.NewPodInfo("live-infra", "live-eth0", "live", "default"),
+	}
+	orphan = cns.IPConfigurationStatus{
+		ID:        "orphan",
+		IPAddress: "10.0.0.2",
+		State:     cns.Allocated,
+		PodInfo:   cns.NewPodInfo("orphan-infra", "orphan-eth0", "orphan", "default"),
+	}
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+}
+
+func newTestLeakDetector(t *testing.T, dryRun bool) (*IPAMLeakDetector, *fakes.HTTPServiceFake, *time.Time) {
+	t.Helper()
+
+	fakecns := fakes.NewHTTPServiceFake()
+	fakecns.IPStateManager.AddIPConfigs([]cns.IPConfigurationStatus{liveV4, liveV6, orphan})
+
+	// only the v4 IP of the live pod is known to the provider, as with the apiserver and CNI providers
+	provider := cns.PodInfoByIPProviderFunc(func(context.Context) (map[string]cns.PodInfo, error) {
+		return map[string]cns.PodInfo{
+			liveV4.IPAddress: cns.NewPodInfo("", "", "live", "default"),
+		}, nil
+	})
+
+	now := time.Now()
+	ld := NewIPAMLeakDetector(fakecns, provider, gracePeriod, dryRun)
+	ld.now = func() time.Time { return now }
+	return ld, fakecns, &now
+}
+
+func TestReconcileReleasesLeakAfterGracePeriod(t *testing.T) {
+	ld, fakecns, now := newTestLeakDetector(t, false)
+
+	require.NoError(t, ld.Reconcile(context.Background()))
+	snapshot := ld.GetStateSnapshot()
+	require.Len(t, snapshot.SuspectedLeaks, 1)
+	assert.Equal(t, orphan.ID, snapshot.SuspectedLeaks[0].IPConfig.ID)
+	assert.Equal(t, *now, snapshot.SuspectedLeaks[0].FirstSeen)
+	assert.Len(t, fakecns.GetAllocatedIPConfigs(), 3, "IP released before the grace period")
+
+	*now = now.Add(gracePeriod / 2)
+	require.NoError(t, ld.Reconcile(context.Background()))
+	assert.Len(t, fakecns.GetAllocatedIPConfigs(), 3, "IP released before the grace period")
+
+	*now = now.Add(gracePeriod / 2)
+	require.NoError(t, ld.Reconcile(context.Background()))
+	assert.Len(t, fakecns.GetAllocatedIPConfigs(), 2)
+	assert.Contains(t, fakecns.IPStateManager.AvailableIPConfigState, orphan.ID)
+
+	snapshot = ld.GetStateSnapshot()
+	assert.Empty(t, snapshot.SuspectedLeaks)
+	assert.Equal(t, 1, snapshot.ReleasedIPCount)
+}
+
+func TestReconcileDryRunDoesNotRelease(t *testing.T) {
+	ld, fakecns, now := newTestLeakDetector(t, true)
+
+	require.NoError(t, ld.Reconcile(context.Background()))
+	*now = now.Add(2 * gracePeriod)
+	require.NoError(t, ld.Reconcile(context.Background()))
+
+	assert.Len(t, fakecns.GetAllocatedIPConfigs(), 3)
+	snapshot := ld.GetStateSnapshot()
+	assert.Len(t, snapshot.SuspectedLeaks, 1)
+	assert.Equal(t, 0, snapshot.ReleasedIPCount)
+}
+
+func TestReconcileResetsGracePeriodWhenIPIsReallocated(t *testing.T) {
+	ld, fakecns, now := newTestLeakDetector(t, false)
+
+	require.NoError(t, ld.Reconcile(context.Background()))
+
+	// the orphaned IP is released and allocated to another missing pod in between reconciles
+	reallocated := orphan
+	reallocated.PodInfo = cns.NewPodInfo("new-infra", "new-eth0", "new", "default")
+	fakecns.IPStateManager.AllocatedIPConfigState[orphan.ID] = reallocated
+
+	*now = now.Add(gracePeriod)
+	require.NoError(t, ld.Reconcile(context.Background()))
+	assert.Len(t, fakecns.GetAllocatedIPConfigs(), 3, "reallocated IP released before its own grace period")
+
+	snapshot := ld.GetStateSnapshot()
+	require.Len(t, snapshot.SuspectedLeaks, 1)
+	assert.Equal(t, *now, snapshot.SuspectedLeaks[0].FirstSeen)
+}
+
+func TestReconcileForgetsLeakWhenPodAppears(t *testing.T) {
+	ld, _, _ := newTestLeakDetector(t, false)
+
+	require.NoError(t, ld.Reconcile(context.Background()))
+	require.Len(t, ld.GetStateSnapshot().SuspectedLeaks, 1)
+
+	ld.podInfoProvider = cns.PodInfoByIPProviderFunc(func(context.Context) (map[string]cns.PodInfo, error) {
+		return map[string]cns.PodInfo{
+			liveV4.IPAddress: cns.NewPodInfo("", "", "live", "default"),
+			orphan.IPAddress: cns.NewPodInfo("", "", "orphan", "default"),
+		}, nil
+	})
+	require.NoError(t, ld.Reconcile(context.Background()))
+	assert.Empty(t, ld.GetStateSnapshot().SuspectedLeaks)
+}
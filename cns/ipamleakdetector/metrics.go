@@ -0,0 +1,35 @@
+package ipamleakdetector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	ipamSuspectedLeakedIPCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ipam_suspected_leaked_ips",
+			Help: "Allocated IP count whose pod was not found.",
+		},
+	)
+	ipamReleasedLeakedIPCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ipam_released_leaked_ips_total",
+			Help: "Leaked IP count released after the grace period.",
+		},
+	)
+	ipamLeakDetectorFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ipam_leak_detector_failures_total",
+			Help: "Leak detector reconcile failure count.",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ipamSuspectedLeakedIPCount,
+		ipamReleasedLeakedIPCount,
+		ipamLeakDetectorFailures,
+	)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/metric"
 	"github.com/Azure/azure-container-networking/cns/singletenantcontroller"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const defaultMaxIPCount = int64(250)
@@ -22,27 +23,53 @@ type CNSIPAMPoolMonitor struct {
 	httpService              cns.HTTPService
 	mu                       sync.RWMutex
 	rc                       singletenantcontroller.RequestController
+	refreshInterval          time.Duration
+	refreshIntervalChanged   chan struct{}
 	scalarUnits              v1alpha.Scaler
+	strategy                 ScalingStrategy
 	updatingIpsNotInUseCount int
 }
 
-func NewCNSIPAMPoolMonitor(httpService cns.HTTPService, rc singletenantcontroller.RequestController) *CNSIPAMPoolMonitor {
+// NewCNSIPAMPoolMonitor creates a pool monitor which scales using the passed ScalingStrategy.
+// If strategy is nil, the default threshold strategy is used.
+func NewCNSIPAMPoolMonitor(httpService cns.HTTPService, rc singletenantcontroller.RequestController, strategy ScalingStrategy) *CNSIPAMPoolMonitor {
 	logger.Printf("NewCNSIPAMPoolMonitor: Create IPAM Pool Monitor")
+	if strategy == nil {
+		strategy = NewThresholdScalingStrategy()
+	}
 	return &CNSIPAMPoolMonitor{
-		httpService: httpService,
-		rc:          rc,
+		httpService:            httpService,
+		rc:                     rc,
+		strategy:               strategy,
+		refreshIntervalChanged: make(chan struct{}, 1),
 	}
 }
 
+// Start reconciles the pool every poolMonitorRefreshMilliseconds, or at the interval set by SetRefreshInterval,
+// until ctx is done.
 func (pm *CNSIPAMPoolMonitor) Start(ctx context.Context, poolMonitorRefreshMilliseconds int) error {
 	logger.Printf("[ipam-pool-monitor] Starting CNS IPAM Pool Monitor")
 
-	ticker := time.NewTicker(time.Duration(poolMonitorRefreshMilliseconds) * time.Millisecond)
+	pm.mu.Lock()
+	if pm.refreshInterval == 0 {
+		pm.refreshInterval = time.Duration(poolMonitorRefreshMilliseconds) * time.Millisecond
+	}
+	interval := pm.refreshInterval
+	pm.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("[ipam-pool-monitor] CNS IPAM Pool Monitor received cancellation signal")
+		case <-pm.refreshIntervalChanged:
+			if next := pm.getRefreshInterval(); next != interval {
+				logger.Printf("[ipam-pool-monitor] Changing refresh interval from %v to %v", interval, next)
+				interval = next
+				ticker.Reset(interval)
+			}
 		case <-ticker.C:
 			err := pm.Reconcile(ctx)
 			if err != nil {
@@ -52,24 +79,50 @@ func (pm *CNSIPAMPoolMonitor) Start(ctx context.Context, poolMonitorRefreshMilli
 	}
 }
 
+// SetRefreshInterval changes how often the pool monitor reconciles the pool.
+func (pm *CNSIPAMPoolMonitor) SetRefreshInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	pm.mu.Lock()
+	pm.refreshInterval = interval
+	pm.mu.Unlock()
+
+	// wake up the running pool monitor, unless it already has a change to pick up
+	select {
+	case pm.refreshIntervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (pm *CNSIPAMPoolMonitor) getRefreshInterval() time.Duration {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.refreshInterval
+}
+
 func (pm *CNSIPAMPoolMonitor) Reconcile(ctx context.Context) error {
-	cnsPodIPConfigCount := len(pm.httpService.GetPodIPConfigState())
-	pendingProgramCount := len(pm.httpService.GetPendingProgramIPConfigs()) // TODO: add pending program count to real cns
-	allocatedPodIPCount := len(pm.httpService.GetAllocatedIPConfigs())
-	pendingReleaseIPCount := len(pm.httpService.GetPendingReleaseIPConfigs())
-	availableIPConfigCount := len(pm.httpService.GetAvailableIPConfigs()) // TODO: add pending allocation count to real cns
+	// the requested IP count is the size of the default subnet, the IPs of other subnets are not scaled
+	ncIDs := pm.httpService.GetDefaultSubnetNCIDs()
+	cnsPodIPConfigCount := poolIPConfigStateCount(pm.httpService.GetPodIPConfigState(), ncIDs)
+	pendingProgramCount := poolIPConfigCount(pm.httpService.GetPendingProgramIPConfigs(), ncIDs) // TODO: add pending program count to real cns
+	allocatedPodIPCount := poolIPConfigCount(pm.httpService.GetAllocatedIPConfigs(), ncIDs)
+	pendingReleaseIPCount := poolIPConfigCount(pm.httpService.GetPendingReleaseIPConfigs(), ncIDs)
+	cooldownIPCount := poolIPConfigCount(pm.httpService.GetCooldownIPConfigs(), ncIDs)
+	availableIPConfigCount := poolIPConfigCount(pm.httpService.GetAvailableIPConfigs(), ncIDs) // TODO: add pending allocation count to real cns
 	requestedIPConfigCount := pm.cachedNNC.Spec.RequestedIPCount
 	unallocatedIPConfigCount := cnsPodIPConfigCount - allocatedPodIPCount
 	freeIPConfigCount := requestedIPConfigCount - int64(allocatedPodIPCount)
 	batchSize := pm.getBatchSize() // Use getters in case customer changes batchsize manually
 	maxIPCount := pm.getMaxIPCount()
 
-	msg := fmt.Sprintf("[ipam-pool-monitor] Pool Size: %v, Goal Size: %v, BatchSize: %v, MaxIPCount: %v, MinFree: %v, MaxFree:%v, Allocated: %v, Available: %v, Pending Release: %v, Free: %v, Pending Program: %v",
-		cnsPodIPConfigCount, pm.cachedNNC.Spec.RequestedIPCount, batchSize, maxIPCount, pm.MinimumFreeIps, pm.MaximumFreeIps, allocatedPodIPCount, availableIPConfigCount, pendingReleaseIPCount, freeIPConfigCount, pendingProgramCount)
+	msg := fmt.Sprintf("[ipam-pool-monitor] Pool Size: %v, Goal Size: %v, BatchSize: %v, MaxIPCount: %v, MinFree: %v, MaxFree:%v, Allocated: %v, Available: %v, Pending Release: %v, Free: %v, Pending Program: %v, Cooldown: %v",
+		cnsPodIPConfigCount, pm.cachedNNC.Spec.RequestedIPCount, batchSize, maxIPCount, pm.MinimumFreeIps, pm.MaximumFreeIps, allocatedPodIPCount, availableIPConfigCount, pendingReleaseIPCount, freeIPConfigCount, pendingProgramCount, cooldownIPCount)
 
 	ipamAllocatedIPCount.Set(float64(allocatedPodIPCount))
 	ipamAvailableIPCount.Set(float64(availableIPConfigCount))
 	ipamBatchSize.Set(float64(batchSize))
+	ipamCooldownIPCount.Set(float64(cooldownIPCount))
 	ipamFreeIPCount.Set(float64(freeIPConfigCount))
 	ipamIPPool.Set(float64(cnsPodIPConfigCount))
 	ipamMaxIPCount.Set(float64(maxIPCount))
@@ -78,19 +131,31 @@ func (pm *CNSIPAMPoolMonitor) Reconcile(ctx context.Context) error {
 	ipamRequestedIPConfigCount.Set(float64(requestedIPConfigCount))
 	ipamUnallocatedIPCount.Set(float64(unallocatedIPConfigCount))
 
+	pm.reportPoolExhausted(ctx, requestedIPConfigCount >= maxIPCount && freeIPConfigCount < pm.MinimumFreeIps, maxIPCount)
+
+	decision := pm.strategy.Evaluate(PoolState{
+		Timestamp:        time.Now(),
+		AllocatedIPCount: int64(allocatedPodIPCount),
+		RequestedIPCount: requestedIPConfigCount,
+		CooldownIPCount:  int64(cooldownIPCount),
+		BatchSize:        batchSize,
+		MaxIPCount:       maxIPCount,
+		MinimumFreeIps:   pm.MinimumFreeIps,
+		MaximumFreeIps:   pm.MaximumFreeIps,
+	})
+
 	switch {
-	// pod count is increasing
-	case freeIPConfigCount < pm.MinimumFreeIps:
-		if pm.cachedNNC.Spec.RequestedIPCount == maxIPCount {
-			// If we're already at the maxIPCount, don't try to increase
-			return nil
-		}
+	// pod count is increasing, but we're already at the maxIPCount
+	case decision.Action == ScaleUpAtMax:
+		return nil
 
+	// pod count is increasing
+	case decision.Action == ScaleUp:
 		logger.Printf("[ipam-pool-monitor] Increasing pool size...%s ", msg)
-		return pm.increasePoolSize(ctx)
+		return pm.increasePoolSize(ctx, decision.RequestedIPCount)
 
 	// pod count is decreasing
-	case freeIPConfigCount >= pm.MaximumFreeIps:
+	case decision.Action == ScaleDown:
 		logger.Printf("[ipam-pool-monitor] Decreasing pool size...%s ", msg)
 		return pm.decreasePoolSize(ctx, pendingReleaseIPCount)
 
@@ -109,7 +174,55 @@ func (pm *CNSIPAMPoolMonitor) Reconcile(ctx context.Context) error {
 	return nil
 }
 
-func (pm *CNSIPAMPoolMonitor) increasePoolSize(ctx context.Context) error {
+// poolIPConfigCount counts the ipconfigs of the NCs in ncIDs, or all ipconfigs if ncIDs is nil.
+func poolIPConfigCount(ipConfigs []cns.IPConfigurationStatus, ncIDs map[string]struct{}) int {
+	if ncIDs == nil {
+		return len(ipConfigs)
+	}
+	var count int
+	for i := range ipConfigs {
+		if _, found := ncIDs[ipConfigs[i].NCID]; found {
+			count++
+		}
+	}
+	return count
+}
+
+// poolIPConfigStateCount counts the ipconfigs of the NCs in ncIDs, or all ipconfigs if ncIDs is nil.
+func poolIPConfigStateCount(ipConfigs map[string]cns.IPConfigurationStatus, ncIDs map[string]struct{}) int {
+	if ncIDs == nil {
+		return len(ipConfigs)
+	}
+	var count int
+	for _, ipConfig := range ipConfigs {
+		if _, found := ncIDs[ipConfig.NCID]; found {
+			count++
+		}
+	}
+	return count
+}
+
+// reportPoolExhausted sets the PoolExhausted condition on the CRD, which is True when more IPs are needed but
+// MaxIPCount IPs are already requested. Failures to set it are only logged, so they don't stop the pool scaling.
+func (pm *CNSIPAMPoolMonitor) reportPoolExhausted(ctx context.Context, exhausted bool, maxIPCount int64) {
+	condition := metav1.Condition{
+		Type:    v1alpha.PoolExhausted,
+		Status:  metav1.ConditionFalse,
+		Reason:  "IPsAvailable",
+		Message: "the pool can grow to meet the demand for IPs",
+	}
+	if exhausted {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "MaxIPCountReached"
+		condition.Message = fmt.Sprintf("free IPs are below the minimum and the requested IP count is at the MaxIPCount of %d", maxIPCount)
+	}
+	if err := pm.rc.SetCondition(ctx, condition); err != nil {
+		logger.Errorf("[ipam-pool-monitor] Failed to set condition %s: %v", condition.Type, err)
+	}
+}
+
+// increasePoolSize requests the goal IP count from the strategy, capped at the max IP count.
+func (pm *CNSIPAMPoolMonitor) increasePoolSize(ctx context.Context, goalIPCount int64) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -120,16 +233,16 @@ func (pm *CNSIPAMPoolMonitor) increasePoolSize(ctx context.Context) error {
 	previouslyRequestedIPCount := tempNNCSpec.RequestedIPCount
 	batchSize := pm.getBatchSize()
 
-	tempNNCSpec.RequestedIPCount += batchSize
+	tempNNCSpec.RequestedIPCount = goalIPCount
 	if tempNNCSpec.RequestedIPCount > maxIPCount {
 		// We don't want to ask for more ips than the max
 		logger.Printf("[ipam-pool-monitor] Requested IP count (%v) is over max limit (%v), requesting max limit instead.", tempNNCSpec.RequestedIPCount, maxIPCount)
 		tempNNCSpec.RequestedIPCount = maxIPCount
 	}
 
-	// If the requested IP count is same as before, then don't do anything
-	if tempNNCSpec.RequestedIPCount == previouslyRequestedIPCount {
-		logger.Printf("[ipam-pool-monitor] Previously requested IP count %v is same as updated IP count %v, doing nothing", previouslyRequestedIPCount, tempNNCSpec.RequestedIPCount)
+	// If the requested IP count is not more than before, then don't do anything
+	if tempNNCSpec.RequestedIPCount <= previouslyRequestedIPCount {
+		logger.Printf("[ipam-pool-monitor] Previously requested IP count %v is not less than updated IP count %v, doing nothing", previouslyRequestedIPCount, tempNNCSpec.RequestedIPCount)
 		return nil
 	}
 
@@ -274,7 +387,9 @@ func (pm *CNSIPAMPoolMonitor) Update(scalar v1alpha.Scaler, spec v1alpha.NodeNet
 	pm.cachedNNC.Spec = spec
 
 	// if the nnc has conveged, observe the pool scaling latency (if any)
-	allocatedIPs := len(pm.httpService.GetPodIPConfigState()) - len(pm.httpService.GetPendingReleaseIPConfigs())
+	ncIDs := pm.httpService.GetDefaultSubnetNCIDs()
+	allocatedIPs := poolIPConfigStateCount(pm.httpService.GetPodIPConfigState(), ncIDs) -
+		poolIPConfigCount(pm.httpService.GetPendingReleaseIPConfigs(), ncIDs)
 	if int(pm.cachedNNC.Spec.RequestedIPCount) == allocatedIPs {
 		// observe elapsed duration for IP pool scaling
 		metric.ObserverPoolScaleLatency()
@@ -4,10 +4,12 @@ import (
 	"context"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns/fakes"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func initFakes(t *testing.T,
@@ -29,7 +31,7 @@ func initFakes(t *testing.T,
 	fakecns := fakes.NewHTTPServiceFake()
 	fakerc := fakes.NewRequestControllerFake(fakecns, scalarUnits, subnetaddresspace, initialIPConfigCount)
 
-	poolmonitor := NewCNSIPAMPoolMonitor(fakecns, fakerc)
+	poolmonitor := NewCNSIPAMPoolMonitor(fakecns, fakerc, nil)
 
 	fakecns.PoolMonitor = poolmonitor
 
@@ -270,6 +272,55 @@ func TestPoolIncreasePastNodeLimit(t *testing.T) {
 	}
 }
 
+func TestPoolExhaustedCondition(t *testing.T) {
+	var (
+		batchSize               = 10
+		initialIPConfigCount    = 10
+		requestThresholdPercent = 50
+		releaseThresholdPercent = 150
+		maxPodIPCount           = int64(20)
+	)
+
+	fakecns, fakerc, poolmonitor := initFakes(t,
+		batchSize,
+		initialIPConfigCount,
+		requestThresholdPercent,
+		releaseThresholdPercent,
+		maxPodIPCount)
+
+	expectCondition := func(status metav1.ConditionStatus) {
+		t.Helper()
+		if err := poolmonitor.Reconcile(context.Background()); err != nil {
+			t.Fatalf("Failed to reconcile pool monitor with err: %v", err)
+		}
+		condition := fakerc.Condition(v1alpha.PoolExhausted)
+		if condition == nil || condition.Status != status {
+			t.Fatalf("Expected PoolExhausted condition to be %s, got %+v", status, condition)
+		}
+	}
+
+	// the pool can still grow to the max
+	if err := fakecns.SetNumberOfAllocatedIPs(8); err != nil {
+		t.Fatalf("Failed to allocate test ipconfigs with err: %v", err)
+	}
+	expectCondition(metav1.ConditionFalse)
+	if err := fakerc.Reconcile(true); err != nil {
+		t.Fatalf("Failed to reconcile fake requestcontroller with err: %v", err)
+	}
+
+	// the max has been requested, but more IPs are needed
+	if err := fakecns.SetNumberOfAllocatedIPs(18); err != nil {
+		t.Fatalf("Failed to allocate test ipconfigs with err: %v", err)
+	}
+	expectCondition(metav1.ConditionTrue)
+
+	// enough IPs are free again
+	if err := fakecns.SetNumberOfAllocatedIPs(10); err != nil {
+		t.Fatalf("Failed to release test ipconfigs with err: %v", err)
+	}
+	expectCondition(metav1.ConditionFalse)
+}
+
 func TestPoolIncreaseBatchSizeGreaterThanMaxPodIPCount(t *testing.T) {
 	var (
 		batchSize               = 50
@@ -763,3 +814,66 @@ func ReconcileAndValidate(ctx context.Context,
 			len(poolmonitor.cachedNNC.Spec.IPsNotInUse))
 	}
 }
+
+func TestSetRefreshInterval(t *testing.T) {
+	_, fakerc, poolmonitor := initFakes(t, 10, 10, 30, 150, 30)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = poolmonitor.Start(ctx, int(time.Hour/time.Millisecond))
+	}()
+
+	// wait for the pool monitor to be running at the interval it started with
+	for poolmonitor.getRefreshInterval() != time.Hour {
+		time.Sleep(time.Millisecond)
+	}
+	poolmonitor.SetRefreshInterval(10 * time.Millisecond)
+
+	// every reconcile publishes the PoolExhausted condition
+	deadline := time.After(5 * time.Second)
+	for fakerc.Condition(v1alpha.PoolExhausted) == nil {
+		select {
+		case <-deadline:
+			t.Fatalf("Expected pool monitor to reconcile at the new refresh interval")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestPoolAtMaxIPCountDoesNothingWhenIncreaseIsNeeded(t *testing.T) {
+	var (
+		batchSize               = 10
+		initialIPConfigCount    = 30
+		requestThresholdPercent = 30
+		releaseThresholdPercent = 150
+		maxPodIPCount           = int64(30)
+	)
+
+	fakecns, _, poolmonitor := initFakes(t,
+		batchSize,
+		initialIPConfigCount,
+		requestThresholdPercent,
+		releaseThresholdPercent,
+		maxPodIPCount)
+
+	err := fakecns.SetNumberOfAllocatedIPs(28)
+	if err != nil {
+		t.Fatalf("Failed to allocate test ipconfigs with err: %v", err)
+	}
+
+	// the pool can't grow, and the pending release IPs in the CRD are left alone until it can
+	poolmonitor.cachedNNC.Spec.IPsNotInUse = []string{"stale"}
+	err = poolmonitor.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reconcile pool monitor with err: %v", err)
+	}
+
+	if poolmonitor.cachedNNC.Spec.RequestedIPCount != maxPodIPCount {
+		t.Fatalf("Pool monitor requested %v IPs, expected the max IP count %v", poolmonitor.cachedNNC.Spec.RequestedIPCount, maxPodIPCount)
+	}
+
+	if len(poolmonitor.cachedNNC.Spec.IPsNotInUse) != 1 {
+		t.Fatalf("Pool monitor cleaned the pending release IPs at the max IP count: %v", poolmonitor.cachedNNC.Spec.IPsNotInUse)
+	}
+}
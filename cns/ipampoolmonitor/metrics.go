@@ -24,6 +24,12 @@ var (
 			Help: "IPAM IP pool batch size.",
 		},
 	)
+	ipamCooldownIPCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ipam_cooldown_ips",
+			Help: "Cooldown IP count.",
+		},
+	)
 	ipamFreeIPCount = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "ipam_free_ips",
@@ -73,6 +79,7 @@ func init() {
 		ipamAllocatedIPCount,
 		ipamAvailableIPCount,
 		ipamBatchSize,
+		ipamCooldownIPCount,
 		ipamFreeIPCount,
 		ipamIPPool,
 		ipamMaxIPCount,
@@ -0,0 +1,208 @@
+package ipampoolmonitor
+
+import (
+	"sync"
+	"time"
+)
+
+// ScalingAction is the action the pool monitor should take on a reconcile.
+type ScalingAction int
+
+const (
+	NoScaling ScalingAction = iota
+	ScaleUp
+	ScaleDown
+	// ScaleUpAtMax is returned when the pool needs to grow but already has the max IP count.
+	// The pool monitor does nothing else on that reconcile.
+	ScaleUpAtMax
+)
+
+// PoolState is the snapshot of the IP pool a ScalingStrategy evaluates.
+type PoolState struct {
+	Timestamp        time.Time
+	AllocatedIPCount int64
+	RequestedIPCount int64
+	CooldownIPCount  int64
+	BatchSize        int64
+	MaxIPCount       int64
+	MinimumFreeIps   int64
+	MaximumFreeIps   int64
+}
+
+// FreeIPCount is the number of requested IPs which are not allocated to pods.
+// IPs in Cooldown are counted as free since they become Available on their own,
+// requesting more IPs for them would only be released again once they do.
+func (s PoolState) FreeIPCount() int64 {
+	return s.RequestedIPCount - s.AllocatedIPCount
+}
+
+// ReleasableIPCount is the number of free IPs which are not in Cooldown and can be released.
+func (s PoolState) ReleasableIPCount() int64 {
+	return s.FreeIPCount() - s.CooldownIPCount
+}
+
+// ScalingDecision is the result of evaluating a PoolState.
+// For ScaleUp, RequestedIPCount is the new goal pool size.
+type ScalingDecision struct {
+	Action           ScalingAction
+	RequestedIPCount int64
+}
+
+// ScalingStrategy decides when and by how much the IPAM pool should be resized.
+type ScalingStrategy interface {
+	Evaluate(state PoolState) ScalingDecision
+}
+
+// thresholdScalingStrategy is the default strategy: request one batch when the free IPs drop
+// below MinimumFreeIps and release one batch when they reach MaximumFreeIps.
+type thresholdScalingStrategy struct{}
+
+// NewThresholdScalingStrategy creates the default static threshold ScalingStrategy.
+func NewThresholdScalingStrategy() ScalingStrategy {
+	return &thresholdScalingStrategy{}
+}
+
+func (*thresholdScalingStrategy) Evaluate(state PoolState) ScalingDecision {
+	switch {
+	// pod count is increasing
+	case state.FreeIPCount() < state.MinimumFreeIps:
+		if state.RequestedIPCount == state.MaxIPCount {
+			// If we're already at the maxIPCount, don't try to increase
+			return ScalingDecision{Action: ScaleUpAtMax}
+		}
+		return ScalingDecision{Action: ScaleUp, RequestedIPCount: state.RequestedIPCount + state.BatchSize}
+
+	// pod count is decreasing
+	case state.ReleasableIPCount() >= state.MaximumFreeIps:
+		return ScalingDecision{Action: ScaleDown}
+	}
+
+	return ScalingDecision{Action: NoScaling}
+}
+
+// RateScalingConfig configures the rate based ScalingStrategy.
+type RateScalingConfig struct {
+	// Window is the sliding window over which the allocation rate is measured.
+	Window time.Duration
+	// Lookahead is how far ahead of the observed demand IPs are requested,
+	// roughly the time it takes for an NNC update to be programmed.
+	Lookahead time.Duration
+	// ReleaseHold is how long the pool must stay above the release threshold
+	// without any allocation growth before IPs are released.
+	ReleaseHold time.Duration
+}
+
+type allocationSample struct {
+	timestamp time.Time
+	allocated int64
+}
+
+// rateScalingStrategy tracks the allocation velocity over a sliding window and requests
+// enough IPs to cover the projected demand over the lookahead period. Releases are held
+// back until the pool has been idle above the release threshold for ReleaseHold.
+type rateScalingStrategy struct {
+	sync.Mutex
+	config        RateScalingConfig
+	samples       []allocationSample
+	lastScaleUp   time.Time
+	releaseSince  time.Time
+	releasePaused bool
+}
+
+// NewRateScalingStrategy creates a ScalingStrategy which scales on the allocation rate.
+func NewRateScalingStrategy(config RateScalingConfig) ScalingStrategy {
+	return &rateScalingStrategy{
+		config: config,
+	}
+}
+
+func (r *rateScalingStrategy) Evaluate(state PoolState) ScalingDecision {
+	r.Lock()
+	defer r.Unlock()
+
+	r.addSample(state.Timestamp, state.AllocatedIPCount)
+	projected := r.projectedGrowth(state.Timestamp)
+
+	// request ahead of demand: keep MinimumFreeIps free on top of the projected growth
+	if state.FreeIPCount() < state.MinimumFreeIps+projected {
+		r.releasePaused = false
+		if state.RequestedIPCount >= state.MaxIPCount {
+			return ScalingDecision{Action: ScaleUpAtMax}
+		}
+		if state.BatchSize <= 0 {
+			return ScalingDecision{Action: NoScaling}
+		}
+
+		target := roundUpToBatch(state.AllocatedIPCount+state.MinimumFreeIps+projected, state.BatchSize)
+		if target <= state.RequestedIPCount {
+			target = state.RequestedIPCount + state.BatchSize
+		}
+		if target > state.MaxIPCount {
+			target = state.MaxIPCount
+		}
+
+		r.lastScaleUp = state.Timestamp
+		return ScalingDecision{Action: ScaleUp, RequestedIPCount: target}
+	}
+
+	if state.ReleasableIPCount() < state.MaximumFreeIps || projected > 0 {
+		r.releasePaused = false
+		return ScalingDecision{Action: NoScaling}
+	}
+
+	// hysteresis: only release once the pool has been idle above the release threshold
+	// for the hold period, and never right after a scale up.
+	if !r.releasePaused {
+		r.releasePaused = true
+		r.releaseSince = state.Timestamp
+	}
+	if state.Timestamp.Sub(r.releaseSince) < r.config.ReleaseHold ||
+		state.Timestamp.Sub(r.lastScaleUp) < r.config.ReleaseHold {
+		return ScalingDecision{Action: NoScaling}
+	}
+
+	r.releasePaused = false
+	return ScalingDecision{Action: ScaleDown}
+}
+
+// addSample records the allocated count and drops the samples which fell out of the window.
+func (r *rateScalingStrategy) addSample(now time.Time, allocated int64) {
+	r.samples = append(r.samples, allocationSample{timestamp: now, allocated: allocated})
+
+	cutoff := now.Add(-r.config.Window)
+	i := 0
+	for i < len(r.samples)-1 && r.samples[i].timestamp.Before(cutoff) {
+		i++
+	}
+	r.samples = r.samples[i:]
+}
+
+// projectedGrowth is the number of IPs expected to be allocated over the lookahead period,
+// extrapolated from the net allocation rate over the window. Shrinking pods project no growth.
+func (r *rateScalingStrategy) projectedGrowth(now time.Time) int64 {
+	if len(r.samples) < 2 {
+		return 0
+	}
+
+	oldest := r.samples[0]
+	elapsed := now.Sub(oldest.timestamp)
+	delta := r.samples[len(r.samples)-1].allocated - oldest.allocated
+	if elapsed <= 0 || delta <= 0 {
+		return 0
+	}
+
+	perSecond := float64(delta) / elapsed.Seconds()
+	projected := perSecond * r.config.Lookahead.Seconds()
+	growth := int64(projected)
+	if float64(growth) < projected {
+		growth++
+	}
+	return growth
+}
+
+func roundUpToBatch(count, batchSize int64) int64 {
+	if mod := count % batchSize; mod != 0 {
+		return count + batchSize - mod
+	}
+	return count
+}
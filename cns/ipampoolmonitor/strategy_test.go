@@ -0,0 +1,105 @@
+package ipampoolmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPoolState(now time.Time, allocated, requested int64) PoolState {
+	return PoolState{
+		Timestamp:        now,
+		AllocatedIPCount: allocated,
+		RequestedIPCount: requested,
+		BatchSize:        10,
+		MaxIPCount:       250,
+		MinimumFreeIps:   5,
+		MaximumFreeIps:   15,
+	}
+}
+
+func TestThresholdScalingStrategy(t *testing.T) {
+	strategy := NewThresholdScalingStrategy()
+	now := time.Now()
+
+	assert.Equal(t, ScalingDecision{Action: ScaleUp, RequestedIPCount: 30}, strategy.Evaluate(newTestPoolState(now, 16, 20)))
+	assert.Equal(t, ScalingDecision{Action: NoScaling}, strategy.Evaluate(newTestPoolState(now, 10, 20)))
+	assert.Equal(t, ScalingDecision{Action: ScaleDown}, strategy.Evaluate(newTestPoolState(now, 5, 20)))
+
+	atMax := newTestPoolState(now, 248, 250)
+	assert.Equal(t, ScalingDecision{Action: ScaleUpAtMax}, strategy.Evaluate(atMax))
+}
+
+func TestThresholdScalingStrategyWithCooldownIPs(t *testing.T) {
+	strategy := NewThresholdScalingStrategy()
+	now := time.Now()
+
+	// IPs in cooldown are free for scaling up, 16 allocated and 4 in cooldown is not below the minimum
+	state := newTestPoolState(now, 10, 20)
+	state.CooldownIPCount = 6
+	assert.Equal(t, ScalingDecision{Action: NoScaling}, strategy.Evaluate(state))
+
+	// but are not released, 15 free of which 5 are in cooldown is below the maximum
+	state = newTestPoolState(now, 5, 20)
+	state.CooldownIPCount = 5
+	assert.Equal(t, ScalingDecision{Action: NoScaling}, strategy.Evaluate(state))
+
+	state.CooldownIPCount = 0
+	assert.Equal(t, ScalingDecision{Action: ScaleDown}, strategy.Evaluate(state))
+}
+
+func TestRateScalingStrategyRequestsAheadOfDemand(t *testing.T) {
+	strategy := NewRateScalingStrategy(RateScalingConfig{
+		Window:      time.Minute,
+		Lookahead:   30 * time.Second,
+		ReleaseHold: 5 * time.Minute,
+	})
+	now := time.Now()
+
+	// no history yet and within the thresholds
+	assert.Equal(t, NoScaling, strategy.Evaluate(newTestPoolState(now, 10, 20)).Action)
+
+	// 10 more pods over 10 seconds, 1 IP/s, is 30 more IPs over the lookahead
+	decision := strategy.Evaluate(newTestPoolState(now.Add(10*time.Second), 20, 30))
+	assert.Equal(t, ScaleUp, decision.Action)
+	// 20 allocated + 5 min free + 30 projected, rounded up to the batch size
+	assert.Equal(t, int64(60), decision.RequestedIPCount)
+}
+
+func TestRateScalingStrategyCapsAtMaxIPCount(t *testing.T) {
+	strategy := NewRateScalingStrategy(RateScalingConfig{
+		Window:      time.Minute,
+		Lookahead:   time.Minute,
+		ReleaseHold: time.Minute,
+	})
+	now := time.Now()
+
+	strategy.Evaluate(newTestPoolState(now, 100, 200))
+	decision := strategy.Evaluate(newTestPoolState(now.Add(time.Second), 190, 200))
+	assert.Equal(t, ScaleUp, decision.Action)
+	assert.Equal(t, int64(250), decision.RequestedIPCount)
+
+	decision = strategy.Evaluate(newTestPoolState(now.Add(2*time.Second), 248, 250))
+	assert.Equal(t, ScaleUpAtMax, decision.Action)
+}
+
+func TestRateScalingStrategyReleaseHysteresis(t *testing.T) {
+	strategy := NewRateScalingStrategy(RateScalingConfig{
+		Window:      10 * time.Second,
+		Lookahead:   30 * time.Second,
+		ReleaseHold: time.Minute,
+	})
+	now := time.Now()
+
+	// free IPs above the release threshold, but the hold period has not passed
+	assert.Equal(t, NoScaling, strategy.Evaluate(newTestPoolState(now, 5, 30)).Action)
+	assert.Equal(t, NoScaling, strategy.Evaluate(newTestPoolState(now.Add(30*time.Second), 5, 30)).Action)
+
+	// a burst of allocations scales up and resets the hold
+	assert.Equal(t, ScaleUp, strategy.Evaluate(newTestPoolState(now.Add(31*time.Second), 6, 30)).Action)
+	assert.Equal(t, NoScaling, strategy.Evaluate(newTestPoolState(now.Add(70*time.Second), 6, 30)).Action)
+
+	// idle above the release threshold for the full hold period
+	assert.Equal(t, ScaleDown, strategy.Evaluate(newTestPoolState(now.Add(131*time.Second), 6, 30)).Action)
+}
@@ -3,6 +3,7 @@ package logger
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
 	"github.com/Azure/azure-container-networking/cns/types"
@@ -24,9 +25,10 @@ type CNSLogger struct {
 	th                   aitelemetry.TelemetryHandle
 	Orchestrator         string
 	NodeID               string
-	DisableTraceLogging  bool
-	DisableMetricLogging bool
-	DisableEventLogging  bool
+	mu                   sync.RWMutex // guards the telemetry switches below, which SetTelemetryLogging changes while logging
+	disableTraceLogging  bool
+	disableMetricLogging bool
+	disableEventLogging  bool
 }
 
 // Initialize CNS Logger
@@ -47,9 +49,7 @@ func InitAI(aiConfig aitelemetry.AIConfig, disableTraceLogging, disableMetricLog
 	}
 
 	Log.logger.Printf("AI Telemetry Handle created")
-	Log.DisableMetricLogging = disableMetricLogging
-	Log.DisableTraceLogging = disableTraceLogging
-	Log.DisableEventLogging = disableEventLogging
+	SetTelemetryLogging(disableTraceLogging, disableMetricLogging, disableEventLogging)
 }
 
 // Close CNS and AI telemetry handle
@@ -60,6 +60,50 @@ func Close() {
 	}
 }
 
+// SetLogLevel sets the log chattiness.
+func SetLogLevel(level int) {
+	Log.logger.SetLevel(level)
+}
+
+// SetTelemetryLogging sets which logs are sent to AI telemetry.
+func SetTelemetryLogging(disableTraceLogging, disableMetricLogging, disableEventLogging bool) {
+	Log.mu.Lock()
+	defer Log.mu.Unlock()
+	Log.disableTraceLogging = disableTraceLogging
+	Log.disableMetricLogging = disableMetricLogging
+	Log.disableEventLogging = disableEventLogging
+}
+
+// traceLoggingEnabled returns whether traces are sent to AI telemetry.
+func traceLoggingEnabled() bool {
+	if Log.th == nil {
+		return false
+	}
+	Log.mu.RLock()
+	defer Log.mu.RUnlock()
+	return !Log.disableTraceLogging
+}
+
+// metricLoggingEnabled returns whether metrics are sent to AI telemetry.
+func metricLoggingEnabled() bool {
+	if Log.th == nil {
+		return false
+	}
+	Log.mu.RLock()
+	defer Log.mu.RUnlock()
+	return !Log.disableMetricLogging
+}
+
+// eventLoggingEnabled returns whether events are sent to AI telemetry.
+func eventLoggingEnabled() bool {
+	if Log.th == nil {
+		return false
+	}
+	Log.mu.RLock()
+	defer Log.mu.RUnlock()
+	return !Log.disableEventLogging
+}
+
 func SetTargetLogDirectory(target int, dir string) error {
 	return Log.logger.SetTargetLogDirectory(target, dir)
 }
@@ -85,7 +129,7 @@ func sendTraceInternal(msg string) {
 func Printf(format string, args ...interface{}) {
 	Log.logger.Logf(format, args...)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -96,7 +140,7 @@ func Printf(format string, args ...interface{}) {
 func Debugf(format string, args ...interface{}) {
 	Log.logger.Debugf(format, args...)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -105,7 +149,7 @@ func Debugf(format string, args ...interface{}) {
 }
 
 func LogEvent(event aitelemetry.Event) {
-	if Log.th == nil || Log.DisableEventLogging {
+	if !eventLoggingEnabled() {
 		return
 	}
 
@@ -117,7 +161,7 @@ func LogEvent(event aitelemetry.Event) {
 func Errorf(format string, args ...interface{}) {
 	Log.logger.Errorf(format, args...)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -128,7 +172,7 @@ func Errorf(format string, args ...interface{}) {
 func Request(tag string, request interface{}, err error) {
 	Log.logger.Request(tag, request, err)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -145,7 +189,7 @@ func Request(tag string, request interface{}, err error) {
 func Response(tag string, response interface{}, returnCode types.ResponseCode, err error) {
 	Log.logger.Response(tag, response, int(returnCode), returnCode.String(), err)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -165,7 +209,7 @@ func Response(tag string, response interface{}, returnCode types.ResponseCode, e
 func ResponseEx(tag string, request interface{}, response interface{}, returnCode types.ResponseCode, err error) {
 	Log.logger.ResponseEx(tag, request, response, int(returnCode), returnCode.String(), err)
 
-	if Log.th == nil || Log.DisableTraceLogging {
+	if !traceLoggingEnabled() {
 		return
 	}
 
@@ -183,7 +227,7 @@ func ResponseEx(tag string, request interface{}, response interface{}, returnCod
 
 // Send AI telemetry metric
 func SendMetric(metric aitelemetry.Metric) {
-	if Log.th == nil || Log.DisableMetricLogging {
+	if !metricLoggingEnabled() {
 		return
 	}
 
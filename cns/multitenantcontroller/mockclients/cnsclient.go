@@ -79,17 +79,31 @@ func (mr *MockAPIClientMockRecorder) GetNC(nc interface{}) *gomock.Call {
 }
 
 // ReconcileNCState mocks base method.
-func (m *MockAPIClient) ReconcileNCState(nc *cns.CreateNetworkContainerRequest, pods map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
+func (m *MockAPIClient) ReconcileNCState(ncs []cns.CreateNetworkContainerRequest, pods map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ReconcileNCState", nc, pods, scalar, spec)
+	ret := m.ctrl.Call(m, "ReconcileNCState", ncs, pods, scalar, spec)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ReconcileNCState indicates an expected call of ReconcileNCState.
-func (mr *MockAPIClientMockRecorder) ReconcileNCState(nc, pods, scalar, spec interface{}) *gomock.Call {
+func (mr *MockAPIClientMockRecorder) ReconcileNCState(ncs, pods, scalar, spec interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileNCState", reflect.TypeOf((*MockAPIClient)(nil).ReconcileNCState), nc, pods, scalar, spec)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileNCState", reflect.TypeOf((*MockAPIClient)(nil).ReconcileNCState), ncs, pods, scalar, spec)
+}
+
+// SetNodeNCs mocks base method.
+func (m *MockAPIClient) SetNodeNCs(ncs []cns.CreateNetworkContainerRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetNodeNCs", ncs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetNodeNCs indicates an expected call of SetNodeNCs.
+func (mr *MockAPIClientMockRecorder) SetNodeNCs(ncs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNodeNCs", reflect.TypeOf((*MockAPIClient)(nil).SetNodeNCs), ncs)
 }
 
 // UpdateIPAMPoolMonitor mocks base method.
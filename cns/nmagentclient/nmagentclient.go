@@ -192,6 +192,11 @@ func (nmagentclient *NMAgentClient) GetNcVersionListWithOutToken(ncNeedUpdateLis
 	response, err := http.Get(nmagentclient.connectionURL)
 	latency := time.Since(now)
 	logger.Printf("[NMAgentClient][Response] GetNcVersionListWithOutToken response: %+v, latency is %d", response, latency.Milliseconds())
+	if err != nil {
+		logger.Printf("[NMAgentClient][Response] GetNcVersionListWithOutToken failed with %v", err)
+		return nil
+	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		logger.Printf("[NMAgentClient][Response] GetNcVersionListWithOutToken failed with %d, err is %v", response.StatusCode, err)
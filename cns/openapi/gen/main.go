@@ -0,0 +1,35 @@
+// gen writes the OpenAPI document of the CNS REST API.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+)
+
+func main() {
+	output := flag.String("output", "cns.json", "path to write the OpenAPI document to")
+	flag.Parse()
+
+	if err := generate(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate the OpenAPI document: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(output string) error {
+	spec, err := restserver.APISpec()
+	if err != nil {
+		return err
+	}
+
+	b, err := spec.JSON()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, b, 0o644) //nolint:gosec // the document is public
+}
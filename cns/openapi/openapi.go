@@ -0,0 +1,357 @@
+// Package openapi describes the CNS REST API as an OpenAPI 3 document generated from the Go request and
+// response types of each route, and validates request bodies against it.
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	openAPIVersion  = "3.0.3"
+	contentTypeJSON = "application/json"
+	schemaRefPrefix = "#/components/schemas/"
+)
+
+// Route is an HTTP JSON API route. Request is nil when the route does not take a request body.
+type Route struct {
+	Path        string
+	Method      string
+	OperationID string
+	Summary     string
+	Request     interface{}
+	Response    interface{}
+}
+
+// Document is an OpenAPI 3 document. Only the parts used to describe the CNS REST API are modelled.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	routes map[string]Route
+}
+
+// Info is the metadata about the API.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem holds the operations on a path.
+type PathItem struct {
+	Get  *Operation `json:"get,omitempty"`
+	Post *Operation `json:"post,omitempty"`
+}
+
+// Operation is a single API operation on a path.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes the body of a response.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas of the named types referenced by the operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema is a JSON schema. An empty Schema matches any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// Generator builds a Document from routes, describing their Go types with JSON schemas.
+type Generator struct {
+	doc   *Document
+	enums map[reflect.Type][]interface{}
+	names map[reflect.Type]string
+}
+
+// NewGenerator creates a generator for a document with the title and version.
+func NewGenerator(title, version string) *Generator {
+	return &Generator{
+		doc: &Document{
+			OpenAPI:    openAPIVersion,
+			Info:       Info{Title: title, Version: version},
+			Paths:      map[string]*PathItem{},
+			Components: Components{Schemas: map[string]*Schema{}},
+			routes:     map[string]Route{},
+		},
+		enums: map[reflect.Type][]interface{}{},
+		names: map[reflect.Type]string{},
+	}
+}
+
+// Enum restricts the values of the type of value to values, wherever the type is used.
+func (g *Generator) Enum(value interface{}, values ...interface{}) {
+	g.enums[reflect.TypeOf(value)] = values
+}
+
+// AddRoute adds the operation of the route to the document.
+func (g *Generator) AddRoute(route Route) error {
+	if _, exists := g.doc.routes[route.Path]; exists {
+		return fmt.Errorf("duplicate route for path %s", route.Path) //nolint:goerr113
+	}
+
+	op := &Operation{
+		OperationID: route.OperationID,
+		Summary:     route.Summary,
+		Responses: map[string]*Response{
+			"200": {
+				Description: "The result of the operation, with a CNS ReturnCode.",
+				Content:     map[string]*MediaType{contentTypeJSON: {Schema: g.schema(reflect.TypeOf(route.Response))}},
+			},
+		},
+	}
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{contentTypeJSON: {Schema: g.schema(reflect.TypeOf(route.Request))}},
+		}
+	}
+
+	item := &PathItem{}
+	switch route.Method {
+	case "GET":
+		item.Get = op
+	case "POST":
+		item.Post = op
+	default:
+		return fmt.Errorf("unsupported method %s for path %s", route.Method, route.Path) //nolint:goerr113
+	}
+
+	g.doc.Paths[route.Path] = item
+	g.doc.routes[route.Path] = route
+	return nil
+}
+
+// Document returns the generated document.
+func (g *Generator) Document() *Document {
+	return g.doc
+}
+
+// JSON returns the document as indented JSON, which is stable for the same routes.
+func (d *Document) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// schema returns the schema of t, adding named struct types to the components and referencing them.
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if values, ok := g.enums[t]; ok {
+		s := g.unnamedSchema(t)
+		s.Enum = values
+		return s
+	}
+
+	if t.Kind() == reflect.Struct && t.Name() != "" && t != timeType && !implements(t, jsonMarshalerType) {
+		name := g.componentName(t)
+		if _, exists := g.doc.Components.Schemas[name]; !exists {
+			// reserve the name before describing the fields, so recursive types terminate
+			g.doc.Components.Schemas[name] = &Schema{}
+			*g.doc.Components.Schemas[name] = *g.structSchema(t)
+		}
+		return &Schema{Ref: schemaRefPrefix + name}
+	}
+
+	return g.unnamedSchema(t)
+}
+
+func (g *Generator) unnamedSchema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case implements(t, jsonMarshalerType):
+		// custom JSON encodings, such as json.RawMessage, can hold any value
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return integerSchema(t)
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		// interfaces can hold any value
+		return &Schema{}
+	}
+}
+
+func integerSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "integer", Format: "int64"}
+	var minimum, maximum float64
+	switch t.Kind() {
+	case reflect.Int8:
+		s.Format = "int32"
+		minimum, maximum = math.MinInt8, math.MaxInt8
+	case reflect.Int16:
+		s.Format = "int32"
+		minimum, maximum = math.MinInt16, math.MaxInt16
+	case reflect.Int32:
+		s.Format = "int32"
+		minimum, maximum = math.MinInt32, math.MaxInt32
+	case reflect.Uint8:
+		s.Format = "int32"
+		maximum = math.MaxUint8
+	case reflect.Uint16:
+		s.Format = "int32"
+		maximum = math.MaxUint16
+	case reflect.Uint32:
+		maximum = math.MaxUint32
+	case reflect.Uint, reflect.Uint64:
+		s.Minimum = &minimum
+		return s
+	default:
+		return s
+	}
+	s.Minimum, s.Maximum = &minimum, &maximum
+	return s
+}
+
+// structSchema describes the fields of t the way encoding/json marshals them.
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, embedded, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+
+		if embedded {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for name, prop := range g.structSchema(ft).Properties {
+				if _, exists := s.Properties[name]; !exists {
+					s.Properties[name] = prop
+				}
+			}
+			continue
+		}
+
+		s.Properties[name] = g.schema(field.Type)
+	}
+	return s
+}
+
+// jsonFieldName returns the name of the field in JSON, whether it is an embedded struct whose fields are
+// promoted, and false if the field is not marshalled.
+func jsonFieldName(field reflect.StructField) (string, bool, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name := strings.Split(tag, ",")[0]
+	if field.Anonymous && name == "" {
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			return "", true, true
+		}
+	}
+
+	if field.PkgPath != "" {
+		return "", false, false
+	}
+
+	if name == "" {
+		name = field.Name
+	}
+	return name, false, true
+}
+
+// componentName names the schema of t by its package and type name.
+func (g *Generator) componentName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := path.Base(t.PkgPath()) + "." + t.Name()
+	taken := map[string]bool{}
+	for _, n := range g.names {
+		taken[n] = true
+	}
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s.%s%d", path.Base(t.PkgPath()), t.Name(), i)
+	}
+	g.names[t] = name
+	return name
+}
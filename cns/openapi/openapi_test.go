@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+}
+
+type testState string
+
+type testEmbedded struct {
+	Embedded string
+}
+
+type testNode struct {
+	Name     string
+	Children []testNode
+}
+
+type testRequest struct {
+	testEmbedded
+	Name      string
+	Renamed   string `json:"renamed,omitempty"`
+	Ignored   string `json:"-"`
+	unexposed string
+	Count     uint8
+	Enabled   bool
+	Ratio     float64
+	State     testState
+	Labels    map[string]string
+	Body      []byte
+	Raw       json.RawMessage
+	Any       interface{}
+	When      time.Time
+	Tree      *testNode
+}
+
+type testResponse struct {
+	Value    string
+	Response cns.Response
+}
+
+const testPath = "/test"
+
+func newTestDocument(t *testing.T) *Document {
+	t.Helper()
+	g := NewGenerator("test", "v1")
+	g.Enum(testState(""), "On", "Off")
+	require.NoError(t, g.AddRoute(Route{Path: testPath, Method: http.MethodPost, OperationID: "Test", Request: testRequest{}, Response: testResponse{}}))
+	require.NoError(t, g.AddRoute(Route{Path: "/plain", Method: http.MethodGet, OperationID: "Plain", Response: cns.Response{}}))
+	return g.Document()
+}
+
+func TestGenerateSchemas(t *testing.T) {
+	doc := newTestDocument(t)
+
+	op := doc.Paths[testPath].Post
+	require.NotNil(t, op)
+	assert.Equal(t, "#/components/schemas/openapi.testRequest", op.RequestBody.Content[contentTypeJSON].Schema.Ref)
+	assert.Nil(t, doc.Paths["/plain"].Post)
+	assert.Nil(t, doc.Paths["/plain"].Get.RequestBody)
+
+	props := doc.Components.Schemas["openapi.testRequest"].Properties
+	assert.ElementsMatch(t,
+		[]string{"Embedded", "Name", "renamed", "Count", "Enabled", "Ratio", "State", "Labels", "Body", "Raw", "Any", "When", "Tree"},
+		keys(props))
+	assert.Equal(t, "integer", props["Count"].Type)
+	assert.Equal(t, float64(255), *props["Count"].Maximum)
+	assert.Equal(t, []interface{}{"On", "Off"}, props["State"].Enum)
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}, Nullable: true}, props["Labels"])
+	assert.Equal(t, "byte", props["Body"].Format)
+	assert.Equal(t, &Schema{}, props["Raw"])
+	assert.Equal(t, &Schema{}, props["Any"])
+	assert.Equal(t, "date-time", props["When"].Format)
+	assert.Equal(t, "#/components/schemas/openapi.testNode", props["Tree"].Ref)
+
+	// recursive types reference themselves
+	assert.Equal(t, "#/components/schemas/openapi.testNode", doc.Components.Schemas["openapi.testNode"].Properties["Children"].Items.Ref)
+
+	_, err := doc.JSON()
+	require.NoError(t, err)
+}
+
+func TestAddRouteRejectsDuplicates(t *testing.T) {
+	g := NewGenerator("test", "v1")
+	require.NoError(t, g.AddRoute(Route{Path: testPath, Method: http.MethodGet, Response: cns.Response{}}))
+	assert.Error(t, g.AddRoute(Route{Path: testPath, Method: http.MethodGet, Response: cns.Response{}}))
+	assert.Error(t, g.AddRoute(Route{Path: "/put", Method: http.MethodPut, Response: cns.Response{}}))
+}
+
+func keys(m map[string]*Schema) []string {
+	var k []string
+	for key := range m {
+		k = append(k, key)
+	}
+	return k
+}
+
+func TestValidateRequest(t *testing.T) {
+	doc := newTestDocument(t)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{name: "valid", body: `{"Name":"a","renamed":"b","Count":255,"Enabled":true,"Ratio":0.5,"State":"On","Labels":{"k":"v"},"Body":"aGk=","Raw":[1,"x"],"Any":{"x":1},"When":"2021-06-01T10:00:00Z","Tree":{"Name":"root","Children":[{"Name":"leaf"}]},"Embedded":"e"}`},
+		{name: "field names match case-insensitively", body: `{"name":"a","COUNT":1}`},
+		{name: "null matches any type", body: `{"Name":null,"Count":null,"Labels":null,"Tree":null}`},
+		{name: "unknown field", body: `{"Name":"a","Unknown":1}`, field: "$.Unknown"},
+		{name: "ignored field", body: `{"Ignored":"a"}`, field: "$.Ignored"},
+		{name: "string type mismatch", body: `{"Name":1}`, field: "$.Name"},
+		{name: "integer type mismatch", body: `{"Count":"1"}`, field: "$.Count"},
+		{name: "fractional integer", body: `{"Count":1.5}`, field: "$.Count"},
+		{name: "integer out of range", body: `{"Count":256}`, field: "$.Count"},
+		{name: "negative unsigned integer", body: `{"Count":-1}`, field: "$.Count"},
+		{name: "enum mismatch", body: `{"State":"Maybe"}`, field: "$.State"},
+		{name: "map value mismatch", body: `{"Labels":{"k":1}}`, field: "$.Labels.k"},
+		{name: "invalid base64", body: `{"Body":"!"}`, field: "$.Body"},
+		{name: "invalid time", body: `{"When":"yesterday"}`, field: "$.When"},
+		{name: "nested field mismatch", body: `{"Tree":{"Children":[{"Name":true}]}}`, field: "$.Tree.Children[0].Name"},
+		{name: "not an object", body: `[]`, field: "$"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := doc.ValidateRequest(testPath, []byte(tt.body))
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+
+	assert.Error(t, doc.ValidateRequest(testPath, []byte(`{`)))
+	assert.NoError(t, doc.ValidateRequest("/unknown", []byte(`{`)))
+}
+
+func TestValidateRequestsMiddleware(t *testing.T) {
+	doc := newTestDocument(t)
+
+	var received []byte
+	handler := doc.ValidateRequests(testPath, func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		_ = json.NewEncoder(w).Encode(testResponse{Value: "handled"})
+	})
+
+	serve := func(method, body string) testResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, testPath, bytes.NewBufferString(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp testResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	// valid requests reach the handler with their body intact
+	resp := serve(http.MethodPost, `{"Name":"a"}`)
+	assert.Equal(t, "handled", resp.Value)
+	assert.Equal(t, `{"Name":"a"}`, string(received))
+
+	resp = serve(http.MethodPost, `{"Name":1}`)
+	assert.Empty(t, resp.Value)
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+	assert.Contains(t, resp.Response.Message, "$.Name")
+
+	resp = serve(http.MethodPost, `not json`)
+	assert.Equal(t, types.InvalidRequest, resp.Response.ReturnCode)
+
+	resp = serve(http.MethodPost, ``)
+	assert.Equal(t, types.InvalidRequest, resp.Response.ReturnCode)
+
+	// other methods are left to the handler to reject
+	resp = serve(http.MethodGet, `{"Name":1}`)
+	assert.Equal(t, "handled", resp.Value)
+}
+
+func TestValidateRequestsPlainResponse(t *testing.T) {
+	g := NewGenerator("test", "v1")
+	require.NoError(t, g.AddRoute(Route{Path: testPath, Method: http.MethodPost, Request: testRequest{}, Response: cns.Response{}}))
+	handler := g.Document().ValidateRequests(testPath, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("invalid request reached the handler")
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, testPath, bytes.NewBufferString(`{"Unknown":1}`)))
+
+	var resp cns.Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.InvalidParameter, resp.ReturnCode)
+	assert.Contains(t, resp.Message, "$.Unknown: unknown field")
+}
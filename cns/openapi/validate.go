@@ -0,0 +1,274 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+)
+
+// ValidationError is returned when a request body does not match the schema of the route.
+type ValidationError struct {
+	// Field is the JSON path to the invalid value, such as $.SecondaryIPConfigs.uuid.NCVersion.
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+// ValidateRequest checks that body is a request for the route at path. Like encoding/json, field names match
+// case-insensitively and null is accepted for any value, but fields which are not part of the request are not.
+func (d *Document) ValidateRequest(path string, body []byte) error {
+	route, ok := d.routes[path]
+	if !ok || route.Request == nil {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("failed to decode request: %w", err)
+	}
+
+	op := d.Paths[path].Post
+	if op == nil {
+		op = d.Paths[path].Get
+	}
+	return d.validate(op.RequestBody.Content[contentTypeJSON].Schema, value, "$")
+}
+
+func (d *Document) resolve(s *Schema) *Schema {
+	for s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRefPrefix)]
+	}
+	return s
+}
+
+//nolint:gocyclo
+func (d *Document) validate(s *Schema, value interface{}, field string) error {
+	s = d.resolve(s)
+	if value == nil {
+		return nil
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf("must be one of %v", s.Enum)}
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError(field, s, value)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return typeError(field, s, value)
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return typeError(field, s, value)
+		}
+		return validateInteger(s, n, field)
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeError(field, s, value)
+		}
+		return validateStringFormat(s, str, field)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return typeError(field, s, value)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(field, s, value)
+		}
+		return d.validateObject(s, obj, field)
+	}
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, obj map[string]interface{}, field string) error {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch {
+		case s.Properties != nil:
+			prop, name := property(s, key)
+			if prop == nil {
+				return &ValidationError{Field: field + "." + key, Reason: "unknown field"}
+			}
+			if err := d.validate(prop, obj[key], field+"."+name); err != nil {
+				return err
+			}
+		case s.AdditionalProperties != nil:
+			if err := d.validate(s.AdditionalProperties, obj[key], field+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// property finds the property named key, preferring an exact match as encoding/json does.
+func property(s *Schema, key string) (*Schema, string) {
+	if prop, ok := s.Properties[key]; ok {
+		return prop, key
+	}
+	for name, prop := range s.Properties {
+		if strings.EqualFold(name, key) {
+			return prop, name
+		}
+	}
+	return nil, ""
+}
+
+func validateInteger(s *Schema, n json.Number, field string) error {
+	var f float64
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		f = float64(i)
+	} else if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		f = float64(u)
+	} else {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf("expected integer, got %s", n)}
+	}
+
+	if (s.Minimum != nil && f < *s.Minimum) || (s.Maximum != nil && f > *s.Maximum) {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf("%s is out of range", n)}
+	}
+	return nil
+}
+
+func validateStringFormat(s *Schema, str, field string) error {
+	var err error
+	switch s.Format {
+	case "byte":
+		_, err = base64.StdEncoding.DecodeString(str)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, str)
+	}
+	if err != nil {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf("invalid %s: %v", s.Format, err)}
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeError(field string, s *Schema, value interface{}) error {
+	var actual string
+	switch value.(type) {
+	case bool:
+		actual = "boolean"
+	case json.Number:
+		actual = "number"
+	case string:
+		actual = "string"
+	case []interface{}:
+		actual = "array"
+	default:
+		actual = "object"
+	}
+	return &ValidationError{Field: field, Reason: fmt.Sprintf("expected %s, got %s", s.Type, actual)}
+}
+
+// ValidateRequests returns a handler which validates the bodies of requests for the route at path before calling
+// next. Invalid requests are answered with the response type of the route, with an InvalidRequest return code
+// for bodies that are not JSON and an InvalidParameter return code for bodies that do not match the schema.
+// Requests with other methods than the route's are passed through, so the handler can reject them.
+func (d *Document) ValidateRequests(path string, next http.HandlerFunc) http.HandlerFunc {
+	route, ok := d.routes[path]
+	if !ok || route.Request == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != route.Method {
+			next(w, r)
+			return
+		}
+
+		var body []byte
+		var err error
+		if r.Body != nil {
+			body, err = ioutil.ReadAll(r.Body)
+			r.Body.Close()
+		}
+		if err == nil && len(bytes.TrimSpace(body)) == 0 {
+			err = fmt.Errorf("request body is empty") //nolint:goerr113
+		}
+		if err == nil {
+			err = d.ValidateRequest(path, body)
+		}
+		if err == nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next(w, r)
+			return
+		}
+
+		returnCode := types.InvalidRequest
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			returnCode = types.InvalidParameter
+		}
+		logger.Errorf("[openapi] Rejected invalid request to %s: %v", path, err)
+		writeErrorResponse(w, route.Response, cns.Response{ReturnCode: returnCode, Message: err.Error()})
+	}
+}
+
+// writeErrorResponse writes a response of the same type as the route's response, so clients decoding it find the
+// return code where they expect it: either it is a cns.Response, or it holds one in a Response field.
+func writeErrorResponse(w http.ResponseWriter, response interface{}, errResponse cns.Response) {
+	var body interface{} = errResponse
+	if t := reflect.TypeOf(response); t != nil && t != reflect.TypeOf(cns.Response{}) {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		v := reflect.New(t).Elem()
+		if f := v.FieldByName("Response"); f.IsValid() && f.Type() == reflect.TypeOf(cns.Response{}) {
+			f.Set(reflect.ValueOf(errResponse))
+			body = v.Interface()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Errorf("[openapi] Failed to encode error response: %v", err)
+	}
+}
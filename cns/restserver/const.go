@@ -8,4 +8,8 @@ const (
 	// Rest service state identifier for named lock
 	stateJoinedNetworks = "JoinedNetworks"
 	dncApiVersion       = "?api-version=2018-03-01"
+	// Reasons of the Events and conditions CNS publishes to kubernetes
+	failedAllocateIPReason = "FailedAllocateIP"
+	ncVersionLagReason     = "NMAgentVersionLag"
+	ncsProgrammedReason    = "NCsProgrammed"
 )
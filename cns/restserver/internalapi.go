@@ -11,7 +11,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -21,6 +23,7 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // This file contains the internal functions called by either HTTP APIs (api.go) or
@@ -202,32 +205,153 @@ func (service *HTTPRestService) SyncHostNCVersion(ctx context.Context, channelMo
 					}
 				}
 				service.Unlock()
+				// a failed sync is persisted by the next write to the ipam store, which compacts it
+				service.syncIPConfigState() //nolint:errcheck // logged
 			}
 		case <-ctxWithTimeout.Done():
 			logger.Errorf("Timeout when getting vfp programmed NC version list from url without token")
 		}
 	}
+
+	service.reportNCProgrammingPending(ctx)
+}
+
+// reportNCProgrammingPending sets the NCProgrammingPending condition on the CRD, which is True while NMAgent has not
+// programmed the latest version of some NCs, so the IPs added in that version can't be allocated yet.
+func (service *HTTPRestService) reportNCProgrammingPending(ctx context.Context) {
+	if service.StatusReporter == nil {
+		return
+	}
+
+	var pendingNCs []string
+	service.RLock()
+	for _, containerstatus := range service.state.ContainerStatus {
+		hostVersion, hostErr := strconv.Atoi(containerstatus.HostVersion)
+		dncNcVersion, dncErr := strconv.Atoi(containerstatus.CreateNetworkContainerRequest.Version)
+		if hostErr == nil && dncErr == nil && hostVersion < dncNcVersion {
+			pendingNCs = append(pendingNCs, fmt.Sprintf("%s (host version %d, NC version %d)", containerstatus.ID, hostVersion, dncNcVersion))
+		}
+	}
+	service.RUnlock()
+
+	condition := metav1.Condition{
+		Type:    v1alpha.NCProgrammingPending,
+		Status:  metav1.ConditionFalse,
+		Reason:  ncsProgrammedReason,
+		Message: "NMAgent has programmed the latest version of all NCs",
+	}
+	if len(pendingNCs) > 0 {
+		sort.Strings(pendingNCs)
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ncVersionLagReason
+		condition.Message = "NMAgent has not programmed the latest version of NCs " + strings.Join(pendingNCs, ", ")
+	}
+	if err := service.StatusReporter.SetCondition(ctx, condition); err != nil {
+		logger.Errorf("Failed to set condition %s: %v", condition.Type, err)
+	}
+}
+
+// SetNodeNetworkContainersInternal makes ncRequests, the NCs of the NodeNetworkConfig status, the NCs of the node.
+// The NCs created from an earlier status which are no longer in it are deleted along with their IPs, and the subnet
+// of the first NC becomes the default subnet. NCs with IPs allocated to pods only lose their other IPs, and are kept
+// until the pods release them; InconsistentIPConfigState is returned so the caller retries.
+func (service *HTTPRestService) SetNodeNetworkContainersInternal(ncRequests []cns.CreateNetworkContainerRequest) types.ResponseCode {
+	ncIDs := make(map[string]struct{}, len(ncRequests))
+	for i := range ncRequests {
+		ncIDs[ncRequests[i].NetworkContainerid] = struct{}{}
+	}
+
+	// the ipconfigs of the NCs are rebuilt on reconcile, so a failed sync is not fatal
+	defer service.syncIPConfigState() //nolint:errcheck // logged
+	service.Lock()
+	defer service.Unlock()
+
+	if len(ncRequests) > 0 {
+		service.state.DefaultSubnetName = ncRequests[0].SubnetName
+	}
+
+	returnCode := types.Success
+	for ncID, containerStatus := range service.state.ContainerStatus {
+		if _, found := ncIDs[ncID]; found || containerStatus.CreateNetworkContainerRequest.NetworkContainerType != cns.Docker {
+			continue
+		}
+
+		var allocatedIPCount int
+		for ipID, ipConfig := range service.PodIPConfigState {
+			if ipConfig.NCID != ncID {
+				continue
+			}
+			if ipConfig.State == cns.Allocated {
+				allocatedIPCount++
+				continue
+			}
+			service.removeToBeDeletedIPStateUntransacted(ipID, true)
+		}
+
+		if allocatedIPCount > 0 {
+			logger.Printf("[Azure CNS] Keeping NC %s which is no longer in the NodeNetworkConfig, %d of its IPs are allocated to pods",
+				ncID, allocatedIPCount)
+			returnCode = types.InconsistentIPConfigState
+			continue
+		}
+
+		logger.Printf("[Azure CNS] Deleting NC %s which is no longer in the NodeNetworkConfig", ncID)
+		delete(service.state.ContainerStatus, ncID)
+		for orchestratorContext, networkContainerID := range service.state.ContainerIDByOrchestratorContext {
+			if networkContainerID == ncID {
+				delete(service.state.ContainerIDByOrchestratorContext, orchestratorContext)
+			}
+		}
+	}
+
+	service.saveState()
+	return returnCode
 }
 
 // This API will be called by CNS RequestController on CRD update.
 func (service *HTTPRestService) ReconcileNCState(
-	ncRequest *cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler,
+	ncRequests []cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler,
 	spec v1alpha.NodeNetworkConfigSpec) types.ResponseCode {
 	logger.Printf("Reconciling NC state with podInfo %+v", podInfoByIP)
-	// check if ncRequest is null, then return as there is no CRD state yet
-	if ncRequest == nil {
+	// check if ncRequests is empty, then return as there is no CRD state yet
+	if len(ncRequests) == 0 {
 		logger.Printf("CNS starting with no NC state, podInfoMap count %d", len(podInfoByIP))
 		return types.Success
 	}
 
-	// If the NC was created successfully, then reconcile the allocated pod state
-	returnCode := service.CreateOrUpdateNetworkContainerInternal(*ncRequest)
-	if returnCode != types.Success {
-		return returnCode
+	// If the NCs were created successfully, then reconcile the allocated pod state
+	for i := range ncRequests {
+		returnCode := service.CreateOrUpdateNetworkContainerInternal(ncRequests[i])
+		if returnCode != types.Success {
+			return returnCode
+		}
 	}
 	service.IPAMPoolMonitor.Update(scalar, spec)
 
-	// now parse the secondaryIP list, if it exists in PodInfo list, then allocate that ip
+	// now parse the secondaryIP lists, if it exists in PodInfo list, then allocate that ip
+	for i := range ncRequests {
+		if returnCode := service.reconcileNCAllocatedIPs(&ncRequests[i], podInfoByIP); returnCode != types.Success {
+			return returnCode
+		}
+	}
+
+	// NCs which are no longer in the NodeNetworkConfig but still have IPs allocated to pods are deleted on later reconciles
+	if returnCode := service.SetNodeNetworkContainersInternal(ncRequests); returnCode != types.Success &&
+		returnCode != types.InconsistentIPConfigState {
+		return returnCode
+	}
+
+	err := service.MarkExistingIPsAsPending(spec.IPsNotInUse)
+	if err != nil {
+		logger.Errorf("[Azure CNS] Error. Failed to mark IP's as pending %v", spec.IPsNotInUse)
+		return types.UnexpectedError
+	}
+
+	return 0
+}
+
+// reconcileNCAllocatedIPs allocates the secondary IPs of the NC which are in use by a pod in podInfoByIP to that pod.
+func (service *HTTPRestService) reconcileNCAllocatedIPs(ncRequest *cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo) types.ResponseCode {
 	for _, secIpConfig := range ncRequest.SecondaryIPConfigs {
 		if podInfo, exists := podInfoByIP[secIpConfig.IPAddress]; exists {
 			logger.Printf("SecondaryIP %+v is allocated to Pod. %+v, ncId: %s", secIpConfig, podInfo, ncRequest.NetworkContainerid)
@@ -254,13 +378,7 @@ func (service *HTTPRestService) ReconcileNCState(
 		}
 	}
 
-	err := service.MarkExistingIPsAsPending(spec.IPsNotInUse)
-	if err != nil {
-		logger.Errorf("[Azure CNS] Error. Failed to mark IP's as pending %v", spec.IPsNotInUse)
-		return types.UnexpectedError
-	}
-
-	return 0
+	return types.Success
 }
 
 // GetNetworkContainerInternal gets network container details.
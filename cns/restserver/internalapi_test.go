@@ -9,13 +9,16 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/fakes"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -174,6 +177,26 @@ func TestPendingIPsGotUpdatedWhenSyncHostNCVersion(t *testing.T) {
 	}
 }
 
+func TestSyncHostNCVersionSetsNCProgrammingPending(t *testing.T) {
+	req := createNCReqeustForSyncHostNCVersion(t)
+	reporter := &fakes.StatusReporterFake{}
+	svc.StatusReporter = reporter
+	defer func() { svc.StatusReporter = nil }()
+
+	// the NC was created with a version NMAgent has not programmed yet
+	svc.reportNCProgrammingPending(context.Background())
+	condition := reporter.Condition(v1alpha.NCProgrammingPending)
+	if condition == nil || condition.Status != metav1.ConditionTrue || !strings.Contains(condition.Message, req.NetworkContainerid) {
+		t.Fatalf("Expected NCProgrammingPending=True for NC %s, got %+v", req.NetworkContainerid, condition)
+	}
+
+	svc.SyncHostNCVersion(context.Background(), cns.CRD, 500*time.Millisecond)
+	condition = reporter.Condition(v1alpha.NCProgrammingPending)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Fatalf("Expected NCProgrammingPending=False after NMAgent programmed the NC, got %+v", condition)
+	}
+}
+
 func createNCReqeustForSyncHostNCVersion(t *testing.T) cns.CreateNetworkContainerRequest {
 	restartService()
 	setEnv(t)
@@ -231,7 +254,7 @@ func TestReconcileNCWithExistingState(t *testing.T) {
 	}
 
 	expectedNcCount := len(svc.state.ContainerStatus)
-	returnCode := svc.ReconcileNCState(&req, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
+	returnCode := svc.ReconcileNCState([]cns.CreateNetworkContainerRequest{req}, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
 	if returnCode != types.Success {
 		t.Errorf("Unexpected failure on reconcile with no state %d", returnCode)
 	}
@@ -264,7 +287,7 @@ func TestReconcileNCWithExistingStateFromInterfaceID(t *testing.T) {
 	}
 
 	expectedNcCount := len(svc.state.ContainerStatus)
-	returnCode := svc.ReconcileNCState(&req, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
+	returnCode := svc.ReconcileNCState([]cns.CreateNetworkContainerRequest{req}, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
 	if returnCode != types.Success {
 		t.Errorf("Unexpected failure on reconcile with no state %d", returnCode)
 	}
@@ -296,7 +319,7 @@ func TestReconcileNCWithSystemPods(t *testing.T) {
 	expectedAllocatedPods["192.168.0.1"] = cns.NewPodInfo("", "", "systempod", "kube-system")
 
 	expectedNcCount := len(svc.state.ContainerStatus)
-	returnCode := svc.ReconcileNCState(&req, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
+	returnCode := svc.ReconcileNCState([]cns.CreateNetworkContainerRequest{req}, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
 	if returnCode != types.Success {
 		t.Errorf("Unexpected failure on reconcile with no state %d", returnCode)
 	}
@@ -305,6 +328,108 @@ func TestReconcileNCWithSystemPods(t *testing.T) {
 	validateNCStateAfterReconcile(t, &req, expectedNcCount, expectedAllocatedPods)
 }
 
+func TestReconcileNCWithMultipleNCs(t *testing.T) {
+	restartService()
+	setEnv(t)
+	setOrchestratorTypeInternal(cns.KubernetesCRD)
+
+	var reqs []cns.CreateNetworkContainerRequest
+	for _, prefix := range []string{"10.0.0.", "10.1.0."} {
+		secondaryIPConfigs := make(map[string]cns.SecondaryIPConfig)
+		for i := 6; i < 10; i++ {
+			secondaryIPConfigs[uuid.New().String()] = newSecondaryIPConfig(prefix+strconv.Itoa(i), -1)
+		}
+		reqs = append(reqs, generateNetworkContainerRequest(secondaryIPConfigs, uuid.New().String(), "-1"))
+	}
+
+	expectedAllocatedPods := map[string]cns.PodInfo{
+		"10.0.0.6": cns.NewPodInfo("", "", "reconcilePod1", "PodNS1"),
+		"10.1.0.7": cns.NewPodInfo("", "", "reconcilePod2", "PodNS1"),
+	}
+
+	expectedNcCount := len(svc.state.ContainerStatus)
+	returnCode := svc.ReconcileNCState(reqs, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
+	if returnCode != types.Success {
+		t.Errorf("Unexpected failure on reconcile with multiple NCs %d", returnCode)
+	}
+
+	validateNCStateAfterReconcile(t, nil, expectedNcCount+len(reqs), expectedAllocatedPods)
+
+	// validate rest of Secondary IPs of every NC in Available state
+	for i := range reqs {
+		for secIpId, secIpConfig := range reqs[i].SecondaryIPConfigs {
+			if _, exists := expectedAllocatedPods[secIpConfig.IPAddress]; exists {
+				continue
+			}
+			if state := svc.PodIPConfigState[secIpId].State; state != cns.Available {
+				t.Fatalf("Secondary IP %s of NC %s is not Available, state: %s", secIpConfig.IPAddress, reqs[i].NetworkContainerid, state)
+			}
+		}
+	}
+}
+
+func TestSetNodeNetworkContainersDeletesStaleNCs(t *testing.T) {
+	restartService()
+	setEnv(t)
+	setOrchestratorTypeInternal(cns.KubernetesCRD)
+
+	var reqs []cns.CreateNetworkContainerRequest
+	for _, prefix := range []string{"10.0.0.", "10.1.0.", "10.2.0."} {
+		secondaryIPConfigs := make(map[string]cns.SecondaryIPConfig)
+		for i := 6; i < 8; i++ {
+			secondaryIPConfigs[uuid.New().String()] = newSecondaryIPConfig(prefix+strconv.Itoa(i), -1)
+		}
+		reqs = append(reqs, generateNetworkContainerRequest(secondaryIPConfigs, uuid.New().String(), "-1"))
+	}
+
+	expectedAllocatedPods := map[string]cns.PodInfo{
+		"10.2.0.6": cns.NewPodInfo("", "", "reconcilePod1", "PodNS1"),
+	}
+	returnCode := svc.ReconcileNCState(reqs, expectedAllocatedPods, fakes.NewFakeScalar(releasePercent, requestPercent, batchSize), fakes.NewFakeNodeNetworkConfigSpec(initPoolSize))
+	if returnCode != types.Success {
+		t.Fatalf("Unexpected failure on reconcile with multiple NCs %d", returnCode)
+	}
+
+	ncIPCount := func(ncID string) int {
+		var count int
+		for _, ipConfig := range svc.PodIPConfigState {
+			if ipConfig.NCID == ncID {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the second NC is deleted, the third is kept with only the IP allocated to a pod
+	if returnCode = svc.SetNodeNetworkContainersInternal(reqs[:1]); returnCode != types.InconsistentIPConfigState {
+		t.Fatalf("Expected the NC with an allocated IP to be kept, returnCode: %d", returnCode)
+	}
+	if _, found := svc.state.ContainerStatus[reqs[1].NetworkContainerid]; found || ncIPCount(reqs[1].NetworkContainerid) != 0 {
+		t.Fatalf("Expected NC %s and its IPs to be deleted", reqs[1].NetworkContainerid)
+	}
+	if _, found := svc.state.ContainerStatus[reqs[2].NetworkContainerid]; !found || ncIPCount(reqs[2].NetworkContainerid) != 1 {
+		t.Fatalf("Expected NC %s to be kept with only its allocated IP", reqs[2].NetworkContainerid)
+	}
+	if ncIPCount(reqs[0].NetworkContainerid) != 2 {
+		t.Fatalf("Expected the IPs of NC %s to be kept", reqs[0].NetworkContainerid)
+	}
+
+	// once the pod releases its IP the NC is deleted
+	for _, ipConfig := range svc.PodIPConfigState {
+		if ipConfig.NCID == reqs[2].NetworkContainerid {
+			if err := svc.releaseIPConfig(ipConfig.PodInfo); err != nil {
+				t.Fatalf("Failed to release IP %s, err: %v", ipConfig.IPAddress, err)
+			}
+		}
+	}
+	if returnCode = svc.SetNodeNetworkContainersInternal(reqs[:1]); returnCode != types.Success {
+		t.Fatalf("Unexpected failure on deleting the released NC %d", returnCode)
+	}
+	if _, found := svc.state.ContainerStatus[reqs[2].NetworkContainerid]; found || ncIPCount(reqs[2].NetworkContainerid) != 0 {
+		t.Fatalf("Expected NC %s and its IPs to be deleted", reqs[2].NetworkContainerid)
+	}
+}
+
 func setOrchestratorTypeInternal(orchestratorType string) {
 	fmt.Println("setOrchestratorTypeInternal")
 	svc.state.OrchestratorType = orchestratorType
@@ -497,8 +622,11 @@ func validateNCStateAfterReconcile(t *testing.T, ncRequest *cns.CreateNetworkCon
 	}
 
 	for ipaddress, podInfo := range expectedAllocatedPods {
-		ipId := svc.PodIPIDByPodInterfaceKey[podInfo.Key()]
-		ipConfigstate := svc.PodIPConfigState[ipId]
+		ipIDs := svc.PodIPIDByPodInterfaceKey[podInfo.Key()]
+		if len(ipIDs) != 1 {
+			t.Fatalf("Unexpected number of IPs allocated for Pod: %+v, ipIDs: %+v", podInfo, ipIDs)
+		}
+		ipConfigstate := svc.PodIPConfigState[ipIDs[0]]
 
 		if ipConfigstate.State != cns.Allocated {
 			t.Fatalf("IpAddress %s is not marked as allocated for Pod: %+v, ipState: %+v", ipaddress, podInfo, ipConfigstate)
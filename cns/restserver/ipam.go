@@ -4,54 +4,126 @@
 package restserver
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/filter"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/types"
+	corev1 "k8s.io/api/core/v1"
 )
 
+var (
+	// errNoFreeIPs is returned when a pod can't be allocated an IP as there are no Available IPs in the pool.
+	errNoFreeIPs = errors.New("no more free IPs available, waiting on Azure CNS to allocated more")
+	// errDesiredIPUnavailable is returned when the desired IP is in the pool, but can't be allocated to the pod.
+	errDesiredIPUnavailable = errors.New("desired IP is not available")
+	// errDesiredIPNotFound is returned when the desired IP is not in the pool.
+	errDesiredIPNotFound = errors.New("requested IP not found in pool")
+	// errNoNCForSubnet is returned when there is no NC in the subnet selected by the pod.
+	errNoNCForSubnet = errors.New("no network container found for subnet")
+	// errReplacedSandbox is returned when the IPs of the pod were moved from the infra container of the request to
+	// the one of a newer sandbox.
+	errReplacedSandbox = errors.New("sandbox of the pod was replaced by a newer one")
+)
+
+// allocationFailureReason returns the reason label of the error of a failed IP allocation.
+func allocationFailureReason(err error) string {
+	switch {
+	case errors.Is(err, errNoFreeIPs):
+		return allocationFailureNoFreeIPs
+	case errors.Is(err, errDesiredIPUnavailable):
+		return allocationFailureDesiredIPUnavailable
+	case errors.Is(err, errDesiredIPNotFound):
+		return allocationFailureDesiredIPNotFound
+	case errors.Is(err, errNoNCForSubnet):
+		return allocationFailureNoNCForSubnet
+	case errors.Is(err, errReplacedSandbox):
+		return allocationFailureReplacedSandbox
+	default:
+		return allocationFailureInternal
+	}
+}
+
 // used to request an IPConfig from the CNS state
 func (service *HTTPRestService) requestIPConfigHandler(w http.ResponseWriter, r *http.Request) {
-	var (
-		err             error
-		ipconfigRequest cns.IPConfigRequest
-		podIpInfo       cns.PodIpInfo
-		returnCode      types.ResponseCode
-		returnMessage   string
-	)
-
-	err = service.Listener.Decode(w, r, &ipconfigRequest)
+	var ipconfigRequest cns.IPConfigRequest
+	err := service.Listener.Decode(w, r, &ipconfigRequest)
 	operationName := "requestIPConfigHandler"
 	logger.Request(service.Name+operationName, ipconfigRequest, err)
 	if err != nil {
 		return
 	}
 
+	reserveResp, _ := service.RequestIPConfigInternal(ipconfigRequest)
+	err = service.Listener.Encode(w, &reserveResp)
+	logger.ResponseEx(service.Name+operationName, ipconfigRequest, reserveResp, reserveResp.Response.ReturnCode, err)
+}
+
+// RequestIPConfigInternal allocates IPConfigs to the pod in the request, or returns the ones it already has.
+func (service *HTTPRestService) RequestIPConfigInternal(ipconfigRequest cns.IPConfigRequest) (cns.IPConfigResponse, types.ResponseCode) {
+	var (
+		err           error
+		podIPInfo     []cns.PodIpInfo
+		returnCode    types.ResponseCode
+		returnMessage string
+	)
+
+	// requests beyond the limit are rejected, so they are retried instead of queueing on the service lock
+	release, ok := service.IPRequestLimiter.acquire()
+	if !ok {
+		ipAllocationFailures.WithLabelValues(allocationFailureThrottled).Inc()
+		returnMessage = fmt.Sprintf("Too many IP requests, retry after %v, IP config request is %s", service.IPRequestRetryAfter, ipconfigRequest)
+		return service.retriableIPConfigResponse(types.RequestThrottled, returnMessage), types.RequestThrottled
+	}
+	defer release()
+
 	// retrieve ipconfig from nc
 	_, returnCode, returnMessage = service.validateIPConfigRequest(ipconfigRequest)
 	if returnCode == types.Success {
-		if podIpInfo, err = requestIPConfigHelper(service, ipconfigRequest); err != nil {
+		if podIPInfo, err = requestIPConfigHelper(service, ipconfigRequest); err != nil {
 			returnCode = types.FailedToAllocateIPConfig
 			returnMessage = fmt.Sprintf("AllocateIPConfig failed: %v, IP config request is %s", err, ipconfigRequest)
+			ipAllocationFailures.WithLabelValues(allocationFailureReason(err)).Inc()
+			if errors.Is(err, errNoFreeIPs) {
+				// the pool monitor is scaling up the pool, so the request may succeed when it is retried
+				service.recordPoolExhaustedPodEvent(ipconfigRequest)
+				return service.retriableIPConfigResponse(types.NoFreeIPs, returnMessage), types.NoFreeIPs
+			}
 		}
+	} else {
+		ipAllocationFailures.WithLabelValues(allocationFailureInvalidRequest).Inc()
 	}
 
-	resp := cns.Response{
-		ReturnCode: returnCode,
-		Message:    returnMessage,
+	reserveResp := cns.IPConfigResponse{
+		Response: cns.Response{
+			ReturnCode: returnCode,
+			Message:    returnMessage,
+		},
+		PodIPInfoList: podIPInfo,
 	}
-
-	reserveResp := &cns.IPConfigResponse{
-		Response: resp,
+	// PodIpInfo carries the first (IPv4 if assigned) IP for clients which are not dual-stack aware
+	if len(podIPInfo) > 0 {
+		reserveResp.PodIpInfo = podIPInfo[0]
 	}
-	reserveResp.PodIpInfo = podIpInfo
 
-	err = service.Listener.Encode(w, &reserveResp)
-	logger.ResponseEx(service.Name+operationName, ipconfigRequest, reserveResp, resp.ReturnCode, err)
+	return reserveResp, returnCode
+}
+
+// retriableIPConfigResponse is the response to an IP request which failed with a retriable code, which asks the
+// caller to retry after IPRequestRetryAfter.
+func (service *HTTPRestService) retriableIPConfigResponse(returnCode types.ResponseCode, message string) cns.IPConfigResponse {
+	return cns.IPConfigResponse{
+		Response: cns.Response{
+			ReturnCode: returnCode,
+			Message:    message,
+		},
+		RetryAfterInMs: int(service.IPRequestRetryAfter.Milliseconds()),
+	}
 }
 
 func (service *HTTPRestService) releaseIPConfigHandler(w http.ResponseWriter, r *http.Request) {
@@ -73,25 +145,42 @@ func (service *HTTPRestService) releaseIPConfigHandler(w http.ResponseWriter, r
 		return
 	}
 
+	resp = service.ReleaseIPConfigInternal(req)
+}
+
+// ReleaseIPConfigInternal releases the IPConfigs of the pod in the request.
+func (service *HTTPRestService) ReleaseIPConfigInternal(req cns.IPConfigRequest) cns.Response {
+	var resp cns.Response
 	var podInfo cns.PodInfo
 	podInfo, resp.ReturnCode, resp.Message = service.validateIPConfigRequest(req)
 
-	if err = service.releaseIPConfig(podInfo); err != nil {
+	if err := service.releaseIPConfig(podInfo); err != nil {
 		resp.ReturnCode = types.UnexpectedError
 		resp.Message = err.Error()
 		logger.Errorf("releaseIPConfigHandler releaseIPConfig failed because %v, release IP config info %s", resp.Message, req)
-		return
 	}
+
+	return resp
 }
 
 // MarkIPAsPendingRelease will set the IPs which are in PendingProgramming or Available to PendingRelease state
 // It will try to update [totalIpsToRelease]  number of ips.
-func (service *HTTPRestService) MarkIPAsPendingRelease(totalIpsToRelease int) (map[string]cns.IPConfigurationStatus, error) {
+func (service *HTTPRestService) MarkIPAsPendingRelease(totalIpsToRelease int) (_ map[string]cns.IPConfigurationStatus, err error) {
 	pendingReleasedIps := make(map[string]cns.IPConfigurationStatus)
+	defer func() {
+		if syncErr := service.syncIPConfigState(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}()
+
 	service.Lock()
 	defer service.Unlock()
 
+	// the pool monitor only scales the default subnet
 	for uuid, existingIpConfig := range service.PodIPConfigState {
+		if !service.inDefaultSubnetUntransacted(existingIpConfig.NCID) {
+			continue
+		}
 		if existingIpConfig.State == cns.PendingProgramming {
 			updatedIpConfig, err := service.updateIPConfigState(uuid, cns.PendingRelease, existingIpConfig.PodInfo)
 			if err != nil {
@@ -107,6 +196,9 @@ func (service *HTTPRestService) MarkIPAsPendingRelease(totalIpsToRelease int) (m
 
 	// if not all expected IPs are set to PendingRelease, then check the Available IPs
 	for uuid, existingIpConfig := range service.PodIPConfigState {
+		if !service.inDefaultSubnetUntransacted(existingIpConfig.NCID) {
+			continue
+		}
 		if existingIpConfig.State == cns.Available {
 			updatedIpConfig, err := service.updateIPConfigState(uuid, cns.PendingRelease, existingIpConfig.PodInfo)
 			if err != nil {
@@ -128,9 +220,14 @@ func (service *HTTPRestService) MarkIPAsPendingRelease(totalIpsToRelease int) (m
 func (service *HTTPRestService) updateIPConfigState(ipID string, updatedState cns.IPConfigState, podInfo cns.PodInfo) (cns.IPConfigurationStatus, error) {
 	if ipConfig, found := service.PodIPConfigState[ipID]; found {
 		logger.Printf("[updateIPConfigState] Changing IpId [%s] state to [%s], podInfo [%+v]. Current config [%+v]", ipID, updatedState, podInfo, ipConfig)
-		ipConfig.State = updatedState
+		transitionIPConfigState(&ipConfig, updatedState)
 		ipConfig.PodInfo = podInfo
-		service.PodIPConfigState[ipID] = ipConfig
+		ipConfig.CooldownStartTime = time.Time{}
+		// persist the transition before applying it, so CNS never hands out an IP it could forget on restart
+		if err := service.saveIPConfigState(ipConfig); err != nil {
+			return cns.IPConfigurationStatus{}, err
+		}
+		service.setPodIPConfigStateUntransacted(ipConfig)
 		return ipConfig, nil
 	}
 
@@ -138,6 +235,14 @@ func (service *HTTPRestService) updateIPConfigState(ipID string, updatedState cn
 	return cns.IPConfigurationStatus{}, fmt.Errorf("[updateIPConfigState] Failed to update state %s for the IPConfig. ID %s not found PodIPConfigState", updatedState, ipID)
 }
 
+// transitionIPConfigState sets the state of the ipconfig, and when it entered the state if the state changes.
+func transitionIPConfigState(ipconfig *cns.IPConfigurationStatus, state cns.IPConfigState) {
+	if ipconfig.State != state || ipconfig.LastStateTransitionTime.IsZero() {
+		ipconfig.LastStateTransitionTime = time.Now().UTC()
+	}
+	ipconfig.State = state
+}
+
 // MarkIpsAsAvailableUntransacted will update pending programming IPs to available if NMAgent side's programmed nc version keep up with nc version.
 // Note: this func is an untransacted API as the caller will take a Service lock
 func (service *HTTPRestService) MarkIpsAsAvailableUntransacted(ncID string, newHostNCVersion int) {
@@ -172,6 +277,30 @@ func (service *HTTPRestService) MarkIpsAsAvailableUntransacted(ncID string, newH
 	}
 }
 
+// GetDefaultSubnetNCIDs returns the IDs of the NCs in the default subnet, which the pool monitor scales. It returns
+// nil while the default subnet is not known, when all NCs are in it.
+func (service *HTTPRestService) GetDefaultSubnetNCIDs() map[string]struct{} {
+	service.RLock()
+	defer service.RUnlock()
+	if service.state.DefaultSubnetName == "" {
+		return nil
+	}
+	ncIDs := make(map[string]struct{})
+	for ncID := range service.state.ContainerStatus {
+		if service.inDefaultSubnetUntransacted(ncID) {
+			ncIDs[ncID] = struct{}{}
+		}
+	}
+	return ncIDs
+}
+
+// inDefaultSubnetUntransacted returns whether the NC is in the default subnet, which pods without a
+// PodSubnetNameAnnotation draw their IPs from. All NCs are in it while the default subnet is not known.
+func (service *HTTPRestService) inDefaultSubnetUntransacted(ncID string) bool {
+	return service.state.DefaultSubnetName == "" ||
+		service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.SubnetName == service.state.DefaultSubnetName
+}
+
 func (service *HTTPRestService) GetPodIPConfigState() map[string]cns.IPConfigurationStatus {
 	service.RLock()
 	defer service.RUnlock()
@@ -186,7 +315,13 @@ func (service *HTTPRestService) handleDebugPodContext(w http.ResponseWriter, r *
 	service.RLock()
 	defer service.RUnlock()
 	resp := cns.GetPodContextResponse{
-		PodContext: service.PodIPIDByPodInterfaceKey,
+		PodContext:     make(map[string]string, len(service.PodIPIDByPodInterfaceKey)),
+		PodContextList: service.PodIPIDByPodInterfaceKey,
+	}
+	for podInterfaceKey, ipIDs := range service.PodIPIDByPodInterfaceKey {
+		if len(ipIDs) > 0 {
+			resp.PodContext[podInterfaceKey] = ipIDs[0]
+		}
 	}
 	err := service.Listener.Encode(w, &resp)
 	logger.Response(service.Name, resp, resp.Response.ReturnCode, err)
@@ -206,6 +341,35 @@ func (service *HTTPRestService) handleDebugRestData(w http.ResponseWriter, r *ht
 	logger.Response(service.Name, resp, resp.Response.ReturnCode, err)
 }
 
+func (service *HTTPRestService) handleDebugIPLeaks(w http.ResponseWriter, r *http.Request) {
+	var resp cns.GetIPLeaksResponse
+	if service.IPAMLeakDetector == nil {
+		resp.Response = cns.Response{
+			ReturnCode: types.UnsupportedOrchestratorType,
+			Message:    "IPAM leak detector only runs for orchestrator type " + cns.KubernetesCRD,
+		}
+	} else {
+		resp.IPAMLeakDetector = service.IPAMLeakDetector.GetStateSnapshot()
+	}
+	err := service.Listener.Encode(w, &resp)
+	logger.Response(service.Name, resp, resp.Response.ReturnCode, err)
+}
+
+func (service *HTTPRestService) handleDebugConfig(w http.ResponseWriter, r *http.Request) {
+	var resp GetConfigResponse
+	if service.ConfigWatcher == nil {
+		resp.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    "CNS is not watching its config file",
+		}
+	} else {
+		resp.Config = service.ConfigWatcher.Active()
+		resp.ReloadStatus = service.ConfigWatcher.Status()
+	}
+	err := service.Listener.Encode(w, &resp)
+	logger.Response(service.Name, resp, resp.Response.ReturnCode, err)
+}
+
 func (service *HTTPRestService) handleDebugIPAddresses(w http.ResponseWriter, r *http.Request) {
 	var req cns.GetIPAddressesRequest
 	if err := service.Listener.Decode(w, r, &req); err != nil {
@@ -227,6 +391,13 @@ func (service *HTTPRestService) handleDebugIPAddresses(w http.ResponseWriter, r
 	logger.ResponseEx(service.Name, req, resp, resp.Response.ReturnCode, err)
 }
 
+// GetIPConfigsMatchingStates returns a filtered list of IPs which are in any of the states.
+func (service *HTTPRestService) GetIPConfigsMatchingStates(states ...cns.IPConfigState) []cns.IPConfigurationStatus {
+	service.RLock()
+	defer service.RUnlock()
+	return filter.MatchAnyIPConfigState(service.PodIPConfigState, filter.PredicatesForStates(states...)...)
+}
+
 // GetAllocatedIPConfigs returns a filtered list of IPs which are in
 // Allocated State.
 func (service *HTTPRestService) GetAllocatedIPConfigs() []cns.IPConfigurationStatus {
@@ -251,6 +422,14 @@ func (service *HTTPRestService) GetPendingProgramIPConfigs() []cns.IPConfigurati
 	return filter.MatchAnyIPConfigState(service.PodIPConfigState, filter.StatePendingProgramming)
 }
 
+// GetCooldownIPConfigs returns a filtered list of IPs which are in
+// Cooldown State.
+func (service *HTTPRestService) GetCooldownIPConfigs() []cns.IPConfigurationStatus {
+	service.RLock()
+	defer service.RUnlock()
+	return filter.MatchAnyIPConfigState(service.PodIPConfigState, filter.StateCooldown)
+}
+
 // GetPendingReleaseIPConfigs returns a filtered list of IPs which are in
 // PendingRelease State.
 func (service *HTTPRestService) GetPendingReleaseIPConfigs() []cns.IPConfigurationStatus {
@@ -267,7 +446,12 @@ func (service *HTTPRestService) setIPConfigAsAllocated(ipconfig cns.IPConfigurat
 		return err
 	}
 
-	service.PodIPIDByPodInterfaceKey[podInfo.Key()] = ipconfig.ID
+	for _, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
+		if ipID == ipconfig.ID {
+			return nil
+		}
+	}
+	service.PodIPIDByPodInterfaceKey[podInfo.Key()] = append(service.PodIPIDByPodInterfaceKey[podInfo.Key()], ipconfig.ID)
 	return nil
 }
 
@@ -278,43 +462,149 @@ func (service *HTTPRestService) setIPConfigAsAvailable(ipconfig cns.IPConfigurat
 		return cns.IPConfigurationStatus{}, err
 	}
 
-	delete(service.PodIPIDByPodInterfaceKey, podInfo.Key())
+	service.removePodIPIDUntransacted(podInfo, ipconfig.ID)
 	logger.Printf("[setIPConfigAsAvailable] Deleted outdated pod info %s from PodIPIDByOrchestratorContext since IP %s with ID %s will be released and set as Available",
 		podInfo.Key(), ipconfig.IPAddress, ipconfig.ID)
 	return ipconfig, nil
 }
 
-////SetIPConfigAsAllocated takes a lock of the service, and sets the ipconfig in the CNS stateas Available
+// setIPConfigAsReleased sets the ipconfig released by the pod as Cooldown if an IP cooldown is configured, so that
+// it isn't handed to the next pod while conntrack entries and network policies may still refer to it.
+// Without an IP cooldown the ipconfig is set as Available. Does not take a lock.
+func (service *HTTPRestService) setIPConfigAsReleased(ipconfig cns.IPConfigurationStatus, podInfo cns.PodInfo) (cns.IPConfigurationStatus, error) {
+	if service.IPCooldown <= 0 {
+		return service.setIPConfigAsAvailable(ipconfig, podInfo)
+	}
+
+	logger.Printf("[setIPConfigAsReleased] Changing IpId [%s] state to [%s] for %v. Current config [%+v]", ipconfig.ID, cns.Cooldown, service.IPCooldown, ipconfig)
+	transitionIPConfigState(&ipconfig, cns.Cooldown)
+	ipconfig.PodInfo = nil
+	ipconfig.CooldownStartTime = ipconfig.LastStateTransitionTime
+	if err := service.saveIPConfigState(ipconfig); err != nil {
+		return cns.IPConfigurationStatus{}, err
+	}
+	service.setPodIPConfigStateUntransacted(ipconfig)
+
+	service.removePodIPIDUntransacted(podInfo, ipconfig.ID)
+	logger.Printf("[setIPConfigAsReleased] Deleted outdated pod info %s from PodIPIDByOrchestratorContext since IP %s with ID %s will be released and set as Cooldown",
+		podInfo.Key(), ipconfig.IPAddress, ipconfig.ID)
+	return ipconfig, nil
+}
+
+// MarkExpiredCooldownIPsAsAvailable sets the ipconfigs which have been in Cooldown for the IP cooldown as Available.
+func (service *HTTPRestService) MarkExpiredCooldownIPsAsAvailable() {
+	// a failed sync is persisted by the next write to the ipam store, which compacts it
+	defer service.syncIPConfigState() //nolint:errcheck // logged
+	service.Lock()
+	defer service.Unlock()
+
+	now := time.Now()
+	for ipID, ipconfig := range service.PodIPConfigState {
+		if ipconfig.State != cns.Cooldown || now.Sub(ipconfig.CooldownStartTime) < service.IPCooldown {
+			continue
+		}
+
+		if _, err := service.updateIPConfigState(ipID, cns.Available, nil); err != nil {
+			logger.Errorf("[MarkExpiredCooldownIPsAsAvailable] Error updating IPConfig [%+v] state to Available, err: %+v", ipconfig, err)
+		}
+	}
+}
+
+// removePodIPIDUntransacted removes the ipconfig from the ipconfigs allocated to the pod, does not take a lock
+func (service *HTTPRestService) removePodIPIDUntransacted(podInfo cns.PodInfo, ipconfigID string) {
+	ipIDs := service.PodIPIDByPodInterfaceKey[podInfo.Key()]
+	remainingIPIDs := make([]string, 0, len(ipIDs))
+	for _, ipID := range ipIDs {
+		if ipID != ipconfigID {
+			remainingIPIDs = append(remainingIPIDs, ipID)
+		}
+	}
+
+	if len(remainingIPIDs) == 0 {
+		delete(service.PodIPIDByPodInterfaceKey, podInfo.Key())
+		delete(service.replacedSandboxes, podInfo.Key())
+	} else {
+		service.PodIPIDByPodInterfaceKey[podInfo.Key()] = remainingIPIDs
+	}
+}
+
+// releaseIPConfig takes a lock of the service, and sets the ipconfigs of the pod in the CNS state as Available.
+// Only the ipconfigs owned by the infra container of the request are released, so a DEL for a sandbox which has
+// been replaced doesn't release the IPs of the new sandbox.
 // Todo - CNI should also pass the IPAddress which needs to be released to validate if that is the right IP allcoated
 // in the first place.
-func (service *HTTPRestService) releaseIPConfig(podInfo cns.PodInfo) error {
+func (service *HTTPRestService) releaseIPConfig(podInfo cns.PodInfo) (err error) {
+	defer func() {
+		if syncErr := service.syncIPConfigState(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}()
+
 	service.Lock()
 	defer service.Unlock()
 
-	ipID := service.PodIPIDByPodInterfaceKey[podInfo.Key()]
-	if ipID != "" {
+	ipIDs := service.PodIPIDByPodInterfaceKey[podInfo.Key()]
+	if len(ipIDs) == 0 {
+		logger.Errorf("[releaseIPConfig] SetIPConfigAsAvailable ignoring request to release, no allocation found for pod [%+v]", podInfo)
+		return nil
+	}
+
+	for _, ipID := range ipIDs {
 		if ipconfig, isExist := service.PodIPConfigState[ipID]; isExist {
+			if !isSameContainer(ipconfig.PodInfo, podInfo) {
+				logger.Printf("[releaseIPConfig] Ignoring request to release IP %s for pod %+v, it is owned by infra container %s",
+					ipconfig.IPAddress, podInfo, ipconfig.PodInfo.InfraContainerID())
+				continue
+			}
 			logger.Printf("[releaseIPConfig] Releasing IP %+v for pod %+v", ipconfig.IPAddress, podInfo)
-			_, err := service.setIPConfigAsAvailable(ipconfig, podInfo)
+			_, err := service.setIPConfigAsReleased(ipconfig, podInfo)
 			if err != nil {
-				return fmt.Errorf("[releaseIPConfig] failed to mark IPConfig [%+v] as Available. err: %v", ipconfig, err)
+				return fmt.Errorf("[releaseIPConfig] failed to release IPConfig [%+v]. err: %v", ipconfig, err)
 			}
 			logger.Printf("[releaseIPConfig] Released IP %+v for pod %+v", ipconfig.IPAddress, podInfo)
 		} else {
 			logger.Errorf("[releaseIPConfig] Failed to get release ipconfig %+v and pod info is %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt",
-				ipconfig.IPAddress, podInfo)
+				ipID, podInfo)
 			return fmt.Errorf("[releaseIPConfig] releaseIPConfig failed. IPconfig %+v and pod info is %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt",
-				ipconfig.IPAddress, podInfo)
+				ipID, podInfo)
 		}
-	} else {
-		logger.Errorf("[releaseIPConfig] SetIPConfigAsAvailable ignoring request to release, no allocation found for pod [%+v]", podInfo)
-		return nil
+	}
+	return nil
+}
+
+// ReleaseLeakedIPConfig takes a lock of the service, and sets the ipconfig as Available if it is still
+// Allocated to the same pod. This guards against releasing an IP that was reallocated since it was found leaked.
+func (service *HTTPRestService) ReleaseLeakedIPConfig(leaked cns.IPConfigurationStatus) (err error) {
+	defer func() {
+		if syncErr := service.syncIPConfigState(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}()
+
+	service.Lock()
+	defer service.Unlock()
+
+	ipconfig, isExist := service.PodIPConfigState[leaked.ID]
+	if !isExist || ipconfig.State != cns.Allocated || ipconfig.PodInfo == nil || leaked.PodInfo == nil ||
+		ipconfig.PodInfo.Key() != leaked.PodInfo.Key() {
+		return fmt.Errorf("[ReleaseLeakedIPConfig] ipconfig %s is no longer allocated to pod %+v", leaked.ID, leaked.PodInfo)
+	}
+
+	logger.Printf("[ReleaseLeakedIPConfig] Releasing leaked IP %s for pod %+v", ipconfig.IPAddress, ipconfig.PodInfo)
+	if _, err := service.setIPConfigAsReleased(ipconfig, ipconfig.PodInfo); err != nil {
+		return fmt.Errorf("[ReleaseLeakedIPConfig] failed to release IPConfig [%+v]. err: %v", ipconfig, err)
 	}
 	return nil
 }
 
 // called when CNS is starting up and there are existing ipconfigs in the CRD that are marked as pending
-func (service *HTTPRestService) MarkExistingIPsAsPending(pendingIPIDs []string) error {
+func (service *HTTPRestService) MarkExistingIPsAsPending(pendingIPIDs []string) (err error) {
+	defer func() {
+		if syncErr := service.syncIPConfigState(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}()
+
 	service.Lock()
 	defer service.Unlock()
 
@@ -325,8 +615,11 @@ func (service *HTTPRestService) MarkExistingIPsAsPending(pendingIPIDs []string)
 			}
 
 			logger.Printf("[MarkExistingIPsAsPending]: Marking IP [%+v] to PendingRelease", ipconfig)
-			ipconfig.State = cns.PendingRelease
-			service.PodIPConfigState[id] = ipconfig
+			transitionIPConfigState(&ipconfig, cns.PendingRelease)
+			if err := service.saveIPConfigState(ipconfig); err != nil {
+				return err
+			}
+			service.setPodIPConfigStateUntransacted(ipconfig)
 		} else {
 			logger.Errorf("Inconsistent state, ipconfig with ID [%v] marked as pending release, but does not exist in state", id)
 		}
@@ -334,33 +627,54 @@ func (service *HTTPRestService) MarkExistingIPsAsPending(pendingIPIDs []string)
 	return nil
 }
 
-func (service *HTTPRestService) GetExistingIPConfig(podInfo cns.PodInfo) (cns.PodIpInfo, bool, error) {
-	var (
-		podIpInfo cns.PodIpInfo
-		isExist   bool
-	)
+// claimExistingIPConfigsUntransacted returns the ipconfigs already allocated to the pod, one per address family.
+// An ADD retried by the same infra container gets the same IPs back. If the pod sandbox was recreated with a new
+// infra container, the IPs move to the new container so that the DEL of the old sandbox doesn't release them.
+// A delayed ADD of the old sandbox fails instead of moving them back. Does not take a lock.
+func (service *HTTPRestService) claimExistingIPConfigsUntransacted(podInfo cns.PodInfo) ([]cns.PodIpInfo, error) {
+	ipIDs := service.PodIPIDByPodInterfaceKey[podInfo.Key()]
+	if len(ipIDs) == 0 {
+		return nil, nil
+	}
 
-	service.RLock()
-	defer service.RUnlock()
+	if service.isReplacedSandboxUntransacted(podInfo) {
+		return nil, fmt.Errorf("[claimExistingIPConfigs] %w, pod %s infra container %s", errReplacedSandbox,
+			podInfo.Key(), podInfo.InfraContainerID())
+	}
 
-	ipID := service.PodIPIDByPodInterfaceKey[podInfo.Key()]
-	if ipID != "" {
-		if ipState, isExist := service.PodIPConfigState[ipID]; isExist {
-			err := service.populateIpConfigInfoUntransacted(ipState, &podIpInfo)
-			return podIpInfo, isExist, err
+	podIPInfo := make([]cns.PodIpInfo, 0, len(ipIDs))
+	for _, ipID := range sortedByAddressFamily(service.PodIPConfigState, ipIDs) {
+		ipState, isExist := service.PodIPConfigState[ipID]
+		if !isExist {
+			logger.Errorf("Failed to get existing ipconfig. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt")
+			return nil, fmt.Errorf("Failed to get existing ipconfig. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt")
 		}
 
-		logger.Errorf("Failed to get existing ipconfig. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt")
-		return podIpInfo, isExist, fmt.Errorf("Failed to get existing ipconfig. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt")
+		if isNewOwner(ipState.PodInfo, podInfo) {
+			if !isSameContainer(ipState.PodInfo, podInfo) {
+				logger.Printf("[claimExistingIPConfigs] Sandbox of pod %s was recreated, moving IP %s from infra container %s to %s",
+					podInfo.Key(), ipState.IPAddress, ipState.PodInfo.InfraContainerID(), podInfo.InfraContainerID())
+				service.addReplacedSandboxUntransacted(ipState.PodInfo)
+			}
+			var err error
+			if ipState, err = service.updateIPConfigState(ipID, cns.Allocated, podInfo); err != nil {
+				return nil, err
+			}
+		}
+
+		var info cns.PodIpInfo
+		if err := service.populateIpConfigInfoUntransacted(ipState, &info); err != nil {
+			return nil, err
+		}
+		podIPInfo = append(podIPInfo, info)
 	}
 
-	return podIpInfo, isExist, nil
+	return podIPInfo, nil
 }
 
-func (service *HTTPRestService) AllocateDesiredIPConfig(podInfo cns.PodInfo, desiredIpAddress string) (cns.PodIpInfo, error) {
+// allocateDesiredIPConfigUntransacted allocates the desired IP to the pod. Does not take a lock.
+func (service *HTTPRestService) allocateDesiredIPConfigUntransacted(podInfo cns.PodInfo, desiredIpAddress string) (cns.PodIpInfo, error) {
 	var podIpInfo cns.PodIpInfo
-	service.Lock()
-	defer service.Unlock()
 
 	found := false
 	for _, ipConfig := range service.PodIPConfigState {
@@ -372,7 +686,7 @@ func (service *HTTPRestService) AllocateDesiredIPConfig(podInfo cns.PodInfo, des
 					logger.Printf("[AllocateDesiredIPConfig]: IP Config [%+v] is already allocated to this Pod [%+v]", ipConfig, podInfo)
 					found = true
 				} else {
-					return podIpInfo, fmt.Errorf("[AllocateDesiredIPConfig] Desired IP is already allocated %+v, requested for pod %+v", ipConfig, podInfo)
+					return podIpInfo, fmt.Errorf("[AllocateDesiredIPConfig] %w, it is already allocated %+v, requested for pod %+v", errDesiredIPUnavailable, ipConfig, podInfo)
 				}
 			} else if ipConfig.State == cns.Available || ipConfig.State == cns.PendingProgramming {
 				// This race can happen during restart, where CNS state is lost and thus we have lost the NC programmed version
@@ -382,7 +696,7 @@ func (service *HTTPRestService) AllocateDesiredIPConfig(podInfo cns.PodInfo, des
 				}
 				found = true
 			} else {
-				return podIpInfo, fmt.Errorf("[AllocateDesiredIPConfig] Desired IP is not available %+v", ipConfig)
+				return podIpInfo, fmt.Errorf("[AllocateDesiredIPConfig] %w %+v", errDesiredIPUnavailable, ipConfig)
 			}
 
 			if found {
@@ -391,54 +705,205 @@ func (service *HTTPRestService) AllocateDesiredIPConfig(podInfo cns.PodInfo, des
 			}
 		}
 	}
-	return podIpInfo, fmt.Errorf("Requested IP not found in pool")
+	return podIpInfo, errDesiredIPNotFound
 }
 
-func (service *HTTPRestService) AllocateAnyAvailableIPConfig(podInfo cns.PodInfo) (cns.PodIpInfo, error) {
-	service.Lock()
-	defer service.Unlock()
+// recordPoolExhaustedPodEvent records an Event on the pod of the request, which could not be allocated an IP as
+// none are free.
+func (service *HTTPRestService) recordPoolExhaustedPodEvent(req cns.IPConfigRequest) {
+	if service.StatusReporter == nil {
+		return
+	}
+	podInfo, err := cns.NewPodInfoFromIPConfigRequest(req)
+	if err != nil {
+		return
+	}
+	service.StatusReporter.RecordPodEvent(podInfo.Name(), podInfo.Namespace(), corev1.EventTypeWarning, failedAllocateIPReason,
+		"Azure CNS has no free IPs to allocate to the pod, waiting for more IPs to be allocated to the node")
+}
 
+// allocateAnyAvailableIPConfigUntransacted allocates one available IP per address family present in the pool,
+// across all NCs, so that dual-stack pods get both an IPv4 and an IPv6 address.
+// Either every family gets an IP or none is allocated. Does not take a lock.
+func (service *HTTPRestService) allocateAnyAvailableIPConfigUntransacted(podInfo cns.PodInfo) ([]cns.PodIpInfo, error) {
+	// pods which select a subnet are only allocated IPs from the NCs in that subnet, other pods from the default subnet
+	subnetName := podInfo.SubnetName()
+
+	families := make(map[cns.IPFamily]struct{})
+	availableByFamily := make(map[cns.IPFamily]cns.IPConfigurationStatus)
 	for _, ipState := range service.PodIPConfigState {
-		if ipState.State == cns.Available {
-			if err := service.setIPConfigAsAllocated(ipState, podInfo); err != nil {
-				return cns.PodIpInfo{}, err
-			}
+		if subnetName != "" && service.state.ContainerStatus[ipState.NCID].CreateNetworkContainerRequest.SubnetName != subnetName {
+			continue
+		}
+		if subnetName == "" && !service.inDefaultSubnetUntransacted(ipState.NCID) {
+			continue
+		}
+		family := cns.GetIPFamily(ipState.IPAddress)
+		families[family] = struct{}{}
+		if _, found := availableByFamily[family]; !found && ipState.State == cns.Available {
+			availableByFamily[family] = ipState
+		}
+	}
 
-			podIPInfo := cns.PodIpInfo{}
-			if err := service.populateIpConfigInfoUntransacted(ipState, &podIPInfo); err != nil {
-				return cns.PodIpInfo{}, err
-			}
+	if len(families) == 0 && subnetName != "" {
+		return nil, fmt.Errorf("%w %s selected by pod %s", errNoNCForSubnet, subnetName, podInfo.Key())
+	}
+
+	if len(families) == 0 || len(availableByFamily) != len(families) {
+		return nil, errNoFreeIPs
+	}
+
+	podIPInfo := make([]cns.PodIpInfo, 0, len(availableByFamily))
+	allocated := make([]cns.IPConfigurationStatus, 0, len(availableByFamily))
+	for _, family := range []cns.IPFamily{cns.IPv4Family, cns.IPv6Family} {
+		ipState, found := availableByFamily[family]
+		if !found {
+			continue
+		}
+
+		if err := service.setIPConfigAsAllocated(ipState, podInfo); err != nil {
+			service.rollbackAllocatedIPConfigsUntransacted(allocated, podInfo)
+			return nil, err
+		}
+		allocated = append(allocated, ipState)
 
-			return podIPInfo, nil
+		info := cns.PodIpInfo{}
+		if err := service.populateIpConfigInfoUntransacted(ipState, &info); err != nil {
+			service.rollbackAllocatedIPConfigsUntransacted(allocated, podInfo)
+			return nil, err
 		}
+		podIPInfo = append(podIPInfo, info)
 	}
-	//nolint:goerr113
-	return cns.PodIpInfo{}, fmt.Errorf("no more free IPs available, waiting on Azure CNS to allocated more")
+
+	return podIPInfo, nil
 }
 
-// If IPConfig is already allocated for pod, it returns that else it returns one of the available ipconfigs.
-func requestIPConfigHelper(service *HTTPRestService, req cns.IPConfigRequest) (cns.PodIpInfo, error) {
-	var (
-		podIpInfo cns.PodIpInfo
-		isExist   bool
-	)
+// rollbackAllocatedIPConfigsUntransacted sets the ipconfigs allocated to the pod by a failed allocation back to
+// Available. They were never handed to the pod, so they skip the IP cooldown. Does not take a lock.
+func (service *HTTPRestService) rollbackAllocatedIPConfigsUntransacted(allocated []cns.IPConfigurationStatus, podInfo cns.PodInfo) {
+	for _, ipState := range allocated {
+		if _, err := service.setIPConfigAsAvailable(ipState, podInfo); err != nil {
+			logger.Errorf("[allocateAnyAvailableIPConfig] Failed to roll back ipconfig %s allocated to pod %s, err: %v",
+				ipState.ID, podInfo.Key(), err)
+		}
+	}
+}
 
-	// check if ipconfig already allocated for this pod and return if exists or error
-	// if error, ipstate is nil, if exists, ipstate is not nil and error is nil
+// If IPConfigs are already allocated for pod, it returns those else it returns one of the available ipconfigs
+// per address family. The lookup and the allocation are done under one lock, so racing ADDs for the same pod
+// don't allocate it more than one IP per address family.
+func requestIPConfigHelper(service *HTTPRestService, req cns.IPConfigRequest) (podIPInfo []cns.PodIpInfo, err error) {
 	podInfo, err := cns.NewPodInfoFromIPConfigRequest(req)
 	if err != nil {
-		return podIpInfo, err
+		return nil, err
 	}
 
-	if podIpInfo, isExist, err = service.GetExistingIPConfig(podInfo); err != nil || isExist {
-		return podIpInfo, err
+	// the IPs are only returned once they are durable, which is waited for after the lock is released. If that
+	// fails, the request fails and the IPs are released by the DEL which follows the failed ADD.
+	defer func() {
+		if syncErr := service.syncIPConfigState(); syncErr != nil && err == nil {
+			podIPInfo, err = nil, syncErr
+		}
+	}()
+
+	service.Lock()
+	defer service.Unlock()
+
+	podIPInfo, err = service.claimExistingIPConfigsUntransacted(podInfo)
+	if err != nil {
+		return nil, err
 	}
 
-	// return desired IPConfig
+	// return desired IPConfig, unless the pod already has an IP of the same address family.
+	// Dual-stack pods are reconciled one desired IP at a time.
 	if req.DesiredIPAddress != "" {
-		return service.AllocateDesiredIPConfig(podInfo, req.DesiredIPAddress)
+		desiredFamily := cns.GetIPFamily(req.DesiredIPAddress)
+		for i := range podIPInfo {
+			if cns.GetIPFamily(podIPInfo[i].PodIPConfig.IPAddress) == desiredFamily {
+				return podIPInfo, nil
+			}
+		}
+
+		info, err := service.allocateDesiredIPConfigUntransacted(podInfo, req.DesiredIPAddress)
+		if err != nil {
+			return nil, err
+		}
+		return append(podIPInfo, info), nil
+	}
+
+	if len(podIPInfo) > 0 {
+		return podIPInfo, nil
 	}
 
 	// return any free IPConfig
-	return service.AllocateAnyAvailableIPConfig(podInfo)
+	return service.allocateAnyAvailableIPConfigUntransacted(podInfo)
+}
+
+// isSameContainer returns true if the ipconfig owned by owner was allocated to the infra container of requester.
+// The infra container IDs are compared if both are known, else the interface IDs. PodInfos without either,
+// such as the ones reconciled from the API server, match any container.
+func isSameContainer(owner, requester cns.PodInfo) bool {
+	if owner == nil {
+		return true
+	}
+	if owner.InfraContainerID() != "" && requester.InfraContainerID() != "" {
+		return owner.InfraContainerID() == requester.InfraContainerID()
+	}
+	if owner.InterfaceID() != "" && requester.InterfaceID() != "" {
+		return owner.InterfaceID() == requester.InterfaceID()
+	}
+	return true
+}
+
+// isNewOwner returns true if the requester knows its infra container and it isn't the one recorded on the ipconfig.
+func isNewOwner(owner, requester cns.PodInfo) bool {
+	if owner == nil {
+		return true
+	}
+	return (requester.InfraContainerID() != "" && requester.InfraContainerID() != owner.InfraContainerID()) ||
+		(requester.InterfaceID() != "" && requester.InterfaceID() != owner.InterfaceID())
+}
+
+// addReplacedSandboxUntransacted records that the sandbox of owner was replaced by a newer one, so that its ADDs
+// don't move the IPs of the pod back to it. The sandboxes are forgotten once the pod has no IPs left. Does not take
+// a lock.
+func (service *HTTPRestService) addReplacedSandboxUntransacted(owner cns.PodInfo) {
+	if service.replacedSandboxes == nil {
+		service.replacedSandboxes = make(map[string]map[string]struct{})
+	}
+	sandboxes, ok := service.replacedSandboxes[owner.Key()]
+	if !ok {
+		sandboxes = make(map[string]struct{})
+		service.replacedSandboxes[owner.Key()] = sandboxes
+	}
+	for _, id := range []string{owner.InfraContainerID(), owner.InterfaceID()} {
+		if id != "" {
+			sandboxes[id] = struct{}{}
+		}
+	}
+}
+
+// isReplacedSandboxUntransacted returns true if the sandbox of the requester was replaced by a newer one. Does not
+// take a lock.
+func (service *HTTPRestService) isReplacedSandboxUntransacted(requester cns.PodInfo) bool {
+	sandboxes := service.replacedSandboxes[requester.Key()]
+	for _, id := range []string{requester.InfraContainerID(), requester.InterfaceID()} {
+		if _, ok := sandboxes[id]; ok && id != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedByAddressFamily orders the ipconfig ids with IPv4 addresses first.
+func sortedByAddressFamily(podIPConfigState map[string]cns.IPConfigurationStatus, ipIDs []string) []string {
+	sorted := make([]string, 0, len(ipIDs))
+	for _, family := range []cns.IPFamily{cns.IPv4Family, cns.IPv6Family} {
+		for _, ipID := range ipIDs {
+			if cns.GetIPFamily(podIPConfigState[ipID].IPAddress) == family {
+				sorted = append(sorted, ipID)
+			}
+		}
+	}
+	return sorted
 }
@@ -4,13 +4,22 @@
 package restserver
 
 import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/fakes"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/store"
 )
 
 var (
@@ -67,11 +76,16 @@ func requestIpAddressAndGetState(t *testing.T, req cns.IPConfigRequest) (cns.IPC
 		err       error
 	)
 
-	PodIpInfo, err = requestIPConfigHelper(svc, req)
+	podIPInfo, err := requestIPConfigHelper(svc, req)
 	if err != nil {
 		return ipState, err
 	}
 
+	if len(podIPInfo) != 1 {
+		t.Fatalf("Expected one IP to be allocated, actual: %+v", podIPInfo)
+	}
+	PodIpInfo = podIPInfo[0]
+
 	if reflect.DeepEqual(PodIpInfo.NetworkContainerPrimaryIPConfig.IPSubnet.IPAddress, primaryIp) != true {
 		t.Fatalf("PrimarIP is not added as expected ipConfig %+v, expected primaryIP: %+v", PodIpInfo.NetworkContainerPrimaryIPConfig, primaryIp)
 	}
@@ -107,8 +121,8 @@ func requestIpAddressAndGetState(t *testing.T, req cns.IPConfigRequest) (cns.IPC
 		return ipState, err
 	}
 
-	ipId := svc.PodIPIDByPodInterfaceKey[podInfo.Key()]
-	ipState = svc.PodIPConfigState[ipId]
+	ipIDs := svc.PodIPIDByPodInterfaceKey[podInfo.Key()]
+	ipState = svc.PodIPConfigState[ipIDs[0]]
 
 	return ipState, err
 }
@@ -143,7 +157,7 @@ func UpdatePodIpConfigState(t *testing.T, svc *HTTPRestService, ipconfigs map[st
 	// update ipconfigs to expected state
 	for ipId, ipconfig := range ipconfigs {
 		if ipconfig.State == cns.Allocated {
-			svc.PodIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()] = ipId
+			svc.PodIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()] = []string{ipId}
 			svc.PodIPConfigState[ipId] = ipconfig
 		}
 	}
@@ -175,6 +189,7 @@ func TestIPAMGetAvailableIPConfig(t *testing.T) {
 	desiredState := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Allocated, 0)
 	desiredState.PodInfo = testPod1Info
 
+	desiredState = withStateTransitionTime(t, desiredState, actualstate)
 	if reflect.DeepEqual(desiredState, actualstate) != true {
 		t.Fatalf("Desired state not matching actual state, expected: %+v, actual: %+v", desiredState, actualstate)
 	}
@@ -185,7 +200,7 @@ func TestIPAMGetNextAvailableIPConfig(t *testing.T) {
 	svc := getTestService()
 
 	// Add already allocated pod ip to state
-	svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()] = testPod1GUID
+	svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()] = []string{testPod1GUID}
 	state1, _ := NewPodStateWithOrchestratorContext(testIP1, testPod1GUID, testNCID, cns.Allocated, 24, 0, testPod1Info)
 	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
 
@@ -212,6 +227,7 @@ func TestIPAMGetNextAvailableIPConfig(t *testing.T) {
 	// want second available Pod IP State as first has been allocated
 	desiredState, _ := NewPodStateWithOrchestratorContext(testIP2, testPod2GUID, testNCID, cns.Allocated, 24, 0, testPod2Info)
 
+	desiredState = withStateTransitionTime(t, desiredState, actualstate)
 	if reflect.DeepEqual(desiredState, actualstate) != true {
 		t.Fatalf("Desired state not matching actual state, expected: %+v, actual: %+v", desiredState, actualstate)
 	}
@@ -307,6 +323,7 @@ func TestIPAMGetDesiredIPConfigWithSpecfiedIP(t *testing.T) {
 	desiredState := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Allocated, 0)
 	desiredState.PodInfo = testPod1Info
 
+	desiredState = withStateTransitionTime(t, desiredState, actualstate)
 	if reflect.DeepEqual(desiredState, actualstate) != true {
 		t.Fatalf("Desired state not matching actual state, expected: %+v, actual: %+v", desiredState, actualstate)
 	}
@@ -367,6 +384,41 @@ func TestIPAMFailToGetIPWhenAllIPsAreAllocated(t *testing.T) {
 	}
 }
 
+func TestIPAMFailToGetIPRecordsPodEvent(t *testing.T) {
+	svc := getTestService()
+	reporter := &fakes.StatusReporterFake{}
+	svc.StatusReporter = reporter
+
+	state1, _ := NewPodStateWithOrchestratorContext(testIP1, testPod1GUID, testNCID, cns.Allocated, 24, 0, testPod1Info)
+	err := UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1})
+	if err != nil {
+		t.Fatalf("Expected to not fail adding IP's to state: %+v", err)
+	}
+
+	req := cns.IPConfigRequest{}
+	req.OrchestratorContext, _ = testPod2Info.OrchestratorContext()
+	svc.IPRequestRetryAfter = 2 * time.Second
+	resp, returnCode := svc.RequestIPConfigInternal(req)
+	if returnCode != types.NoFreeIPs || !returnCode.IsRetriable() || resp.RetryAfterInMs != 2000 {
+		t.Fatalf("Expected a retriable failure requesting IP when there are no more IP's, got %d, %+v", returnCode, resp)
+	}
+
+	if len(reporter.PodEvents) != 1 {
+		t.Fatalf("Expected one pod event, got %+v", reporter.PodEvents)
+	}
+	event := reporter.PodEvents[0]
+	if event.PodName != testPod2Info.Name() || event.PodNamespace != testPod2Info.Namespace() || event.Reason != failedAllocateIPReason {
+		t.Fatalf("Expected %s event for pod %s, got %+v", failedAllocateIPReason, testPod2Info.Key(), event)
+	}
+
+	// requests which fail for other reasons are not about the pool
+	req.DesiredIPAddress = testIP1
+	svc.RequestIPConfigInternal(req)
+	if len(reporter.PodEvents) != 1 {
+		t.Fatalf("Expected no more pod events, got %+v", reporter.PodEvents)
+	}
+}
+
 // 10.0.0.1 = PodInfo1
 // Request 10.0.0.1 with PodInfo2 (Fail)
 // Release PodInfo1
@@ -426,6 +478,7 @@ func TestIPAMRequestThenReleaseThenRequestAgain(t *testing.T) {
 	desiredState.IPAddress = desiredIpAddress
 	desiredState.PodInfo = testPod2Info
 
+	desiredState = withStateTransitionTime(t, desiredState, actualstate)
 	if reflect.DeepEqual(desiredState, actualstate) != true {
 		t.Fatalf("Desired state not matching actual state, expected: %+v, actual: %+v", state1, actualstate)
 	}
@@ -527,6 +580,17 @@ func TestAvailableIPConfigs(t *testing.T) {
 	validateIpState(t, allocatedIps, desiredAllocatedIpConfigs)
 }
 
+// withStateTransitionTime returns expected with the state transition time of actual, which is set when the IP
+// changes state.
+func withStateTransitionTime(t *testing.T, expected, actual cns.IPConfigurationStatus) cns.IPConfigurationStatus {
+	t.Helper()
+	if actual.LastStateTransitionTime.IsZero() {
+		t.Fatalf("Expected the state transition time to be set: %+v", actual)
+	}
+	expected.LastStateTransitionTime = actual.LastStateTransitionTime
+	return expected
+}
+
 func validateIpState(t *testing.T, actualIps []cns.IPConfigurationStatus, expectedList map[string]cns.IPConfigurationStatus) {
 	if len(actualIps) != len(expectedList) {
 		t.Fatalf("Actual and expected  count doesnt match, expected %d, actual %d", len(actualIps), len(expectedList))
@@ -536,6 +600,7 @@ func validateIpState(t *testing.T, actualIps []cns.IPConfigurationStatus, expect
 		var expectedIp cns.IPConfigurationStatus
 		var found bool
 		for _, expectedIp = range expectedList {
+			expectedIp = withStateTransitionTime(t, expectedIp, actualIp)
 			if reflect.DeepEqual(actualIp, expectedIp) == true {
 				found = true
 				break
@@ -683,7 +748,7 @@ func TestIPAMMarkExistingIPConfigAsPending(t *testing.T) {
 	svc := getTestService()
 
 	// Add already allocated pod ip to state
-	svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()] = testPod1GUID
+	svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()] = []string{testPod1GUID}
 	state1, _ := NewPodStateWithOrchestratorContext(testIP1, testPod1GUID, testNCID, cns.Allocated, 24, 0, testPod1Info)
 	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
 
@@ -720,3 +785,602 @@ func TestIPAMMarkExistingIPConfigAsPending(t *testing.T) {
 		t.Fatalf("Expected to see ID %v in pending release ipconfigs, actual %+v", testPod1GUID, allocatedIPConfigs)
 	}
 }
+
+func TestIPAMAllocateDualStackIPConfigs(t *testing.T) {
+	svc := getTestService()
+
+	testNCIDv6 := "a0cab0fb-6ff4-4f6c-bd3b-4f0c2bc4bd3f"
+	testIP1v6 := "fd00::2"
+
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+
+	ncRequestv6 := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod2GUID: newSecondaryIPConfig(testIP1v6, -1),
+	}, testNCIDv6, "-1")
+	ncRequestv6.IPConfiguration.IPSubnet = cns.IPSubnet{IPAddress: "fd00::5", PrefixLength: 64}
+	ncRequestv6.IPConfiguration.GatewayIPAddress = "fd00::1"
+	if returnCode := svc.CreateOrUpdateNetworkContainerInternal(ncRequestv6); returnCode != types.Success {
+		t.Fatalf("Failed to create IPv6 NC, returnCode: %d", returnCode)
+	}
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	podIPInfo, err := requestIPConfigHelper(svc, req)
+	if err != nil {
+		t.Fatalf("Expected dual-stack IP allocation to succeed, err: %v", err)
+	}
+
+	if len(podIPInfo) != 2 {
+		t.Fatalf("Expected an IPv4 and an IPv6 address, actual: %+v", podIPInfo)
+	}
+
+	if podIPInfo[0].PodIPConfig.IPAddress != testIP1 || podIPInfo[0].PodIPConfig.PrefixLength != subnetPrfixLength {
+		t.Fatalf("Unexpected IPv4 pod ipconfig: %+v", podIPInfo[0].PodIPConfig)
+	}
+
+	if podIPInfo[1].PodIPConfig.IPAddress != testIP1v6 || podIPInfo[1].PodIPConfig.PrefixLength != 64 {
+		t.Fatalf("Unexpected IPv6 pod ipconfig: %+v", podIPInfo[1].PodIPConfig)
+	}
+
+	if podIPInfo[1].NetworkContainerPrimaryIPConfig.GatewayIPAddress != "fd00::1" {
+		t.Fatalf("Unexpected IPv6 gateway: %+v", podIPInfo[1].NetworkContainerPrimaryIPConfig)
+	}
+
+	// a retried request returns the same IPs
+	retriedPodIPInfo, err := requestIPConfigHelper(svc, req)
+	if err != nil {
+		t.Fatalf("Expected retried IP request to succeed, err: %v", err)
+	}
+
+	if !reflect.DeepEqual(podIPInfo, retriedPodIPInfo) {
+		t.Fatalf("Expected the same IPs for a retried request, expected: %+v, actual: %+v", podIPInfo, retriedPodIPInfo)
+	}
+
+	// the IPv6 pool is exhausted, so no IP should be allocated to another pod
+	req2 := cns.IPConfigRequest{
+		PodInterfaceID:   testPod2Info.InterfaceID(),
+		InfraContainerID: testPod2Info.InfraContainerID(),
+	}
+	req2.OrchestratorContext, _ = testPod2Info.OrchestratorContext()
+	if _, err = requestIPConfigHelper(svc, req2); err == nil {
+		t.Fatal("Expected IP allocation to fail when one address family is exhausted")
+	}
+
+	// release frees both address families
+	if err = svc.releaseIPConfig(testPod1Info); err != nil {
+		t.Fatalf("Expected release to succeed, err: %v", err)
+	}
+
+	if len(svc.PodIPIDByPodInterfaceKey) != 0 {
+		t.Fatalf("Expected no allocations after release, actual: %+v", svc.PodIPIDByPodInterfaceKey)
+	}
+
+	if available := svc.GetAvailableIPConfigs(); len(available) != 2 {
+		t.Fatalf("Expected both IPs to be available after release, actual: %+v", available)
+	}
+}
+
+func TestIPAMAllocateDualStackIPConfigsRollsBackIPv4WhenIPv6Fails(t *testing.T) {
+	svc := getTestService()
+
+	testNCIDv6 := "a0cab0fb-6ff4-4f6c-bd3b-4f0c2bc4bd3f"
+
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+
+	ncRequestv6 := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod2GUID: newSecondaryIPConfig("fd00::2", -1),
+	}, testNCIDv6, "-1")
+	ncRequestv6.IPConfiguration.IPSubnet = cns.IPSubnet{IPAddress: "fd00::5", PrefixLength: 64}
+	if returnCode := svc.CreateOrUpdateNetworkContainerInternal(ncRequestv6); returnCode != types.Success {
+		t.Fatalf("Failed to create IPv6 NC, returnCode: %d", returnCode)
+	}
+
+	// the IPv6 ipconfig can be allocated but not populated without its NC
+	delete(svc.state.ContainerStatus, testNCIDv6)
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	if _, err := requestIPConfigHelper(svc, req); err == nil {
+		t.Fatal("Expected dual-stack IP allocation to fail when the IPv6 allocation fails")
+	}
+
+	if len(svc.PodIPIDByPodInterfaceKey) != 0 {
+		t.Fatalf("Expected no allocations after the failed request, actual: %+v", svc.PodIPIDByPodInterfaceKey)
+	}
+
+	if available := svc.GetAvailableIPConfigs(); len(available) != 2 {
+		t.Fatalf("Expected both IPs to be available after the failed request, actual: %+v", available)
+	}
+}
+
+func TestIPAMRestoreIPConfigStateFromStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipamstore")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ipamStoreFile := filepath.Join(dir, "azure-cns-ipam.json")
+	svc := getTestService()
+	if svc.ipamStore, err = store.NewJournalFileStore(ipamStoreFile); err != nil {
+		t.Fatalf("Failed to create ipam store: %v", err)
+	}
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+		state2.ID: state2,
+	})
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+		DesiredIPAddress: testIP1,
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+	if _, err = requestIPConfigHelper(svc, req); err != nil {
+		t.Fatalf("Expected IP allocation to succeed, err: %v", err)
+	}
+
+	// simulate a CNS restart with the same ipam store
+	restarted := getTestService()
+	if restarted.ipamStore, err = store.NewJournalFileStore(ipamStoreFile); err != nil {
+		t.Fatalf("Failed to create ipam store: %v", err)
+	}
+	restarted.restoreIPConfigState()
+
+	if !reflect.DeepEqual(svc.PodIPConfigState, restarted.PodIPConfigState) {
+		t.Fatalf("Restored state doesn't match, expected: %+v, actual: %+v", svc.PodIPConfigState, restarted.PodIPConfigState)
+	}
+
+	if !reflect.DeepEqual(svc.PodIPIDByPodInterfaceKey, restarted.PodIPIDByPodInterfaceKey) {
+		t.Fatalf("Restored pod IPs don't match, expected: %+v, actual: %+v", svc.PodIPIDByPodInterfaceKey, restarted.PodIPIDByPodInterfaceKey)
+	}
+}
+
+// unsyncedIPAMStore fails to make its writes durable.
+type unsyncedIPAMStore struct {
+	store.IncrementalKeyValueStore
+}
+
+func (s *unsyncedIPAMStore) Sync() error {
+	return errors.New("disk failed")
+}
+
+func TestIPAMRequestIPConfigFailsIfNotDurable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipamstore")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	svc := getTestService()
+	ipamStore, err := store.NewJournalFileStore(filepath.Join(dir, "azure-cns-ipam.json"))
+	if err != nil {
+		t.Fatalf("Failed to create ipam store: %v", err)
+	}
+	svc.ipamStore = &unsyncedIPAMStore{IncrementalKeyValueStore: ipamStore}
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+	})
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+	if podIPInfo, err := requestIPConfigHelper(svc, req); err == nil {
+		t.Fatalf("Expected IP allocation to fail when it isn't durable, got: %+v", podIPInfo)
+	}
+
+	// the IP is released by the DEL which follows the failed ADD
+	if err := svc.releaseIPConfig(testPod1Info); err == nil {
+		t.Fatalf("Expected IP release to fail when it isn't durable")
+	}
+	if available := svc.GetAvailableIPConfigs(); len(available) != 1 {
+		t.Fatalf("Expected the IP to be available after the release, actual: %+v", available)
+	}
+}
+
+func TestIPAMReleaseLeakedIPConfig(t *testing.T) {
+	svc := getTestService()
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+	})
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+		DesiredIPAddress: testIP1,
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+	if _, err := requestIPConfigHelper(svc, req); err != nil {
+		t.Fatalf("Expected IP allocation to succeed, err: %v", err)
+	}
+
+	// the IP is not released if it is allocated to another pod than the one found leaked
+	leaked := svc.PodIPConfigState[state1.ID]
+	leaked.PodInfo = testPod2Info
+	if err := svc.ReleaseLeakedIPConfig(leaked); err == nil {
+		t.Fatalf("Expected release of IP allocated to another pod to fail")
+	}
+
+	if svc.PodIPConfigState[state1.ID].State != cns.Allocated {
+		t.Fatalf("Expected IP to stay allocated, actual state: %s", svc.PodIPConfigState[state1.ID].State)
+	}
+
+	if err := svc.ReleaseLeakedIPConfig(svc.PodIPConfigState[state1.ID]); err != nil {
+		t.Fatalf("Expected release of leaked IP to succeed, err: %v", err)
+	}
+
+	if svc.PodIPConfigState[state1.ID].State != cns.Available {
+		t.Fatalf("Expected leaked IP to be available, actual state: %s", svc.PodIPConfigState[state1.ID].State)
+	}
+
+	if _, exists := svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()]; exists {
+		t.Fatalf("Expected pod to be removed from PodIPIDByPodInterfaceKey")
+	}
+}
+
+func newIPConfigRequestForContainer(t *testing.T, podInfo cns.PodInfo, infraContainerID, interfaceID string) cns.IPConfigRequest {
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   interfaceID,
+		InfraContainerID: infraContainerID,
+	}
+	var err error
+	if req.OrchestratorContext, err = podInfo.OrchestratorContext(); err != nil {
+		t.Fatalf("Failed to marshal orchestrator context: %v", err)
+	}
+	return req
+}
+
+func TestIPAMRequestIPConfigRetryAndRecreatedSandbox(t *testing.T) {
+	svc := getTestService()
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+		state2.ID: state2,
+	})
+
+	oldSandbox := newIPConfigRequestForContainer(t, testPod1Info, "oldinfracontainer", "oldinf-eth0")
+	podIPInfo, err := requestIPConfigHelper(svc, oldSandbox)
+	if err != nil {
+		t.Fatalf("Expected IP allocation to succeed, err: %v", err)
+	}
+	allocatedIP := podIPInfo[0].PodIPConfig.IPAddress
+
+	// a retried ADD from the same container gets the same IP
+	podIPInfo, err = requestIPConfigHelper(svc, oldSandbox)
+	if err != nil || len(podIPInfo) != 1 || podIPInfo[0].PodIPConfig.IPAddress != allocatedIP {
+		t.Fatalf("Expected retried request to return IP %s, actual: %+v, err: %v", allocatedIP, podIPInfo, err)
+	}
+
+	// an ADD from a recreated sandbox takes over the IP of the pod
+	newSandbox := newIPConfigRequestForContainer(t, testPod1Info, "newinfracontainer", "newinf-eth0")
+	podIPInfo, err = requestIPConfigHelper(svc, newSandbox)
+	if err != nil || len(podIPInfo) != 1 || podIPInfo[0].PodIPConfig.IPAddress != allocatedIP {
+		t.Fatalf("Expected recreated sandbox to get IP %s, actual: %+v, err: %v", allocatedIP, podIPInfo, err)
+	}
+
+	if len(svc.GetAllocatedIPConfigs()) != 1 {
+		t.Fatalf("Expected one allocated IP, actual: %+v", svc.GetAllocatedIPConfigs())
+	}
+
+	// the DEL of the old sandbox doesn't release the IP owned by the new sandbox
+	oldPodInfo, _ := cns.NewPodInfoFromIPConfigRequest(oldSandbox)
+	if err = svc.releaseIPConfig(oldPodInfo); err != nil {
+		t.Fatalf("Expected release from old sandbox to be ignored, err: %v", err)
+	}
+
+	allocated := svc.GetAllocatedIPConfigs()
+	if len(allocated) != 1 || allocated[0].PodInfo.InfraContainerID() != "newinfracontainer" {
+		t.Fatalf("Expected IP to stay allocated to the new sandbox, actual: %+v", allocated)
+	}
+
+	newPodInfo, _ := cns.NewPodInfoFromIPConfigRequest(newSandbox)
+	if err = svc.releaseIPConfig(newPodInfo); err != nil {
+		t.Fatalf("Expected release from new sandbox to succeed, err: %v", err)
+	}
+
+	if len(svc.GetAllocatedIPConfigs()) != 0 {
+		t.Fatalf("Expected IP to be released, actual: %+v", svc.GetAllocatedIPConfigs())
+	}
+}
+
+func TestIPAMRequestIPConfigDelayedRetryFromReplacedSandbox(t *testing.T) {
+	svc := getTestService()
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+	})
+
+	oldSandbox := newIPConfigRequestForContainer(t, testPod1Info, "oldinfracontainer", "oldinf-eth0")
+	if _, err := requestIPConfigHelper(svc, oldSandbox); err != nil {
+		t.Fatalf("Expected IP allocation to succeed, err: %v", err)
+	}
+
+	newSandbox := newIPConfigRequestForContainer(t, testPod1Info, "newinfracontainer", "newinf-eth0")
+	if _, err := requestIPConfigHelper(svc, newSandbox); err != nil {
+		t.Fatalf("Expected recreated sandbox to get the IP, err: %v", err)
+	}
+
+	// a retry of the ADD of the old sandbox which arrives after the new sandbox took over doesn't take the IP back
+	podIPInfo, err := requestIPConfigHelper(svc, oldSandbox)
+	if !errors.Is(err, errReplacedSandbox) {
+		t.Fatalf("Expected delayed retry from old sandbox to fail with %v, actual: %+v, err: %v", errReplacedSandbox, podIPInfo, err)
+	}
+
+	allocated := svc.GetAllocatedIPConfigs()
+	if len(allocated) != 1 || allocated[0].PodInfo.InfraContainerID() != "newinfracontainer" {
+		t.Fatalf("Expected IP to stay allocated to the new sandbox, actual: %+v", allocated)
+	}
+
+	// the new sandbox still gets its IP on retries
+	if podIPInfo, err = requestIPConfigHelper(svc, newSandbox); err != nil || len(podIPInfo) != 1 {
+		t.Fatalf("Expected retried request from new sandbox to succeed, actual: %+v, err: %v", podIPInfo, err)
+	}
+
+	// the replaced sandboxes are forgotten once the pod is released
+	newPodInfo, _ := cns.NewPodInfoFromIPConfigRequest(newSandbox)
+	if err = svc.releaseIPConfig(newPodInfo); err != nil {
+		t.Fatalf("Expected release from new sandbox to succeed, err: %v", err)
+	}
+	if _, exists := svc.replacedSandboxes[testPod1Info.Key()]; exists {
+		t.Fatalf("Expected replaced sandboxes of the released pod to be forgotten")
+	}
+}
+
+func TestIPAMRequestIPConfigConcurrentRequestsForSamePod(t *testing.T) {
+	svc := getTestService()
+
+	ipconfigs := make(map[string]cns.IPConfigurationStatus)
+	for i := 0; i < 8; i++ {
+		state := NewPodState("10.0.0."+strconv.Itoa(i+1), 24, "ipconfig"+strconv.Itoa(i), testNCID, cns.Available, 0)
+		ipconfigs[state.ID] = state
+	}
+	UpdatePodIpConfigState(t, svc, ipconfigs)
+
+	req := newIPConfigRequestForContainer(t, testPod1Info, testPod1Info.InfraContainerID(), testPod1Info.InterfaceID())
+
+	var wg sync.WaitGroup
+	results := make([][]cns.PodIpInfo, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = requestIPConfigHelper(svc, req)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(svc.GetAllocatedIPConfigs()) != 1 {
+		t.Fatalf("Expected racing requests to allocate one IP, actual: %+v", svc.GetAllocatedIPConfigs())
+	}
+
+	for i := range results {
+		if len(results[i]) != 1 || results[i][0].PodIPConfig.IPAddress != results[0][0].PodIPConfig.IPAddress {
+			t.Fatalf("Expected racing requests to return the same IP, actual: %+v", results)
+		}
+	}
+}
+
+func TestIPAMReleaseIPConfigWithCooldown(t *testing.T) {
+	svc := getTestService()
+	svc.IPCooldown = time.Minute
+
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+	})
+
+	req := newIPConfigRequestForContainer(t, testPod1Info, testPod1Info.InfraContainerID(), testPod1Info.InterfaceID())
+	if _, err := requestIPConfigHelper(svc, req); err != nil {
+		t.Fatalf("Expected IP allocation to succeed, err: %v", err)
+	}
+
+	if err := svc.releaseIPConfig(testPod1Info); err != nil {
+		t.Fatalf("Expected release to succeed, err: %v", err)
+	}
+
+	released := svc.PodIPConfigState[state1.ID]
+	if released.State != cns.Cooldown || released.PodInfo != nil || released.CooldownStartTime.IsZero() {
+		t.Fatalf("Expected released IP to be in cooldown, actual: %+v", released)
+	}
+
+	// the IP in cooldown isn't handed to the next pod
+	req = newIPConfigRequestForContainer(t, testPod2Info, testPod2Info.InfraContainerID(), testPod2Info.InterfaceID())
+	if _, err := requestIPConfigHelper(svc, req); err == nil {
+		t.Fatalf("Expected allocation to fail while the only IP is in cooldown")
+	}
+
+	// the cooldown has not expired yet
+	svc.MarkExpiredCooldownIPsAsAvailable()
+	if svc.PodIPConfigState[state1.ID].State != cns.Cooldown {
+		t.Fatalf("Expected IP to stay in cooldown, actual: %+v", svc.PodIPConfigState[state1.ID])
+	}
+
+	released.CooldownStartTime = time.Now().Add(-svc.IPCooldown)
+	svc.PodIPConfigState[state1.ID] = released
+	svc.MarkExpiredCooldownIPsAsAvailable()
+
+	available := svc.PodIPConfigState[state1.ID]
+	if available.State != cns.Available || !available.CooldownStartTime.IsZero() {
+		t.Fatalf("Expected IP to be available after the cooldown, actual: %+v", available)
+	}
+
+	if _, err := requestIPConfigHelper(svc, req); err != nil {
+		t.Fatalf("Expected allocation to succeed after the cooldown, err: %v", err)
+	}
+}
+
+func TestIPAMMarkRestoredCooldownIPsAsAvailableWithoutCooldown(t *testing.T) {
+	svc := getTestService()
+
+	// the IP was restored in Cooldown from a run with a cooldown, which is now disabled
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Cooldown, 0)
+	state1.CooldownStartTime = time.Now()
+	UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{
+		state1.ID: state1,
+	})
+
+	svc.MarkExpiredCooldownIPsAsAvailable()
+
+	if available := svc.PodIPConfigState[state1.ID]; available.State != cns.Available {
+		t.Fatalf("Expected IP to be available without a cooldown, actual: %+v", available)
+	}
+}
+
+func TestIPAMAllocateIPConfigFromSelectedSubnet(t *testing.T) {
+	svc := getTestService()
+
+	testNCID2 := "4b1a4a1c-60a3-4f5e-a8a4-6a0d4cc2a7e9"
+	testIP2Subnet2 := "10.1.0.2"
+
+	ncRequest := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	ncRequest.SubnetName = "subnet1"
+	ncRequest2 := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod2GUID: newSecondaryIPConfig(testIP2Subnet2, -1),
+	}, testNCID2, "-1")
+	ncRequest2.SubnetName = "subnet2"
+	for _, req := range []cns.CreateNetworkContainerRequest{ncRequest, ncRequest2} {
+		if returnCode := svc.CreateOrUpdateNetworkContainerInternal(req); returnCode != types.Success {
+			t.Fatalf("Failed to create NC %s, returnCode: %d", req.NetworkContainerid, returnCode)
+		}
+	}
+
+	newRequest := func(podInfo cns.PodInfo, subnetName string) cns.IPConfigRequest {
+		req := cns.IPConfigRequest{
+			PodInterfaceID:   podInfo.InterfaceID(),
+			InfraContainerID: podInfo.InfraContainerID(),
+		}
+		var err error
+		req.OrchestratorContext, err = json.Marshal(cns.KubernetesPodInfo{
+			PodName:       podInfo.Name(),
+			PodNamespace:  podInfo.Namespace(),
+			PodSubnetName: subnetName,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal orchestrator context: %v", err)
+		}
+		return req
+	}
+
+	// the pod selecting subnet2 is allocated from its NC, even though subnet1 has an available IP
+	podIPInfo, err := requestIPConfigHelper(svc, newRequest(testPod1Info, "subnet2"))
+	if err != nil {
+		t.Fatalf("Expected IP allocation from the selected subnet to succeed, err: %v", err)
+	}
+	if len(podIPInfo) != 1 || podIPInfo[0].PodIPConfig.IPAddress != testIP2Subnet2 {
+		t.Fatalf("Expected IP %s from subnet2, actual: %+v", testIP2Subnet2, podIPInfo)
+	}
+
+	// subnet2 is exhausted
+	if _, err = requestIPConfigHelper(svc, newRequest(testPod2Info, "subnet2")); err == nil {
+		t.Fatal("Expected IP allocation to fail when the selected subnet is exhausted")
+	}
+
+	// no NC is in the selected subnet
+	if _, err = requestIPConfigHelper(svc, newRequest(testPod2Info, "subnet3")); err == nil {
+		t.Fatal("Expected IP allocation to fail when no NC is in the selected subnet")
+	}
+
+	// a pod which doesn't select a subnet is allocated from any NC
+	podIPInfo, err = requestIPConfigHelper(svc, newRequest(testPod2Info, ""))
+	if err != nil {
+		t.Fatalf("Expected IP allocation without a selected subnet to succeed, err: %v", err)
+	}
+	if len(podIPInfo) != 1 || podIPInfo[0].PodIPConfig.IPAddress != testIP1 {
+		t.Fatalf("Expected IP %s, actual: %+v", testIP1, podIPInfo)
+	}
+}
+
+func TestIPAMAllocateIPConfigFromDefaultSubnet(t *testing.T) {
+	svc := getTestService()
+
+	testNCID2 := "4b1a4a1c-60a3-4f5e-a8a4-6a0d4cc2a7e9"
+	testIP2Subnet2 := "10.1.0.2"
+
+	ncRequest := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	ncRequest.SubnetName = "subnet1"
+	ncRequest2 := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testPod2GUID: newSecondaryIPConfig(testIP2Subnet2, -1),
+	}, testNCID2, "-1")
+	ncRequest2.SubnetName = "subnet2"
+	ncRequests := []cns.CreateNetworkContainerRequest{ncRequest, ncRequest2}
+	for _, req := range ncRequests {
+		if returnCode := svc.CreateOrUpdateNetworkContainerInternal(req); returnCode != types.Success {
+			t.Fatalf("Failed to create NC %s, returnCode: %d", req.NetworkContainerid, returnCode)
+		}
+	}
+	// the subnet of the first NC is the default subnet
+	if returnCode := svc.SetNodeNetworkContainersInternal(ncRequests); returnCode != types.Success {
+		t.Fatalf("Failed to set the NCs of the node, returnCode: %d", returnCode)
+	}
+
+	if ncIDs := svc.GetDefaultSubnetNCIDs(); len(ncIDs) != 1 {
+		t.Fatalf("Expected only NC %s in the default subnet, actual: %v", testNCID, ncIDs)
+	}
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+	}
+	var err error
+	req.OrchestratorContext, err = testPod1Info.OrchestratorContext()
+	if err != nil {
+		t.Fatalf("Failed to marshal orchestrator context: %v", err)
+	}
+	podIPInfo, err := requestIPConfigHelper(svc, req)
+	if err != nil {
+		t.Fatalf("Expected IP allocation from the default subnet to succeed, err: %v", err)
+	}
+	if len(podIPInfo) != 1 || podIPInfo[0].PodIPConfig.IPAddress != testIP1 {
+		t.Fatalf("Expected IP %s from the default subnet, actual: %+v", testIP1, podIPInfo)
+	}
+
+	// the default subnet is exhausted, pods which don't select a subnet are not allocated from subnet2
+	req = cns.IPConfigRequest{
+		PodInterfaceID:   testPod2Info.InterfaceID(),
+		InfraContainerID: testPod2Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, err = testPod2Info.OrchestratorContext()
+	if err != nil {
+		t.Fatalf("Failed to marshal orchestrator context: %v", err)
+	}
+	if _, err = requestIPConfigHelper(svc, req); err == nil {
+		t.Fatal("Expected IP allocation to fail when the default subnet is exhausted")
+	}
+
+	// the pool monitor only releases IPs of the default subnet
+	pendingRelease, err := svc.MarkIPAsPendingRelease(1)
+	if err != nil {
+		t.Fatalf("Failed to mark IPs as pending release, err: %v", err)
+	}
+	if len(pendingRelease) != 0 {
+		t.Fatalf("Expected no IP outside the default subnet to be marked as pending release, actual: %+v", pendingRelease)
+	}
+}
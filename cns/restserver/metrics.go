@@ -4,10 +4,44 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// ipConfigRemoved is the state label of IPs which are removed from the pool.
+const ipConfigRemoved = "Removed"
+
+// Reasons IP allocations fail, as labels of ipAllocationFailures.
+const (
+	allocationFailureInvalidRequest       = "InvalidRequest"
+	allocationFailureThrottled            = "Throttled"
+	allocationFailureNoFreeIPs            = "NoFreeIPs"
+	allocationFailureDesiredIPUnavailable = "DesiredIPUnavailable"
+	allocationFailureDesiredIPNotFound    = "DesiredIPNotFound"
+	allocationFailureNoNCForSubnet        = "NoNetworkContainerForSubnet"
+	allocationFailureReplacedSandbox      = "ReplacedSandbox"
+	allocationFailureInternal             = "Internal"
+)
+
+var ipConfigStateDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "ipam_ip_state_duration_seconds",
+		Help: "Time IPs spent in a state before moving to the next one, such as PendingProgramming to Available, by state and next state.",
+		//nolint:gomnd
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 12), // 10 ms to ~11 hours
+	},
+	[]string{"state", "next_state"},
+)
+
+var ipAllocationFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ipam_ip_allocation_failures_total",
+		Help: "Number of IP requests which failed to allocate IPs, by reason.",
+	},
+	[]string{"reason"},
+)
+
 var httpRequestLatency = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Name: "http_request_latency_seconds",
@@ -25,9 +59,21 @@ var httpRequestLatency = prometheus.NewHistogramVec(
 func init() {
 	metrics.Registry.MustRegister(
 		httpRequestLatency,
+		ipConfigStateDuration,
+		ipAllocationFailures,
 	)
 }
 
+// observeIPConfigStateDuration records how long the ipconfig was in its state, when it moves to the next state at
+// transitionTime. IPs restored from before CNS recorded state transitions are skipped.
+func observeIPConfigStateDuration(ipconfig cns.IPConfigurationStatus, nextState cns.IPConfigState, transitionTime time.Time) {
+	if ipconfig.LastStateTransitionTime.IsZero() || transitionTime.Before(ipconfig.LastStateTransitionTime) {
+		return
+	}
+	ipConfigStateDuration.WithLabelValues(string(ipconfig.State), string(nextState)).
+		Observe(transitionTime.Sub(ipconfig.LastStateTransitionTime).Seconds())
+}
+
 func newHandlerFuncWithHistogram(handler http.HandlerFunc, histogram *prometheus.HistogramVec) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		start := time.Now()
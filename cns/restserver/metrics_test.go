@@ -0,0 +1,105 @@
+package restserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stateDurationSamples returns the number of samples and their sum of the state duration histogram.
+func stateDurationSamples(t *testing.T, state cns.IPConfigState, nextState string) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, ipConfigStateDuration.WithLabelValues(string(state), nextState).(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestIPConfigStateDurations(t *testing.T) {
+	svc := getTestService()
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1}))
+
+	added := svc.PodIPConfigState[state1.ID]
+	require.False(t, added.LastStateTransitionTime.IsZero(), "IPs added to the pool are timestamped")
+
+	// the IP waited Available for a minute before it is allocated
+	added.LastStateTransitionTime = time.Now().Add(-time.Minute)
+	svc.PodIPConfigState[state1.ID] = added
+	allocatedCount, allocatedSum := stateDurationSamples(t, cns.Available, string(cns.Allocated))
+
+	req := newIPConfigRequestForContainer(t, testPod1Info, testPod1Info.InfraContainerID(), testPod1Info.InterfaceID())
+	_, err := requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+
+	count, sum := stateDurationSamples(t, cns.Available, string(cns.Allocated))
+	assert.Equal(t, allocatedCount+1, count)
+	assert.GreaterOrEqual(t, sum-allocatedSum, time.Minute.Seconds())
+	allocated := svc.PodIPConfigState[state1.ID]
+	assert.True(t, allocated.LastStateTransitionTime.After(added.LastStateTransitionTime))
+
+	// reclaiming the IP for a new container is not a state transition
+	recreated := cns.NewPodInfo("recreated-infra", testPod1Info.InterfaceID(), testPod1Info.Name(), testPod1Info.Namespace())
+	req = newIPConfigRequestForContainer(t, recreated, recreated.InfraContainerID(), recreated.InterfaceID())
+	_, err = requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+	assert.Equal(t, allocated.LastStateTransitionTime, svc.PodIPConfigState[state1.ID].LastStateTransitionTime)
+
+	require.NoError(t, svc.releaseIPConfig(recreated))
+	_, err = svc.MarkIPAsPendingRelease(1)
+	require.NoError(t, err)
+	require.Equal(t, cns.PendingRelease, svc.PodIPConfigState[state1.ID].State)
+
+	removedCount, _ := stateDurationSamples(t, cns.PendingRelease, ipConfigRemoved)
+	svc.Lock()
+	returnCode, _ := svc.removeToBeDeletedIPStateUntransacted(state1.ID, false)
+	svc.Unlock()
+	require.Equal(t, types.Success, returnCode)
+
+	count, _ = stateDurationSamples(t, cns.PendingRelease, ipConfigRemoved)
+	assert.Equal(t, removedCount+1, count)
+}
+
+func TestIPAllocationFailuresByReason(t *testing.T) {
+	svc := getTestService()
+	state1, _ := NewPodStateWithOrchestratorContext(testIP1, testPod1GUID, testNCID, cns.Allocated, 24, 0, testPod1Info)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1}))
+
+	orchestratorContext, err := testPod2Info.OrchestratorContext()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		req    cns.IPConfigRequest
+		reason string
+	}{
+		{name: "no free IPs", req: cns.IPConfigRequest{OrchestratorContext: orchestratorContext}, reason: allocationFailureNoFreeIPs},
+		{
+			name:   "desired IP allocated to another pod",
+			req:    cns.IPConfigRequest{OrchestratorContext: orchestratorContext, DesiredIPAddress: testIP1},
+			reason: allocationFailureDesiredIPUnavailable,
+		},
+		{
+			name:   "desired IP not in the pool",
+			req:    cns.IPConfigRequest{OrchestratorContext: orchestratorContext, DesiredIPAddress: testIP3},
+			reason: allocationFailureDesiredIPNotFound,
+		},
+		{name: "invalid request", req: cns.IPConfigRequest{OrchestratorContext: []byte("{")}, reason: allocationFailureInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			failures := testutil.ToFloat64(ipAllocationFailures.WithLabelValues(tt.reason))
+			_, returnCode := svc.RequestIPConfigInternal(tt.req)
+			require.NotEqual(t, types.Success, returnCode)
+			assert.Equal(t, failures+1, testutil.ToFloat64(ipAllocationFailures.WithLabelValues(tt.reason)))
+		})
+	}
+}
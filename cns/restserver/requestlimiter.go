@@ -0,0 +1,63 @@
+package restserver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/configuration"
+)
+
+// IPRequestLimiter bounds how many IP requests CNS handles at once. Requests beyond the limit wait in a bounded
+// queue, and are rejected when the queue is full or they waited longer than the queue timeout, so a burst of pods
+// is retried by the CNI instead of queueing unboundedly on the service lock.
+type IPRequestLimiter struct {
+	slots        chan struct{}
+	queued       int32
+	maxQueued    int32
+	queueTimeout time.Duration
+}
+
+// NewIPRequestLimiter creates a limiter with the settings, or returns nil if the settings do not limit requests.
+func NewIPRequestLimiter(settings configuration.IPRequestLimitSettings) *IPRequestLimiter {
+	if settings.MaxConcurrentRequests <= 0 {
+		return nil
+	}
+	return &IPRequestLimiter{
+		slots:        make(chan struct{}, settings.MaxConcurrentRequests),
+		maxQueued:    int32(settings.MaxQueuedRequests),
+		queueTimeout: time.Duration(settings.QueueTimeoutInMs) * time.Millisecond,
+	}
+}
+
+// acquire waits for a slot to handle a request, and returns the func which frees the slot when the request is
+// done. It returns false if the request is rejected. A nil limiter does not limit requests.
+func (l *IPRequestLimiter) acquire() (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, true
+	default:
+	}
+
+	if atomic.AddInt32(&l.queued, 1) > l.maxQueued {
+		atomic.AddInt32(&l.queued, -1)
+		return nil, false
+	}
+	defer atomic.AddInt32(&l.queued, -1)
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, true
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+func (l *IPRequestLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,86 @@
+package restserver
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPRequestLimiterQueuesRequests(t *testing.T) {
+	assert.Nil(t, NewIPRequestLimiter(configuration.IPRequestLimitSettings{}), "requests are not limited by default")
+
+	limiter := NewIPRequestLimiter(configuration.IPRequestLimitSettings{
+		MaxConcurrentRequests: 1,
+		MaxQueuedRequests:     1,
+		QueueTimeoutInMs:      5000,
+	})
+	release, ok := limiter.acquire()
+	require.True(t, ok)
+
+	// the second request waits in the queue until the first is done
+	acquired := make(chan func())
+	go func() {
+		queuedRelease, queuedOK := limiter.acquire()
+		assert.True(t, queuedOK)
+		acquired <- queuedRelease
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&limiter.queued) == 1 }, 5*time.Second, time.Millisecond)
+
+	// the queue is full, so the third request is rejected
+	_, ok = limiter.acquire()
+	assert.False(t, ok)
+
+	release()
+	select {
+	case queuedRelease := <-acquired:
+		queuedRelease()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the queued request to be handled when the first request is done")
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&limiter.queued))
+}
+
+func TestIPRequestLimiterQueueTimeout(t *testing.T) {
+	limiter := NewIPRequestLimiter(configuration.IPRequestLimitSettings{
+		MaxConcurrentRequests: 1,
+		MaxQueuedRequests:     1,
+		QueueTimeoutInMs:      10,
+	})
+	release, ok := limiter.acquire()
+	require.True(t, ok)
+	defer release()
+
+	_, ok = limiter.acquire()
+	assert.False(t, ok, "requests which waited longer than the queue timeout are rejected")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&limiter.queued))
+}
+
+func TestRequestIPConfigThrottled(t *testing.T) {
+	svc := getTestService()
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1}))
+
+	svc.IPRequestLimiter = NewIPRequestLimiter(configuration.IPRequestLimitSettings{MaxConcurrentRequests: 1, QueueTimeoutInMs: 10})
+	svc.IPRequestRetryAfter = 500 * time.Millisecond
+
+	req := newIPConfigRequestForContainer(t, testPod1Info, testPod1Info.InfraContainerID(), testPod1Info.InterfaceID())
+	release, ok := svc.IPRequestLimiter.acquire()
+	require.True(t, ok)
+
+	resp, returnCode := svc.RequestIPConfigInternal(req)
+	assert.Equal(t, types.RequestThrottled, returnCode)
+	assert.True(t, returnCode.IsRetriable())
+	assert.Equal(t, 500, resp.RetryAfterInMs)
+	assert.Equal(t, cns.Available, svc.PodIPConfigState[state1.ID].State, "throttled requests are not allocated IPs")
+
+	release()
+	resp, returnCode = svc.RequestIPConfigInternal(req)
+	require.Equal(t, types.Success, returnCode, resp.Response.Message)
+	assert.Zero(t, resp.RetryAfterInMs)
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/auth"
 	"github.com/Azure/azure-container-networking/cns/common"
+	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/dockerclient"
 	"github.com/Azure/azure-container-networking/cns/imdsclient"
 	"github.com/Azure/azure-container-networking/cns/ipamclient"
@@ -16,6 +18,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/networkcontainers"
 	"github.com/Azure/azure-container-networking/cns/nmagentclient"
 	"github.com/Azure/azure-container-networking/cns/routes"
+	"github.com/Azure/azure-container-networking/cns/singletenantcontroller"
 	"github.com/Azure/azure-container-networking/cns/types"
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/store"
@@ -42,11 +45,22 @@ type HTTPRestService struct {
 	ipamClient               *ipamclient.IpamClient
 	nmagentClient            nmagentclient.NMAgentClientInterface
 	networkContainer         *networkcontainers.NetworkContainers
-	PodIPIDByPodInterfaceKey map[string]string                    // PodInterfaceId is key and value is Pod IP (SecondaryIP) uuid.
+	PodIPIDByPodInterfaceKey map[string][]string                  // PodInterfaceId is key and value is Pod IP (SecondaryIP) uuids, one per address family.
 	PodIPConfigState         map[string]cns.IPConfigurationStatus // Secondary IP ID(uuid) is key
 	IPAMPoolMonitor          cns.IPAMPoolMonitor
+	IPAMLeakDetector         cns.IPAMLeakDetector
+	IPCooldown               time.Duration                                  // how long released IPs are held in Cooldown before they can be reused
+	IPRequestLimiter         *IPRequestLimiter                              // bounds how many IP requests are handled at once when set
+	IPRequestRetryAfter      time.Duration                                  // how long callers wait before retrying IP requests which failed with a retriable code
+	Authorizer               *auth.Policy                                   // authorizes callers of the REST API when set before Init
+	StatusReporter           singletenantcontroller.StatusReporter          // publishes conditions and Events to kubernetes when set
+	NodeNetworkConfigGetter  singletenantcontroller.NodeNetworkConfigGetter // gets the NNC snapshots are validated against when set
+	ConfigWatcher            *configuration.Watcher                         // reports the active CNS config on the debug API when set
+	ipConfigWatcher          *ipConfigWatcher                               // records changes to PodIPConfigState for the watch API
+	replacedSandboxes        map[string]map[string]struct{}                 // IDs of the sandboxes replaced by a newer one, PodInterfaceId is key
 	routingTable             *routes.RoutingTable
 	store                    store.KeyValueStore
+	ipamStore                store.IncrementalKeyValueStore // persists PodIPConfigState, keyed by Secondary IP ID(uuid)
 	state                    *httpRestServiceState
 	sync.RWMutex
 	dncPartitionKey string
@@ -57,9 +71,16 @@ type GetHTTPServiceDataResponse struct {
 	Response            Response
 }
 
+// GetConfigResponse is used in CNS Client debug mode to get the active CNS config.
+type GetConfigResponse struct {
+	Config       configuration.CNSConfig
+	ReloadStatus configuration.ReloadStatus
+	Response     Response
+}
+
 // HTTPRestServiceData represents in-memory CNS data in the debug API paths.
 type HTTPRestServiceData struct {
-	PodIPIDByPodInterfaceKey map[string]string                    // PodInterfaceId is key and value is Pod IP uuid.
+	PodIPIDByPodInterfaceKey map[string][]string                  // PodInterfaceId is key and value is Pod IP uuids.
 	PodIPConfigState         map[string]cns.IPConfigurationStatus // secondaryipid(uuid) is key
 	IPAMPoolMonitor          cns.IpamPoolMonitorStateSnapshot
 }
@@ -89,6 +110,7 @@ type httpRestServiceState struct {
 	ContainerStatus                  map[string]containerstatus // NetworkContainerID is key.
 	Networks                         map[string]*networkInfo
 	TimeStamp                        time.Time
+	DefaultSubnetName                string // Subnet which pods without a PodSubnetNameAnnotation draw their IPs from.
 	joinedNetworks                   map[string]struct{}
 }
 
@@ -122,12 +144,13 @@ func NewHTTPRestService(config *common.ServiceConfig, imdsClientInterface imdscl
 	serviceState.Networks = make(map[string]*networkInfo)
 	serviceState.joinedNetworks = make(map[string]struct{})
 
-	podIPIDByPodInterfaceKey := make(map[string]string)
+	podIPIDByPodInterfaceKey := make(map[string][]string)
 	podIPConfigState := make(map[string]cns.IPConfigurationStatus)
 
 	return &HTTPRestService{
 		Service:                  service,
 		store:                    service.Service.Store,
+		ipamStore:                config.IPAMStore,
 		dockerClient:             dc,
 		imdsClient:               imdsClient,
 		ipamClient:               ic,
@@ -135,6 +158,7 @@ func NewHTTPRestService(config *common.ServiceConfig, imdsClientInterface imdscl
 		networkContainer:         nc,
 		PodIPIDByPodInterfaceKey: podIPIDByPodInterfaceKey,
 		PodIPConfigState:         podIPConfigState,
+		ipConfigWatcher:          newIPConfigWatcher(),
 		routingTable:             routingTable,
 		state:                    serviceState,
 	}, nil
@@ -149,66 +173,30 @@ func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	}
 
 	service.restoreState()
+	service.restoreIPConfigState()
 	err = service.restoreNetworkState()
 	if err != nil {
 		logger.Errorf("[Azure CNS]  Failed to restore network state, err:%v.", err)
 		return err
 	}
 
-	// Add handlers.
+	// Add handlers, validating their requests against the OpenAPI document of the API.
+	routes := service.apiRoutes()
+	spec, err := newAPISpec(routes)
+	if err != nil {
+		logger.Errorf("[Azure CNS]  Failed to generate the OpenAPI document, err:%v.", err)
+		return err
+	}
+
 	listener := service.Listener
-	// default handlers
-	listener.AddHandler(cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
-	listener.AddHandler(cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
-	listener.AddHandler(cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
-	listener.AddHandler(cns.PublishNetworkContainer, service.publishNetworkContainer)
-	listener.AddHandler(cns.UnpublishNetworkContainer, service.unpublishNetworkContainer)
-	listener.AddHandler(cns.RequestIPConfig, newHandlerFuncWithHistogram(service.requestIPConfigHandler, httpRequestLatency))
-	listener.AddHandler(cns.ReleaseIPConfig, newHandlerFuncWithHistogram(service.releaseIPConfigHandler, httpRequestLatency))
-	listener.AddHandler(cns.NmAgentSupportedApisPath, service.nmAgentSupportedApisHandler)
-	listener.AddHandler(cns.DebugIPAddresses, service.handleDebugIPAddresses)
-	listener.AddHandler(cns.DebugPodContext, service.handleDebugPodContext)
-	listener.AddHandler(cns.DebugRestData, service.handleDebugRestData)
-
-	// handlers for v0.2
-	listener.AddHandler(cns.V2Prefix+cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.V2Prefix+cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.V2Prefix+cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.V2Prefix+cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.V2Prefix+cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.V2Prefix+cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.V2Prefix+cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.V2Prefix+cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
-	listener.AddHandler(cns.V2Prefix+cns.CreateHostNCApipaEndpointPath, service.createHostNCApipaEndpoint)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteHostNCApipaEndpointPath, service.deleteHostNCApipaEndpoint)
-	listener.AddHandler(cns.V2Prefix+cns.NmAgentSupportedApisPath, service.nmAgentSupportedApisHandler)
+	listener.SetConnContext(auth.ConnContext)
+	for i := range routes {
+		handler := spec.ValidateRequests(routes[i].Path, routes[i].handler)
+		if service.Authorizer != nil {
+			handler = service.Authorizer.Authorize(routes[i].Path, handler)
+		}
+		listener.AddHandler(routes[i].Path, handler)
+	}
 
 	// Initialize HTTP client to be reused in CNS
 	connectionTimeout, _ := service.GetOption(acn.OptHttpConnectionTimeout).(int)
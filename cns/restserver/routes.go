@@ -0,0 +1,429 @@
+package restserver
+
+//go:generate go run ../openapi/gen -output ../openapi/cns.json
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/openapi"
+)
+
+// apiRoute is a CNS REST API route and the handler serving it.
+type apiRoute struct {
+	openapi.Route
+	handler http.HandlerFunc
+	// v2 also serves the route under V2Prefix.
+	v2 bool
+}
+
+// apiRoutes returns the routes of the CNS REST API. The request and response types of the routes are used to
+// generate the OpenAPI document of the API, which requests are validated against.
+func (service *HTTPRestService) apiRoutes() []apiRoute {
+	routes := []apiRoute{
+		{
+			Route: openapi.Route{
+				Path:        cns.SetEnvironmentPath,
+				Method:      http.MethodPost,
+				OperationID: "SetEnvironment",
+				Summary:     "Sets the environment of CNS.",
+				Request:     cns.SetEnvironmentRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.setEnvironment,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.CreateNetworkPath,
+				Method:      http.MethodPost,
+				OperationID: "CreateNetwork",
+				Summary:     "Creates a network.",
+				Request:     cns.CreateNetworkRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.createNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DeleteNetworkPath,
+				Method:      http.MethodPost,
+				OperationID: "DeleteNetwork",
+				Summary:     "Deletes a network.",
+				Request:     cns.DeleteNetworkRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.deleteNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.ReserveIPAddressPath,
+				Method:      http.MethodPost,
+				OperationID: "ReserveIPAddress",
+				Summary:     "Reserves an IP address.",
+				Request:     cns.ReserveIPAddressRequest{},
+				Response:    cns.ReserveIPAddressResponse{},
+			},
+			handler: service.reserveIPAddress,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.ReleaseIPAddressPath,
+				Method:      http.MethodPost,
+				OperationID: "ReleaseIPAddress",
+				Summary:     "Releases a reserved IP address.",
+				Request:     cns.ReleaseIPAddressRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.releaseIPAddress,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.GetHostLocalIPPath,
+				Method:      http.MethodGet,
+				OperationID: "GetHostLocalIP",
+				Summary:     "Gets the local IP of the host.",
+				Response:    cns.HostLocalIPAddressResponse{},
+			},
+			handler: service.getHostLocalIP,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.GetIPAddressUtilizationPath,
+				Method:      http.MethodGet,
+				OperationID: "GetIPAddressUtilization",
+				Summary:     "Gets the utilization of the IP addresses.",
+				Response:    cns.IPAddressesUtilizationResponse{},
+			},
+			handler: service.getIPAddressUtilization,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.GetUnhealthyIPAddressesPath,
+				Method:      http.MethodGet,
+				OperationID: "GetUnhealthyIPAddresses",
+				Summary:     "Gets the unhealthy IP addresses.",
+				Response:    cns.GetIPAddressesResponse{},
+			},
+			handler: service.getUnhealthyIPAddresses,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.CreateOrUpdateNetworkContainer,
+				Method:      http.MethodPost,
+				OperationID: "CreateOrUpdateNetworkContainer",
+				Summary:     "Creates or updates a network container.",
+				Request:     cns.CreateNetworkContainerRequest{},
+				Response:    cns.CreateNetworkContainerResponse{},
+			},
+			handler: service.createOrUpdateNetworkContainer,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DeleteNetworkContainer,
+				Method:      http.MethodPost,
+				OperationID: "DeleteNetworkContainer",
+				Summary:     "Deletes a network container.",
+				Request:     cns.DeleteNetworkContainerRequest{},
+				Response:    cns.DeleteNetworkContainerResponse{},
+			},
+			handler: service.deleteNetworkContainer,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.GetInterfaceForContainer,
+				Method:      http.MethodPost,
+				OperationID: "GetInterfaceForContainer",
+				Summary:     "Gets the interface of a network container.",
+				Request:     cns.GetInterfaceForContainerRequest{},
+				Response:    cns.GetInterfaceForContainerResponse{},
+			},
+			handler: service.getInterfaceForContainer,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.SetOrchestratorType,
+				Method:      http.MethodPost,
+				OperationID: "SetOrchestratorType",
+				Summary:     "Sets the orchestrator type of the node.",
+				Request:     cns.SetOrchestratorTypeRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.setOrchestratorType,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.GetNetworkContainerByOrchestratorContext,
+				Method:      http.MethodPost,
+				OperationID: "GetNetworkContainerByOrchestratorContext",
+				Summary:     "Gets the network container of an orchestrator context.",
+				Request:     cns.GetNetworkContainerRequest{},
+				Response:    cns.GetNetworkContainerResponse{},
+			},
+			handler: service.getNetworkContainerByOrchestratorContext,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.AttachContainerToNetwork,
+				Method:      http.MethodPost,
+				OperationID: "AttachContainerToNetwork",
+				Summary:     "Attaches a container to the network of a network container.",
+				Request:     cns.ConfigureContainerNetworkingRequest{},
+				Response:    cns.AttachContainerToNetworkResponse{},
+			},
+			handler: service.attachNetworkContainerToNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DetachContainerFromNetwork,
+				Method:      http.MethodPost,
+				OperationID: "DetachContainerFromNetwork",
+				Summary:     "Detaches a container from the network of a network container.",
+				Request:     cns.ConfigureContainerNetworkingRequest{},
+				Response:    cns.DetachContainerFromNetworkResponse{},
+			},
+			handler: service.detachNetworkContainerFromNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.CreateHnsNetworkPath,
+				Method:      http.MethodPost,
+				OperationID: "CreateHnsNetwork",
+				Summary:     "Creates an HNS network.",
+				Request:     cns.CreateHnsNetworkRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.createHnsNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DeleteHnsNetworkPath,
+				Method:      http.MethodPost,
+				OperationID: "DeleteHnsNetwork",
+				Summary:     "Deletes an HNS network.",
+				Request:     cns.DeleteHnsNetworkRequest{},
+				Response:    cns.Response{},
+			},
+			handler: service.deleteHnsNetwork,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.NumberOfCPUCoresPath,
+				Method:      http.MethodGet,
+				OperationID: "GetNumberOfCPUCores",
+				Summary:     "Gets the number of CPU cores of the host.",
+				Response:    cns.NumOfCPUCoresResponse{},
+			},
+			handler: service.getNumberOfCPUCores,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.CreateHostNCApipaEndpointPath,
+				Method:      http.MethodPost,
+				OperationID: "CreateHostNCApipaEndpoint",
+				Summary:     "Creates an APIPA endpoint for host to network container connectivity.",
+				Request:     cns.CreateHostNCApipaEndpointRequest{},
+				Response:    cns.CreateHostNCApipaEndpointResponse{},
+			},
+			handler: service.createHostNCApipaEndpoint,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DeleteHostNCApipaEndpointPath,
+				Method:      http.MethodPost,
+				OperationID: "DeleteHostNCApipaEndpoint",
+				Summary:     "Deletes the APIPA endpoint of a network container.",
+				Request:     cns.DeleteHostNCApipaEndpointRequest{},
+				Response:    cns.DeleteHostNCApipaEndpointResponse{},
+			},
+			handler: service.deleteHostNCApipaEndpoint,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.PublishNetworkContainer,
+				Method:      http.MethodPost,
+				OperationID: "PublishNetworkContainer",
+				Summary:     "Publishes a network container to NMAgent.",
+				Request:     cns.PublishNetworkContainerRequest{},
+				Response:    cns.PublishNetworkContainerResponse{},
+			},
+			handler: service.publishNetworkContainer,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.UnpublishNetworkContainer,
+				Method:      http.MethodPost,
+				OperationID: "UnpublishNetworkContainer",
+				Summary:     "Unpublishes a network container from NMAgent.",
+				Request:     cns.UnpublishNetworkContainerRequest{},
+				Response:    cns.UnpublishNetworkContainerResponse{},
+			},
+			handler: service.unpublishNetworkContainer,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.RequestIPConfig,
+				Method:      http.MethodPost,
+				OperationID: "RequestIPConfig",
+				Summary:     "Allocates IPs to a pod.",
+				Request:     cns.IPConfigRequest{},
+				Response:    cns.IPConfigResponse{},
+			},
+			handler: newHandlerFuncWithHistogram(service.requestIPConfigHandler, httpRequestLatency),
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.ReleaseIPConfig,
+				Method:      http.MethodPost,
+				OperationID: "ReleaseIPConfig",
+				Summary:     "Releases the IPs of a pod.",
+				Request:     cns.IPConfigRequest{},
+				Response:    cns.Response{},
+			},
+			handler: newHandlerFuncWithHistogram(service.releaseIPConfigHandler, httpRequestLatency),
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.NmAgentSupportedApisPath,
+				Method:      http.MethodPost,
+				OperationID: "NmAgentSupportedApis",
+				Summary:     "Gets the APIs supported by NMAgent.",
+				Request:     cns.NmAgentSupportedApisRequest{},
+				Response:    cns.NmAgentSupportedApisResponse{},
+			},
+			handler: service.nmAgentSupportedApisHandler,
+			v2:      true,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DebugIPAddresses,
+				Method:      http.MethodPost,
+				OperationID: "DebugIPAddresses",
+				Summary:     "Gets the IPs in the requested states.",
+				Request:     cns.GetIPAddressesRequest{},
+				Response:    cns.GetIPAddressStatusResponse{},
+			},
+			handler: service.handleDebugIPAddresses,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DebugPodContext,
+				Method:      http.MethodGet,
+				OperationID: "DebugPodContext",
+				Summary:     "Gets the IPs allocated to each pod.",
+				Response:    cns.GetPodContextResponse{},
+			},
+			handler: service.handleDebugPodContext,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DebugRestData,
+				Method:      http.MethodGet,
+				OperationID: "DebugRestData",
+				Summary:     "Gets the in-memory IPAM state.",
+				Response:    GetHTTPServiceDataResponse{},
+			},
+			handler: service.handleDebugRestData,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DebugIPLeaks,
+				Method:      http.MethodGet,
+				OperationID: "DebugIPLeaks",
+				Summary:     "Gets the state of the IP leak detector.",
+				Response:    cns.GetIPLeaksResponse{},
+			},
+			handler: service.handleDebugIPLeaks,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.DebugConfig,
+				Method:      http.MethodGet,
+				OperationID: "DebugConfig",
+				Summary:     "Gets the active CNS config and the result of the last reload of the config file.",
+				Response:    GetConfigResponse{},
+			},
+			handler: service.handleDebugConfig,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.ExportStateSnapshot,
+				Method:      http.MethodGet,
+				OperationID: "ExportStateSnapshot",
+				Summary:     "Exports a versioned, checksummed snapshot of the NC and IP state.",
+				Response:    GetStateSnapshotResponse{},
+			},
+			handler: service.handleExportStateSnapshot,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.ImportStateSnapshot,
+				Method:      http.MethodPost,
+				OperationID: "ImportStateSnapshot",
+				Summary:     "Validates a snapshot against the NodeNetworkConfig and restores the NC and IP state from it.",
+				Request:     ImportStateSnapshotRequest{},
+				Response:    Response{},
+			},
+			handler: service.handleImportStateSnapshot,
+		},
+		{
+			Route: openapi.Route{
+				Path:        cns.WatchIPConfigs,
+				Method:      http.MethodPost,
+				OperationID: "WatchIPConfigs",
+				Summary:     "Waits for changes to the IPs after a revision.",
+				Request:     cns.WatchIPConfigsRequest{},
+				Response:    cns.WatchIPConfigsResponse{},
+			},
+			handler: service.watchIPConfigsHandler,
+		},
+	}
+
+	for i := range routes {
+		if routes[i].v2 {
+			v2 := routes[i]
+			v2.Path = cns.V2Prefix + v2.Path
+			v2.OperationID += "V2"
+			v2.v2 = false
+			routes = append(routes, v2)
+		}
+	}
+	return routes
+}
+
+// newAPISpec generates the OpenAPI document for the routes.
+func newAPISpec(routes []apiRoute) (*openapi.Document, error) {
+	g := openapi.NewGenerator("Azure Container Networking Service", "v0.2")
+	g.Enum(cns.IPConfigState(""), cns.Available, cns.Allocated, cns.PendingRelease, cns.PendingProgramming, cns.Cooldown)
+	g.Enum(cns.IPConfigEventType(""), cns.IPConfigAdded, cns.IPConfigStateChanged, cns.IPConfigDeleted)
+	for i := range routes {
+		if err := g.AddRoute(routes[i].Route); err != nil {
+			return nil, err
+		}
+	}
+	return g.Document(), nil
+}
+
+// APISpec returns the OpenAPI document of the CNS REST API.
+func APISpec() (*openapi.Document, error) {
+	return newAPISpec((&HTTPRestService{}).apiRoutes())
+}
@@ -0,0 +1,63 @@
+package restserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPISpecIsUpToDate(t *testing.T) {
+	spec, err := APISpec()
+	require.NoError(t, err)
+
+	generated, err := spec.JSON()
+	require.NoError(t, err)
+
+	committed, err := ioutil.ReadFile("../openapi/cns.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(committed), string(generated), "cns/openapi/cns.json is out of date, run go generate ./cns/restserver/")
+}
+
+func TestAPISpecCoversV2Routes(t *testing.T) {
+	spec, err := APISpec()
+	require.NoError(t, err)
+
+	for _, route := range (&HTTPRestService{}).apiRoutes() {
+		assert.Contains(t, spec.Paths, route.Path)
+	}
+	assert.Contains(t, spec.Paths, cns.V2Prefix+cns.CreateOrUpdateNetworkContainer)
+	assert.Contains(t, spec.Paths, cns.V2Prefix+cns.SetEnvironmentPath)
+	assert.NotContains(t, spec.Paths, cns.V2Prefix+cns.RequestIPConfig)
+}
+
+func TestInvalidRequestIsRejected(t *testing.T) {
+	body := `{"NetworkContainerid":"nc","SecondaryIPConfigs":{"uuid":{"IPAddress":"10.0.0.4","NCVersion":"1"}}}`
+	req, err := http.NewRequest(http.MethodPost, cns.CreateOrUpdateNetworkContainer, bytes.NewBufferString(body))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var resp cns.CreateNetworkContainerResponse
+	require.NoError(t, decodeResponse(w, &resp))
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+	assert.Contains(t, resp.Response.Message, "$.SecondaryIPConfigs.uuid.NCVersion")
+
+	req, err = http.NewRequest(http.MethodPost, cns.V2Prefix+cns.SetEnvironmentPath, bytes.NewBufferString(`{"Location":"Azure","Unknown":true}`))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var envResp cns.Response
+	require.NoError(t, decodeResponse(w, &envResp))
+	assert.Equal(t, types.InvalidParameter, envResp.ReturnCode)
+	assert.Contains(t, envResp.Message, "$.Unknown: unknown field")
+}
@@ -0,0 +1,350 @@
+package restserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/pkg/errors"
+)
+
+// StateSnapshotVersion is the version of the StateSnapshot format. Snapshots of other versions are not imported.
+const StateSnapshotVersion = 1
+
+// getNNCTimeout bounds getting the NodeNetworkConfig a snapshot is validated against.
+const getNNCTimeout = 10 * time.Second
+
+// StateSnapshot is a copy of the NC state and the IP state of CNS, which is exported to debug a node or to restore
+// CNS when the node image is replaced.
+type StateSnapshot struct {
+	Version          int
+	CreatedAt        time.Time
+	Checksum         string // hex encoded sha256 of the Version, State and PodIPConfigState
+	State            httpRestServiceState
+	PodIPConfigState map[string]cns.IPConfigurationStatus
+}
+
+// GetStateSnapshotResponse is used in CNS Client debug mode to export a snapshot of the CNS state.
+type GetStateSnapshotResponse struct {
+	Snapshot StateSnapshot
+	Response Response
+}
+
+// ImportStateSnapshotRequest is used in CNS Client debug mode to restore the CNS state from a snapshot.
+type ImportStateSnapshotRequest struct {
+	Snapshot StateSnapshot
+	// ValidateOnly validates the snapshot against the NodeNetworkConfig without restoring it.
+	ValidateOnly bool
+}
+
+// checksum returns the checksum of the snapshot content.
+func (s *StateSnapshot) checksum() (string, error) {
+	b, err := json.Marshal(struct {
+		Version          int
+		State            httpRestServiceState
+		PodIPConfigState map[string]cns.IPConfigurationStatus
+	}{s.Version, s.State, s.PodIPConfigState})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal snapshot")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stateSnapshot returns a snapshot of the current state, without the authorization tokens of the NCs. The snapshot
+// shares the other maps of the state, so the caller holds the service lock while it uses the snapshot.
+func (service *HTTPRestService) stateSnapshot() (StateSnapshot, error) {
+	snapshot := StateSnapshot{
+		Version:          StateSnapshotVersion,
+		CreatedAt:        time.Now().UTC(),
+		State:            *service.state,
+		PodIPConfigState: service.PodIPConfigState,
+	}
+	// tokens are not persisted, but state saved by older versions may still have them
+	snapshot.State.ContainerStatus = make(map[string]containerstatus, len(service.state.ContainerStatus))
+	for ncID, status := range service.state.ContainerStatus {
+		status.CreateNetworkContainerRequest.AuthorizationToken = ""
+		snapshot.State.ContainerStatus[ncID] = status
+	}
+	checksum, err := snapshot.checksum()
+	if err != nil {
+		return StateSnapshot{}, err
+	}
+	snapshot.Checksum = checksum
+	return snapshot, nil
+}
+
+// validateStateSnapshot checks that the snapshot is intact and matches the NCs and IPs the NodeNetworkConfig
+// assigns to the node, so restoring it can't hand out IPs the node does not own.
+func validateStateSnapshot(snapshot *StateSnapshot, nnc *v1alpha.NodeNetworkConfig) error {
+	if snapshot.Version != StateSnapshotVersion {
+		return fmt.Errorf("snapshot version %d is not supported, expected version %d", snapshot.Version, StateSnapshotVersion)
+	}
+	checksum, err := snapshot.checksum()
+	if err != nil {
+		return err
+	}
+	if checksum != snapshot.Checksum {
+		return fmt.Errorf("snapshot checksum %s does not match its content, expected %s", snapshot.Checksum, checksum)
+	}
+
+	ncs := make(map[string]v1alpha.NetworkContainer, len(nnc.Status.NetworkContainers))
+	for _, nc := range nnc.Status.NetworkContainers {
+		ncs[nc.ID] = nc
+	}
+
+	for ncID, status := range snapshot.State.ContainerStatus {
+		nc, ok := ncs[ncID]
+		if !ok {
+			return fmt.Errorf("NC %s is not in NodeNetworkConfig %s", ncID, nnc.Name)
+		}
+		// NCs are only updated to newer versions, so a snapshot which is ahead of the NNC is not from this node
+		if version, err := strconv.ParseInt(status.CreateNetworkContainerRequest.Version, 10, 64); err == nil && version > nc.Version {
+			return fmt.Errorf("NC %s has version %d, which is newer than version %d in NodeNetworkConfig %s", ncID, version, nc.Version, nnc.Name)
+		}
+	}
+
+	for ipID, ipconfig := range snapshot.PodIPConfigState {
+		if ipconfig.ID != ipID {
+			return fmt.Errorf("IP %s is stored under ID %s", ipconfig.ID, ipID)
+		}
+		nc, ok := ncs[ipconfig.NCID]
+		if !ok {
+			return fmt.Errorf("IP %s belongs to NC %s, which is not in NodeNetworkConfig %s", ipID, ipconfig.NCID, nnc.Name)
+		}
+		assigned := false
+		for _, assignment := range nc.IPAssignments {
+			if assignment.Name == ipID && assignment.IP == ipconfig.IPAddress {
+				assigned = true
+				break
+			}
+		}
+		if !assigned {
+			return fmt.Errorf("IP %s with address %s is not assigned to NC %s in NodeNetworkConfig %s", ipID, ipconfig.IPAddress, nc.ID, nnc.Name)
+		}
+		if ipconfig.State == cns.Allocated && ipconfig.PodInfo == nil {
+			return fmt.Errorf("IP %s is %s without a pod", ipID, ipconfig.State)
+		}
+	}
+	return nil
+}
+
+// restoreStateSnapshotUntransacted replaces the state and the IP state with the snapshot. The new state is built and
+// persisted before it is swapped in, so a restore which fails leaves CNS unchanged. The changed ipconfigs are recorded
+// for watchers. Caller will acquire/release the service lock.
+func (service *HTTPRestService) restoreStateSnapshotUntransacted(snapshot *StateSnapshot) error {
+	state := snapshot.State
+	state.joinedNetworks = service.state.joinedNetworks
+	if state.ContainerIDByOrchestratorContext == nil {
+		state.ContainerIDByOrchestratorContext = make(map[string]string)
+	}
+	if state.ContainerStatus == nil {
+		state.ContainerStatus = make(map[string]containerstatus)
+	}
+	if state.Networks == nil {
+		state.Networks = make(map[string]*networkInfo)
+	}
+
+	podIPConfigState := make(map[string]cns.IPConfigurationStatus, len(snapshot.PodIPConfigState))
+	podIPIDByPodInterfaceKey := make(map[string][]string)
+	for ipID, ipconfig := range snapshot.PodIPConfigState {
+		podIPConfigState[ipID] = ipconfig
+		if ipconfig.State == cns.Allocated {
+			podIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()] = append(podIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()], ipID)
+		}
+	}
+
+	if err := service.saveStateSnapshotUntransacted(&state, podIPConfigState); err != nil {
+		return err
+	}
+
+	*service.state = state
+	for ipID := range service.PodIPConfigState {
+		if _, ok := podIPConfigState[ipID]; !ok {
+			service.deletePodIPConfigStateUntransacted(ipID)
+		}
+	}
+	for _, ipconfig := range podIPConfigState {
+		// watchers are only told about changes of state, so an ipconfig which keeps its state but changes
+		// otherwise, such as one allocated to another pod, is recorded as deleted and added again
+		if previous, ok := service.PodIPConfigState[ipconfig.ID]; ok && previous.State == ipconfig.State && !isSameIPConfig(previous, ipconfig) {
+			delete(service.PodIPConfigState, ipconfig.ID)
+			service.ipConfigWatcher.record(cns.IPConfigDeleted, "", previous)
+		}
+		service.setPodIPConfigStateUntransacted(ipconfig)
+	}
+	service.PodIPIDByPodInterfaceKey = podIPIDByPodInterfaceKey
+	return nil
+}
+
+// saveStateSnapshotUntransacted persists the state and the ipconfigs of a snapshot in place of the current ones. Only
+// the ipconfigs which differ are written. If persisting fails, the current state and ipconfigs are written back, so
+// the stores keep matching the state in memory. Caller will acquire/release the service lock.
+func (service *HTTPRestService) saveStateSnapshotUntransacted(state *httpRestServiceState, podIPConfigState map[string]cns.IPConfigurationStatus) error {
+	if service.store != nil {
+		state.TimeStamp = time.Now()
+		if err := service.store.Write(storeKey, state); err != nil {
+			return errors.Wrap(err, "failed to save state")
+		}
+	}
+
+	var changed []string
+	err := func() error {
+		for ipID := range service.PodIPConfigState {
+			if _, ok := podIPConfigState[ipID]; ok {
+				continue
+			}
+			changed = append(changed, ipID)
+			if err := service.removeIPConfigState(ipID); err != nil {
+				return errors.Wrapf(err, "failed to remove ipconfig %s", ipID)
+			}
+		}
+		for ipID, ipconfig := range podIPConfigState {
+			if previous, ok := service.PodIPConfigState[ipID]; ok && reflect.DeepEqual(previous, ipconfig) {
+				continue
+			}
+			changed = append(changed, ipID)
+			if err := service.saveIPConfigState(ipconfig); err != nil {
+				return errors.Wrapf(err, "failed to save ipconfig %s", ipID)
+			}
+		}
+		// restores are rare, so they are synced under the lock to roll back if they are not durable
+		return errors.Wrap(service.syncIPConfigState(), "failed to sync ipconfigs")
+	}()
+	if err == nil {
+		return nil
+	}
+
+	for _, ipID := range changed {
+		var rollbackErr error
+		if previous, ok := service.PodIPConfigState[ipID]; ok {
+			rollbackErr = service.saveIPConfigState(previous)
+		} else {
+			rollbackErr = service.removeIPConfigState(ipID)
+		}
+		if rollbackErr != nil {
+			logger.Errorf("[Azure CNS] Failed to roll back ipconfig %s, err:%v", ipID, rollbackErr)
+		}
+	}
+	if rollbackErr := service.syncIPConfigState(); rollbackErr != nil {
+		logger.Errorf("[Azure CNS] Failed to roll back ipconfigs, err:%v", rollbackErr)
+	}
+	if rollbackErr := service.saveState(); rollbackErr != nil {
+		logger.Errorf("[Azure CNS] Failed to roll back state, err:%v", rollbackErr)
+	}
+	return err
+}
+
+// isSameIPConfig returns true if the ipconfigs have the same NC, address and pod.
+func isSameIPConfig(a, b cns.IPConfigurationStatus) bool {
+	if a.NCID != b.NCID || a.IPAddress != b.IPAddress {
+		return false
+	}
+	if a.PodInfo == nil || b.PodInfo == nil {
+		return a.PodInfo == nil && b.PodInfo == nil
+	}
+	return a.PodInfo.Key() == b.PodInfo.Key() &&
+		a.PodInfo.InfraContainerID() == b.PodInfo.InfraContainerID() &&
+		a.PodInfo.InterfaceID() == b.PodInfo.InterfaceID()
+}
+
+// ImportStateSnapshot validates the snapshot against the node's NodeNetworkConfig and, unless only validating,
+// restores the state from it. The pool monitor is updated from the NodeNetworkConfig after a restore, so it
+// scales the restored pool.
+func (service *HTTPRestService) ImportStateSnapshot(ctx context.Context, req ImportStateSnapshotRequest) Response {
+	if service.NodeNetworkConfigGetter == nil {
+		return Response{
+			ReturnCode: types.UnsupportedOrchestratorType,
+			Message:    "Snapshots can only be imported for orchestrator type " + cns.KubernetesCRD,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, getNNCTimeout)
+	defer cancel()
+	nnc, err := service.NodeNetworkConfigGetter.GetNodeNetworkConfig(ctx)
+	if err != nil {
+		return Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("Failed to get NodeNetworkConfig to validate the snapshot against: %v", err),
+		}
+	}
+
+	if err := validateStateSnapshot(&req.Snapshot, nnc); err != nil {
+		return Response{
+			ReturnCode: types.InvalidStateSnapshot,
+			Message:    err.Error(),
+		}
+	}
+	if req.ValidateOnly {
+		return Response{Message: "Snapshot is valid"}
+	}
+
+	service.Lock()
+	err = service.restoreStateSnapshotUntransacted(&req.Snapshot)
+	service.Unlock()
+	if err != nil {
+		return Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("Failed to restore snapshot: %v", err),
+		}
+	}
+
+	// without an IP cooldown the Cooldown IPs of the snapshot are not expired by the cooldown ticker
+	if service.IPCooldown <= 0 {
+		service.MarkExpiredCooldownIPsAsAvailable()
+	}
+
+	// the pool monitor reads the IP state, so it is updated without the service lock
+	if service.IPAMPoolMonitor != nil {
+		service.IPAMPoolMonitor.Update(nnc.Status.Scaler, nnc.Spec)
+	}
+	logger.Printf("[Azure CNS] Restored snapshot created at %s with %d NCs and %d IPs",
+		req.Snapshot.CreatedAt, len(req.Snapshot.State.ContainerStatus), len(req.Snapshot.PodIPConfigState))
+	return Response{
+		Message: fmt.Sprintf("Restored %d NCs and %d IPs", len(req.Snapshot.State.ContainerStatus), len(req.Snapshot.PodIPConfigState)),
+	}
+}
+
+func (service *HTTPRestService) handleExportStateSnapshot(w http.ResponseWriter, r *http.Request) {
+	service.RLock()
+	defer service.RUnlock()
+	var resp GetStateSnapshotResponse
+	snapshot, err := service.stateSnapshot()
+	if err != nil {
+		resp.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    err.Error(),
+		}
+	} else {
+		resp.Snapshot = snapshot
+	}
+	err = service.Listener.Encode(w, &resp)
+	logger.Response(service.Name, resp.Response, resp.Response.ReturnCode, err)
+}
+
+func (service *HTTPRestService) handleImportStateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req ImportStateSnapshotRequest
+	if err := service.Listener.Decode(w, r, &req); err != nil {
+		resp := Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    err.Error(),
+		}
+		err = service.Listener.Encode(w, &resp)
+		logger.Response(service.Name, resp, resp.ReturnCode, err)
+		return
+	}
+
+	resp := service.ImportStateSnapshot(r.Context(), req)
+	err := service.Listener.Encode(w, &resp)
+	logger.Response(service.Name, resp, resp.ReturnCode, err)
+}
@@ -0,0 +1,269 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/fakes"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nodeNetworkConfigGetterFake struct {
+	nnc v1alpha.NodeNetworkConfig
+}
+
+func (f *nodeNetworkConfigGetterFake) GetNodeNetworkConfig(context.Context) (*v1alpha.NodeNetworkConfig, error) {
+	return f.nnc.DeepCopy(), nil
+}
+
+func newTestNNC(assignments ...v1alpha.IPAssignment) *nodeNetworkConfigGetterFake {
+	return &nodeNetworkConfigGetterFake{
+		nnc: v1alpha.NodeNetworkConfig{
+			Status: v1alpha.NodeNetworkConfigStatus{
+				NetworkContainers: []v1alpha.NetworkContainer{{ID: testNCID, IPAssignments: assignments}},
+			},
+		},
+	}
+}
+
+// exportTestSnapshot exports a snapshot of a service with testPod1 allocated testIP1, the way the CLI writes it.
+func exportTestSnapshot(t *testing.T) (*HTTPRestService, StateSnapshot) {
+	t.Helper()
+	svc := getTestService()
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1, state2.ID: state2}))
+	req := newIPConfigRequestForContainer(t, testPod1Info, testPod1Info.InfraContainerID(), testPod1Info.InterfaceID())
+	req.DesiredIPAddress = testIP1
+	_, err := requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+
+	svc.RLock()
+	snapshot, err := svc.stateSnapshot()
+	require.NoError(t, err)
+	b, err := json.Marshal(snapshot)
+	svc.RUnlock()
+	require.NoError(t, err)
+
+	var exported StateSnapshot
+	require.NoError(t, json.Unmarshal(b, &exported))
+	return svc, exported
+}
+
+func TestImportStateSnapshot(t *testing.T) {
+	exporter, snapshot := exportTestSnapshot(t)
+
+	svc := getTestService()
+	// exported snapshots are valid requests to the import API
+	spec, err := APISpec()
+	require.NoError(t, err)
+	body, err := json.Marshal(ImportStateSnapshotRequest{Snapshot: snapshot})
+	require.NoError(t, err)
+	require.NoError(t, spec.ValidateRequest(cns.ImportStateSnapshot, body))
+
+	resp := svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+	assert.Equal(t, types.UnsupportedOrchestratorType, resp.ReturnCode, "snapshots are only validated against a NodeNetworkConfig")
+
+	svc.NodeNetworkConfigGetter = newTestNNC(
+		v1alpha.IPAssignment{Name: testPod1GUID, IP: testIP1},
+		v1alpha.IPAssignment{Name: testPod2GUID, IP: testIP2},
+	)
+	resp = svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot, ValidateOnly: true})
+	require.Equal(t, types.Success, resp.ReturnCode, resp.Message)
+	assert.Empty(t, svc.PodIPConfigState, "validating a snapshot does not restore it")
+
+	resp = svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+	require.Equal(t, types.Success, resp.ReturnCode, resp.Message)
+	assert.Equal(t, exporter.PodIPConfigState, svc.PodIPConfigState)
+	assert.Equal(t, exporter.PodIPIDByPodInterfaceKey, svc.PodIPIDByPodInterfaceKey)
+	require.Contains(t, svc.state.ContainerStatus, testNCID)
+	assert.Equal(t, exporter.state.ContainerStatus[testNCID].CreateNetworkContainerRequest.Version,
+		svc.state.ContainerStatus[testNCID].CreateNetworkContainerRequest.Version)
+
+	// the restored IP of testPod1 is still allocated to it, so the next pod gets the other IP
+	podIPInfo, err := requestIPConfigHelper(svc, newIPConfigRequestForContainer(t, testPod2Info, testPod2Info.InfraContainerID(), testPod2Info.InterfaceID()))
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, testIP2, podIPInfo[0].PodIPConfig.IPAddress)
+}
+
+func TestExportStateSnapshotRedactsAuthorizationTokens(t *testing.T) {
+	svc, _ := exportTestSnapshot(t)
+	status := svc.state.ContainerStatus[testNCID]
+	status.CreateNetworkContainerRequest.AuthorizationToken = "token"
+	svc.state.ContainerStatus[testNCID] = status
+
+	snapshot, err := svc.stateSnapshot()
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.State.ContainerStatus[testNCID].CreateNetworkContainerRequest.AuthorizationToken)
+	assert.Equal(t, "token", svc.state.ContainerStatus[testNCID].CreateNetworkContainerRequest.AuthorizationToken,
+		"the state keeps the token")
+}
+
+// poolMonitorUpdateRecorder records the updates of the pool monitor.
+type poolMonitorUpdateRecorder struct {
+	fakes.IPAMPoolMonitorFake
+	scalers []v1alpha.Scaler
+}
+
+func (r *poolMonitorUpdateRecorder) Update(scalar v1alpha.Scaler, _ v1alpha.NodeNetworkConfigSpec) {
+	r.scalers = append(r.scalers, scalar)
+}
+
+func TestImportStateSnapshotNotifiesWatchersAndPoolMonitor(t *testing.T) {
+	_, snapshot := exportTestSnapshot(t)
+
+	// testIP1 is allocated to testPod2 before the import, and to testPod1 in the snapshot
+	svc := getTestService()
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	state2 := NewPodState(testIP2, 24, testPod2GUID, testNCID, cns.Available, 0)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1, state2.ID: state2}))
+	req := newIPConfigRequestForContainer(t, testPod2Info, testPod2Info.InfraContainerID(), testPod2Info.InterfaceID())
+	req.DesiredIPAddress = testIP1
+	_, err := requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+
+	poolMonitor := &poolMonitorUpdateRecorder{}
+	svc.IPAMPoolMonitor = poolMonitor
+	nnc := newTestNNC(
+		v1alpha.IPAssignment{Name: testPod1GUID, IP: testIP1},
+		v1alpha.IPAssignment{Name: testPod2GUID, IP: testIP2},
+	)
+	nnc.nnc.Status.Scaler = v1alpha.Scaler{BatchSize: 10, RequestThresholdPercent: 50, ReleaseThresholdPercent: 150, MaxIPCount: 250}
+	svc.NodeNetworkConfigGetter = nnc
+
+	before := watchAndRequireSuccess(t, svc, 0)
+	resp := svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+	require.Equal(t, types.Success, resp.ReturnCode, resp.Message)
+
+	// the IP which stayed Allocated but moved to another pod is reported as deleted and added again
+	changed := watchAndRequireSuccess(t, svc, before.Revision)
+	require.Len(t, changed.Events, 2)
+	assert.Equal(t, cns.IPConfigDeleted, changed.Events[0].Type)
+	assert.Equal(t, testPod2Info.Key(), changed.Events[0].IPConfig.PodInfo.Key())
+	assert.Equal(t, cns.IPConfigAdded, changed.Events[1].Type)
+	assert.Equal(t, testPod1Info.Key(), changed.Events[1].IPConfig.PodInfo.Key())
+	assert.Equal(t, cns.Allocated, changed.Events[1].IPConfig.State)
+
+	require.Len(t, poolMonitor.scalers, 1, "the pool monitor is updated after a restore")
+	assert.Equal(t, nnc.nnc.Status.Scaler, poolMonitor.scalers[0])
+}
+
+// failingIPAMStore fails to write the ipconfig with the ID failKey.
+type failingIPAMStore struct {
+	store.IncrementalKeyValueStore
+	failKey string
+}
+
+func (s *failingIPAMStore) Stage(key string, value interface{}) error {
+	if key == s.failKey && value != nil {
+		return errors.New("disk full")
+	}
+	return s.IncrementalKeyValueStore.Stage(key, value)
+}
+
+func TestImportStateSnapshotRollsBackFailedRestore(t *testing.T) {
+	_, snapshot := exportTestSnapshot(t)
+
+	svc := getTestService()
+	ipamStore, err := store.NewJournalFileStore(filepath.Join(t.TempDir(), "azure-cns-ipam.json"))
+	require.NoError(t, err)
+	svc.ipamStore = ipamStore
+	state1 := NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0)
+	state3 := NewPodState(testIP3, 24, testPod3GUID, testNCID, cns.Available, 0)
+	require.NoError(t, UpdatePodIpConfigState(t, svc, map[string]cns.IPConfigurationStatus{state1.ID: state1, state3.ID: state3}))
+	for _, ipconfig := range svc.PodIPConfigState {
+		require.NoError(t, svc.saveIPConfigState(ipconfig))
+	}
+	before := make(map[string]cns.IPConfigurationStatus, len(svc.PodIPConfigState))
+	for ipID, ipconfig := range svc.PodIPConfigState {
+		before[ipID] = ipconfig
+	}
+
+	// the write of testPod2 fails after testPod3 may have been removed and testPod1 allocated
+	svc.ipamStore = &failingIPAMStore{IncrementalKeyValueStore: ipamStore, failKey: testPod2GUID}
+	svc.NodeNetworkConfigGetter = newTestNNC(
+		v1alpha.IPAssignment{Name: testPod1GUID, IP: testIP1},
+		v1alpha.IPAssignment{Name: testPod2GUID, IP: testIP2},
+	)
+	resp := svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+	require.Equal(t, types.UnexpectedError, resp.ReturnCode, resp.Message)
+	assert.Equal(t, before, svc.PodIPConfigState)
+	assert.Empty(t, svc.PodIPIDByPodInterfaceKey)
+	assert.Contains(t, svc.state.ContainerStatus[testNCID].CreateNetworkContainerRequest.SecondaryIPConfigs, testPod3GUID)
+
+	keys, err := ipamStore.Keys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{testPod1GUID, testPod3GUID}, keys)
+	for ipID, ipconfig := range before {
+		var stored cns.IPConfigurationStatus
+		require.NoError(t, ipamStore.Read(ipID, &stored))
+		assert.Equal(t, ipconfig.State, stored.State)
+		assert.Nil(t, stored.PodInfo)
+	}
+}
+
+func TestImportInvalidStateSnapshot(t *testing.T) {
+	_, snapshot := exportTestSnapshot(t)
+	allAssignments := []v1alpha.IPAssignment{{Name: testPod1GUID, IP: testIP1}, {Name: testPod2GUID, IP: testIP2}}
+
+	tests := []struct {
+		name        string
+		modify      func(*StateSnapshot)
+		assignments []v1alpha.IPAssignment
+	}{
+		{
+			name:        "unsupported version",
+			modify:      func(s *StateSnapshot) { s.Version = StateSnapshotVersion + 1 },
+			assignments: allAssignments,
+		},
+		{
+			name: "content does not match checksum",
+			modify: func(s *StateSnapshot) {
+				ipconfig := s.PodIPConfigState[testPod2GUID]
+				ipconfig.State = cns.PendingRelease
+				s.PodIPConfigState[testPod2GUID] = ipconfig
+			},
+			assignments: allAssignments,
+		},
+		{
+			name:        "IP is not assigned to the node",
+			modify:      func(*StateSnapshot) {},
+			assignments: allAssignments[:1],
+		},
+		{
+			name:        "IP is assigned another address",
+			modify:      func(*StateSnapshot) {},
+			assignments: []v1alpha.IPAssignment{{Name: testPod1GUID, IP: testIP3}, {Name: testPod2GUID, IP: testIP2}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, snapshot := exportTestSnapshot(t)
+			tt.modify(&snapshot)
+
+			svc := getTestService()
+			svc.NodeNetworkConfigGetter = newTestNNC(tt.assignments...)
+			resp := svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+			assert.Equal(t, types.InvalidStateSnapshot, resp.ReturnCode, resp.Message)
+			assert.Empty(t, svc.PodIPConfigState)
+		})
+	}
+
+	t.Run("NC is not in the NodeNetworkConfig", func(t *testing.T) {
+		svc := getTestService()
+		svc.NodeNetworkConfigGetter = &nodeNetworkConfigGetterFake{}
+		resp := svc.ImportStateSnapshot(context.Background(), ImportStateSnapshotRequest{Snapshot: snapshot})
+		assert.Equal(t, types.InvalidStateSnapshot, resp.ReturnCode, resp.Message)
+	})
+}
@@ -98,9 +98,90 @@ func (service *HTTPRestService) restoreState() {
 	logger.Printf("[Azure CNS]  Restored state, %+v\n", service.state)
 }
 
+// saveIPConfigState writes the ipconfig to the ipam store. The write is durable once syncIPConfigState returns.
+func (service *HTTPRestService) saveIPConfigState(ipconfig cns.IPConfigurationStatus) error {
+	// Skip if a store is not provided.
+	if service.ipamStore == nil {
+		return nil
+	}
+
+	if err := service.ipamStore.Stage(ipconfig.ID, &ipconfig); err != nil {
+		logger.Errorf("[Azure CNS]  Failed to save ipconfig %+v, err:%v", ipconfig, err)
+		return err
+	}
+
+	return nil
+}
+
+// removeIPConfigState removes the ipconfig from the ipam store. The removal is durable once syncIPConfigState
+// returns.
+func (service *HTTPRestService) removeIPConfigState(ipID string) error {
+	// Skip if a store is not provided.
+	if service.ipamStore == nil {
+		return nil
+	}
+
+	return service.ipamStore.Stage(ipID, nil)
+}
+
+// syncIPConfigState waits until the ipconfigs written to the ipam store are durable. It is called after the service
+// lock is released, so that requests don't wait for the disk while they hold it, and requests which changed
+// ipconfigs at the same time share one flush of the store.
+func (service *HTTPRestService) syncIPConfigState() error {
+	// Skip if a store is not provided.
+	if service.ipamStore == nil {
+		return nil
+	}
+
+	if err := service.ipamStore.Sync(); err != nil {
+		logger.Errorf("[Azure CNS]  Failed to sync ipam store, err:%v", err)
+		return err
+	}
+
+	return nil
+}
+
+// restoreIPConfigState restores PodIPConfigState from the ipam store and rebuilds the pod to IP mapping.
+func (service *HTTPRestService) restoreIPConfigState() {
+	logger.Printf("[Azure CNS] restoreIPConfigState")
+
+	// Skip if a store is not provided.
+	if service.ipamStore == nil {
+		logger.Printf("[Azure CNS]  ipam store not initialized.")
+		return
+	}
+
+	// The store is kept when it cannot be read, the ipconfigs which are not restored are reconciled from the pods.
+	ipIDs, err := service.ipamStore.Keys()
+	if err != nil {
+		logger.Errorf("[Azure CNS]  Failed to restore ipconfig state, err:%v", err)
+		return
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	for _, ipID := range ipIDs {
+		var ipconfig cns.IPConfigurationStatus
+		if err := service.ipamStore.Read(ipID, &ipconfig); err != nil {
+			logger.Errorf("[Azure CNS]  Failed to restore ipconfig %s, err:%v", ipID, err)
+			continue
+		}
+
+		service.setPodIPConfigStateUntransacted(ipconfig)
+		if ipconfig.State == cns.Allocated && ipconfig.PodInfo != nil {
+			service.PodIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()] = append(service.PodIPIDByPodInterfaceKey[ipconfig.PodInfo.Key()], ipID)
+		}
+	}
+
+	logger.Printf("[Azure CNS]  Restored %d ipconfigs", len(service.PodIPConfigState))
+}
+
 func (service *HTTPRestService) saveNetworkContainerGoalState(
 	req cns.CreateNetworkContainerRequest,
 ) (types.ResponseCode, string) {
+	// the ipconfigs of the NC are rebuilt on reconcile, so a failed sync is not fatal
+	defer service.syncIPConfigState() //nolint:errcheck // logged
 	// we don't want to overwrite what other calls may have written
 	service.Lock()
 	defer service.Unlock()
@@ -286,15 +367,20 @@ func (service *HTTPRestService) addIPConfigStateUntransacted(ncID string, hostVe
 		}
 		// add the new State
 		ipconfigStatus := cns.IPConfigurationStatus{
-			NCID:      ncID,
-			ID:        ipID,
-			IPAddress: ipconfig.IPAddress,
-			State:     newIPCNSStatus,
-			PodInfo:   nil,
+			NCID:                    ncID,
+			ID:                      ipID,
+			IPAddress:               ipconfig.IPAddress,
+			State:                   newIPCNSStatus,
+			PodInfo:                 nil,
+			LastStateTransitionTime: time.Now().UTC(),
 		}
 		logger.Printf("[Azure-Cns] Add IP %s as %s", ipconfig.IPAddress, newIPCNSStatus)
 
-		service.PodIPConfigState[ipID] = ipconfigStatus
+		// the pool is rebuilt from the NC on reconcile, so a failed write is not fatal
+		if err := service.saveIPConfigState(ipconfigStatus); err != nil {
+			logger.Errorf("[Azure-Cns] Failed to persist IP %s, err: %v", ipconfig.IPAddress, err)
+		}
+		service.setPodIPConfigStateUntransacted(ipconfigStatus)
 
 		// Todo Update batch API and maintain the count
 	}
@@ -333,7 +419,10 @@ func (service *HTTPRestService) removeToBeDeletedIPStateUntransacted(
 	logger.Printf("[Azure-Cns] Delete the PodIpConfigState, IpId: %s, IPConfigStatus: %v",
 		ipID,
 		service.PodIPConfigState[ipID])
-	delete(service.PodIPConfigState, ipID)
+	if err := service.removeIPConfigState(ipID); err != nil {
+		logger.Errorf("[Azure-Cns] Failed to remove IpId %s from the ipam store, err: %v", ipID, err)
+	}
+	service.deletePodIPConfigStateUntransacted(ipID)
 	return 0, ""
 }
 
@@ -0,0 +1,204 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+)
+
+const (
+	// ipConfigEventHistory is how many events are retained for watchers to resume from.
+	ipConfigEventHistory = 1024
+	// defaultWatchTimeout is how long a watch request is held when it does not set a timeout.
+	defaultWatchTimeout = 30 * time.Second
+	// maxWatchTimeout bounds how long a watch request can be held.
+	maxWatchTimeout = 5 * time.Minute
+)
+
+// ipConfigWatcher records the changes to PodIPConfigState as a sequence of revisioned events, and wakes up
+// the watch requests waiting for them.
+type ipConfigWatcher struct {
+	sync.Mutex
+	revision int64
+	// events holds the most recent events, oldest first. Its length never exceeds ipConfigEventHistory.
+	events []cns.IPConfigEvent
+	// changed is closed and replaced whenever an event is recorded.
+	changed chan struct{}
+}
+
+func newIPConfigWatcher() *ipConfigWatcher {
+	return &ipConfigWatcher{
+		// start from the time CNS started, so revisions held by watchers of a previous run are
+		// reported as compacted instead of being mistaken for revisions of this run.
+		revision: time.Now().UnixNano(),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (w *ipConfigWatcher) record(eventType cns.IPConfigEventType, previousState cns.IPConfigState, ipConfig cns.IPConfigurationStatus) {
+	if w == nil {
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.revision++
+	if len(w.events) == ipConfigEventHistory {
+		copy(w.events, w.events[1:])
+		w.events = w.events[:len(w.events)-1]
+	}
+	w.events = append(w.events, cns.IPConfigEvent{
+		Revision:      w.revision,
+		Type:          eventType,
+		PreviousState: previousState,
+		IPConfig:      ipConfig,
+	})
+
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// eventsSince returns the events after revision and the current revision. If there are no such events, it
+// returns a channel which is closed when the next event is recorded.
+func (w *ipConfigWatcher) eventsSince(revision int64) ([]cns.IPConfigEvent, int64, <-chan struct{}, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	oldest := w.revision - int64(len(w.events))
+	if revision < oldest || revision > w.revision {
+		//nolint:goerr113
+		return nil, w.revision, nil, fmt.Errorf("revision %d is outside of the retained revisions [%d, %d]", revision, oldest, w.revision)
+	}
+
+	if revision == w.revision {
+		return nil, w.revision, w.changed, nil
+	}
+
+	start := len(w.events) - int(w.revision-revision)
+	events := make([]cns.IPConfigEvent, len(w.events)-start)
+	copy(events, w.events[start:])
+	return events, w.revision, nil, nil
+}
+
+func (w *ipConfigWatcher) currentRevision() int64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.revision
+}
+
+// setPodIPConfigStateUntransacted stores the ipconfig in PodIPConfigState and records the change for watchers.
+// Caller will acquire/release the service lock.
+func (service *HTTPRestService) setPodIPConfigStateUntransacted(ipconfig cns.IPConfigurationStatus) {
+	previous, exists := service.PodIPConfigState[ipconfig.ID]
+	service.PodIPConfigState[ipconfig.ID] = ipconfig
+
+	switch {
+	case !exists:
+		service.ipConfigWatcher.record(cns.IPConfigAdded, "", ipconfig)
+	case previous.State != ipconfig.State:
+		service.ipConfigWatcher.record(cns.IPConfigStateChanged, previous.State, ipconfig)
+		observeIPConfigStateDuration(previous, ipconfig.State, ipconfig.LastStateTransitionTime)
+	}
+}
+
+// deletePodIPConfigStateUntransacted deletes the ipconfig from PodIPConfigState and records the change for watchers.
+// Caller will acquire/release the service lock.
+func (service *HTTPRestService) deletePodIPConfigStateUntransacted(ipID string) {
+	previous, exists := service.PodIPConfigState[ipID]
+	if !exists {
+		return
+	}
+
+	delete(service.PodIPConfigState, ipID)
+	service.ipConfigWatcher.record(cns.IPConfigDeleted, "", previous)
+	observeIPConfigStateDuration(previous, ipConfigRemoved, time.Now())
+}
+
+// WatchIPConfigs returns the changes to IPConfigs after req.Revision, waiting until there is at least one or the
+// request times out. A request for revision 0 returns every IPConfig as an Added event.
+func (service *HTTPRestService) WatchIPConfigs(ctx context.Context, req cns.WatchIPConfigsRequest) cns.WatchIPConfigsResponse {
+	if req.Revision == 0 {
+		return service.ipConfigSnapshot()
+	}
+
+	timeout := defaultWatchTimeout
+	if req.TimeoutInSecs > 0 {
+		timeout = time.Duration(req.TimeoutInSecs) * time.Second
+	}
+	if timeout > maxWatchTimeout {
+		timeout = maxWatchTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		events, revision, changed, err := service.ipConfigWatcher.eventsSince(req.Revision)
+		if err != nil {
+			return cns.WatchIPConfigsResponse{
+				Revision: revision,
+				Response: cns.Response{
+					ReturnCode: types.WatchRevisionCompacted,
+					Message:    err.Error(),
+				},
+			}
+		}
+
+		if changed == nil {
+			return cns.WatchIPConfigsResponse{Revision: revision, Events: events}
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return cns.WatchIPConfigsResponse{Revision: revision}
+		case <-ctx.Done():
+			return cns.WatchIPConfigsResponse{Revision: revision}
+		}
+	}
+}
+
+func (service *HTTPRestService) ipConfigSnapshot() cns.WatchIPConfigsResponse {
+	// hold the service lock so no change can be recorded between reading the revision and the state.
+	service.RLock()
+	defer service.RUnlock()
+
+	resp := cns.WatchIPConfigsResponse{
+		Revision: service.ipConfigWatcher.currentRevision(),
+		Events:   make([]cns.IPConfigEvent, 0, len(service.PodIPConfigState)),
+	}
+	for _, ipconfig := range service.PodIPConfigState {
+		resp.Events = append(resp.Events, cns.IPConfigEvent{
+			Revision: resp.Revision,
+			Type:     cns.IPConfigAdded,
+			IPConfig: ipconfig,
+		})
+	}
+	return resp
+}
+
+func (service *HTTPRestService) watchIPConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	var req cns.WatchIPConfigsRequest
+	if err := service.Listener.Decode(w, r, &req); err != nil {
+		resp := cns.WatchIPConfigsResponse{
+			Response: cns.Response{
+				ReturnCode: types.UnexpectedError,
+				Message:    err.Error(),
+			},
+		}
+		err = service.Listener.Encode(w, &resp)
+		logger.ResponseEx(service.Name, req, resp, resp.Response.ReturnCode, err)
+		return
+	}
+
+	resp := service.WatchIPConfigs(r.Context(), req)
+	err := service.Listener.Encode(w, &resp)
+	logger.Printf("[Azure CNS] WatchIPConfigs from revision %d returned %d events at revision %d, code %s, err %v",
+		req.Revision, len(resp.Events), resp.Revision, resp.Response.ReturnCode, err)
+}
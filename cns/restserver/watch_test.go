@@ -0,0 +1,150 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func watchAndRequireSuccess(t *testing.T, svc *HTTPRestService, revision int64) cns.WatchIPConfigsResponse {
+	t.Helper()
+	resp := svc.WatchIPConfigs(context.Background(), cns.WatchIPConfigsRequest{Revision: revision, TimeoutInSecs: 1})
+	require.Equal(t, types.Success, resp.Response.ReturnCode, resp.Response.Message)
+	return resp
+}
+
+func TestWatchIPConfigsEmitsStateTransitions(t *testing.T) {
+	svc := getTestService()
+
+	snapshot := watchAndRequireSuccess(t, svc, 0)
+	assert.Empty(t, snapshot.Events)
+
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+
+	added := watchAndRequireSuccess(t, svc, snapshot.Revision)
+	require.Len(t, added.Events, 1)
+	assert.Equal(t, snapshot.Revision+1, added.Events[0].Revision)
+	assert.Equal(t, cns.IPConfigAdded, added.Events[0].Type)
+	assert.Equal(t, cns.Available, added.Events[0].IPConfig.State)
+	assert.Equal(t, added.Events[0].Revision, added.Revision)
+
+	req := cns.IPConfigRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+	_, err := requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+
+	// a retried request does not change the state, so it is not an event
+	_, err = requestIPConfigHelper(svc, req)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.releaseIPConfig(testPod1Info))
+
+	changed := watchAndRequireSuccess(t, svc, added.Revision)
+	require.Len(t, changed.Events, 2)
+	assert.Equal(t, cns.IPConfigStateChanged, changed.Events[0].Type)
+	assert.Equal(t, cns.Available, changed.Events[0].PreviousState)
+	assert.Equal(t, cns.Allocated, changed.Events[0].IPConfig.State)
+	assert.Equal(t, testIP1, changed.Events[0].IPConfig.IPAddress)
+	assert.Equal(t, cns.IPConfigStateChanged, changed.Events[1].Type)
+	assert.Equal(t, cns.Allocated, changed.Events[1].PreviousState)
+	assert.Equal(t, cns.Available, changed.Events[1].IPConfig.State)
+
+	svc.Lock()
+	svc.removeToBeDeletedIPStateUntransacted(testPod1GUID, false)
+	svc.Unlock()
+
+	deleted := watchAndRequireSuccess(t, svc, changed.Revision)
+	require.Len(t, deleted.Events, 1)
+	assert.Equal(t, cns.IPConfigDeleted, deleted.Events[0].Type)
+	assert.Equal(t, testPod1GUID, deleted.Events[0].IPConfig.ID)
+}
+
+func TestWatchIPConfigsSnapshot(t *testing.T) {
+	svc := getTestService()
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testPod1GUID: newSecondaryIPConfig(testIP1, -1),
+		testPod2GUID: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+
+	snapshot := watchAndRequireSuccess(t, svc, 0)
+	require.Len(t, snapshot.Events, 2)
+	for _, event := range snapshot.Events {
+		assert.Equal(t, cns.IPConfigAdded, event.Type)
+		assert.Equal(t, snapshot.Revision, event.Revision)
+		assert.Equal(t, svc.PodIPConfigState[event.IPConfig.ID], event.IPConfig)
+	}
+
+	// there are no changes after the snapshot, so the watch times out without events
+	start := time.Now()
+	resp := watchAndRequireSuccess(t, svc, snapshot.Revision)
+	assert.Empty(t, resp.Events)
+	assert.Equal(t, snapshot.Revision, resp.Revision)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestWatchIPConfigsWaitsForChanges(t *testing.T) {
+	svc := getTestService()
+	snapshot := watchAndRequireSuccess(t, svc, 0)
+
+	respCh := make(chan cns.WatchIPConfigsResponse)
+	go func() {
+		respCh <- svc.WatchIPConfigs(context.Background(), cns.WatchIPConfigsRequest{Revision: snapshot.Revision, TimeoutInSecs: 10})
+	}()
+
+	svc.Lock()
+	svc.setPodIPConfigStateUntransacted(NewPodState(testIP1, 24, testPod1GUID, testNCID, cns.Available, 0))
+	svc.Unlock()
+
+	select {
+	case resp := <-respCh:
+		require.Equal(t, types.Success, resp.Response.ReturnCode)
+		require.Len(t, resp.Events, 1)
+		assert.Equal(t, testPod1GUID, resp.Events[0].IPConfig.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watch to return when the IPConfig was added")
+	}
+
+	// a cancelled request returns without events
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := svc.WatchIPConfigs(ctx, cns.WatchIPConfigsRequest{Revision: snapshot.Revision + 1})
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Events)
+}
+
+func TestWatchIPConfigsCompactedRevision(t *testing.T) {
+	svc := getTestService()
+	snapshot := watchAndRequireSuccess(t, svc, 0)
+
+	svc.Lock()
+	for i := 0; i <= ipConfigEventHistory; i++ {
+		state := cns.Available
+		if i%2 == 0 {
+			state = cns.PendingRelease
+		}
+		svc.setPodIPConfigStateUntransacted(NewPodState(testIP1, 24, testPod1GUID, testNCID, state, 0))
+	}
+	svc.Unlock()
+
+	// the first event has been dropped from the history
+	resp := svc.WatchIPConfigs(context.Background(), cns.WatchIPConfigsRequest{Revision: snapshot.Revision})
+	assert.Equal(t, types.WatchRevisionCompacted, resp.Response.ReturnCode)
+
+	resp = watchAndRequireSuccess(t, svc, snapshot.Revision+1)
+	assert.Len(t, resp.Events, ipConfigEventHistory)
+	assert.Equal(t, snapshot.Revision+ipConfigEventHistory+1, resp.Revision)
+
+	// revisions from the future, such as those of a previous run of CNS, are also rejected
+	resp = svc.WatchIPConfigs(context.Background(), cns.WatchIPConfigsRequest{Revision: resp.Revision + 1})
+	assert.Equal(t, types.WatchRevisionCompacted, resp.Response.ReturnCode)
+}
@@ -107,6 +107,12 @@ func (service *Service) StartListener(config *common.ServiceConfig) error {
 		if err := service.Listener.Start(config.ErrChan); err != nil {
 			return err
 		}
+		// the unix socket serves the same API during the migration of clients from the TCP endpoint
+		if config.UnixSocketPath != "" {
+			if err := service.Listener.StartUnixSocket(config.ErrChan, config.UnixSocketPath, config.UnixSocketMode); err != nil {
+				return err
+			}
+		}
 	} else {
 		return fmt.Errorf("Failed to start a listener, it is not initialized, config %+v", config)
 	}
@@ -21,13 +21,16 @@ import (
 	"github.com/Azure/azure-container-networking/cnm/ipam"
 	"github.com/Azure/azure-container-networking/cnm/network"
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/auth"
 	"github.com/Azure/azure-container-networking/cns/cnireconciler"
 	cni "github.com/Azure/azure-container-networking/cns/cnireconciler"
 	"github.com/Azure/azure-container-networking/cns/cnsclient"
+	"github.com/Azure/azure-container-networking/cns/cnsgrpc"
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/hnsclient"
 	"github.com/Azure/azure-container-networking/cns/imdsclient"
+	"github.com/Azure/azure-container-networking/cns/ipamleakdetector"
 	"github.com/Azure/azure-container-networking/cns/ipampoolmonitor"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/multitenantcontroller"
@@ -46,11 +49,12 @@ import (
 
 const (
 	// Service name.
-	name                              = "azure-cns"
-	pluginName                        = "azure-vnet"
-	defaultCNINetworkConfigFileName   = "10-azure.conflist"
-	dncApiVersion                     = "?api-version=2018-03-01"
-	poolIPAMRefreshRateInMilliseconds = 1000
+	name                            = "azure-cns"
+	pluginName                      = "azure-vnet"
+	defaultCNINetworkConfigFileName = "10-azure.conflist"
+	dncApiVersion                   = "?api-version=2018-03-01"
+	ipCooldownRefreshInterval       = time.Second
+	configReloadInterval            = 10 * time.Second
 
 	// 720 * acn.FiveSeconds sec sleeps = 1Hr
 	maxRetryNodeRegister = 720
@@ -239,7 +243,7 @@ var args = acn.ArgumentList{
 	{
 		Name:         acn.OptDebugArg,
 		Shorthand:    acn.OptDebugArgAlias,
-		Description:  "Argument flag to be paired with the 'debugcmd' flag.",
+		Description:  "Argument flag to be paired with the 'debugcmd' flag, such as the snapshot file of the exportSnapshot, importSnapshot and validateSnapshot commands.",
 		Type:         "string",
 		DefaultValue: "",
 	},
@@ -423,6 +427,14 @@ func main() {
 
 	configuration.SetCNSConfigDefaults(&cnsconfig)
 	logger.Printf("[Azure CNS] Read config :%+v", cnsconfig)
+	applyLogLevel(cnsconfig, logLevel)
+
+	// settings which can change while CNS is running are applied when the config file changes
+	configPath, err := configuration.ConfigPath()
+	if err != nil {
+		logger.Errorf("[Azure CNS] Changes to the cns config will not be applied until CNS restarts: %v", err)
+	}
+	configWatcher := configuration.NewWatcher(configPath, cnsconfig)
 
 	if cnsconfig.WireserverIP != "" {
 		nmagentclient.WireserverIP = cnsconfig.WireserverIP
@@ -457,6 +469,14 @@ func main() {
 		logger.InitAI(aiConfig, ts.DisableTrace, ts.DisableMetric, ts.DisableEvent)
 	}
 
+	configWatcher.OnReload(func(cnsconfig configuration.CNSConfig) {
+		applyLogLevel(cnsconfig, logLevel)
+		if !disableTelemetry {
+			ts := cnsconfig.TelemetrySettings
+			logger.SetTelemetryLogging(ts.DisableTrace, ts.DisableMetric, ts.DisableEvent)
+		}
+	})
+
 	// Log platform information.
 	logger.Printf("Running on %v", platform.GetOSInfo())
 
@@ -474,6 +494,14 @@ func main() {
 		return
 	}
 
+	// Create the journaled store for the IPAM pod IP state.
+	ipamStoreFileName := storeFileLocation + name + "-ipam.json"
+	config.IPAMStore, err = store.NewJournalFileStore(ipamStoreFileName)
+	if err != nil {
+		logger.Errorf("Failed to create ipam store file: %s, due to error %v\n", ipamStoreFileName, err)
+		return
+	}
+
 	nmaclient, err := nmagentclient.NewNMAgentClient("")
 	if err != nil {
 		logger.Errorf("Failed to start nmagent client due to error %v", err)
@@ -511,8 +539,34 @@ func main() {
 				TLSSubjectName:     cnsconfig.TLSSubjectName,
 				TLSCertificatePath: cnsconfig.TLSCertificatePath,
 				TLSPort:            cnsconfig.TLSPort,
+				TLSClientCAPath:    cnsconfig.TLSClientCAPath,
+			}
+		}
+
+		if cnsconfig.UnixSocketSettings.Enable {
+			mode, err := cnsconfig.UnixSocketSettings.Mode()
+			if err != nil {
+				logger.Errorf("Failed to parse the unix socket settings, err:%v.\n", err)
+				return
+			}
+			config.UnixSocketPath = cnsconfig.UnixSocketSettings.SocketPath
+			config.UnixSocketMode = mode
+		}
+
+		if cnsconfig.AuthSettings.Enable {
+			authorizer, err := auth.NewPolicy(cnsconfig.AuthSettings.Policy)
+			if err != nil {
+				logger.Errorf("Failed to create the auth policy, err:%v.\n", err)
+				return
 			}
+			httpRestService.(*restserver.HTTPRestService).Authorizer = authorizer
 		}
+		httpRestService.(*restserver.HTTPRestService).ConfigWatcher = configWatcher
+
+		// bound the IP requests handled at once, and ask callers to retry requests which can't be handled now
+		httpRestService.(*restserver.HTTPRestService).IPRequestLimiter = restserver.NewIPRequestLimiter(cnsconfig.IPRequestLimitSettings)
+		httpRestService.(*restserver.HTTPRestService).IPRequestRetryAfter =
+			time.Duration(cnsconfig.IPRequestLimitSettings.RetryAfterInMs) * time.Millisecond
 
 		err = httpRestService.Init(&config)
 		if err != nil {
@@ -556,7 +610,7 @@ func main() {
 		}
 		logger.Printf("Set GlobalPodInfoScheme %v", cns.GlobalPodInfoScheme)
 
-		err = InitializeCRDState(rootCtx, httpRestService, cnsconfig)
+		err = InitializeCRDState(rootCtx, httpRestService, cnsconfig, configWatcher)
 		if err != nil {
 			logger.Errorf("Failed to start CRD Controller, err:%v.\n", err)
 			return
@@ -566,7 +620,7 @@ func main() {
 	// Initialize multi-tenant controller if the CNS is running in MultiTenantCRD mode.
 	// It must be started before we start HTTPRestService.
 	if config.ChannelMode == cns.MultiTenantCRD {
-		err = InitializeMultiTenantController(rootCtx, httpRestService, cnsconfig)
+		err = InitializeMultiTenantController(rootCtx, httpRestService, cnsconfig, configWatcher)
 		if err != nil {
 			logger.Errorf("Failed to start multiTenantController, err:%v.\n", err)
 			return
@@ -582,11 +636,31 @@ func main() {
 		}
 	}
 
+	var grpcServer *cnsgrpc.Server
+	if cnsconfig.GRPCSettings.Enable {
+		logger.Printf("[Azure CNS] Start gRPC listener")
+		mode, err := cnsconfig.GRPCSettings.Mode()
+		if err != nil {
+			logger.Errorf("Failed to parse the gRPC settings, err:%v.\n", err)
+			return
+		}
+		grpcServer = cnsgrpc.NewServer(httpRestService.(*restserver.HTTPRestService), cnsconfig.GRPCSettings.SocketPath, mode,
+			httpRestService.(*restserver.HTTPRestService).Authorizer)
+		if err = grpcServer.Start(); err != nil {
+			logger.Errorf("Failed to start CNS gRPC server, err:%v.\n", err)
+			return
+		}
+	}
+
 	if !disableTelemetry {
 		go logger.SendHeartBeat(rootCtx, cnsconfig.TelemetrySettings.HeartBeatIntervalInMins)
 		go httpRestService.SendNCSnapShotPeriodically(rootCtx, cnsconfig.TelemetrySettings.SnapshotIntervalInMins)
 	}
 
+	if configPath != "" {
+		go configWatcher.Start(rootCtx, configReloadInterval)
+	}
+
 	// If CNS is running on managed DNC mode
 	if config.ChannelMode == cns.Managed {
 		if privateEndpoint == "" || infravnet == "" || nodeID == "" {
@@ -683,6 +757,10 @@ func main() {
 
 	logger.Printf("stop cns service")
 	// Cleanup.
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+
 	if httpRestService != nil {
 		httpRestService.Stop()
 	}
@@ -703,7 +781,8 @@ func main() {
 	logger.Close()
 }
 
-func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig) error {
+func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig,
+	configWatcher *configuration.Watcher) error {
 	var multiTenantController multitenantcontroller.RequestController
 	kubeConfig, err := ctrl.GetConfig()
 	if err != nil {
@@ -757,24 +836,46 @@ func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HT
 
 	// TODO: do we need this to be running?
 	logger.Printf("Starting SyncHostNCVersion")
-	go func() {
-		// Periodically poll vfp programmed NC version from NMAgent
-		tickerChannel := time.Tick(cnsconfig.SyncHostNCVersionIntervalMs * time.Millisecond)
-		for {
-			select {
-			case <-tickerChannel:
-				httpRestServiceImpl.SyncHostNCVersion(ctx, cnsconfig.ChannelMode, cnsconfig.SyncHostNCTimeoutMs)
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	go syncHostNCVersionPeriodically(ctx, httpRestServiceImpl, configWatcher)
 
 	return nil
 }
 
+// newPoolScalingStrategy returns the ipam pool monitor scaling strategy selected in the CNS config.
+func newPoolScalingStrategy(settings configuration.IPAMPoolMonitorSettings) ipampoolmonitor.ScalingStrategy {
+	switch settings.ScalingStrategy {
+	case configuration.RateStrategy:
+		logger.Printf("[Azure CNS] Using rate based ipam pool scaling strategy with settings %+v", settings)
+		return ipampoolmonitor.NewRateScalingStrategy(ipampoolmonitor.RateScalingConfig{
+			Window:      time.Duration(settings.RateWindowInSecs) * time.Second,
+			Lookahead:   time.Duration(settings.RateLookaheadInSecs) * time.Second,
+			ReleaseHold: time.Duration(settings.ReleaseHoldInSecs) * time.Second,
+		})
+	case configuration.ThresholdStrategy:
+	default:
+		logger.Errorf("[Azure CNS] Unknown ipam pool scaling strategy %s, using %s", settings.ScalingStrategy, configuration.ThresholdStrategy)
+	}
+	return ipampoolmonitor.NewThresholdScalingStrategy()
+}
+
+// newLeakDetectorPodInfoProvider returns the source of the pods on the node for the leak detector.
+func newLeakDetectorPodInfoProvider(initializeFromCNI bool, apiServerProvider cns.PodInfoByIPProvider) cns.PodInfoByIPProvider {
+	if !initializeFromCNI {
+		return apiServerProvider
+	}
+	// the CNI provider holds the CNI state from when it was created, so create a new one for every call
+	return cns.PodInfoByIPProviderFunc(func(ctx context.Context) (map[string]cns.PodInfo, error) {
+		provider, err := cnireconciler.NewCNIPodInfoProvider()
+		if err != nil {
+			return nil, err
+		}
+		return provider.PodInfoByIP(ctx)
+	})
+}
+
 // initializeCRD state
-func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig) error {
+func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig,
+	configWatcher *configuration.Watcher) error {
 	var requestController singletenantcontroller.RequestController
 
 	logger.Printf("[Azure CNS] Starting request controller")
@@ -800,7 +901,7 @@ func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cn
 	httpRestServiceImplementation.SetNodeOrchestrator(&orchestrator)
 
 	// Get crd implementation of request controller
-	requestController, err = kubecontroller.New(
+	kubeRequestController, err := kubecontroller.New(
 		kubecontroller.Config{
 			InitializeFromCNI:  cnsconfig.InitializeFromCNI,
 			KubeConfig:         kubeConfig,
@@ -811,9 +912,26 @@ func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cn
 		logger.Errorf("[Azure CNS] Failed to make crd request controller :%v", err)
 		return err
 	}
+	requestController = kubeRequestController
+	httpRestServiceImplementation.StatusReporter = requestController
+	httpRestServiceImplementation.NodeNetworkConfigGetter = requestController
 
 	// initialize the ipam pool monitor
-	httpRestServiceImplementation.IPAMPoolMonitor = ipampoolmonitor.NewCNSIPAMPoolMonitor(httpRestServiceImplementation, requestController)
+	poolMonitor := ipampoolmonitor.NewCNSIPAMPoolMonitor(httpRestServiceImplementation, requestController,
+		newPoolScalingStrategy(cnsconfig.IPAMPoolMonitorSettings))
+	httpRestServiceImplementation.IPAMPoolMonitor = poolMonitor
+	configWatcher.OnReload(func(cnsconfig configuration.CNSConfig) {
+		poolMonitor.SetRefreshInterval(time.Duration(cnsconfig.IPAMPoolMonitorSettings.RefreshIntervalInMs) * time.Millisecond)
+	})
+
+	// hold released IPs in Cooldown before they are reused
+	httpRestServiceImplementation.IPCooldown = time.Duration(cnsconfig.IPCooldownInSecs) * time.Second
+
+	// initialize the ipam leak detector
+	httpRestServiceImplementation.IPAMLeakDetector = ipamleakdetector.NewIPAMLeakDetector(httpRestServiceImplementation,
+		newLeakDetectorPodInfoProvider(cnsconfig.InitializeFromCNI, kubeRequestController),
+		time.Duration(cnsconfig.IPAMLeakDetectorSettings.GracePeriodInSecs)*time.Second,
+		!cnsconfig.IPAMLeakDetectorSettings.EnableRelease)
 
 	err = requestController.Init(ctx)
 	if err != nil {
@@ -851,7 +969,7 @@ func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cn
 	logger.Printf("Starting IPAM Pool Monitor")
 	go func() {
 		for {
-			if err := httpRestServiceImplementation.IPAMPoolMonitor.Start(ctx, poolIPAMRefreshRateInMilliseconds); err != nil {
+			if err := poolMonitor.Start(ctx, configWatcher.Active().IPAMPoolMonitorSettings.RefreshIntervalInMs); err != nil {
 				logger.Errorf("[Azure CNS] Failed to start pool monitor with err: %v", err)
 				// todo: add a CNS metric to count # of failures
 			} else {
@@ -864,19 +982,70 @@ func InitializeCRDState(ctx context.Context, httpRestService cns.HTTPService, cn
 		}
 	}()
 
-	logger.Printf("Starting SyncHostNCVersion")
+	logger.Printf("Starting IPAM Leak Detector")
 	go func() {
-		// Periodically poll vfp programmed NC version from NMAgent
-		tickerChannel := time.Tick(cnsconfig.SyncHostNCVersionIntervalMs * time.Millisecond)
+		leakDetectorRefreshMilliseconds := cnsconfig.IPAMLeakDetectorSettings.RefreshIntervalInSecs * 1000
 		for {
-			select {
-			case <-tickerChannel:
-				httpRestServiceImplementation.SyncHostNCVersion(ctx, cnsconfig.ChannelMode, cnsconfig.SyncHostNCTimeoutMs)
-			case <-ctx.Done():
+			if err := httpRestServiceImplementation.IPAMLeakDetector.Start(ctx, leakDetectorRefreshMilliseconds); err != nil {
+				logger.Errorf("[Azure CNS] Failed to start leak detector with err: %v", err)
+			} else {
+				logger.Printf("[Azure CNS] Exiting IPAM Leak Detector")
 				return
 			}
+
+			// Retry after 1sec
+			time.Sleep(time.Second)
 		}
 	}()
 
+	// Without an IP cooldown released IPs are set Available right away, so only the IPs restored in Cooldown from
+	// a run with a cooldown are expired, once.
+	if httpRestServiceImplementation.IPCooldown <= 0 {
+		httpRestServiceImplementation.MarkExpiredCooldownIPsAsAvailable()
+	} else {
+		logger.Printf("Starting IP Cooldown expiry with cooldown %v", httpRestServiceImplementation.IPCooldown)
+		go func() {
+			tickerChannel := time.Tick(ipCooldownRefreshInterval)
+			for {
+				select {
+				case <-tickerChannel:
+					httpRestServiceImplementation.MarkExpiredCooldownIPsAsAvailable()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	logger.Printf("Starting SyncHostNCVersion")
+	go syncHostNCVersionPeriodically(ctx, httpRestServiceImplementation, configWatcher)
+
 	return nil
 }
+
+// syncHostNCVersionPeriodically polls the NC versions programmed by NMAgent, with the interval and timeout of the
+// active config, until ctx is done.
+func syncHostNCVersionPeriodically(ctx context.Context, httpRestService *restserver.HTTPRestService, configWatcher *configuration.Watcher) {
+	for {
+		cnsconfig := configWatcher.Active()
+		select {
+		case <-time.After(cnsconfig.SyncHostNCVersionIntervalMs * time.Millisecond):
+			httpRestService.SyncHostNCVersion(ctx, cnsconfig.ChannelMode, cnsconfig.SyncHostNCTimeoutMs)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// applyLogLevel sets the log level of the config, or the log level from the command line if the config does not
+// set one.
+func applyLogLevel(cnsconfig configuration.CNSConfig, cmdLineLogLevel int) {
+	level := cmdLineLogLevel
+	switch cnsconfig.LogLevel {
+	case acn.OptLogLevelInfo:
+		level = log.LevelInfo
+	case acn.OptLogLevelDebug:
+		level = log.LevelDebug
+	}
+	logger.SetLogLevel(level)
+}
@@ -2,23 +2,35 @@ package kubecontroller
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/cnsclient"
 	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/singletenantcontroller"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// Reasons of the ReconcileFailed condition
+const (
+	reasonReconciled               = "Reconciled"
+	reasonInvalidNetworkContainers = "InvalidNetworkContainers"
+	reasonNCUpdateFailed           = "NCUpdateFailed"
+	reasonStaleNCsInUse            = "StaleNetworkContainersInUse"
+)
+
 // CrdReconciler watches for CRD status changes
 type CrdReconciler struct {
 	KubeClient      KubeClient
 	NodeName        string
 	CNSClient       cnsclient.APIClient
 	IPAMPoolMonitor cns.IPAMPoolMonitor
+	StatusReporter  singletenantcontroller.StatusReporter // Reports reconcile failures on the CRD when set
 }
 
 // Reconcile is called on CRD status changes
@@ -43,38 +55,74 @@ func (r *CrdReconciler) Reconcile(ctx context.Context, request reconcile.Request
 		return reconcile.Result{}, nil
 	}
 
-	networkContainer := nnc.Status.NetworkContainers[0]
-	logger.Printf("[cns-rc] CRD Status: NcId: [%s], Version: [%d],  podSubnet: [%s], Subnet CIDR: [%s], "+
-		"Gateway Addr: [%s], Primary IP: [%s], SecondaryIpsCount: [%d]",
-		networkContainer.ID,
-		networkContainer.Version,
-		networkContainer.SubnetName,
-		networkContainer.SubnetAddressSpace,
-		networkContainer.DefaultGateway,
-		networkContainer.PrimaryIP,
-		len(networkContainer.IPAssignments))
+	var assignedIPCount int
+	for i := range nnc.Status.NetworkContainers {
+		networkContainer := nnc.Status.NetworkContainers[i]
+		logger.Printf("[cns-rc] CRD Status: NcId: [%s], Version: [%d],  podSubnet: [%s], Subnet CIDR: [%s], "+
+			"Gateway Addr: [%s], Primary IP: [%s], SecondaryIpsCount: [%d]",
+			networkContainer.ID,
+			networkContainer.Version,
+			networkContainer.SubnetName,
+			networkContainer.SubnetAddressSpace,
+			networkContainer.DefaultGateway,
+			networkContainer.PrimaryIP,
+			len(networkContainer.IPAssignments))
+		assignedIPCount += len(networkContainer.IPAssignments)
+	}
 
-	// Otherwise, create NC request and hand it off to CNS
-	ncRequest, err := CRDStatusToNCRequest(nnc.Status)
+	// Otherwise, create NC requests and hand them off to CNS
+	ncRequests, err := CRDStatusToNCRequests(nnc.Status)
 	if err != nil {
-		logger.Errorf("[cns-rc] Error translating crd status to nc request %v", err)
+		logger.Errorf("[cns-rc] Error translating crd status to nc requests %v", err)
+		r.setReconcileFailed(ctx, metav1.ConditionTrue, reasonInvalidNetworkContainers, err.Error())
 		// requeue
 		return reconcile.Result{}, err
 	}
 
-	if err = r.CNSClient.CreateOrUpdateNC(ncRequest); err != nil {
-		logger.Errorf("[cns-rc] Error creating or updating NC in reconcile: %v", err)
-		// requeue
-		return reconcile.Result{}, err
+	for i := range ncRequests {
+		if err = r.CNSClient.CreateOrUpdateNC(ncRequests[i]); err != nil {
+			logger.Errorf("[cns-rc] Error creating or updating NC %s in reconcile: %v", ncRequests[i].NetworkContainerid, err)
+			r.setReconcileFailed(ctx, metav1.ConditionTrue, reasonNCUpdateFailed,
+				fmt.Sprintf("failed to create or update NC %s: %v", ncRequests[i].NetworkContainerid, err))
+			// requeue
+			return reconcile.Result{}, err
+		}
 	}
 
 	r.CNSClient.UpdateIPAMPoolMonitor(nnc.Status.Scaler, nnc.Spec)
 	// record assigned IPs metric
-	assignedIPs.Set(float64(len(nnc.Status.NetworkContainers[0].IPAssignments)))
+	assignedIPs.Set(float64(assignedIPCount))
+
+	// NCs which are no longer in the status are deleted, once their IPs are released
+	if err = r.CNSClient.SetNodeNCs(ncRequests); err != nil {
+		logger.Errorf("[cns-rc] Error deleting the NCs which are no longer in the CRD status: %v", err)
+		r.setReconcileFailed(ctx, metav1.ConditionTrue, reasonStaleNCsInUse,
+			fmt.Sprintf("failed to delete the NetworkContainers which are no longer in the status: %v", err))
+		// requeue
+		return reconcile.Result{}, err
+	}
+	r.setReconcileFailed(ctx, metav1.ConditionFalse, reasonReconciled, "all NetworkContainers are reconciled")
 
 	return reconcile.Result{}, nil
 }
 
+// setReconcileFailed sets the ReconcileFailed condition. Failures to set it are only logged, the reconcile result
+// does not depend on them.
+func (r *CrdReconciler) setReconcileFailed(ctx context.Context, status metav1.ConditionStatus, reason, message string) {
+	if r.StatusReporter == nil {
+		return
+	}
+	condition := metav1.Condition{
+		Type:    v1alpha.ReconcileFailed,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	if err := r.StatusReporter.SetCondition(ctx, condition); err != nil {
+		logger.Errorf("[cns-rc] Failed to set condition %s: %v", condition.Type, err)
+	}
+}
+
 // SetupWithManager Sets up the reconciler with a new manager, filtering using NodeNetworkConfigFilter
 func (r *CrdReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
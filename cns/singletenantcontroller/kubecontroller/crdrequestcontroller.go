@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/cnireconciler"
@@ -20,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -41,11 +43,15 @@ type Config struct {
 	Service            *restserver.HTTPRestService
 }
 
-var _ singletenantcontroller.RequestController = (*requestController)(nil)
+var (
+	_ singletenantcontroller.RequestController = (*requestController)(nil)
+	_ cns.PodInfoByIPProvider                  = (*requestController)(nil)
+)
 
 // requestController
 // - watches CRD status changes
 // - updates CRD spec
+// - publishes CRD status conditions and Events
 type requestController struct {
 	cfg             Config
 	mgr             manager.Manager // Manager starts the reconcile loop which watches for crd status changes
@@ -53,11 +59,14 @@ type requestController struct {
 	directAPIClient DirectAPIClient // Direct client to interact with API server
 	directCRDClient DirectCRDClient // Direct client to interact with CRDs on API server
 	CNSClient       cnsclient.APIClient
-	nodeName        string // name of node running this program
+	recorder        record.EventRecorder // Records Events on the node and its pods
+	nodeName        string               // name of node running this program
 	Reconciler      *CrdReconciler
 	initialized     bool
 	Started         bool
 	lock            sync.Mutex
+	podEventsLock   sync.Mutex
+	lastPodEvents   map[string]time.Time // when the last Event was recorded, by pod and reason
 }
 
 // GetKubeConfig precedence
@@ -148,9 +157,11 @@ func New(cfg Config) (*requestController, error) {
 		directAPIClient: directAPIClient,
 		directCRDClient: directCRDClient,
 		CNSClient:       httpClient,
+		recorder:        mgr.GetEventRecorderFor(eventSource),
 		nodeName:        nodeName,
 		Reconciler:      crdreconciler,
 	}
+	crdreconciler.StatusReporter = &rc
 
 	return &rc, nil
 }
@@ -238,10 +249,10 @@ func (rc *requestController) initCNS(ctx context.Context) error {
 		return rc.CNSClient.ReconcileNCState(nil, nil, nnc.Status.Scaler, nnc.Spec)
 	}
 
-	// Convert to CreateNetworkContainerRequest
-	ncRequest, err := CRDStatusToNCRequest(nnc.Status)
+	// Convert to CreateNetworkContainerRequests
+	ncRequests, err := CRDStatusToNCRequests(nnc.Status)
 	if err != nil {
-		logger.Errorf("Error when converting nodeNetConfig status into CreateNetworkContainerRequest: %v", err)
+		logger.Errorf("Error when converting nodeNetConfig status into CreateNetworkContainerRequests: %v", err)
 		return err
 	}
 
@@ -262,19 +273,19 @@ func (rc *requestController) initCNS(ctx context.Context) error {
 			logger.Errorf("error when getting all pods when initializing cns: %v", err)
 			return err
 		}
-		podInfoByIPProvider = cns.PodInfoByIPProviderFunc(func() (map[string]cns.PodInfo, error) {
+		podInfoByIPProvider = cns.PodInfoByIPProviderFunc(func(context.Context) (map[string]cns.PodInfo, error) {
 			return rc.kubePodsToPodInfoByIP(pods.Items)
 		})
 	}
 
-	podInfoByIP, err := podInfoByIPProvider.PodInfoByIP()
+	podInfoByIP, err := podInfoByIPProvider.PodInfoByIP(ctx)
 	if err != nil {
 		return errors.Wrap(err, "err in CNS initialization")
 	}
 
 	// errors.Wrap provides additional context, and return nil if the err input arg is nil
 	// Call cnsclient init cns passing those two things.
-	return errors.Wrap(rc.CNSClient.ReconcileNCState(&ncRequest, podInfoByIP, nnc.Status.Scaler, nnc.Spec), "err in CNS reconciliation")
+	return errors.Wrap(rc.CNSClient.ReconcileNCState(ncRequests, podInfoByIP, nnc.Status.Scaler, nnc.Spec), "err in CNS reconciliation")
 }
 
 // kubePodsToPodInfoByIP maps kubernetes pods to cns.PodInfos by IP
@@ -291,6 +302,23 @@ func (rc *requestController) kubePodsToPodInfoByIP(pods []corev1.Pod) (map[strin
 	return podInfoByIP, nil
 }
 
+// PodInfoByIP lists the pods on this node from the API server and maps them to cns.PodInfos by IP.
+// Pods which have not been assigned an IP yet are skipped.
+func (rc *requestController) PodInfoByIP(ctx context.Context) (map[string]cns.PodInfo, error) {
+	pods, err := rc.getAllPods(ctx, rc.nodeName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+
+	assigned := make([]corev1.Pod, 0, len(pods.Items))
+	for i := range pods.Items {
+		if pods.Items[i].Status.PodIP != "" {
+			assigned = append(assigned, pods.Items[i])
+		}
+	}
+	return rc.kubePodsToPodInfoByIP(assigned)
+}
+
 // UpdateCRDSpec updates the CRD spec
 func (rc *requestController) UpdateCRDSpec(ctx context.Context, nnc v1alpha.NodeNetworkConfigSpec) error {
 	nodeNetworkConfig, err := rc.getNodeNetConfig(ctx, rc.nodeName, k8sNamespace)
@@ -318,6 +346,11 @@ func (rc *requestController) UpdateCRDSpec(ctx context.Context, nnc v1alpha.Node
 	return nil
 }
 
+// GetNodeNetworkConfig gets the nodeNetworkConfig CRD of the node CNS runs on
+func (rc *requestController) GetNodeNetworkConfig(ctx context.Context) (*v1alpha.NodeNetworkConfig, error) {
+	return rc.getNodeNetConfig(ctx, rc.nodeName, k8sNamespace)
+}
+
 // getNodeNetConfig gets the nodeNetworkConfig CRD given the name and namespace of the CRD object
 func (rc *requestController) getNodeNetConfig(ctx context.Context, name, namespace string) (*v1alpha.NodeNetworkConfig, error) {
 	nodeNetworkConfig := &v1alpha.NodeNetworkConfig{}
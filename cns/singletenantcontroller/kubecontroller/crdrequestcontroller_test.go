@@ -88,17 +88,52 @@ func (mc MockKubeClient) Update(ctx context.Context, obj client.Object, opts ...
 	return nil
 }
 
+// Mock implementation of the KubeClient interface Status method
+// Mimics that of controller-runtime's client.Client, which updates the status subresource
+func (mc MockKubeClient) Status() client.StatusWriter {
+	return MockStatusWriter{mockAPI: mc.mockAPI}
+}
+
+// MockStatusWriter implements client.StatusWriter
+type MockStatusWriter struct {
+	mockAPI *MockAPI
+}
+
+func (mw MockStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	nodeNetConfig := obj.(*v1alpha.NodeNetworkConfig)
+
+	existing, ok := mw.mockAPI.nodeNetConfigs[MockKey{Namespace: nodeNetConfig.Namespace, Name: nodeNetConfig.Name}]
+	if !ok {
+		return errors.New("Node Net Config not found in mock store")
+	}
+
+	nodeNetConfig.Status.DeepCopyInto(&existing.Status)
+	return nil
+}
+
+func (mw MockStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.New("Patch is not supported by the mock status writer")
+}
+
 // MockCNSClient implements API client interface
 type MockCNSClient struct {
 	MockCNSUpdated     bool
 	MockCNSInitialized bool
 	Pods               map[string]cns.PodInfo
-	NCRequest          *cns.CreateNetworkContainerRequest
+	NCRequests         []cns.CreateNetworkContainerRequest
+	UpdatedNCRequests  []cns.CreateNetworkContainerRequest
+	NodeNCRequests     []cns.CreateNetworkContainerRequest
 }
 
 // we're just testing that reconciler interacts with CNS on Reconcile().
 func (mi *MockCNSClient) CreateOrUpdateNC(ncRequest cns.CreateNetworkContainerRequest) error {
 	mi.MockCNSUpdated = true
+	mi.UpdatedNCRequests = append(mi.UpdatedNCRequests, ncRequest)
+	return nil
+}
+
+func (mi *MockCNSClient) SetNodeNCs(ncRequests []cns.CreateNetworkContainerRequest) error {
+	mi.NodeNCRequests = ncRequests
 	return nil
 }
 
@@ -113,10 +148,10 @@ func (mi *MockCNSClient) GetNC(nc cns.GetNetworkContainerRequest) (cns.GetNetwor
 	return cns.GetNetworkContainerResponse{NetworkContainerID: nc.NetworkContainerid}, nil
 }
 
-func (mi *MockCNSClient) ReconcileNCState(ncRequest *cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
+func (mi *MockCNSClient) ReconcileNCState(ncRequests []cns.CreateNetworkContainerRequest, podInfoByIP map[string]cns.PodInfo, scalar v1alpha.Scaler, spec v1alpha.NodeNetworkConfigSpec) error {
 	mi.MockCNSInitialized = true
 	mi.Pods = podInfoByIP
-	mi.NCRequest = ncRequest
+	mi.NCRequests = ncRequests
 	return nil
 }
 
@@ -678,7 +713,11 @@ func TestInitRequestController(t *testing.T) {
 		t.Fatalf("Init should pass cns pods that aren't part of host network")
 	}
 
-	if _, ok := mockCNSClient.NCRequest.SecondaryIPConfigs[allocatedUUID]; !ok {
+	if len(mockCNSClient.NCRequests) != 1 {
+		t.Fatalf("Expected 1 ncrequest but got %d", len(mockCNSClient.NCRequests))
+	}
+
+	if _, ok := mockCNSClient.NCRequests[0].SecondaryIPConfigs[allocatedUUID]; !ok {
 		t.Fatalf("Expected secondary ip config to be in ncrequest")
 	}
 }
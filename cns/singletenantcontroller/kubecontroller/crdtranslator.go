@@ -10,11 +10,24 @@ import (
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 )
 
-// CRDStatusToNCRequest translates a crd status to createnetworkcontainer request
-func CRDStatusToNCRequest(crdStatus v1alpha.NodeNetworkConfigStatus) (cns.CreateNetworkContainerRequest, error) {
+// CRDStatusToNCRequests translates a crd status to a createnetworkcontainer request per network container,
+// in the order the network containers are listed in the status
+func CRDStatusToNCRequests(crdStatus v1alpha.NodeNetworkConfigStatus) ([]cns.CreateNetworkContainerRequest, error) {
+	ncRequests := make([]cns.CreateNetworkContainerRequest, 0, len(crdStatus.NetworkContainers))
+	for i := range crdStatus.NetworkContainers {
+		ncRequest, err := crdNCToNCRequest(crdStatus.NetworkContainers[i])
+		if err != nil {
+			return nil, err
+		}
+		ncRequests = append(ncRequests, ncRequest)
+	}
+	return ncRequests, nil
+}
+
+// crdNCToNCRequest translates a crd network container to a createnetworkcontainer request
+func crdNCToNCRequest(nc v1alpha.NetworkContainer) (cns.CreateNetworkContainerRequest, error) {
 	var (
 		ncRequest         cns.CreateNetworkContainerRequest
-		nc                v1alpha.NetworkContainer
 		secondaryIPConfig cns.SecondaryIPConfig
 		ipSubnet          cns.IPSubnet
 		ipAssignment      v1alpha.IPAssignment
@@ -22,57 +35,45 @@ func CRDStatusToNCRequest(crdStatus v1alpha.NodeNetworkConfigStatus) (cns.Create
 		ip                net.IP
 		ipNet             *net.IPNet
 		size              int
-		numNCsSupported   int
-		numNCs            int
 	)
 
-	numNCsSupported = 1
-	numNCs = len(crdStatus.NetworkContainers)
+	ncRequest.SecondaryIPConfigs = make(map[string]cns.SecondaryIPConfig)
+	ncRequest.NetworkContainerid = nc.ID
+	ncRequest.NetworkContainerType = cns.Docker
+	ncRequest.Version = strconv.FormatInt(nc.Version, 10)
+	ncRequest.SubnetName = nc.SubnetName
 
-	// Right now we're only supporing one NC per node, but in the future we will support multiple NCs per node
-	if numNCs > numNCsSupported {
-		return ncRequest, fmt.Errorf("Number of network containers is not supported. Got %v number of ncs, supports %v", numNCs, numNCsSupported)
+	if ip = net.ParseIP(nc.PrimaryIP); ip == nil {
+		return ncRequest, fmt.Errorf("Invalid PrimaryIP %s:", nc.PrimaryIP)
 	}
 
-	for _, nc = range crdStatus.NetworkContainers {
-		ncRequest.SecondaryIPConfigs = make(map[string]cns.SecondaryIPConfig)
-		ncRequest.NetworkContainerid = nc.ID
-		ncRequest.NetworkContainerType = cns.Docker
-		ncRequest.Version = strconv.FormatInt(nc.Version, 10)
-
-		if ip = net.ParseIP(nc.PrimaryIP); ip == nil {
-			return ncRequest, fmt.Errorf("Invalid PrimaryIP %s:", nc.PrimaryIP)
-		}
+	if _, ipNet, err = net.ParseCIDR(nc.SubnetAddressSpace); err != nil {
+		return ncRequest, fmt.Errorf("Invalid SubnetAddressSpace %s:, err:%s", nc.SubnetAddressSpace, err)
+	}
 
-		if _, ipNet, err = net.ParseCIDR(nc.SubnetAddressSpace); err != nil {
-			return ncRequest, fmt.Errorf("Invalid SubnetAddressSpace %s:, err:%s", nc.SubnetAddressSpace, err)
-		}
+	size, _ = ipNet.Mask.Size()
+	ipSubnet.IPAddress = ip.String()
+	ipSubnet.PrefixLength = uint8(size)
+	ncRequest.IPConfiguration.IPSubnet = ipSubnet
+	ncRequest.IPConfiguration.GatewayIPAddress = nc.DefaultGateway
+	var ncVersion int
+	if ncVersion, err = strconv.Atoi(ncRequest.Version); err != nil {
+		return ncRequest, fmt.Errorf("Invalid ncRequest.Version is %s in CRD, err:%s", ncRequest.Version, err)
+	}
 
-		size, _ = ipNet.Mask.Size()
-		ipSubnet.IPAddress = ip.String()
-		ipSubnet.PrefixLength = uint8(size)
-		ncRequest.IPConfiguration.IPSubnet = ipSubnet
-		ncRequest.IPConfiguration.GatewayIPAddress = nc.DefaultGateway
-		var ncVersion int
-		if ncVersion, err = strconv.Atoi(ncRequest.Version); err != nil {
-			return ncRequest, fmt.Errorf("Invalid ncRequest.Version is %s in CRD, err:%s", ncRequest.Version, err)
+	for _, ipAssignment = range nc.IPAssignments {
+		if ip = net.ParseIP(ipAssignment.IP); ip == nil {
+			return ncRequest, fmt.Errorf("Invalid SecondaryIP %s:", ipAssignment.IP)
 		}
-
-		for _, ipAssignment = range nc.IPAssignments {
-			if ip = net.ParseIP(ipAssignment.IP); ip == nil {
-				return ncRequest, fmt.Errorf("Invalid SecondaryIP %s:", ipAssignment.IP)
-			}
-			secondaryIPConfig = cns.SecondaryIPConfig{
-				IPAddress: ip.String(),
-				NCVersion: ncVersion,
-			}
-			ncRequest.SecondaryIPConfigs[ipAssignment.Name] = secondaryIPConfig
-			logger.Debugf("Seconday IP Configs got set, name is %s, config is %v", ipAssignment.Name, secondaryIPConfig)
+		secondaryIPConfig = cns.SecondaryIPConfig{
+			IPAddress: ip.String(),
+			NCVersion: ncVersion,
 		}
-		logger.Printf("Set NC request info with NetworkContainerid %s, NetworkContainerType %s, NC Version %s",
-			ncRequest.NetworkContainerid, ncRequest.NetworkContainerType, ncRequest.Version)
+		ncRequest.SecondaryIPConfigs[ipAssignment.Name] = secondaryIPConfig
+		logger.Debugf("Seconday IP Configs got set, name is %s, config is %v", ipAssignment.Name, secondaryIPConfig)
 	}
+	logger.Printf("Set NC request info with NetworkContainerid %s, NetworkContainerType %s, NC Version %s, SubnetName %s",
+		ncRequest.NetworkContainerid, ncRequest.NetworkContainerType, ncRequest.Version, ncRequest.SubnetName)
 
-	// Only returning the first network container for now, later we will return a list
 	return ncRequest, nil
 }
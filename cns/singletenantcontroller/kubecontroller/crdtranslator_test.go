@@ -43,7 +43,7 @@ func TestStatusToNCRequestMalformedPrimaryIP(t *testing.T) {
 	}
 
 	// Test with malformed primary ip
-	_, err = CRDStatusToNCRequest(status)
+	_, err = CRDStatusToNCRequests(status)
 
 	if err == nil {
 		t.Fatalf("Expected translation of CRD status with malformed ip to fail.")
@@ -73,7 +73,7 @@ func TestStatusToNCRequestMalformedIPAssignment(t *testing.T) {
 	}
 
 	// Test with malformed ip assignment
-	_, err = CRDStatusToNCRequest(status)
+	_, err = CRDStatusToNCRequests(status)
 
 	if err == nil {
 		t.Fatalf("Expected translation of CRD status with malformed ip assignment to fail.")
@@ -103,7 +103,7 @@ func TestStatusToNCRequestPrimaryIPInCIDR(t *testing.T) {
 	}
 
 	// Test with primary ip not in CIDR form
-	_, err = CRDStatusToNCRequest(status)
+	_, err = CRDStatusToNCRequests(status)
 
 	if err == nil {
 		t.Fatalf("Expected translation of CRD status with primary ip not CIDR, to fail.")
@@ -133,7 +133,7 @@ func TestStatusToNCRequestIPAssignmentNotCIDR(t *testing.T) {
 	}
 
 	// Test with ip assignment not in CIDR form
-	_, err = CRDStatusToNCRequest(status)
+	_, err = CRDStatusToNCRequests(status)
 
 	if err == nil {
 		t.Fatalf("Expected translation of CRD status with ip assignment not CIDR, to fail.")
@@ -163,7 +163,7 @@ func TestStatusToNCRequestWithIncorrectSubnetAddressSpace(t *testing.T) {
 	}
 
 	// Test with ip assignment not in CIDR form
-	_, err = CRDStatusToNCRequest(status)
+	_, err = CRDStatusToNCRequests(status)
 
 	if err == nil {
 		t.Fatalf("Expected translation of CRD status with ip assignment not CIDR, to fail.")
@@ -173,6 +173,7 @@ func TestStatusToNCRequestWithIncorrectSubnetAddressSpace(t *testing.T) {
 func TestStatusToNCRequestSuccess(t *testing.T) {
 	var (
 		status       v1alpha.NodeNetworkConfigStatus
+		ncRequests   []cns.CreateNetworkContainerRequest
 		ncRequest    cns.CreateNetworkContainerRequest
 		secondaryIPs map[string]cns.SecondaryIPConfig
 		secondaryIP  cns.SecondaryIPConfig
@@ -200,12 +201,21 @@ func TestStatusToNCRequestSuccess(t *testing.T) {
 	}
 
 	// Test with ips formed correctly as CIDRs
-	ncRequest, err = CRDStatusToNCRequest(status)
+	ncRequests, err = CRDStatusToNCRequests(status)
 
 	if err != nil {
 		t.Fatalf("Expected translation of CRD status to succeed, got error :%v", err)
 	}
 
+	if len(ncRequests) != 1 {
+		t.Fatalf("Expected 1 ncRequest but got %d", len(ncRequests))
+	}
+	ncRequest = ncRequests[0]
+
+	if ncRequest.SubnetName != subnetName {
+		t.Fatalf("Expected ncRequest's subnet name to be %s but got %s", subnetName, ncRequest.SubnetName)
+	}
+
 	if ncRequest.IPConfiguration.IPSubnet.IPAddress != primaryIp {
 		t.Fatalf("Expected ncRequest's ipconfiguration to have the ip %v but got %v", primaryIp, ncRequest.IPConfiguration.IPSubnet.IPAddress)
 	}
@@ -240,3 +250,71 @@ func TestStatusToNCRequestSuccess(t *testing.T) {
 		t.Fatalf("Expected %d as the secondary IP config NC version but got %v", version, secondaryIP.NCVersion)
 	}
 }
+
+func TestStatusToNCRequestsMultipleNCs(t *testing.T) {
+	const (
+		ncID2               = "260005ba-cd02-11ea-87d0-0242ac130003"
+		primaryIp2          = "10.1.0.1"
+		subnetName2         = "subnet2"
+		subnetAddressSpace2 = "10.1.0.0/24"
+		testSecIp2          = "10.1.0.2"
+	)
+
+	status := v1alpha.NodeNetworkConfigStatus{
+		NetworkContainers: []v1alpha.NetworkContainer{
+			{
+				PrimaryIP: primaryIp,
+				ID:        ncID,
+				IPAssignments: []v1alpha.IPAssignment{
+					{
+						Name: allocatedUUID,
+						IP:   testSecIp1,
+					},
+				},
+				SubnetName:         subnetName,
+				DefaultGateway:     defaultGateway,
+				SubnetAddressSpace: subnetAddressSpace,
+				Version:            version,
+			},
+			{
+				PrimaryIP: primaryIp2,
+				ID:        ncID2,
+				IPAssignments: []v1alpha.IPAssignment{
+					{
+						Name: allocatedUUID2,
+						IP:   testSecIp2,
+					},
+				},
+				SubnetName:         subnetName2,
+				SubnetAddressSpace: subnetAddressSpace2,
+				Version:            version,
+			},
+		},
+	}
+
+	ncRequests, err := CRDStatusToNCRequests(status)
+	if err != nil {
+		t.Fatalf("Expected translation of CRD status to succeed, got error :%v", err)
+	}
+
+	if len(ncRequests) != 2 {
+		t.Fatalf("Expected 2 ncRequests but got %d", len(ncRequests))
+	}
+
+	for i, expected := range []struct{ id, subnet, secIP string }{{ncID, subnetName, testSecIp1}, {ncID2, subnetName2, testSecIp2}} {
+		if ncRequests[i].NetworkContainerid != expected.id {
+			t.Fatalf("Expected ncRequest %d to have the network container id %s but got %s", i, expected.id, ncRequests[i].NetworkContainerid)
+		}
+		if ncRequests[i].SubnetName != expected.subnet {
+			t.Fatalf("Expected ncRequest %d to have the subnet name %s but got %s", i, expected.subnet, ncRequests[i].SubnetName)
+		}
+		if len(ncRequests[i].SecondaryIPConfigs) != 1 {
+			t.Fatalf("Expected ncRequest %d to have 1 secondary ip but got %d", i, len(ncRequests[i].SecondaryIPConfigs))
+		}
+		for _, secondaryIP := range ncRequests[i].SecondaryIPConfigs {
+			if secondaryIP.IPAddress != expected.secIP {
+				t.Fatalf("Expected ncRequest %d to have the secondary ip %s but got %s", i, expected.secIP, secondaryIP.IPAddress)
+			}
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 type KubeClient interface {
 	Get(ctx context.Context, key client.ObjectKey, obj client.Object) error
 	Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error
+	Status() client.StatusWriter
 }
 
 // DirectCRDClient is an interface to get CRDs directly, without cache
@@ -0,0 +1,110 @@
+package kubecontroller
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// eventSource is the component Events recorded by CNS are attributed to
+	eventSource = "azure-cns"
+	// podEventInterval is how long Events on a pod with the same reason are dropped after one is recorded
+	podEventInterval = time.Minute
+)
+
+// SetCondition sets the condition on the status of the node's NodeNetworkConfig. The status is only updated when
+// the condition changes, and an Event is recorded on the node when the status of the condition changes: a Warning
+// when it becomes True, as the conditions CNS publishes report problems, and Normal when it is resolved.
+func (rc *requestController) SetCondition(ctx context.Context, condition metav1.Condition) error {
+	nnc, err := rc.getNodeNetConfig(ctx, rc.nodeName, k8sNamespace)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get NodeNetworkConfig to set condition %s", condition.Type)
+	}
+
+	// the previous status is kept, as setting the condition updates the existing one in place
+	var previousStatus metav1.ConditionStatus
+	if existing := meta.FindStatusCondition(nnc.Status.Conditions, condition.Type); existing != nil {
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return nil
+		}
+		previousStatus = existing.Status
+	}
+
+	condition.ObservedGeneration = nnc.Generation
+	meta.SetStatusCondition(&nnc.Status.Conditions, condition)
+	if err := rc.KubeClient.Status().Update(ctx, nnc); err != nil {
+		return errors.Wrapf(err, "failed to update NodeNetworkConfig status with condition %s", condition.Type)
+	}
+	logger.Printf("[cns-rc] Set NodeNetworkConfig condition %s=%s, reason: %s, message: %s",
+		condition.Type, condition.Status, condition.Reason, condition.Message)
+
+	// a condition which is first published as False has not been resolved, so it is not an event
+	statusChanged := previousStatus != condition.Status && (previousStatus != "" || condition.Status == metav1.ConditionTrue)
+	if rc.recorder != nil && statusChanged {
+		eventType := corev1.EventTypeNormal
+		if condition.Status == metav1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		rc.recorder.Event(rc.nodeReference(), eventType, condition.Reason, condition.Message)
+	}
+	return nil
+}
+
+// RecordPodEvent records an Event on the pod. The pod is referred to by its namespace and name, as looking up its UID
+// would cost the caller, which is usually serving the CNI, a call to the API server. Events on the pod with the same
+// reason are dropped for the podEventInterval after one is recorded, so a pod which keeps retrying doesn't flood the
+// API server with them.
+func (rc *requestController) RecordPodEvent(podName, podNamespace, eventType, reason, message string) {
+	if rc.recorder == nil {
+		return
+	}
+
+	now := time.Now()
+	key := podNamespace + "/" + podName + "/" + reason
+	rc.podEventsLock.Lock()
+	if rc.lastPodEvents == nil {
+		rc.lastPodEvents = make(map[string]time.Time)
+	}
+	for k, recorded := range rc.lastPodEvents {
+		if now.Sub(recorded) >= podEventInterval {
+			delete(rc.lastPodEvents, k)
+		}
+	}
+	_, recent := rc.lastPodEvents[key]
+	if !recent {
+		rc.lastPodEvents[key] = now
+	}
+	rc.podEventsLock.Unlock()
+	if recent {
+		return
+	}
+
+	rc.recorder.Event(podReference(podName, podNamespace), eventType, reason, message)
+}
+
+// podReference refers to a pod by its namespace and name.
+func podReference(podName, podNamespace string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       podName,
+		Namespace:  podNamespace,
+	}
+}
+
+// nodeReference refers to the node CNS is running on. Like the kubelet, the node name is used as its UID, which is
+// where kubectl describe node looks for Events.
+func (rc *requestController) nodeReference() *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: rc.nodeName,
+		UID:  types.UID(rc.nodeName),
+	}
+}
@@ -0,0 +1,198 @@
+package kubecontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newStatusReporterTest(nnc *v1alpha.NodeNetworkConfig, pods ...*corev1.Pod) (*requestController, *MockAPI, *record.FakeRecorder) {
+	mockAPI := &MockAPI{
+		nodeNetConfigs: map[MockKey]*v1alpha.NodeNetworkConfig{
+			{Namespace: nnc.Namespace, Name: nnc.Name}: nnc,
+		},
+		pods: map[MockKey]*corev1.Pod{},
+	}
+	for _, pod := range pods {
+		mockAPI.pods[MockKey{Namespace: pod.Namespace, Name: pod.Name}] = pod
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	rc := &requestController{
+		nodeName:        nnc.Name,
+		KubeClient:      MockKubeClient{mockAPI: mockAPI},
+		directAPIClient: &MockDirectAPIClient{mockAPI: mockAPI},
+		recorder:        recorder,
+	}
+	logger.InitLogger("Azure CNS RequestController", 0, 0, "")
+	return rc, mockAPI, recorder
+}
+
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, expected string) {
+	t.Helper()
+	select {
+	case event := <-recorder.Events:
+		if event != expected {
+			t.Fatalf("Expected event %q, got %q", expected, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected event %q to be recorded", expected)
+	}
+}
+
+func expectNoEvent(t *testing.T, recorder *record.FakeRecorder) {
+	t.Helper()
+	select {
+	case event := <-recorder.Events:
+		t.Fatalf("Expected no event, got %q", event)
+	default:
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	nnc := &v1alpha.NodeNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: existingNNCName, Namespace: existingNamespace, Generation: 3},
+	}
+	rc, mockAPI, recorder := newStatusReporterTest(nnc)
+	ctx := context.Background()
+	stored := mockAPI.nodeNetConfigs[MockKey{Namespace: existingNamespace, Name: existingNNCName}]
+
+	// conditions which start out False are published without an event
+	if err := rc.SetCondition(ctx, metav1.Condition{Type: v1alpha.PoolExhausted, Status: metav1.ConditionFalse, Reason: "IPsAvailable"}); err != nil {
+		t.Fatalf("Expected no error setting condition, got %v", err)
+	}
+	condition := meta.FindStatusCondition(stored.Status.Conditions, v1alpha.PoolExhausted)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.ObservedGeneration != 3 {
+		t.Fatalf("Expected PoolExhausted=False for generation 3, got %+v", condition)
+	}
+	expectNoEvent(t, recorder)
+
+	exhausted := metav1.Condition{Type: v1alpha.PoolExhausted, Status: metav1.ConditionTrue, Reason: "MaxIPCountReached", Message: "at max"}
+	if err := rc.SetCondition(ctx, exhausted); err != nil {
+		t.Fatalf("Expected no error setting condition, got %v", err)
+	}
+	if !meta.IsStatusConditionTrue(stored.Status.Conditions, v1alpha.PoolExhausted) {
+		t.Fatalf("Expected PoolExhausted=True, got %+v", stored.Status.Conditions)
+	}
+	expectEvent(t, recorder, "Warning MaxIPCountReached at max")
+
+	// setting the same condition again is not another transition
+	if err := rc.SetCondition(ctx, exhausted); err != nil {
+		t.Fatalf("Expected no error setting condition, got %v", err)
+	}
+	expectNoEvent(t, recorder)
+
+	if err := rc.SetCondition(ctx, metav1.Condition{Type: v1alpha.PoolExhausted, Status: metav1.ConditionFalse, Reason: "IPsAvailable", Message: "ok"}); err != nil {
+		t.Fatalf("Expected no error setting condition, got %v", err)
+	}
+	expectEvent(t, recorder, "Normal IPsAvailable ok")
+
+	// other conditions are kept
+	if err := rc.SetCondition(ctx, metav1.Condition{Type: v1alpha.ReconcileFailed, Status: metav1.ConditionTrue, Reason: "InvalidNetworkContainers"}); err != nil {
+		t.Fatalf("Expected no error setting condition, got %v", err)
+	}
+	if len(stored.Status.Conditions) != 2 {
+		t.Fatalf("Expected 2 conditions, got %+v", stored.Status.Conditions)
+	}
+}
+
+func TestSetConditionOnNonExistingNodeNetConfig(t *testing.T) {
+	nnc := &v1alpha.NodeNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: existingNNCName, Namespace: existingNamespace},
+	}
+	rc, _, _ := newStatusReporterTest(nnc)
+	rc.nodeName = nonexistingNNCName
+
+	if err := rc.SetCondition(context.Background(), metav1.Condition{Type: v1alpha.PoolExhausted, Status: metav1.ConditionTrue, Reason: "MaxIPCountReached"}); err == nil {
+		t.Fatalf("Expected error setting condition on non-existing NodeNetworkConfig")
+	}
+}
+
+func TestRecordPodEvent(t *testing.T) {
+	nnc := &v1alpha.NodeNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: existingNNCName, Namespace: existingNamespace},
+	}
+	rc, _, recorder := newStatusReporterTest(nnc)
+
+	rc.RecordPodEvent(existingPodName, "default", corev1.EventTypeWarning, "FailedAllocateIP", "no free IPs")
+	expectEvent(t, recorder, "Warning FailedAllocateIP no free IPs")
+
+	// events on the same pod with the same reason are dropped for a while
+	rc.RecordPodEvent(existingPodName, "default", corev1.EventTypeWarning, "FailedAllocateIP", "no free IPs")
+	expectNoEvent(t, recorder)
+
+	rc.RecordPodEvent(existingPodName, "default", corev1.EventTypeWarning, "OtherReason", "other")
+	expectEvent(t, recorder, "Warning OtherReason other")
+	rc.RecordPodEvent("other", "default", corev1.EventTypeWarning, "FailedAllocateIP", "no free IPs")
+	expectEvent(t, recorder, "Warning FailedAllocateIP no free IPs")
+
+	// and recorded again once the interval has passed
+	for key := range rc.lastPodEvents {
+		rc.lastPodEvents[key] = time.Now().Add(-podEventInterval)
+	}
+	rc.RecordPodEvent(existingPodName, "default", corev1.EventTypeWarning, "FailedAllocateIP", "no free IPs")
+	expectEvent(t, recorder, "Warning FailedAllocateIP no free IPs")
+	if len(rc.lastPodEvents) != 1 {
+		t.Fatalf("Expected the expired events to be forgotten, got %v", rc.lastPodEvents)
+	}
+}
+
+func TestReconcileSetsReconcileFailed(t *testing.T) {
+	nnc := &v1alpha.NodeNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: existingNNCName, Namespace: existingNamespace},
+		Status: v1alpha.NodeNetworkConfigStatus{
+			NetworkContainers: []v1alpha.NetworkContainer{
+				{
+					ID:                 networkContainerID,
+					PrimaryIP:          ncPrimaryIP,
+					SubnetAddressSpace: subnetRange,
+					IPAssignments:      []v1alpha.IPAssignment{{Name: allocatedUUID, IP: "not an ip"}},
+				},
+			},
+		},
+	}
+	rc, mockAPI, recorder := newStatusReporterTest(nnc)
+	stored := mockAPI.nodeNetConfigs[MockKey{Namespace: existingNamespace, Name: existingNNCName}]
+	mockCNSClient := &MockCNSClient{}
+	reconciler := &CrdReconciler{
+		KubeClient:     rc.KubeClient,
+		NodeName:       existingNNCName,
+		CNSClient:      mockCNSClient,
+		StatusReporter: rc,
+	}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: existingNamespace, Name: existingNNCName}}
+
+	if _, err := reconciler.Reconcile(context.Background(), request); err == nil {
+		t.Fatalf("Expected reconcile of invalid IPAssignments to fail")
+	}
+	condition := meta.FindStatusCondition(stored.Status.Conditions, v1alpha.ReconcileFailed)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != reasonInvalidNetworkContainers {
+		t.Fatalf("Expected ReconcileFailed=True with reason %s, got %+v", reasonInvalidNetworkContainers, condition)
+	}
+	<-recorder.Events
+
+	stored.Status.NetworkContainers[0].IPAssignments[0].IP = allocatedPodIP
+	if _, err := reconciler.Reconcile(context.Background(), request); err != nil {
+		t.Fatalf("Expected reconcile to succeed, got %v", err)
+	}
+	if !mockCNSClient.MockCNSUpdated {
+		t.Fatalf("Expected the NC to be created in CNS")
+	}
+	if len(mockCNSClient.NodeNCRequests) != 1 {
+		t.Fatalf("Expected the NCs of the status to be set as the NCs of the node, got %+v", mockCNSClient.NodeNCRequests)
+	}
+	condition = meta.FindStatusCondition(stored.Status.Conditions, v1alpha.ReconcileFailed)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Fatalf("Expected ReconcileFailed=False, got %+v", condition)
+	}
+	expectEvent(t, recorder, "Normal Reconciled all NetworkContainers are reconciled")
+}
@@ -4,12 +4,29 @@ import (
 	"context"
 
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // RequestController interface for cns to interact with the request controller
 type RequestController interface {
+	StatusReporter
+	NodeNetworkConfigGetter
 	Init(context.Context) error
 	Start(context.Context) error
 	UpdateCRDSpec(context.Context, v1alpha.NodeNetworkConfigSpec) error
 	IsStarted() bool
 }
+
+// StatusReporter publishes the state of CNS to kubernetes, so it is visible without the CNS logs
+type StatusReporter interface {
+	// SetCondition sets the condition on the NodeNetworkConfig status, and records an Event on the node when the
+	// status of the condition changes
+	SetCondition(ctx context.Context, condition metav1.Condition) error
+	// RecordPodEvent records an Event on the pod
+	RecordPodEvent(podName, podNamespace, eventType, reason, message string)
+}
+
+// NodeNetworkConfigGetter gets the NodeNetworkConfig of the node CNS runs on
+type NodeNetworkConfigGetter interface {
+	GetNodeNetworkConfig(ctx context.Context) (*v1alpha.NodeNetworkConfig, error)
+}
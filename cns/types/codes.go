@@ -38,6 +38,11 @@ const (
 	NetworkContainerVfpProgramCheckSkipped ResponseCode = 36
 	NmAgentSupportedApisError              ResponseCode = 37
 	UnsupportedNCVersion                   ResponseCode = 38
+	WatchRevisionCompacted                 ResponseCode = 39
+	Unauthorized                           ResponseCode = 40
+	RequestThrottled                       ResponseCode = 41
+	NoFreeIPs                              ResponseCode = 42
+	InvalidStateSnapshot                   ResponseCode = 43
 	UnexpectedError                        ResponseCode = 99
 )
 
@@ -64,6 +69,8 @@ func (c ResponseCode) String() string {
 		return "InvalidRequest"
 	case InvalidSecondaryIPConfig:
 		return "InvalidSecondaryIPConfig"
+	case InvalidStateSnapshot:
+		return "InvalidStateSnapshot"
 	case MalformedSubnet:
 		return "MalformedSubnet"
 	case NetworkContainerNotSpecified:
@@ -82,14 +89,20 @@ func (c ResponseCode) String() string {
 		return "NetworkJoinFailed"
 	case NmAgentSupportedApisError:
 		return "NmAgentSupportedApisError"
+	case NoFreeIPs:
+		return "NoFreeIPs"
 	case NotFound:
 		return "NotFound"
 	case PrimaryCANotSame:
 		return "PrimaryCANotSame"
+	case RequestThrottled:
+		return "RequestThrottled"
 	case ReservationNotFound:
 		return "ReservationNotFound"
 	case Success:
 		return "Success"
+	case Unauthorized:
+		return "Unauthorized"
 	case UnexpectedError:
 		return "UnexpectedError"
 	case UnknownContainerID:
@@ -114,7 +127,15 @@ func (c ResponseCode) String() string {
 		return "UnsupportedOrchestratorType"
 	case UnsupportedVerb:
 		return "UnsupportedVerb"
+	case WatchRevisionCompacted:
+		return "WatchRevisionCompacted"
 	default:
 		return "UnknownError"
 	}
 }
+
+// IsRetriable returns true if requests which failed with the code may succeed when they are retried later, such as
+// IP requests which found no free IPs while the pool is scaling up.
+func (c ResponseCode) IsRetriable() bool {
+	return c == RequestThrottled || c == NoFreeIPs
+}
@@ -4,13 +4,17 @@
 package common
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 
 	"github.com/Azure/azure-container-networking/log"
 	localtls "github.com/Azure/azure-container-networking/server/tls"
@@ -25,7 +29,10 @@ type Listener struct {
 	active         bool
 	l              net.Listener
 	securelistener net.Listener
+	unixListener   net.Listener
+	unixSocketPath string
 	mux            *http.ServeMux
+	connContext    func(context.Context, net.Conn) context.Context
 }
 
 // NewListener creates a new Listener.
@@ -69,6 +76,20 @@ func GetTlsConfig(tlsSettings localtls.TlsSettings) (*tls.Config, error) {
 			tlsCert,
 		},
 	}
+
+	if tlsSettings.TLSClientCAPath != "" {
+		caCerts, err := ioutil.ReadFile(tlsSettings.TLSClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read client CA certificates %+v", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("No client CA certificates found in %s", tlsSettings.TLSClientCAPath)
+		}
+		// clients without a certificate can still connect, and are authorized as anonymous callers
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
 	return tlsConfig, nil
 }
 
@@ -80,8 +101,9 @@ func (listener *Listener) StartTLS(errChan chan<- error, tlsSettings localtls.Tl
 		return err
 	}
 	server := http.Server{
-		TLSConfig: tlsConfig,
-		Handler:   listener.mux,
+		TLSConfig:   tlsConfig,
+		Handler:     listener.mux,
+		ConnContext: listener.connContext,
 	}
 
 	// listen on a seperate endpoint for secure tls connections
@@ -118,9 +140,58 @@ func (listener *Listener) Start(errChan chan<- error) error {
 
 	log.Printf("[Listener] Started listening on %s.", listener.localAddress)
 
+	server := http.Server{
+		Handler:     listener.mux,
+		ConnContext: listener.connContext,
+	}
+
 	// Launch goroutine for servicing requests.
 	go func() {
-		errChan <- http.Serve(listener.l, listener.mux)
+		errChan <- server.Serve(listener.l)
+	}()
+
+	listener.active = true
+	return nil
+}
+
+// StartUnixSocket creates a unix socket at path with the file mode and starts an HTTP server on it, serving the
+// same handlers as the listener's other sockets. Any stale socket left at path is replaced.
+func (listener *Listener) StartUnixSocket(errChan chan<- error, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("[Listener] Failed to create the directory of unix socket %s: %+v", path, err)
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Listener] Failed to remove stale unix socket %s: %+v", path, err)
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		log.Printf("[Listener] Failed to listen on unix socket %s: %+v", path, err)
+		return err
+	}
+
+	if err = os.Chmod(path, mode); err != nil {
+		log.Printf("[Listener] Failed to set mode %v on unix socket %s: %+v", mode, path, err)
+		l.Close()
+		os.Remove(path)
+		return err
+	}
+
+	listener.unixListener = l
+	listener.unixSocketPath = path
+	log.Printf("[Listener] Started listening on unix socket %s with mode %v.", path, mode)
+
+	server := http.Server{
+		Handler:     listener.mux,
+		ConnContext: listener.connContext,
+	}
+
+	// Launch goroutine for servicing requests on the unix socket.
+	go func() {
+		errChan <- server.Serve(l)
 	}()
 
 	listener.active = true
@@ -136,7 +207,9 @@ func (listener *Listener) Stop() {
 	listener.active = false
 
 	// Stop servicing requests.
-	listener.l.Close()
+	if listener.l != nil {
+		listener.l.Close()
+	}
 
 	if listener.securelistener != nil {
 		// Stop servicing requests on secure listener
@@ -148,6 +221,12 @@ func (listener *Listener) Stop() {
 		os.Remove(listener.localAddress)
 	}
 
+	if listener.unixListener != nil {
+		// Stop servicing requests on the unix socket and delete it.
+		listener.unixListener.Close()
+		os.Remove(listener.unixSocketPath)
+	}
+
 	log.Printf("[Listener] Stopped listening on %s", listener.localAddress)
 }
 
@@ -166,6 +245,12 @@ func (listener *Listener) AddEndpoint(endpoint string) {
 	listener.endpoints = append(listener.endpoints, endpoint)
 }
 
+// SetConnContext sets a function deriving the context of the requests on a connection from the connection, such as
+// to identify the peer. It must be set before the listener is started.
+func (listener *Listener) SetConnContext(connContext func(context.Context, net.Conn) context.Context) {
+	listener.connContext = connContext
+}
+
 // AddHandler registers a protocol handler.
 func (listener *Listener) AddHandler(path string, handler http.HandlerFunc) {
 	listener.mux.HandleFunc(path, handler)
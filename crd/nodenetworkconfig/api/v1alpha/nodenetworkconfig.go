@@ -48,6 +48,10 @@ type NodeNetworkConfigStatus struct {
 	Scaler            Scaler             `json:"scaler,omitempty"`
 	Status            Status             `json:"status,omitempty"`
 	NetworkContainers []NetworkContainer `json:"networkContainers,omitempty"`
+	// Conditions are published by CNS to report the state of the node's IP pool
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // Scaler groups IP request params together
@@ -68,6 +72,16 @@ const (
 	Error    Status = "Error"
 )
 
+// Types of the conditions CNS publishes on the NodeNetworkConfig status
+const (
+	// PoolExhausted is True when CNS needs more IPs, but has already requested the MaxIPCount
+	PoolExhausted = "PoolExhausted"
+	// NCProgrammingPending is True when the host has not yet programmed the latest version of an NC
+	NCProgrammingPending = "NCProgrammingPending"
+	// ReconcileFailed is True when CNS cannot apply the NetworkContainers in the status
+	ReconcileFailed = "ReconcileFailed"
+)
+
 // NetworkContainer defines the structure of a Network Container as found in NetworkConfigStatus
 type NetworkContainer struct {
 	ID                 string         `json:"id,omitempty"`
@@ -224,9 +224,10 @@ func EbTableRuleExists(tableName, chainName, matchSet string) (bool, error) {
 	return false, nil
 }
 
-// runEbCmd runs an EB rule command.
+// runEbCmd runs an EB rule command. Concurrent CNI invocations change rules in parallel, so the command waits
+// for the ebtables lock.
 func runEbCmd(table, action, chain, rule string) error {
-	command := fmt.Sprintf("ebtables -t %s %s %s %s", table, action, chain, rule)
+	command := fmt.Sprintf("ebtables --concurrent -t %s %s %s %s", table, action, chain, rule)
 	_, err := platform.ExecuteCommand(command)
 
 	return err
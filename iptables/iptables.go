@@ -4,6 +4,7 @@ package iptables
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
@@ -11,8 +12,10 @@ import (
 
 // cni iptable chains
 const (
-	CNIInputChain  = "AZURECNIINPUT"
-	CNIOutputChain = "AZURECNIOUTPUT"
+	CNIInputChain        = "AZURECNIINPUT"
+	CNIOutputChain       = "AZURECNIOUTPUT"
+	CNIHostPortChain     = "AZURECNIHOSTPORT"
+	CNIHostPortSnatChain = "AZURECNIHOSTPORTSNAT"
 )
 
 // standard iptable chains
@@ -24,6 +27,7 @@ const (
 	Postrouting = "POSTROUTING"
 	Swift       = "SWIFT"
 	Snat        = "SNAT"
+	Dnat        = "DNAT"
 	Return      = "RETURN"
 )
 
@@ -73,8 +77,9 @@ const (
 
 // known protocols
 const (
-	UDP = "udp"
-	TCP = "tcp"
+	UDP  = "udp"
+	TCP  = "tcp"
+	SCTP = "sctp"
 )
 
 // known IP's
@@ -92,6 +97,12 @@ type IPTableEntry struct {
 
 // Run iptables command
 func RunCmd(version, params string) error {
+	_, err := runCmd(version, params)
+	return err
+}
+
+// runCmd runs the iptables command and returns its output
+func runCmd(version, params string) (string, error) {
 	var cmd string
 
 	iptCmd := iptables
@@ -105,11 +116,7 @@ func RunCmd(version, params string) error {
 		cmd = fmt.Sprintf("%s -w %d %s", iptCmd, lockTimeout, params)
 	}
 
-	if _, err := platform.ExecuteCommand(cmd); err != nil {
-		return err
-	}
-
-	return nil
+	return platform.ExecuteCommand(cmd)
 }
 
 // check if iptable chain alreay exists
@@ -122,6 +129,24 @@ func ChainExists(version, tableName, chainName string) bool {
 	return true
 }
 
+// get the rules of an iptable chain in iptables-save format, such as "-A SWIFT -s 10.0.0.0/24 -d 168.63.129.16/32 -j SNAT --to-source 10.1.0.4"
+func GetChainRules(version, tableName, chainName string) ([]string, error) {
+	params := fmt.Sprintf("-t %s -S %s", tableName, chainName)
+	out, err := runCmd(version, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "-A ") {
+			rules = append(rules, strings.TrimSpace(line))
+		}
+	}
+
+	return rules, nil
+}
+
 func GetCreateChainCmd(version, tableName, chainName string) IPTableEntry {
 	return IPTableEntry{
 		Version: version,
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"sync"
+	"sync/atomic"
 )
 
 // Log level
@@ -47,7 +48,7 @@ type Logger struct {
 	l            *log.Logger
 	out          io.WriteCloser
 	name         string
-	level        int
+	level        int32 // accessed atomically, since SetLevel can be called while logging
 	target       int
 	maxFileSize  int
 	maxFileCount int
@@ -64,7 +65,7 @@ func NewLogger(name string, level int, target int, logDir string) *Logger {
 
 	logger.l = log.New(nil, logPrefix, log.LstdFlags)
 	logger.name = name
-	logger.level = level
+	logger.level = int32(level)
 	logger.directory = logDir
 	logger.SetTarget(target)
 	logger.maxFileSize = maxLogFileSize
@@ -81,7 +82,11 @@ func (logger *Logger) SetName(name string) {
 
 // SetLevel sets the log chattiness.
 func (logger *Logger) SetLevel(level int) {
-	logger.level = level
+	atomic.StoreInt32(&logger.level, int32(level))
+}
+
+func (logger *Logger) getLevel() int {
+	return int(atomic.LoadInt32(&logger.level))
 }
 
 // SetLogFileLimits sets the log file limits.
@@ -213,7 +218,7 @@ func (logger *Logger) Logf(format string, args ...interface{}) {
 
 // Printf logs a formatted string at info level.
 func (logger *Logger) Printf(format string, args ...interface{}) {
-	if logger.level < LevelInfo {
+	if logger.getLevel() < LevelInfo {
 		return
 	}
 
@@ -222,7 +227,7 @@ func (logger *Logger) Printf(format string, args ...interface{}) {
 
 // Debugf logs a formatted string at info level.
 func (logger *Logger) Debugf(format string, args ...interface{}) {
-	if logger.level < LevelDebug {
+	if logger.getLevel() < LevelDebug {
 		return
 	}
 
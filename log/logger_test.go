@@ -76,3 +76,28 @@ func TestPid(t *testing.T) {
 		t.Fatalf("Unexpected log: %s.", log)
 	}
 }
+
+// Tests that the log level can be changed while logging, run with -race.
+func TestSetLevelWhileLogging(t *testing.T) {
+	l := NewLogger(logName, LevelInfo, TargetStderr, "")
+	if l == nil {
+		t.Fatalf("Failed to create logger.")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.SetLevel(LevelDebug - i%2)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		l.Debugf("LogText %v", i)
+	}
+	<-done
+
+	if level := l.getLevel(); level != LevelInfo {
+		t.Errorf("Expected level %d after the last SetLevel, got %d", LevelInfo, level)
+	}
+}
@@ -19,6 +19,7 @@ const (
 	LINK_TYPE_VETH   = "veth"
 	LINK_TYPE_IPVLAN = "ipvlan"
 	LINK_TYPE_DUMMY  = "dummy"
+	LINK_TYPE_IFB    = "ifb"
 )
 
 // IPVLAN link attributes.
@@ -77,6 +78,11 @@ type DummyLink struct {
 	LinkInfo
 }
 
+// IFBLink represents an intermediate functional block network interface, which redirected traffic can be shaped on.
+type IFBLink struct {
+	LinkInfo
+}
+
 // AddLink adds a new network interface of a specified type.
 func AddLink(link Link) error {
 	info := link.Info()
@@ -324,6 +330,58 @@ func SetLinkAddress(ifName string, hwAddress net.HardwareAddr) error {
 	return s.sendAndWaitForAck(req)
 }
 
+// SetLinkMTU sets the maximum transmission unit of a network interface.
+func SetLinkMTU(ifName string, mtu int) error {
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	req := newRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+
+	ifInfo := newIfInfoMsg()
+	ifInfo.Type = unix.RTM_SETLINK
+	ifInfo.Index = int32(iface.Index)
+	ifInfo.Flags = unix.NLM_F_REQUEST
+	ifInfo.Change = DEFAULT_CHANGE
+	req.addPayload(ifInfo)
+
+	req.addPayload(newAttributeUint32(unix.IFLA_MTU, uint32(mtu)))
+
+	return s.sendAndWaitForAck(req)
+}
+
+// SetLinkTxQueueLen sets the length of the transmit queue of a network interface.
+func SetLinkTxQueueLen(ifName string, txQLen int) error {
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	req := newRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+
+	ifInfo := newIfInfoMsg()
+	ifInfo.Type = unix.RTM_SETLINK
+	ifInfo.Index = int32(iface.Index)
+	ifInfo.Flags = unix.NLM_F_REQUEST
+	ifInfo.Change = DEFAULT_CHANGE
+	req.addPayload(ifInfo)
+
+	req.addPayload(newAttributeUint32(unix.IFLA_TXQLEN, uint32(txQLen)))
+
+	return s.sendAndWaitForAck(req)
+}
+
 // SetLinkPromisc sets the promiscuous mode of a network interface.
 func SetLinkPromisc(ifName string, on bool) error {
 	s, err := getSocket()
@@ -6,7 +6,9 @@
 package netlink
 
 import (
+	"io/ioutil"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -257,3 +259,35 @@ func TestAddRemoveStaticArp(t *testing.T) {
 		t.Errorf("DeleteLink failed: %+v", err)
 	}
 }
+
+func TestSetLinkMTUAndTxQueueLen(t *testing.T) {
+	err := AddLink(&VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+		},
+		PeerName: ifName2,
+	})
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+	defer DeleteLink(ifName)
+
+	if err = SetLinkMTU(ifName, 1400); err != nil {
+		t.Errorf("SetLinkMTU failed: %+v", err)
+	}
+
+	veth, err := net.InterfaceByName(ifName)
+	if err != nil || veth.MTU != 1400 {
+		t.Errorf("MTU of %v is not 1400: %+v %+v", ifName, veth, err)
+	}
+
+	if err = SetLinkTxQueueLen(ifName, 500); err != nil {
+		t.Errorf("SetLinkTxQueueLen failed: %+v", err)
+	}
+
+	txQLen, err := ioutil.ReadFile("/sys/class/net/" + ifName + "/tx_queue_len")
+	if err != nil || strings.TrimSpace(string(txQLen)) != "500" {
+		t.Errorf("Transmit queue length of %v is not 500: %s %+v", ifName, txQLen, err)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Traffic control attributes that are not defined in unix package.
+const (
+	TCA_KIND    = 1
+	TCA_OPTIONS = 2
+
+	TCA_TBF_PARMS  = 1
+	TCA_TBF_RATE64 = 4
+
+	TCA_U32_SEL = 5
+	TCA_U32_ACT = 7
+
+	TCA_ACT_KIND    = 1
+	TCA_ACT_OPTIONS = 2
+
+	TCA_MIRRED_PARMS = 2
+	TCA_EGRESS_REDIR = 1
+	TC_ACT_STOLEN    = 4
+
+	TC_U32_TERMINAL = 1
+
+	TC_H_ROOT    = 0xFFFFFFFF
+	TC_H_INGRESS = 0xFFFFFFF1
+)
+
+// Traffic control qdisc and filter kinds.
+const (
+	QDISC_KIND_TBF      = "tbf"
+	QDISC_KIND_INGRESS  = "ingress"
+	FILTER_KIND_U32     = "u32"
+	ACTION_KIND_MIRRED  = "mirred"
+	timeUnitsPerSec     = 1000000
+	pschedPath          = "/proc/net/psched"
+	tbfLatencyInUsec    = 25000
+	ingressQdiscHandle  = 0xFFFF0000
+	rootQdiscHandle     = 0x10000
+	filterPriority      = 1
+	sizeofTcMsg         = 20
+	sizeofTcTbfQopt     = 36
+	sizeofTcU32Sel      = 16
+	sizeofTcU32Key      = 16
+	sizeofTcMirred      = 28
+	maxRate32           = 1<<32 - 1
+	defaultTickInUsec   = 15.625
+	ethProtocolAllInNBO = 0x0300 // htons(ETH_P_ALL)
+)
+
+// Traffic control message
+type tcMsg struct {
+	Family  uint8
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+// Creates a new traffic control message.
+func newTcMsg(ifIndex int, handle uint32, parent uint32) *tcMsg {
+	return &tcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: int32(ifIndex),
+		Handle:  handle,
+		Parent:  parent,
+	}
+}
+
+// Serializes a traffic control message.
+func (tc *tcMsg) serialize() []byte {
+	b := make([]byte, tc.length())
+	b[0] = tc.Family
+	encoder.PutUint32(b[4:8], uint32(tc.Ifindex))
+	encoder.PutUint32(b[8:12], tc.Handle)
+	encoder.PutUint32(b[12:16], tc.Parent)
+	encoder.PutUint32(b[16:20], tc.Info)
+	return b
+}
+
+// Returns the length of a traffic control message.
+func (tc *tcMsg) length() int {
+	return sizeofTcMsg
+}
+
+// getTickInUsec returns the number of packet scheduler ticks per microsecond.
+func getTickInUsec() float64 {
+	data, err := ioutil.ReadFile(pschedPath)
+	if err != nil {
+		return defaultTickInUsec
+	}
+
+	var t2us, us2t, clockRes uint32
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%08x%08x%08x", &t2us, &us2t, &clockRes); err != nil || us2t == 0 {
+		return defaultTickInUsec
+	}
+
+	return float64(t2us) / float64(us2t) * float64(clockRes) / timeUnitsPerSec
+}
+
+// serializeTbfQopt serializes the tc_tbf_qopt parameters of a token bucket filter with a rate in bytes per second,
+// a bucket size in packet scheduler ticks and a queue limit in bytes.
+func serializeTbfQopt(rate uint64, buffer uint32, limit uint32) []byte {
+	b := make([]byte, sizeofTcTbfQopt)
+
+	// rate is the last field of the 12 byte tc_ratespec, the peak rate is left unset
+	rate32 := uint32(maxRate32)
+	if rate < maxRate32 {
+		rate32 = uint32(rate)
+	}
+	encoder.PutUint32(b[8:12], rate32)
+	encoder.PutUint32(b[24:28], limit)
+	encoder.PutUint32(b[28:32], buffer)
+	return b
+}
+
+// AddTbfQdisc adds a token bucket filter as the root qdisc of a network interface, which shapes the traffic it
+// sends to the rate. Rate is in bits per second and burst is the bucket size in bits.
+func AddTbfQdisc(ifName string, rate uint64, burst uint64) error {
+	if rate == 0 || burst == 0 {
+		return fmt.Errorf("Invalid rate %d or burst %d", rate, burst)
+	}
+
+	rateInBytes := rate / 8
+	burstInBytes := burst / 8
+	if rateInBytes == 0 {
+		return fmt.Errorf("Invalid rate %d", rate)
+	}
+
+	// the buffer is the time in ticks to send the burst at the rate, which the kernel takes as 32 bits
+	buffer := float64(burstInBytes) * timeUnitsPerSec / float64(rateInBytes) * getTickInUsec()
+	limit := float64(rateInBytes)*tbfLatencyInUsec/timeUnitsPerSec + float64(burstInBytes)
+	if buffer > math.MaxUint32 || limit > math.MaxUint32 {
+		return fmt.Errorf("Burst %d is too large for rate %d", burst, rate)
+	}
+
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	req := newRequest(unix.RTM_NEWQDISC, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.addPayload(newTcMsg(iface.Index, rootQdiscHandle, TC_H_ROOT))
+	req.addPayload(newAttributeStringZ(TCA_KIND, QDISC_KIND_TBF))
+
+	attrOptions := newAttribute(TCA_OPTIONS, nil)
+	attrOptions.addNested(newAttribute(TCA_TBF_PARMS, serializeTbfQopt(rateInBytes, uint32(buffer), uint32(limit))))
+	if rateInBytes >= maxRate32 {
+		rate64 := make([]byte, 8)
+		encoder.PutUint64(rate64, rateInBytes)
+		attrOptions.addNested(newAttribute(TCA_TBF_RATE64, rate64))
+	}
+	req.addPayload(attrOptions)
+
+	return s.sendAndWaitForAck(req)
+}
+
+// AddIngressQdisc adds the ingress qdisc to a network interface, which filters can be attached to.
+func AddIngressQdisc(ifName string) error {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	req := newRequest(unix.RTM_NEWQDISC, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.addPayload(newTcMsg(iface.Index, ingressQdiscHandle, TC_H_INGRESS))
+	req.addPayload(newAttributeStringZ(TCA_KIND, QDISC_KIND_INGRESS))
+
+	return s.sendAndWaitForAck(req)
+}
+
+// DeleteQdisc deletes the root or the ingress qdisc of a network interface.
+func DeleteQdisc(ifName string, ingress bool) error {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	msg := newTcMsg(iface.Index, rootQdiscHandle, TC_H_ROOT)
+	if ingress {
+		msg = newTcMsg(iface.Index, ingressQdiscHandle, TC_H_INGRESS)
+	}
+
+	req := newRequest(unix.RTM_DELQDISC, unix.NLM_F_ACK)
+	req.addPayload(msg)
+
+	return s.sendAndWaitForAck(req)
+}
+
+// serializeU32MatchAll serializes a tc_u32_sel with a single key which matches every packet.
+func serializeU32MatchAll() []byte {
+	b := make([]byte, sizeofTcU32Sel+sizeofTcU32Key)
+	b[0] = TC_U32_TERMINAL
+	b[2] = 1 // number of keys, the key is all zeroes
+	return b
+}
+
+// serializeMirredRedirect serializes the tc_mirred parameters of an action which redirects packets to the egress of
+// the network interface.
+func serializeMirredRedirect(ifIndex int) []byte {
+	b := make([]byte, sizeofTcMirred)
+	encoder.PutUint32(b[8:12], TC_ACT_STOLEN)
+	encoder.PutUint32(b[20:24], TCA_EGRESS_REDIR)
+	encoder.PutUint32(b[24:28], uint32(ifIndex))
+	return b
+}
+
+// AddIngressRedirect redirects all traffic a network interface receives to the egress of the target interface,
+// such as an IFB device, so it can be shaped there. The interface must have an ingress qdisc.
+func AddIngressRedirect(ifName string, targetIfName string) error {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return err
+	}
+
+	targetIface, err := net.InterfaceByName(targetIfName)
+	if err != nil {
+		return err
+	}
+
+	s, err := getSocket()
+	if err != nil {
+		return err
+	}
+
+	req := newRequest(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	msg := newTcMsg(iface.Index, 0, ingressQdiscHandle)
+	msg.Info = filterPriority<<16 | ethProtocolAllInNBO
+	req.addPayload(msg)
+	req.addPayload(newAttributeStringZ(TCA_KIND, FILTER_KIND_U32))
+
+	attrMirredOptions := newAttribute(TCA_ACT_OPTIONS, nil)
+	attrMirredOptions.addNested(newAttribute(TCA_MIRRED_PARMS, serializeMirredRedirect(targetIface.Index)))
+
+	// actions are nested in attributes numbered by their order
+	attrMirred := newAttribute(1, nil)
+	attrMirred.addNested(newAttributeStringZ(TCA_ACT_KIND, ACTION_KIND_MIRRED))
+	attrMirred.addNested(attrMirredOptions)
+
+	attrActions := newAttribute(TCA_U32_ACT, nil)
+	attrActions.addNested(attrMirred)
+
+	attrOptions := newAttribute(TCA_OPTIONS, nil)
+	attrOptions.addNested(newAttribute(TCA_U32_SEL, serializeU32MatchAll()))
+	attrOptions.addNested(attrActions)
+	req.addPayload(attrOptions)
+
+	return s.sendAndWaitForAck(req)
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"testing"
+)
+
+const ifbName = "nltestifb"
+
+// TestShapeVEthTraffic tests shaping the traffic a virtual ethernet interface sends and receives.
+func TestShapeVEthTraffic(t *testing.T) {
+	err := AddLink(&VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+		},
+		PeerName: ifName2,
+	})
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+	defer DeleteLink(ifName)
+
+	err = AddLink(&IFBLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_IFB,
+			Name: ifbName,
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+	defer DeleteLink(ifbName)
+
+	if err = AddTbfQdisc(ifName, 1000000, 32000); err != nil {
+		t.Errorf("AddTbfQdisc failed: %+v", err)
+	}
+
+	if err = AddIngressQdisc(ifName); err != nil {
+		t.Errorf("AddIngressQdisc failed: %+v", err)
+	}
+
+	if err = AddIngressRedirect(ifName, ifbName); err != nil {
+		t.Errorf("AddIngressRedirect failed: %+v", err)
+	}
+
+	// Rates above 32 bits in bytes per second are set with a separate attribute.
+	if err = AddTbfQdisc(ifbName, 80000000000, 64000000); err != nil {
+		t.Errorf("AddTbfQdisc with 64 bit rate failed: %+v", err)
+	}
+
+	if err = AddTbfQdisc(ifbName, 1000000, 0); err == nil {
+		t.Errorf("AddTbfQdisc without burst succeeded")
+	}
+
+	// the time to send the burst at the rate does not fit in the 32 bit buffer
+	if err = AddTbfQdisc(ifbName, 8, 80000000000); err == nil {
+		t.Errorf("AddTbfQdisc with too large burst succeeded")
+	}
+
+	if err = DeleteQdisc(ifName, true); err != nil {
+		t.Errorf("DeleteQdisc ingress failed: %+v", err)
+	}
+
+	if err = DeleteQdisc(ifName, false); err != nil {
+		t.Errorf("DeleteQdisc root failed: %+v", err)
+	}
+}
@@ -5,6 +5,7 @@ package network
 
 import (
 	"fmt"
+	"strings"
 )
 
 var (
@@ -20,3 +21,14 @@ var (
 	errEndpointInUse          = fmt.Errorf("Endpoint is already joined to a sandbox")
 	errEndpointNotInUse       = fmt.Errorf("Endpoint is not joined to a sandbox")
 )
+
+// EndpointDriftError is returned by CheckEndpoint when the data plane of an endpoint does not match its state.
+type EndpointDriftError struct {
+	EndpointID string
+	// Drift describes each mismatch, such as a missing IP address or rule.
+	Drift []string
+}
+
+func (e *EndpointDriftError) Error() string {
+	return fmt.Sprintf("Endpoint %s does not match its state: %s", e.EndpointID, strings.Join(e.Drift, "; "))
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+)
+
+const (
+	// Prefix for the IFB interface which shapes the traffic an endpoint sends.
+	ifbInterfacePrefix = commonInterfacePrefix + "i"
+)
+
+// getIfbName returns the name of the IFB interface of the host veth of an endpoint.
+func getIfbName(hostIfName string) string {
+	return ifbInterfacePrefix + strings.TrimPrefix(hostIfName, hostVEthInterfacePrefix)
+}
+
+// validateBandwidth checks that each limited rate has a burst which the token bucket filter can hold.
+func validateBandwidth(bw *BandwidthInfo) error {
+	for _, limit := range []struct {
+		direction string
+		rate      uint64
+		burst     uint64
+	}{
+		{"ingress", bw.IngressRate, bw.IngressBurst},
+		{"egress", bw.EgressRate, bw.EgressBurst},
+	} {
+		if limit.rate == 0 && limit.burst == 0 {
+			continue
+		}
+
+		if limit.rate == 0 || limit.burst == 0 {
+			return fmt.Errorf("%s rate %d and burst %d must both be set", limit.direction, limit.rate, limit.burst)
+		}
+
+		if limit.rate < 8 || limit.burst/8 >= math.MaxUint32 {
+			return fmt.Errorf("%s rate %d or burst %d is out of range", limit.direction, limit.rate, limit.burst)
+		}
+	}
+
+	return nil
+}
+
+// addBandwidthShaping limits the traffic rates of the endpoint with token bucket filters. The traffic the endpoint
+// receives is shaped on the host veth. The traffic the endpoint sends is received by the host veth, so it is
+// redirected to an IFB interface and shaped there.
+func addBandwidthShaping(hostIfName string, bw *BandwidthInfo) error {
+	if bw == nil {
+		return nil
+	}
+
+	if err := validateBandwidth(bw); err != nil {
+		return err
+	}
+
+	if bw.IngressRate > 0 {
+		log.Printf("[net] Adding ingress rate limit %v burst %v on %v.", bw.IngressRate, bw.IngressBurst, hostIfName)
+		if err := netlink.AddTbfQdisc(hostIfName, bw.IngressRate, bw.IngressBurst); err != nil {
+			return err
+		}
+	}
+
+	if bw.EgressRate > 0 {
+		hostIf, err := net.InterfaceByName(hostIfName)
+		if err != nil {
+			return err
+		}
+
+		ifbName := getIfbName(hostIfName)
+		log.Printf("[net] Creating IFB interface %v for host veth %v.", ifbName, hostIfName)
+		link := netlink.IFBLink{
+			LinkInfo: netlink.LinkInfo{
+				Type: netlink.LINK_TYPE_IFB,
+				Name: ifbName,
+				MTU:  uint(hostIf.MTU),
+			},
+		}
+
+		if err := netlink.AddLink(&link); err != nil {
+			return err
+		}
+
+		if err := netlink.SetLinkState(ifbName, true); err != nil {
+			return err
+		}
+
+		log.Printf("[net] Redirecting traffic received by %v to %v.", hostIfName, ifbName)
+		if err := netlink.AddIngressQdisc(hostIfName); err != nil {
+			return err
+		}
+
+		if err := netlink.AddIngressRedirect(hostIfName, ifbName); err != nil {
+			return err
+		}
+
+		log.Printf("[net] Adding egress rate limit %v burst %v on %v.", bw.EgressRate, bw.EgressBurst, ifbName)
+		if err := netlink.AddTbfQdisc(ifbName, bw.EgressRate, bw.EgressBurst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteBandwidthShaping deletes the IFB interface of the host veth, if the endpoint has one. The qdiscs of the
+// host veth are deleted with it.
+func deleteBandwidthShaping(hostIfName string) error {
+	ifbName := getIfbName(hostIfName)
+	if _, err := net.InterfaceByName(ifbName); err != nil {
+		// endpoints without bandwidth shaping have no IFB interface
+		return nil
+	}
+
+	log.Printf("[net] Deleting IFB interface %v.", ifbName)
+	if err := netlink.DeleteLink(ifbName); err != nil {
+		log.Printf("[net] Failed to delete IFB interface %v: %v.", ifbName, err)
+		return err
+	}
+
+	return nil
+}
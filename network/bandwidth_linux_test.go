@@ -0,0 +1,35 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test bandwidth shaping", func() {
+
+	Describe("Test getIfbName", func() {
+		It("Should name the IFB interface after the host veth", func() {
+			Expect(getIfbName("azv1234567890a")).To(Equal("azi1234567890a"))
+		})
+	})
+
+	Describe("Test validateBandwidth", func() {
+		It("Should accept limits in either direction", func() {
+			Expect(validateBandwidth(&BandwidthInfo{})).To(Succeed())
+			Expect(validateBandwidth(&BandwidthInfo{IngressRate: 1000000, IngressBurst: 32000})).To(Succeed())
+			Expect(validateBandwidth(&BandwidthInfo{EgressRate: 1000000, EgressBurst: 32000})).To(Succeed())
+		})
+
+		It("Should reject a rate without a burst and a burst without a rate", func() {
+			Expect(validateBandwidth(&BandwidthInfo{IngressRate: 1000000})).NotTo(Succeed())
+			Expect(validateBandwidth(&BandwidthInfo{EgressBurst: 32000})).NotTo(Succeed())
+		})
+
+		It("Should reject bursts the token bucket filter cannot hold", func() {
+			Expect(validateBandwidth(&BandwidthInfo{EgressRate: 1000000, EgressBurst: 1 << 40})).NotTo(Succeed())
+		})
+	})
+})
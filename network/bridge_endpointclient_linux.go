@@ -102,7 +102,7 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		return err
 	}
 
-	return nil
+	return addBandwidthShaping(client.hostVethName, epInfo.Bandwidth)
 }
 
 func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
@@ -193,7 +193,7 @@ func (client *LinuxBridgeEndpointClient) ConfigureContainerInterfacesAndRoutes(e
 		return err
 	}
 
-	return nil
+	return applyTuning(client.containerVethName, epInfo.Tuning)
 }
 
 func (client *LinuxBridgeEndpointClient) DeleteEndpoints(ep *endpoint) error {
@@ -204,7 +204,7 @@ func (client *LinuxBridgeEndpointClient) DeleteEndpoints(ep *endpoint) error {
 		return err
 	}
 
-	return nil
+	return deleteBandwidthShaping(ep.HostIfName)
 }
 
 func addRuleToRouteViaHost(epInfo *EndpointInfo) error {
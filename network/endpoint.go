@@ -38,10 +38,12 @@ type endpoint struct {
 	NetworkContainerID       string
 	NetworkNameSpace         string `json:",omitempty"`
 	ContainerID              string
-	PODName                  string `json:",omitempty"`
-	PODNameSpace             string `json:",omitempty"`
-	InfraVnetAddressSpace    string `json:",omitempty"`
-	NetNs                    string `json:",omitempty"`
+	PODName                  string                  `json:",omitempty"`
+	PODNameSpace             string                  `json:",omitempty"`
+	InfraVnetAddressSpace    string                  `json:",omitempty"`
+	NetNs                    string                  `json:",omitempty"`
+	PortMappings             []PortMapping           `json:",omitempty"`
+	NetworkAttachments       []NetworkAttachmentInfo `json:",omitempty"`
 }
 
 // EndpointInfo contains read-only information about an endpoint.
@@ -75,6 +77,47 @@ type EndpointInfo struct {
 	IPV6Mode                 string
 	VnetCidrs                string
 	ServiceCidrs             string
+	PortMappings             []PortMapping
+	Bandwidth                *BandwidthInfo
+	Tuning                   *TuningInfo
+	NetworkAttachments       []NetworkAttachmentInfo
+}
+
+// PortMapping forwards a port of the host to a port of the endpoint.
+type PortMapping struct {
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+	// HostIP restricts the mapping to traffic to this address of the host.
+	HostIP string `json:",omitempty"`
+}
+
+// BandwidthInfo limits the traffic rates of an endpoint. Rates are in bits per second and bursts are in bits.
+type BandwidthInfo struct {
+	// IngressRate and IngressBurst limit the traffic the endpoint receives.
+	IngressRate  uint64
+	IngressBurst uint64
+	// EgressRate and EgressBurst limit the traffic the endpoint sends.
+	EgressRate  uint64
+	EgressBurst uint64
+}
+
+// TuningInfo sets sysctls and interface settings in the network namespace of an endpoint.
+type TuningInfo struct {
+	Sysctls map[string]string
+	// MTU and TxQueueLen are set on the container interface if they are not zero.
+	MTU        int
+	TxQueueLen int
+}
+
+// NetworkAttachmentInfo is a secondary interface of the pod of an endpoint, in another network. It is recorded on
+// the endpoint of the primary interface, so that the secondary interfaces are deleted with it.
+type NetworkAttachmentInfo struct {
+	Network  string
+	IfName   string
+	Master   string `json:",omitempty"`
+	IPAMType string `json:",omitempty"`
+	Subnet   string `json:",omitempty"`
 }
 
 // RouteInfo contains information about an IP route.
@@ -144,6 +187,23 @@ func (nw *network) deleteEndpoint(endpointId string) error {
 	return nil
 }
 
+// checkEndpoint verifies that the data plane of the endpoint matches its state. The container side is checked in
+// the netns at netNsPath, where the container interface is named ifName.
+func (nw *network) checkEndpoint(ep *endpoint, netNsPath string, ifName string) error {
+	log.Printf("[net] Checking endpoint %v in netns %v.", ep.Id, netNsPath)
+
+	drift, err := nw.checkEndpointImpl(ep, netNsPath, ifName)
+	if err != nil {
+		return err
+	}
+
+	if len(drift) > 0 {
+		return &EndpointDriftError{EndpointID: ep.Id, Drift: drift}
+	}
+
+	return nil
+}
+
 // GetEndpoint returns the endpoint with the given ID.
 func (nw *network) getEndpoint(endpointId string) (*endpoint, error) {
 	log.Printf("Trying to retrieve endpoint id %v", endpointId)
@@ -222,6 +282,10 @@ func (ep *endpoint) getInfo() *EndpointInfo {
 
 	info.Gateways = append(info.Gateways, ep.Gateways...)
 
+	info.PortMappings = append(info.PortMappings, ep.PortMappings...)
+
+	info.NetworkAttachments = append(info.NetworkAttachments, ep.NetworkAttachments...)
+
 	// Call the platform implementation.
 	ep.getInfoImpl(info)
 
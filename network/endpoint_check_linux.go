@@ -0,0 +1,268 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/ebtables"
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// sysfs path of the link a network interface is enslaved to.
+const linkMasterPathFormat = "/sys/class/net/%s/master"
+
+// checkEndpointImpl checks the host side of the endpoint, then enters the container netns to check the container
+// side. It returns a description of each mismatch between the data plane and the endpoint state.
+func (nw *network) checkEndpointImpl(ep *endpoint, netNsPath string, ifName string) ([]string, error) {
+	drift, err := nw.checkHostEndpoint(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.NetworkNameSpace != "" && ep.NetworkNameSpace != netNsPath {
+		drift = append(drift, fmt.Sprintf("endpoint was created in netns %s, not %s", ep.NetworkNameSpace, netNsPath))
+	}
+
+	containerDrift, err := checkContainerEndpoint(ep, netNsPath, ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(drift, containerDrift...), nil
+}
+
+// checkHostEndpoint checks the host veth of the endpoint and the rules which forward traffic to it.
+func (nw *network) checkHostEndpoint(ep *endpoint) ([]string, error) {
+	var drift []string
+
+	hostIf, err := net.InterfaceByName(ep.HostIfName)
+	if err != nil {
+		return []string{fmt.Sprintf("host veth %s not found", ep.HostIfName)}, nil
+	}
+
+	if hostIf.Flags&net.FlagUp == 0 {
+		drift = append(drift, fmt.Sprintf("host veth %s is down", ep.HostIfName))
+	}
+
+	switch {
+	case ep.VlanID != 0:
+		// OVS endpoints are forwarded by flows on the OVS bridge, which are not checked.
+	case nw.Mode == opModeTransparent:
+		routes, err := netlink.GetIpRoute(&netlink.Route{Family: unix.AF_INET})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ipAddr := range ep.IPAddresses {
+			if ipAddr.IP.To4() == nil {
+				continue
+			}
+
+			hostRoute := RouteInfo{Dst: net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(32, 32)}}
+			if !routeExists(routes, hostRoute, hostIf.Index) {
+				drift = append(drift, fmt.Sprintf("host route to %s via %s is missing", hostRoute.Dst.String(), ep.HostIfName))
+			}
+		}
+	default:
+		if master := getLinkMaster(ep.HostIfName); master != nw.extIf.BridgeName {
+			drift = append(drift, fmt.Sprintf("host veth %s is attached to %q, not bridge %s", ep.HostIfName, master, nw.extIf.BridgeName))
+		}
+
+		rules, err := ebtables.GetEbtableRules(ebtables.Nat, ebtables.PreRouting)
+		if err != nil {
+			return nil, err
+		}
+
+		drift = append(drift, nw.checkBridgeEndpointRules(ep, rules)...)
+	}
+
+	return drift, nil
+}
+
+// checkBridgeEndpointRules checks the ebtables rules which answer ARP requests for the IP addresses of the endpoint
+// and forward traffic to them.
+func (nw *network) checkBridgeEndpointRules(ep *endpoint, rules []string) []string {
+	var drift []string
+
+	arpReplyMac := ep.MacAddress
+	if nw.Mode == opModeTunnel {
+		arpReplyMac, _ = net.ParseMAC(virtualMacAddress)
+	}
+
+	for _, ipAddr := range ep.IPAddresses {
+		dst := "--ip-dst"
+		if ipAddr.IP.To4() != nil {
+			if !ebRuleExists(rules, "--arp-ip-dst "+ipAddr.IP.String(), "--arpreply-mac "+arpReplyMac.String()) {
+				drift = append(drift, fmt.Sprintf("ebtables ARP reply rule for %s is missing", ipAddr.IP.String()))
+			}
+		} else {
+			dst = "--ip6-dst"
+		}
+
+		if !ebRuleExists(rules, "-i "+nw.extIf.Name, dst+" "+ipAddr.IP.String(), "--to-dst "+ep.MacAddress.String()) {
+			drift = append(drift, fmt.Sprintf("ebtables MAC DNAT rule for %s is missing", ipAddr.IP.String()))
+		}
+	}
+
+	return drift
+}
+
+// checkContainerEndpoint checks the container interface of the endpoint, its IP addresses and routes.
+func checkContainerEndpoint(ep *endpoint, netNsPath string, ifName string) ([]string, error) {
+	var drift []string
+
+	log.Printf("[net] Opening netns %v.", netNsPath)
+	ns, err := OpenNamespace(netNsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+
+	log.Printf("[net] Entering netns %v.", netNsPath)
+	if err = ns.Enter(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		log.Printf("[net] Exiting netns %v.", netNsPath)
+		if err := ns.Exit(); err != nil {
+			log.Printf("[net] Failed to exit netns, err:%v.", err)
+		}
+	}()
+
+	containerIf, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return []string{fmt.Sprintf("container interface %s not found", ifName)}, nil
+	}
+
+	if containerIf.Flags&net.FlagUp == 0 {
+		drift = append(drift, fmt.Sprintf("container interface %s is down", ifName))
+	}
+
+	if len(ep.MacAddress) > 0 && !bytes.Equal(containerIf.HardwareAddr, ep.MacAddress) {
+		drift = append(drift, fmt.Sprintf("container interface %s has MAC %s, not %s", ifName, containerIf.HardwareAddr, ep.MacAddress))
+	}
+
+	addrs, err := containerIf.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	drift = append(drift, missingAddresses(ifName, ep.IPAddresses, addrs)...)
+
+	var routes []*netlink.Route
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		familyRoutes, err := netlink.GetIpRoute(&netlink.Route{Family: family})
+		if err != nil {
+			return nil, err
+		}
+
+		routes = append(routes, familyRoutes...)
+	}
+
+	for _, route := range ep.Routes {
+		linkIndex := containerIf.Index
+		if route.DevName != "" {
+			// the route is on another interface, which is not part of the endpoint
+			linkIndex = 0
+		}
+
+		if !routeExists(routes, route, linkIndex) {
+			drift = append(drift, fmt.Sprintf("route to %s via %v is missing", route.Dst.String(), route.Gw))
+		}
+	}
+
+	return drift, nil
+}
+
+// getLinkMaster returns the name of the link the interface is enslaved to, or an empty string if it has none.
+func getLinkMaster(ifName string) string {
+	master, err := os.Readlink(fmt.Sprintf(linkMasterPathFormat, ifName))
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Base(master)
+}
+
+// missingAddresses describes each of the expected IP addresses which is not assigned to the interface.
+func missingAddresses(ifName string, expected []net.IPNet, addrs []net.Addr) []string {
+	var drift []string
+
+	for _, ipAddr := range expected {
+		found := false
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ipAddr.IP) && bytes.Equal(ipNet.Mask, ipAddr.Mask) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			drift = append(drift, fmt.Sprintf("IP address %s is not assigned to %s", ipAddr.String(), ifName))
+		}
+	}
+
+	return drift
+}
+
+// routeExists returns true if one of the routes matches the destination and gateway of the expected route, and is
+// on the link if linkIndex is set.
+func routeExists(routes []*netlink.Route, expected RouteInfo, linkIndex int) bool {
+	expectedOnes, _ := expected.Dst.Mask.Size()
+
+	for _, route := range routes {
+		if linkIndex != 0 && route.LinkIndex != linkIndex {
+			continue
+		}
+
+		// the kernel reports default routes without a destination
+		if route.Dst == nil {
+			if expectedOnes != 0 {
+				continue
+			}
+		} else {
+			ones, _ := route.Dst.Mask.Size()
+			if ones != expectedOnes || !route.Dst.IP.Equal(expected.Dst.IP) {
+				continue
+			}
+		}
+
+		if expected.Gw != nil && !expected.Gw.IsUnspecified() && !route.Gw.Equal(expected.Gw) {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// ebRuleExists returns true if one of the ebtables rules contains all of the matches, such as "--ip-dst 10.0.0.4".
+func ebRuleExists(rules []string, matches ...string) bool {
+	for _, rule := range rules {
+		padded := " " + rule + " "
+		found := true
+		for _, match := range matches {
+			if !strings.Contains(padded, " "+match+" ") {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
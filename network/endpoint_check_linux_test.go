@@ -0,0 +1,70 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test checkEndpoint", func() {
+	_, podSubnet, _ := net.ParseCIDR("10.0.0.0/24")
+	podIP := net.IPNet{IP: net.ParseIP("10.0.0.4"), Mask: podSubnet.Mask}
+	gw := net.ParseIP("10.0.0.1")
+
+	Describe("Test routeExists", func() {
+		routes := []*netlink.Route{
+			{LinkIndex: 2, Gw: gw},
+			{LinkIndex: 2, Dst: podSubnet},
+		}
+
+		It("Should match the default route without a destination", func() {
+			defaultRoute := RouteInfo{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, Gw: gw}
+			Expect(routeExists(routes, defaultRoute, 2)).To(BeTrue())
+			Expect(routeExists(routes, defaultRoute, 3)).To(BeFalse())
+		})
+
+		It("Should match the destination and gateway", func() {
+			Expect(routeExists(routes, RouteInfo{Dst: *podSubnet}, 2)).To(BeTrue())
+			Expect(routeExists(routes, RouteInfo{Dst: *podSubnet, Gw: gw}, 2)).To(BeFalse())
+			Expect(routeExists(routes, RouteInfo{Dst: podIP}, 2)).To(BeFalse())
+		})
+	})
+
+	Describe("Test missingAddresses", func() {
+		It("Should describe each address which is not assigned", func() {
+			addrs := []net.Addr{&net.IPNet{IP: podIP.IP, Mask: podIP.Mask}}
+			Expect(missingAddresses("eth0", []net.IPNet{podIP}, addrs)).To(BeEmpty())
+
+			otherIP := net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: podSubnet.Mask}
+			Expect(missingAddresses("eth0", []net.IPNet{podIP, otherIP}, addrs)).To(
+				Equal([]string{"IP address 10.0.0.5/24 is not assigned to eth0"}))
+		})
+	})
+
+	Describe("Test checkBridgeEndpointRules", func() {
+		mac, _ := net.ParseMAC("00:0d:3a:12:34:56")
+		ep := &endpoint{MacAddress: mac, IPAddresses: []net.IPNet{podIP}}
+		rules := []string{
+			"-p ARP --arp-op Request --arp-ip-dst 10.0.0.4 -j arpreply --arpreply-mac 00:0d:3a:12:34:56",
+			"-p IPv4 -i eth0 --ip-dst 10.0.0.4 -j dnat --to-dst 00:0d:3a:12:34:56 --dnat-target ACCEPT",
+		}
+
+		It("Should find the ARP reply and DNAT rules of the endpoint", func() {
+			nw := &network{Mode: opModeBridge, extIf: &externalInterface{Name: "eth0"}}
+			Expect(nw.checkBridgeEndpointRules(ep, rules)).To(BeEmpty())
+		})
+
+		It("Should report rules on another interface or MAC as drift", func() {
+			nw := &network{Mode: opModeTunnel, extIf: &externalInterface{Name: "eth1"}}
+			Expect(nw.checkBridgeEndpointRules(ep, rules)).To(Equal([]string{
+				"ebtables ARP reply rule for 10.0.0.4 is missing",
+				"ebtables MAC DNAT rule for 10.0.0.4 is missing",
+			}))
+		})
+	})
+})
@@ -59,6 +59,13 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		return nil, err
 	}
 
+	// packets larger than the MTU of the host interface cannot leave the host
+	if nw.extIf != nil {
+		if epInfo.Tuning, err = capTuningMTU(epInfo.Tuning, nw.extIf.Name); err != nil {
+			return nil, err
+		}
+	}
+
 	if epInfo.Data != nil {
 		if _, ok := epInfo.Data[VlanIDKey]; ok {
 			vlanid = epInfo.Data[VlanIDKey].(int)
@@ -125,6 +132,7 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 			if containerIf != nil {
 				endpt.MacAddress = containerIf.HardwareAddr
 				epClient.DeleteEndpointRules(endpt)
+				deletePortMappings(epInfo.Id, epInfo.IPAddresses, epInfo.PortMappings)
 			}
 
 			epClient.DeleteEndpoints(endpt)
@@ -145,6 +153,20 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		return nil, err
 	}
 
+	// Setup rules for the host ports mapped to the container.
+	// The host reaches the container through the bridge of the network, or through the host veth in transparent mode.
+	routeIfName, bridgePortName := nw.extIf.BridgeName, ""
+	switch epClient.(type) {
+	case *LinuxBridgeEndpointClient:
+		bridgePortName = hostIfName
+	case *TransparentEndpointClient:
+		routeIfName = hostIfName
+	}
+
+	if err = addPortMappings(epInfo.Id, routeIfName, bridgePortName, epInfo.IPAddresses, epInfo.PortMappings); err != nil {
+		return nil, err
+	}
+
 	// If a network namespace for the container interface is specified...
 	if epInfo.NetNsPath != "" {
 		// Open the network namespace.
@@ -206,6 +228,8 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
 		PODNameSpace:             epInfo.PODNameSpace,
+		PortMappings:             epInfo.PortMappings,
+		NetworkAttachments:       epInfo.NetworkAttachments,
 	}
 
 	ep.Routes = append(ep.Routes, epInfo.Routes...)
@@ -229,6 +253,7 @@ func (nw *network) deleteEndpointImpl(ep *endpoint) error {
 	}
 
 	epClient.DeleteEndpointRules(ep)
+	deletePortMappings(ep.Id, ep.IPAddresses, ep.PortMappings)
 	epClient.DeleteEndpoints(ep)
 
 	return nil
@@ -157,16 +157,17 @@ func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo) (*endpoint, error)
 
 	// Create the endpoint object.
 	ep := &endpoint{
-		Id:               infraEpName,
-		HnsId:            hnsResponse.Id,
-		SandboxKey:       epInfo.ContainerID,
-		IfName:           epInfo.IfName,
-		IPAddresses:      epInfo.IPAddresses,
-		Gateways:         []net.IP{net.ParseIP(hnsResponse.GatewayAddress)},
-		DNS:              epInfo.DNS,
-		VlanID:           vlanid,
-		EnableSnatOnHost: epInfo.EnableSnatOnHost,
-		NetNs:            epInfo.NetNsPath,
+		Id:                 infraEpName,
+		HnsId:              hnsResponse.Id,
+		SandboxKey:         epInfo.ContainerID,
+		IfName:             epInfo.IfName,
+		IPAddresses:        epInfo.IPAddresses,
+		Gateways:           []net.IP{net.ParseIP(hnsResponse.GatewayAddress)},
+		DNS:                epInfo.DNS,
+		VlanID:             vlanid,
+		EnableSnatOnHost:   epInfo.EnableSnatOnHost,
+		NetNs:              epInfo.NetNsPath,
+		NetworkAttachments: epInfo.NetworkAttachments,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -386,6 +387,7 @@ func (nw *network) newEndpointImplHnsV2(epInfo *EndpointInfo) (*endpoint, error)
 		AllowInboundFromNCToHost: epInfo.AllowInboundFromNCToHost,
 		AllowInboundFromHostToNC: epInfo.AllowInboundFromHostToNC,
 		NetworkContainerID:       epInfo.NetworkContainerID,
+		NetworkAttachments:       epInfo.NetworkAttachments,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -469,6 +471,11 @@ func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
 	epInfo.Data["hnsid"] = ep.HnsId
 }
 
+// checkEndpointImpl in windows does nothing for now, as HNS owns the data plane of the endpoint
+func (nw *network) checkEndpointImpl(ep *endpoint, netNsPath string, ifName string) ([]string, error) {
+	return nil, nil
+}
+
 // updateEndpointImpl in windows does nothing for now
 func (nw *network) updateEndpointImpl(existingEpInfo *EndpointInfo, targetEpInfo *EndpointInfo) (*endpoint, error) {
 	return nil, nil
@@ -4,7 +4,10 @@
 package network
 
 import (
+	"fmt"
+	"hash/fnv"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,11 +29,25 @@ const (
 	genericData = "com.docker.network.generic"
 )
 
+const (
+	// Kinds of resources locked while their data plane is changed.
+	networkLockKind  = "network"
+	endpointLockKind = "endpoint"
+
+	// Number of lock files the resources of each kind are spread over.
+	resourceLockStripes = 64
+)
+
 var Ipv4DefaultRouteDstPrefix = net.IPNet{
 	IP:   net.IPv4zero,
 	Mask: net.IPv4Mask(0, 0, 0, 0),
 }
 
+var Ipv6DefaultRouteDstPrefix = net.IPNet{
+	IP:   net.IPv6zero,
+	Mask: net.CIDRMask(0, 128),
+}
+
 type NetworkClient interface {
 	CreateBridge() error
 	DeleteBridge() error
@@ -73,6 +90,7 @@ type NetworkManager interface {
 	CreateEndpoint(networkId string, epInfo *EndpointInfo) error
 	DeleteEndpoint(networkId string, endpointId string) error
 	GetEndpointInfo(networkId string, endpointId string) (*EndpointInfo, error)
+	CheckEndpoint(networkId string, endpointId string, netNsPath string, ifName string) error
 	GetAllEndpoints(networkId string) (map[string]*EndpointInfo, error)
 	GetEndpointInfoBasedOnPODDetails(networkId string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error)
 	AttachEndpoint(networkId string, endpointId string, sandboxKey string) (*endpoint, error)
@@ -96,8 +114,14 @@ func (nm *networkManager) Initialize(config *common.PluginConfig, isRehydrationR
 	nm.Version = config.Version
 	nm.store = config.Store
 
+	locked, err := nm.lockState()
+	if err != nil {
+		return err
+	}
+	defer nm.unlockState(locked)
+
 	// Restore persisted state.
-	err := nm.restore(isRehydrationRequired)
+	err = nm.restore(isRehydrationRequired)
 	return err
 }
 
@@ -166,12 +190,7 @@ func (nm *networkManager) restore(isRehydrationRequired bool) error {
 			}
 		}
 	}
-	// Populate pointers.
-	for _, extIf := range nm.ExternalInterfaces {
-		for _, nw := range extIf.Networks {
-			nw.extIf = extIf
-		}
-	}
+	nm.populatePointers()
 
 	// if rebooted recreate the network that existed before reboot.
 	if rebooted {
@@ -206,6 +225,150 @@ func (nm *networkManager) restore(isRehydrationRequired bool) error {
 	return nil
 }
 
+// populatePointers links the networks to their external interfaces, which are not persisted.
+func (nm *networkManager) populatePointers() {
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			nw.extIf = extIf
+		}
+	}
+}
+
+// reload replaces network manager state with the persisted state, which other plugin processes may have changed
+// since it was read.
+func (nm *networkManager) reload() error {
+	nm.ExternalInterfaces = make(map[string]*externalInterface)
+
+	err := nm.store.Read(storeKey, nm)
+	if err != nil && err != store.ErrKeyNotFound && err != store.ErrStoreEmpty {
+		log.Printf("[net] Failed to reload state, err:%v\n", err)
+		return err
+	}
+
+	nm.populatePointers()
+
+	return nil
+}
+
+// lockState locks the store while network manager state is read, modified and written, and reloads the state.
+// It returns false without locking the store if the caller already holds the store lock, as the state is then
+// current.
+func (nm *networkManager) lockState() (bool, error) {
+	// Skip if a store is not provided.
+	if nm.store == nil {
+		return false, nil
+	}
+
+	err := nm.store.Lock(true)
+	if err == store.ErrStoreLocked {
+		return false, nil
+	}
+
+	if err != nil {
+		log.Printf("[net] Failed to lock store, err:%v\n", err)
+		return false, err
+	}
+
+	if err = nm.reload(); err != nil {
+		nm.unlockState(true)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unlockState unlocks the store if it was locked by lockState.
+func (nm *networkManager) unlockState(locked bool) {
+	if !locked {
+		return
+	}
+
+	if err := nm.store.Unlock(false); err != nil {
+		log.Printf("[net] Failed to unlock store, err:%v\n", err)
+	}
+}
+
+// updateState applies a change to the latest network manager state and saves it, while holding the store lock.
+func (nm *networkManager) updateState(change func() error) error {
+	locked, err := nm.lockState()
+	if err != nil {
+		return err
+	}
+	defer nm.unlockState(locked)
+
+	if err = change(); err != nil {
+		return err
+	}
+
+	return nm.save()
+}
+
+// getLatestNetwork returns the given network from the latest network manager state.
+func (nm *networkManager) getLatestNetwork(networkId string) (*network, error) {
+	locked, err := nm.lockState()
+	if err != nil {
+		return nil, err
+	}
+	defer nm.unlockState(locked)
+
+	return nm.getNetwork(networkId)
+}
+
+// lockResource locks a network or an endpoint across plugin processes while its data plane is changed, so the
+// store only needs to be locked while the state is changed. Exclusive locks exclude all other holders, while shared
+// locks only exclude exclusive holders. The resources of each kind are spread over a fixed number of lock files next
+// to the lock file of the store, so the lock files are never deleted.
+func (nm *networkManager) lockResource(kind string, id string, exclusive bool) (*store.FileLock, error) {
+	// Skip if a store is not provided.
+	if nm.store == nil || nm.store.GetLockFileName() == "" {
+		return nil, nil
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	lockFileName := fmt.Sprintf("%s.%s-%d.lock",
+		strings.TrimSuffix(nm.store.GetLockFileName(), ".lock"), kind, hash.Sum32()%resourceLockStripes)
+
+	lock := store.NewFileLock(lockFileName)
+	if err := lock.Lock(exclusive); err != nil {
+		log.Printf("[net] Failed to lock %v %v, err:%v\n", kind, id, err)
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// unlockResource unlocks a lock returned by lockResource.
+func unlockResource(lock *store.FileLock) {
+	if lock == nil {
+		return
+	}
+
+	if err := lock.Unlock(); err != nil {
+		log.Printf("[net] Failed to unlock resource, err:%v\n", err)
+	}
+}
+
+// lockEndpoint locks the network of an endpoint shared, so it is not created or deleted concurrently, and the
+// endpoint exclusively.
+func (nm *networkManager) lockEndpoint(networkId string, endpointId string) (func(), error) {
+	nwLock, err := nm.lockResource(networkLockKind, networkId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	epLock, err := nm.lockResource(endpointLockKind, endpointId, true)
+	if err != nil {
+		unlockResource(nwLock)
+		return nil, err
+	}
+
+	return func() {
+		unlockResource(epLock)
+		unlockResource(nwLock)
+	}, nil
+}
+
 // Save writes network manager state to persistent store.
 func (nm *networkManager) save() error {
 	// Skip if a store is not provided.
@@ -236,53 +399,48 @@ func (nm *networkManager) AddExternalInterface(ifName string, subnet string) err
 	nm.Lock()
 	defer nm.Unlock()
 
-	err := nm.newExternalInterface(ifName, subnet)
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		return nm.newExternalInterface(ifName, subnet)
+	})
+}
 
-	err = nm.save()
+// CreateNetwork creates a new container network. Networks share external interfaces, so the store stays locked
+// while the network is created.
+func (nm *networkManager) CreateNetwork(nwInfo *NetworkInfo) error {
+	nwLock, err := nm.lockResource(networkLockKind, nwInfo.Id, true)
 	if err != nil {
 		return err
 	}
+	defer unlockResource(nwLock)
 
-	return nil
-}
-
-// CreateNetwork creates a new container network.
-func (nm *networkManager) CreateNetwork(nwInfo *NetworkInfo) error {
 	nm.Lock()
 	defer nm.Unlock()
 
-	_, err := nm.newNetwork(nwInfo)
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		if _, err := nm.getNetwork(nwInfo.Id); err == nil {
+			log.Printf("[net] Network %v was created by another invocation.", nwInfo.Id)
+			return nil
+		}
 
-	err = nm.save()
-	if err != nil {
+		_, err := nm.newNetwork(nwInfo)
 		return err
-	}
-
-	return nil
+	})
 }
 
 // DeleteNetwork deletes an existing container network.
 func (nm *networkManager) DeleteNetwork(networkId string) error {
-	nm.Lock()
-	defer nm.Unlock()
-
-	err := nm.deleteNetwork(networkId)
+	nwLock, err := nm.lockResource(networkLockKind, networkId, true)
 	if err != nil {
 		return err
 	}
+	defer unlockResource(nwLock)
 
-	err = nm.save()
-	if err != nil {
-		return err
-	}
+	nm.Lock()
+	defer nm.Unlock()
 
-	return nil
+	return nm.updateState(func() error {
+		return nm.deleteNetwork(networkId)
+	})
 }
 
 // GetNetworkInfo returns information about the given network.
@@ -313,12 +471,24 @@ func (nm *networkManager) GetNetworkInfo(networkId string) (NetworkInfo, error)
 	return nwInfo, nil
 }
 
-// CreateEndpoint creates a new container endpoint.
+// CreateEndpoint creates a new container endpoint. The store is only locked while the endpoint is read from and
+// written to the state, not while its data plane is created.
 func (nm *networkManager) CreateEndpoint(networkId string, epInfo *EndpointInfo) error {
+	return nm.createEndpoint(networkId, epInfo, (*network).newEndpoint)
+}
+
+// createEndpoint creates a new container endpoint with the given function, which creates its data plane.
+func (nm *networkManager) createEndpoint(networkId string, epInfo *EndpointInfo, newEndpoint func(*network, *EndpointInfo) (*endpoint, error)) error {
+	unlock, err := nm.lockEndpoint(networkId, epInfo.Id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	nm.Lock()
 	defer nm.Unlock()
 
-	nw, err := nm.getNetwork(networkId)
+	nw, err := nm.getLatestNetwork(networkId)
 	if err != nil {
 		return err
 	}
@@ -330,25 +500,38 @@ func (nm *networkManager) CreateEndpoint(networkId string, epInfo *EndpointInfo)
 		}
 	}
 
-	_, err = nw.newEndpoint(epInfo)
+	ep, err := newEndpoint(nw, epInfo)
 	if err != nil {
 		return err
 	}
 
-	err = nm.save()
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		latest, err := nm.getNetwork(networkId)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// Creating the endpoint may set the SNAT bridge IP of the network.
+		latest.SnatBridgeIP = nw.SnatBridgeIP
+		latest.Endpoints[ep.Id] = ep
+
+		return nil
+	})
 }
 
-// DeleteEndpoint deletes an existing container endpoint.
+// DeleteEndpoint deletes an existing container endpoint. The store is only locked while the endpoint is read from
+// and removed from the state, not while its data plane is deleted.
 func (nm *networkManager) DeleteEndpoint(networkId string, endpointId string) error {
+	unlock, err := nm.lockEndpoint(networkId, endpointId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	nm.Lock()
 	defer nm.Unlock()
 
-	nw, err := nm.getNetwork(networkId)
+	nw, err := nm.getLatestNetwork(networkId)
 	if err != nil {
 		return err
 	}
@@ -358,12 +541,16 @@ func (nm *networkManager) DeleteEndpoint(networkId string, endpointId string) er
 		return err
 	}
 
-	err = nm.save()
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		latest, err := nm.getNetwork(networkId)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		delete(latest.Endpoints, endpointId)
+
+		return nil
+	})
 }
 
 // GetEndpointInfo returns information about the given endpoint.
@@ -384,6 +571,25 @@ func (nm *networkManager) GetEndpointInfo(networkId string, endpointId string) (
 	return ep.getInfo(), nil
 }
 
+// CheckEndpoint verifies that the data plane of the given endpoint matches its state, and returns an
+// EndpointDriftError describing every mismatch.
+func (nm *networkManager) CheckEndpoint(networkId string, endpointId string, netNsPath string, ifName string) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkId)
+	if err != nil {
+		return err
+	}
+
+	ep, err := nw.getEndpoint(endpointId)
+	if err != nil {
+		return err
+	}
+
+	return nw.checkEndpoint(ep, netNsPath, ifName)
+}
+
 func (nm *networkManager) GetAllEndpoints(networkId string) (map[string]*EndpointInfo, error) {
 	nm.Lock()
 	defer nm.Unlock()
@@ -432,22 +638,20 @@ func (nm *networkManager) AttachEndpoint(networkId string, endpointId string, sa
 	nm.Lock()
 	defer nm.Unlock()
 
-	nw, err := nm.getNetwork(networkId)
-	if err != nil {
-		return nil, err
-	}
-
-	ep, err := nw.getEndpoint(endpointId)
-	if err != nil {
-		return nil, err
-	}
+	var ep *endpoint
+	err := nm.updateState(func() error {
+		nw, err := nm.getNetwork(networkId)
+		if err != nil {
+			return err
+		}
 
-	err = ep.attach(sandboxKey)
-	if err != nil {
-		return nil, err
-	}
+		ep, err = nw.getEndpoint(endpointId)
+		if err != nil {
+			return err
+		}
 
-	err = nm.save()
+		return ep.attach(sandboxKey)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -460,50 +664,58 @@ func (nm *networkManager) DetachEndpoint(networkId string, endpointId string) er
 	nm.Lock()
 	defer nm.Unlock()
 
-	nw, err := nm.getNetwork(networkId)
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		nw, err := nm.getNetwork(networkId)
+		if err != nil {
+			return err
+		}
 
-	ep, err := nw.getEndpoint(endpointId)
-	if err != nil {
-		return err
-	}
+		ep, err := nw.getEndpoint(endpointId)
+		if err != nil {
+			return err
+		}
 
-	err = ep.detach()
-	if err != nil {
-		return err
-	}
+		return ep.detach()
+	})
+}
 
-	err = nm.save()
+// UpdateEndpoint updates an existing container endpoint. The store is only locked while the endpoint is read from
+// and written to the state, not while its routes are updated.
+func (nm *networkManager) UpdateEndpoint(networkID string, existingEpInfo *EndpointInfo, targetEpInfo *EndpointInfo) error {
+	unlock, err := nm.lockEndpoint(networkID, existingEpInfo.Id)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return nil
-}
-
-// UpdateEndpoint updates an existing container endpoint.
-func (nm *networkManager) UpdateEndpoint(networkID string, existingEpInfo *EndpointInfo, targetEpInfo *EndpointInfo) error {
 	nm.Lock()
 	defer nm.Unlock()
 
-	nw, err := nm.getNetwork(networkID)
+	nw, err := nm.getLatestNetwork(networkID)
 	if err != nil {
 		return err
 	}
 
-	_, err = nw.updateEndpoint(existingEpInfo, targetEpInfo)
+	ep, err := nw.updateEndpoint(existingEpInfo, targetEpInfo)
 	if err != nil {
 		return err
 	}
 
-	err = nm.save()
-	if err != nil {
-		return err
-	}
+	return nm.updateState(func() error {
+		latest, err := nm.getNetwork(networkID)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		latestEp, err := latest.getEndpoint(existingEpInfo.Id)
+		if err != nil {
+			return err
+		}
+
+		latestEp.Routes = ep.Routes
+
+		return nil
+	})
 }
 
 func (nm *networkManager) GetNumberOfEndpoints(ifName string, networkId string) int {
@@ -9,8 +9,9 @@ import (
 
 // MockNetworkManager is a mock structure for Network Manager
 type MockNetworkManager struct {
-	TestNetworkInfoMap  map[string]*NetworkInfo
-	TestEndpointInfoMap map[string]*EndpointInfo
+	TestNetworkInfoMap   map[string]*NetworkInfo
+	TestEndpointInfoMap  map[string]*EndpointInfo
+	TestCheckEndpointErr error
 }
 
 // NewMockNetworkmanager returns a new mock
@@ -61,6 +62,7 @@ func (nm *MockNetworkManager) CreateEndpoint(networkID string, epInfo *EndpointI
 
 // DeleteEndpoint mock
 func (nm *MockNetworkManager) DeleteEndpoint(networkID string, endpointID string) error {
+	delete(nm.TestEndpointInfoMap, endpointID)
 	return nil
 }
 
@@ -70,7 +72,15 @@ func (nm *MockNetworkManager) GetAllEndpoints(networkID string) (map[string]*End
 
 // GetEndpointInfo mock
 func (nm *MockNetworkManager) GetEndpointInfo(networkID string, endpointID string) (*EndpointInfo, error) {
-	return nm.TestEndpointInfoMap[networkID], nil
+	if info, exists := nm.TestEndpointInfoMap[endpointID]; exists {
+		return info, nil
+	}
+	return nil, fmt.Errorf("Not found")
+}
+
+// CheckEndpoint mock
+func (nm *MockNetworkManager) CheckEndpoint(networkID string, endpointID string, netNsPath string, ifName string) error {
+	return nm.TestCheckEndpointErr
 }
 
 // GetEndpointInfoBasedOnPODDetails mock
@@ -2,12 +2,18 @@ package network
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/testutils"
 )
@@ -226,4 +232,93 @@ var _ = Describe("Test Manager", func() {
 			})
 		})
 	})
+
+	Describe("Test CreateEndpoint in parallel", func() {
+		It("Should save every endpoint while creating their data plane in parallel", func() {
+			const (
+				ifName      = "eth0"
+				nwId        = "azure"
+				numAdds     = 16
+				waitTimeout = 5 * time.Second
+			)
+
+			dir, err := ioutil.TempDir("", "network")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			fileName := filepath.Join(dir, "test-azure-vnet.json")
+
+			kvs, err := store.NewJsonFileStore(fileName)
+			Expect(err).NotTo(HaveOccurred())
+			nm := &networkManager{
+				ExternalInterfaces: map[string]*externalInterface{
+					ifName: {
+						Name:     ifName,
+						Networks: map[string]*network{nwId: {Id: nwId, Endpoints: map[string]*endpoint{}}},
+					},
+				},
+				store: kvs,
+			}
+			Expect(nm.save()).To(Succeed())
+
+			// Each ADD creates its data plane while other ADDs are creating theirs.
+			var mu sync.Mutex
+			cond := sync.NewCond(&mu)
+			creating, maxCreating := 0, 0
+			newEndpoint := func(nw *network, epInfo *EndpointInfo) (*endpoint, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				creating++
+				if creating > maxCreating {
+					maxCreating = creating
+				}
+				cond.Broadcast()
+
+				timer := time.AfterFunc(waitTimeout, cond.Broadcast)
+				defer timer.Stop()
+				for deadline := time.Now().Add(waitTimeout); maxCreating < 2 && time.Now().Before(deadline); {
+					cond.Wait()
+				}
+				creating--
+
+				return &endpoint{Id: epInfo.Id, IfName: epInfo.IfName}, nil
+			}
+
+			// Each ADD runs in its own plugin process, with its own network manager and store.
+			var wg sync.WaitGroup
+			errs := make(chan error, numAdds)
+			for i := 0; i < numAdds; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					kvs, err := store.NewJsonFileStore(fileName)
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					nm := &networkManager{ExternalInterfaces: map[string]*externalInterface{}}
+					if err = nm.Initialize(&common.PluginConfig{Store: kvs}, false); err != nil {
+						errs <- err
+						return
+					}
+
+					epInfo := &EndpointInfo{Id: fmt.Sprintf("%08x-eth0", i), IfName: "eth0"}
+					errs <- nm.createEndpoint(nwId, epInfo, newEndpoint)
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(maxCreating).To(BeNumerically(">=", 2))
+
+			kvs, err = store.NewJsonFileStore(fileName)
+			Expect(err).NotTo(HaveOccurred())
+			nm = &networkManager{ExternalInterfaces: map[string]*externalInterface{}}
+			Expect(nm.Initialize(&common.PluginConfig{Store: kvs}, false)).To(Succeed())
+			Expect(nm.GetNumberOfEndpoints(ifName, nwId)).To(Equal(numAdds))
+		})
+	})
 })
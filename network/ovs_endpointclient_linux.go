@@ -209,7 +209,11 @@ func (client *OVSEndpointClient) ConfigureContainerInterfacesAndRoutes(epInfo *E
 		return err
 	}
 
-	return addRoutes(client.containerVethName, epInfo.Routes)
+	if err := addRoutes(client.containerVethName, epInfo.Routes); err != nil {
+		return err
+	}
+
+	return applyTuning(client.containerVethName, epInfo.Tuning)
 }
 
 func (client *OVSEndpointClient) DeleteEndpoints(ep *endpoint) error {
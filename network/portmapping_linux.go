@@ -0,0 +1,205 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+)
+
+const (
+	// Source of traffic to host ports from the host itself, through the loopback interface.
+	localhostSubnet = "127.0.0.0/8"
+)
+
+// portMappingRule is an iptables rule which implements a port mapping.
+type portMappingRule struct {
+	version string
+	chain   string
+	match   string
+	target  string
+}
+
+// getPortMappingRules returns the rules which forward the host ports of the mappings to the IP addresses of the
+// endpoint. Each mapping gets a DNAT rule for traffic to the host port, and a SNAT rule for hairpin traffic from the
+// endpoint to its own host port, so replies return through the host. IPv4 mappings also get a SNAT rule for traffic
+// from localhost, which the endpoint cannot reply to. The rules are commented with the endpoint ID.
+func getPortMappingRules(endpointID string, ipAddresses []net.IPNet, mappings []PortMapping) ([]portMappingRule, error) {
+	var rules []portMappingRule
+
+	for _, mapping := range mappings {
+		protocol := strings.ToLower(strings.TrimSpace(mapping.Protocol))
+		switch protocol {
+		case "":
+			protocol = iptables.TCP
+		case iptables.TCP, iptables.UDP, iptables.SCTP:
+		default:
+			return nil, fmt.Errorf("Port mapping %+v has unsupported protocol %s", mapping, mapping.Protocol)
+		}
+
+		var hostIP net.IP
+		if mapping.HostIP != "" {
+			if hostIP = net.ParseIP(mapping.HostIP); hostIP == nil {
+				return nil, fmt.Errorf("Port mapping %+v has invalid host IP %s", mapping, mapping.HostIP)
+			}
+		}
+
+		for _, ipAddr := range ipAddresses {
+			isIPv4 := ipAddr.IP.To4() != nil
+			if hostIP != nil && (hostIP.To4() != nil) != isIPv4 {
+				continue
+			}
+
+			version := iptables.V4
+			podAddress := fmt.Sprintf("%s:%d", ipAddr.IP.String(), mapping.ContainerPort)
+			if !isIPv4 {
+				version = iptables.V6
+				podAddress = fmt.Sprintf("[%s]:%d", ipAddr.IP.String(), mapping.ContainerPort)
+			}
+
+			dnatMatch := fmt.Sprintf("-p %s --dport %d", protocol, mapping.HostPort)
+			if hostIP != nil {
+				dnatMatch = fmt.Sprintf("-d %s %s", hostIP.String(), dnatMatch)
+			}
+
+			rules = append(rules,
+				portMappingRule{
+					version: version,
+					chain:   iptables.CNIHostPortChain,
+					match:   fmt.Sprintf("%s -m comment --comment %s", dnatMatch, endpointID),
+					target:  fmt.Sprintf("%s --to-destination %s", iptables.Dnat, podAddress),
+				},
+				portMappingRule{
+					version: version,
+					chain:   iptables.CNIHostPortSnatChain,
+					match: fmt.Sprintf("-s %s -d %s -p %s --dport %d -m comment --comment %s",
+						ipAddr.IP.String(), ipAddr.IP.String(), protocol, mapping.ContainerPort, endpointID),
+					target: iptables.Masquerade,
+				})
+
+			if isIPv4 {
+				rules = append(rules, portMappingRule{
+					version: version,
+					chain:   iptables.CNIHostPortSnatChain,
+					match: fmt.Sprintf("-s %s -d %s -p %s --dport %d -m comment --comment %s",
+						localhostSubnet, ipAddr.IP.String(), protocol, mapping.ContainerPort, endpointID),
+					target: iptables.Masquerade,
+				})
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// addPortMappingChains creates the chains of the port mapping rules, and jumps to them from the standard chains.
+func addPortMappingChains(version string) error {
+	for _, chain := range []string{iptables.CNIHostPortChain, iptables.CNIHostPortSnatChain} {
+		if err := iptables.CreateChain(version, iptables.Nat, chain); err != nil {
+			return err
+		}
+	}
+
+	// traffic to host ports is either from other hosts, or from the host itself
+	localMatch := "-m addrtype --dst-type LOCAL"
+	if err := iptables.AppendIptableRule(version, iptables.Nat, iptables.Prerouting, localMatch, iptables.CNIHostPortChain); err != nil {
+		return err
+	}
+
+	if err := iptables.AppendIptableRule(version, iptables.Nat, iptables.Output, localMatch, iptables.CNIHostPortChain); err != nil {
+		return err
+	}
+
+	return iptables.AppendIptableRule(version, iptables.Nat, iptables.Postrouting, "", iptables.CNIHostPortSnatChain)
+}
+
+// setPortMappingHairpin enables hairpin on the bridge port of the host veth of an endpoint with port mappings, so
+// that hairpin traffic from the endpoint to its own host port is bridged back out of the port it came in on.
+func setPortMappingHairpin(bridgePortName string, mappings []PortMapping) error {
+	if bridgePortName == "" || len(mappings) == 0 {
+		return nil
+	}
+
+	log.Printf("[net] Setting hairpin for port mappings on %v.", bridgePortName)
+	return netlink.SetLinkHairpin(bridgePortName, true)
+}
+
+// setPortMappingLocalnet enables routing of localhost traffic on the interface the host reaches an endpoint with
+// IPv4 port mappings through, so that traffic from localhost to a host port can be forwarded to the endpoint.
+func setPortMappingLocalnet(routeIfName string, ipAddresses []net.IPNet, mappings []PortMapping) error {
+	if routeIfName == "" || len(mappings) == 0 {
+		return nil
+	}
+
+	for _, ipAddr := range ipAddresses {
+		if ipAddr.IP.To4() == nil {
+			continue
+		}
+
+		// interface names may contain dots, so the path is not derived from the sysctl name
+		log.Printf("[net] Setting route_localnet for port mappings on %v.", routeIfName)
+		return ioutil.WriteFile(filepath.Join(sysctlDir, "net/ipv4/conf", routeIfName, "route_localnet"), []byte("1"), 0644)
+	}
+
+	return nil
+}
+
+// addPortMappings programs the rules which forward the host ports of the mappings to the endpoint. routeIfName is
+// the interface the host reaches the endpoint through, and bridgePortName is the host veth of the endpoint if it is
+// a port of the bridge of the network, in bridge mode.
+func addPortMappings(endpointID string, routeIfName string, bridgePortName string, ipAddresses []net.IPNet, mappings []PortMapping) error {
+	rules, err := getPortMappingRules(endpointID, ipAddresses, mappings)
+	if err != nil {
+		return err
+	}
+
+	if err := setPortMappingHairpin(bridgePortName, mappings); err != nil {
+		return err
+	}
+
+	if err := setPortMappingLocalnet(routeIfName, ipAddresses, mappings); err != nil {
+		return err
+	}
+
+	chainsAdded := make(map[string]bool)
+	for _, rule := range rules {
+		if !chainsAdded[rule.version] {
+			if err := addPortMappingChains(rule.version); err != nil {
+				return err
+			}
+
+			chainsAdded[rule.version] = true
+		}
+
+		log.Printf("[net] Adding port mapping rule %s -j %s to chain %s.", rule.match, rule.target, rule.chain)
+		if err := iptables.AppendIptableRule(rule.version, iptables.Nat, rule.chain, rule.match, rule.target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deletePortMappings deletes the rules which forward the host ports of the mappings to the endpoint.
+func deletePortMappings(endpointID string, ipAddresses []net.IPNet, mappings []PortMapping) {
+	rules, err := getPortMappingRules(endpointID, ipAddresses, mappings)
+	if err != nil {
+		log.Printf("[net] Failed to get port mapping rules of endpoint %v: %v.", endpointID, err)
+		return
+	}
+
+	for _, rule := range rules {
+		log.Printf("[net] Deleting port mapping rule %s -j %s from chain %s.", rule.match, rule.target, rule.chain)
+		if err := iptables.DeleteIptableRule(rule.version, iptables.Nat, rule.chain, rule.match, rule.target); err != nil {
+			log.Printf("[net] Failed to delete port mapping rule: %v.", err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test port mappings", func() {
+	ipAddresses := []net.IPNet{
+		{IP: net.ParseIP("10.240.0.10"), Mask: net.CIDRMask(16, 32)},
+		{IP: net.ParseIP("fd00::a"), Mask: net.CIDRMask(64, 128)},
+	}
+
+	Describe("Test getPortMappingRules", func() {
+		It("Should DNAT the host port and SNAT hairpin and IPv4 localhost traffic for each IP address", func() {
+			rules, err := getPortMappingRules("3f813b02-eth0", ipAddresses, []PortMapping{{HostPort: 8080, ContainerPort: 80}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(Equal([]portMappingRule{
+				{
+					version: iptables.V4,
+					chain:   iptables.CNIHostPortChain,
+					match:   "-p tcp --dport 8080 -m comment --comment 3f813b02-eth0",
+					target:  "DNAT --to-destination 10.240.0.10:80",
+				},
+				{
+					version: iptables.V4,
+					chain:   iptables.CNIHostPortSnatChain,
+					match:   "-s 10.240.0.10 -d 10.240.0.10 -p tcp --dport 80 -m comment --comment 3f813b02-eth0",
+					target:  iptables.Masquerade,
+				},
+				{
+					version: iptables.V4,
+					chain:   iptables.CNIHostPortSnatChain,
+					match:   "-s 127.0.0.0/8 -d 10.240.0.10 -p tcp --dport 80 -m comment --comment 3f813b02-eth0",
+					target:  iptables.Masquerade,
+				},
+				{
+					version: iptables.V6,
+					chain:   iptables.CNIHostPortChain,
+					match:   "-p tcp --dport 8080 -m comment --comment 3f813b02-eth0",
+					target:  "DNAT --to-destination [fd00::a]:80",
+				},
+				{
+					version: iptables.V6,
+					chain:   iptables.CNIHostPortSnatChain,
+					match:   "-s fd00::a -d fd00::a -p tcp --dport 80 -m comment --comment 3f813b02-eth0",
+					target:  iptables.Masquerade,
+				},
+			}))
+		})
+
+		It("Should only map IP addresses in the family of the host IP", func() {
+			rules, err := getPortMappingRules("3f813b02-eth0", ipAddresses, []PortMapping{{HostPort: 5000, ContainerPort: 5000, Protocol: "SCTP", HostIP: "10.240.0.4"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(3))
+			Expect(rules[0].match).To(Equal("-d 10.240.0.4 -p sctp --dport 5000 -m comment --comment 3f813b02-eth0"))
+		})
+
+		It("Should reject unsupported protocols and invalid host IPs", func() {
+			_, err := getPortMappingRules("3f813b02-eth0", ipAddresses, []PortMapping{{HostPort: 8080, ContainerPort: 80, Protocol: "icmp"}})
+			Expect(err).To(HaveOccurred())
+			_, err = getPortMappingRules("3f813b02-eth0", ipAddresses, []PortMapping{{HostPort: 8080, ContainerPort: 80, HostIP: "invalid"}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Test setPortMappingHairpin", func() {
+		It("Should do nothing without a bridge port or port mappings", func() {
+			Expect(setPortMappingHairpin("", []PortMapping{{HostPort: 8080, ContainerPort: 80}})).To(Succeed())
+			Expect(setPortMappingHairpin("nonexistent0", nil)).To(Succeed())
+		})
+
+		It("Should fail if the bridge port does not exist", func() {
+			Expect(setPortMappingHairpin("nonexistent0", []PortMapping{{HostPort: 8080, ContainerPort: 80}})).NotTo(Succeed())
+		})
+	})
+
+	Describe("Test setPortMappingLocalnet", func() {
+		mappings := []PortMapping{{HostPort: 8080, ContainerPort: 80}}
+
+		It("Should do nothing without an interface, port mappings or IPv4 addresses", func() {
+			Expect(setPortMappingLocalnet("", ipAddresses, mappings)).To(Succeed())
+			Expect(setPortMappingLocalnet("nonexistent0", ipAddresses, nil)).To(Succeed())
+			Expect(setPortMappingLocalnet("nonexistent0", ipAddresses[1:], mappings)).To(Succeed())
+		})
+
+		It("Should fail if the interface does not exist", func() {
+			Expect(setPortMappingLocalnet("nonexistent0", ipAddresses, mappings)).NotTo(Succeed())
+		})
+	})
+})
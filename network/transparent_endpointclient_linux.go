@@ -65,6 +65,10 @@ func (client *TransparentEndpointClient) AddEndpoints(epInfo *EndpointInfo) erro
 		return err
 	}
 
+	if err := applyHostTuning(client.hostVethName, epInfo.Tuning); err != nil {
+		return err
+	}
+
 	containerIf, err := net.InterfaceByName(client.containerVethName)
 	if err != nil {
 		return err
@@ -104,7 +108,7 @@ func (client *TransparentEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		return err
 	}
 
-	return nil
+	return addBandwidthShaping(client.hostVethName, epInfo.Bandwidth)
 }
 
 func (client *TransparentEndpointClient) DeleteEndpointRules(ep *endpoint) {
@@ -184,9 +188,14 @@ func (client *TransparentEndpointClient) ConfigureContainerInterfacesAndRoutes(e
 
 	// arp -s 169.254.1.1 e3:45:f4:ac:34:12 - add static arp entry for virtualgwip to hostveth interface mac
 	log.Printf("[net] Adding static arp for IP address %v and MAC %v in Container namespace", virtualGwNet.String(), client.hostVethMac)
-	return netlink.AddOrRemoveStaticArp(netlink.ADD, client.containerVethName, virtualGwNet.IP, client.hostVethMac, false)
+	if err := netlink.AddOrRemoveStaticArp(netlink.ADD, client.containerVethName, virtualGwNet.IP, client.hostVethMac, false); err != nil {
+		return err
+	}
+
+	return applyTuning(client.containerVethName, epInfo.Tuning)
 }
 
 func (client *TransparentEndpointClient) DeleteEndpoints(ep *endpoint) error {
-	return nil
+	// The host veth is deleted with the container netns, but the IFB interface is not.
+	return deleteBandwidthShaping(ep.HostIfName)
 }
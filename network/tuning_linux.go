@@ -0,0 +1,97 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+)
+
+const (
+	// Directory of the sysctls of the current network namespace.
+	sysctlDir = "/proc/sys"
+)
+
+// getSysctlPath returns the path of the file of a sysctl, such as /proc/sys/net/core/somaxconn for net.core.somaxconn.
+func getSysctlPath(name string) string {
+	return filepath.Join(sysctlDir, strings.Replace(name, ".", "/", -1))
+}
+
+// applyTuning sets the sysctls and the settings of the container interface of the endpoint. It must be called in
+// the network namespace of the container.
+func applyTuning(ifName string, tuning *TuningInfo) error {
+	if tuning == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(tuning.Sysctls))
+	for name := range tuning.Sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.Printf("[net] Setting sysctl %v to %v.", name, tuning.Sysctls[name])
+		if err := ioutil.WriteFile(getSysctlPath(name), []byte(tuning.Sysctls[name]), 0644); err != nil {
+			log.Printf("[net] Failed to set sysctl %v: %v.", name, err)
+			return err
+		}
+	}
+
+	if tuning.MTU > 0 {
+		log.Printf("[net] Setting MTU of %v to %v.", ifName, tuning.MTU)
+		if err := netlink.SetLinkMTU(ifName, tuning.MTU); err != nil {
+			return err
+		}
+	}
+
+	if tuning.TxQueueLen > 0 {
+		log.Printf("[net] Setting transmit queue length of %v to %v.", ifName, tuning.TxQueueLen)
+		if err := netlink.SetLinkTxQueueLen(ifName, tuning.TxQueueLen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// capTuningMTU returns the tuning with its MTU capped at the MTU of the host interface of the network.
+func capTuningMTU(tuning *TuningInfo, extIfName string) (*TuningInfo, error) {
+	if tuning == nil || tuning.MTU <= 0 {
+		return tuning, nil
+	}
+
+	extIf, err := net.InterfaceByName(extIfName)
+	if err != nil {
+		return nil, err
+	}
+
+	if tuning.MTU <= extIf.MTU {
+		return tuning, nil
+	}
+
+	log.Printf("[net] Capping MTU %v at the MTU %v of host interface %v.", tuning.MTU, extIf.MTU, extIfName)
+	capped := *tuning
+	capped.MTU = extIf.MTU
+	return &capped, nil
+}
+
+// applyHostTuning sets the MTU of the tuning on the host veth of the endpoint, so that the host end of the veth pair
+// does not drop the packets the container interface sends and receives. It must be called in the host namespace, and
+// only for host veths which are routed. Bridges lower their MTU to the smallest MTU of their ports, so the MTU of
+// bridged host veths is not changed.
+func applyHostTuning(hostIfName string, tuning *TuningInfo) error {
+	if tuning == nil || tuning.MTU <= 0 {
+		return nil
+	}
+
+	log.Printf("[net] Setting MTU of %v to %v.", hostIfName, tuning.MTU)
+	return netlink.SetLinkMTU(hostIfName, tuning.MTU)
+}
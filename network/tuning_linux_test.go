@@ -0,0 +1,63 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test tuning", func() {
+
+	Describe("Test getSysctlPath", func() {
+		It("Should map the sysctl name to its file in /proc/sys", func() {
+			Expect(getSysctlPath("net.ipv4.tcp_keepalive_time")).To(Equal("/proc/sys/net/ipv4/tcp_keepalive_time"))
+		})
+	})
+
+	Describe("Test applyTuning", func() {
+		It("Should do nothing without tuning", func() {
+			Expect(applyTuning("nonexistent0", nil)).To(Succeed())
+			Expect(applyTuning("nonexistent0", &TuningInfo{})).To(Succeed())
+		})
+
+		It("Should fail if the container interface does not exist", func() {
+			Expect(applyTuning("nonexistent0", &TuningInfo{MTU: 1400})).NotTo(Succeed())
+		})
+	})
+
+	Describe("Test capTuningMTU", func() {
+		It("Should cap the MTU at the MTU of the host interface", func() {
+			lo, err := net.InterfaceByName("lo")
+			Expect(err).NotTo(HaveOccurred())
+
+			tuning := &TuningInfo{MTU: lo.MTU + 1, TxQueueLen: 500}
+			capped, err := capTuningMTU(tuning, "lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capped).To(Equal(&TuningInfo{MTU: lo.MTU, TxQueueLen: 500}))
+			Expect(tuning.MTU).To(Equal(lo.MTU+1), "the tuning of the caller is not changed")
+
+			capped, err = capTuningMTU(&TuningInfo{MTU: 1400}, "lo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(capped.MTU).To(Equal(1400))
+		})
+
+		It("Should do nothing without an MTU", func() {
+			Expect(capTuningMTU(nil, "nonexistent0")).To(BeNil())
+		})
+	})
+
+	Describe("Test applyHostTuning", func() {
+		It("Should do nothing without an MTU", func() {
+			Expect(applyHostTuning("nonexistent0", nil)).To(Succeed())
+			Expect(applyHostTuning("nonexistent0", &TuningInfo{TxQueueLen: 500})).To(Succeed())
+		})
+
+		It("Should fail if the host veth does not exist", func() {
+			Expect(applyHostTuning("nonexistent0", &TuningInfo{MTU: 1400})).NotTo(Succeed())
+		})
+	})
+})
@@ -163,3 +163,14 @@ func PrintDependencyPackageDetails() {
 func ReplaceFile(source, destination string) error {
 	return os.Rename(source, destination)
 }
+
+// SyncDir flushes the entries of the directory, so that files renamed into it persist across a crash.
+func SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
@@ -0,0 +1,2199 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        (unknown)
+// source: cns.proto
+
+package cnsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Response struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ReturnCode int32  `protobuf:"varint,1,opt,name=return_code,json=returnCode,proto3" json:"return_code,omitempty"`
+	Message    string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Response) GetReturnCode() int32 {
+	if x != nil {
+		return x.ReturnCode
+	}
+	return 0
+}
+
+func (x *Response) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type IPSubnet struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpAddress    string `protobuf:"bytes,1,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	PrefixLength uint32 `protobuf:"varint,2,opt,name=prefix_length,json=prefixLength,proto3" json:"prefix_length,omitempty"`
+}
+
+func (x *IPSubnet) Reset() {
+	*x = IPSubnet{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPSubnet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPSubnet) ProtoMessage() {}
+
+func (x *IPSubnet) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPSubnet.ProtoReflect.Descriptor instead.
+func (*IPSubnet) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *IPSubnet) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *IPSubnet) GetPrefixLength() uint32 {
+	if x != nil {
+		return x.PrefixLength
+	}
+	return 0
+}
+
+type IPConfiguration struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpSubnet         *IPSubnet `protobuf:"bytes,1,opt,name=ip_subnet,json=ipSubnet,proto3" json:"ip_subnet,omitempty"`
+	DnsServers       []string  `protobuf:"bytes,2,rep,name=dns_servers,json=dnsServers,proto3" json:"dns_servers,omitempty"`
+	GatewayIpAddress string    `protobuf:"bytes,3,opt,name=gateway_ip_address,json=gatewayIpAddress,proto3" json:"gateway_ip_address,omitempty"`
+}
+
+func (x *IPConfiguration) Reset() {
+	*x = IPConfiguration{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPConfiguration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPConfiguration) ProtoMessage() {}
+
+func (x *IPConfiguration) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPConfiguration.ProtoReflect.Descriptor instead.
+func (*IPConfiguration) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IPConfiguration) GetIpSubnet() *IPSubnet {
+	if x != nil {
+		return x.IpSubnet
+	}
+	return nil
+}
+
+func (x *IPConfiguration) GetDnsServers() []string {
+	if x != nil {
+		return x.DnsServers
+	}
+	return nil
+}
+
+func (x *IPConfiguration) GetGatewayIpAddress() string {
+	if x != nil {
+		return x.GatewayIpAddress
+	}
+	return ""
+}
+
+type HostIPInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Gateway   string `protobuf:"bytes,1,opt,name=gateway,proto3" json:"gateway,omitempty"`
+	PrimaryIp string `protobuf:"bytes,2,opt,name=primary_ip,json=primaryIp,proto3" json:"primary_ip,omitempty"`
+	Subnet    string `protobuf:"bytes,3,opt,name=subnet,proto3" json:"subnet,omitempty"`
+}
+
+func (x *HostIPInfo) Reset() {
+	*x = HostIPInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HostIPInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HostIPInfo) ProtoMessage() {}
+
+func (x *HostIPInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HostIPInfo.ProtoReflect.Descriptor instead.
+func (*HostIPInfo) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *HostIPInfo) GetGateway() string {
+	if x != nil {
+		return x.Gateway
+	}
+	return ""
+}
+
+func (x *HostIPInfo) GetPrimaryIp() string {
+	if x != nil {
+		return x.PrimaryIp
+	}
+	return ""
+}
+
+func (x *HostIPInfo) GetSubnet() string {
+	if x != nil {
+		return x.Subnet
+	}
+	return ""
+}
+
+type PodIPInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PodIpConfig                     *IPSubnet        `protobuf:"bytes,1,opt,name=pod_ip_config,json=podIpConfig,proto3" json:"pod_ip_config,omitempty"`
+	NetworkContainerPrimaryIpConfig *IPConfiguration `protobuf:"bytes,2,opt,name=network_container_primary_ip_config,json=networkContainerPrimaryIpConfig,proto3" json:"network_container_primary_ip_config,omitempty"`
+	HostPrimaryIpInfo               *HostIPInfo      `protobuf:"bytes,3,opt,name=host_primary_ip_info,json=hostPrimaryIpInfo,proto3" json:"host_primary_ip_info,omitempty"`
+}
+
+func (x *PodIPInfo) Reset() {
+	*x = PodIPInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodIPInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodIPInfo) ProtoMessage() {}
+
+func (x *PodIPInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodIPInfo.ProtoReflect.Descriptor instead.
+func (*PodIPInfo) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PodIPInfo) GetPodIpConfig() *IPSubnet {
+	if x != nil {
+		return x.PodIpConfig
+	}
+	return nil
+}
+
+func (x *PodIPInfo) GetNetworkContainerPrimaryIpConfig() *IPConfiguration {
+	if x != nil {
+		return x.NetworkContainerPrimaryIpConfig
+	}
+	return nil
+}
+
+func (x *PodIPInfo) GetHostPrimaryIpInfo() *HostIPInfo {
+	if x != nil {
+		return x.HostPrimaryIpInfo
+	}
+	return nil
+}
+
+type IPConfigRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	DesiredIpAddress string `protobuf:"bytes,1,opt,name=desired_ip_address,json=desiredIpAddress,proto3" json:"desired_ip_address,omitempty"`
+	PodInterfaceId   string `protobuf:"bytes,2,opt,name=pod_interface_id,json=podInterfaceId,proto3" json:"pod_interface_id,omitempty"`
+	InfraContainerId string `protobuf:"bytes,3,opt,name=infra_container_id,json=infraContainerId,proto3" json:"infra_container_id,omitempty"`
+	// JSON KubernetesPodInfo
+	OrchestratorContext []byte `protobuf:"bytes,4,opt,name=orchestrator_context,json=orchestratorContext,proto3" json:"orchestrator_context,omitempty"`
+}
+
+func (x *IPConfigRequest) Reset() {
+	*x = IPConfigRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPConfigRequest) ProtoMessage() {}
+
+func (x *IPConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPConfigRequest.ProtoReflect.Descriptor instead.
+func (*IPConfigRequest) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *IPConfigRequest) GetDesiredIpAddress() string {
+	if x != nil {
+		return x.DesiredIpAddress
+	}
+	return ""
+}
+
+func (x *IPConfigRequest) GetPodInterfaceId() string {
+	if x != nil {
+		return x.PodInterfaceId
+	}
+	return ""
+}
+
+func (x *IPConfigRequest) GetInfraContainerId() string {
+	if x != nil {
+		return x.InfraContainerId
+	}
+	return ""
+}
+
+func (x *IPConfigRequest) GetOrchestratorContext() []byte {
+	if x != nil {
+		return x.OrchestratorContext
+	}
+	return nil
+}
+
+type IPConfigResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// one entry per address family allocated to the pod, IPv4 first
+	PodIpInfoList []*PodIPInfo `protobuf:"bytes,1,rep,name=pod_ip_info_list,json=podIpInfoList,proto3" json:"pod_ip_info_list,omitempty"`
+	Response      *Response    `protobuf:"bytes,2,opt,name=response,proto3" json:"response,omitempty"`
+	// how long to wait before retrying a request which failed with a retriable code
+	RetryAfterMs int32 `protobuf:"varint,3,opt,name=retry_after_ms,json=retryAfterMs,proto3" json:"retry_after_ms,omitempty"`
+}
+
+func (x *IPConfigResponse) Reset() {
+	*x = IPConfigResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPConfigResponse) ProtoMessage() {}
+
+func (x *IPConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPConfigResponse.ProtoReflect.Descriptor instead.
+func (*IPConfigResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *IPConfigResponse) GetPodIpInfoList() []*PodIPInfo {
+	if x != nil {
+		return x.PodIpInfoList
+	}
+	return nil
+}
+
+func (x *IPConfigResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *IPConfigResponse) GetRetryAfterMs() int32 {
+	if x != nil {
+		return x.RetryAfterMs
+	}
+	return 0
+}
+
+type ReleaseIPAddressResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response *Response `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+}
+
+func (x *ReleaseIPAddressResponse) Reset() {
+	*x = ReleaseIPAddressResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReleaseIPAddressResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseIPAddressResponse) ProtoMessage() {}
+
+func (x *ReleaseIPAddressResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseIPAddressResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseIPAddressResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ReleaseIPAddressResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+type GetIPAddressesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpConfigStateFilter []string `protobuf:"bytes,1,rep,name=ip_config_state_filter,json=ipConfigStateFilter,proto3" json:"ip_config_state_filter,omitempty"`
+}
+
+func (x *GetIPAddressesRequest) Reset() {
+	*x = GetIPAddressesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetIPAddressesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetIPAddressesRequest) ProtoMessage() {}
+
+func (x *GetIPAddressesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetIPAddressesRequest.ProtoReflect.Descriptor instead.
+func (*GetIPAddressesRequest) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetIPAddressesRequest) GetIpConfigStateFilter() []string {
+	if x != nil {
+		return x.IpConfigStateFilter
+	}
+	return nil
+}
+
+type PodInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InfraContainerId string `protobuf:"bytes,1,opt,name=infra_container_id,json=infraContainerId,proto3" json:"infra_container_id,omitempty"`
+	InterfaceId      string `protobuf:"bytes,2,opt,name=interface_id,json=interfaceId,proto3" json:"interface_id,omitempty"`
+	// JSON KubernetesPodInfo
+	OrchestratorContext []byte `protobuf:"bytes,3,opt,name=orchestrator_context,json=orchestratorContext,proto3" json:"orchestrator_context,omitempty"`
+}
+
+func (x *PodInfo) Reset() {
+	*x = PodInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodInfo) ProtoMessage() {}
+
+func (x *PodInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodInfo.ProtoReflect.Descriptor instead.
+func (*PodInfo) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *PodInfo) GetInfraContainerId() string {
+	if x != nil {
+		return x.InfraContainerId
+	}
+	return ""
+}
+
+func (x *PodInfo) GetInterfaceId() string {
+	if x != nil {
+		return x.InterfaceId
+	}
+	return ""
+}
+
+func (x *PodInfo) GetOrchestratorContext() []byte {
+	if x != nil {
+		return x.OrchestratorContext
+	}
+	return nil
+}
+
+type IPConfigurationStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NcId      string `protobuf:"bytes,1,opt,name=nc_id,json=ncId,proto3" json:"nc_id,omitempty"`
+	Id        string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	IpAddress string `protobuf:"bytes,3,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	State     string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// unset if the IP is not allocated to a pod
+	PodInfo           *PodInfo               `protobuf:"bytes,5,opt,name=pod_info,json=podInfo,proto3" json:"pod_info,omitempty"`
+	CooldownStartTime *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=cooldown_start_time,json=cooldownStartTime,proto3" json:"cooldown_start_time,omitempty"`
+	// when the IP entered its current state
+	LastStateTransitionTime *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=last_state_transition_time,json=lastStateTransitionTime,proto3" json:"last_state_transition_time,omitempty"`
+}
+
+func (x *IPConfigurationStatus) Reset() {
+	*x = IPConfigurationStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IPConfigurationStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IPConfigurationStatus) ProtoMessage() {}
+
+func (x *IPConfigurationStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IPConfigurationStatus.ProtoReflect.Descriptor instead.
+func (*IPConfigurationStatus) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IPConfigurationStatus) GetNcId() string {
+	if x != nil {
+		return x.NcId
+	}
+	return ""
+}
+
+func (x *IPConfigurationStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IPConfigurationStatus) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *IPConfigurationStatus) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *IPConfigurationStatus) GetPodInfo() *PodInfo {
+	if x != nil {
+		return x.PodInfo
+	}
+	return nil
+}
+
+func (x *IPConfigurationStatus) GetCooldownStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CooldownStartTime
+	}
+	return nil
+}
+
+func (x *IPConfigurationStatus) GetLastStateTransitionTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastStateTransitionTime
+	}
+	return nil
+}
+
+type GetIPAddressesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpConfigurationStatus []*IPConfigurationStatus `protobuf:"bytes,1,rep,name=ip_configuration_status,json=ipConfigurationStatus,proto3" json:"ip_configuration_status,omitempty"`
+	Response              *Response                `protobuf:"bytes,2,opt,name=response,proto3" json:"response,omitempty"`
+}
+
+func (x *GetIPAddressesResponse) Reset() {
+	*x = GetIPAddressesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetIPAddressesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetIPAddressesResponse) ProtoMessage() {}
+
+func (x *GetIPAddressesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetIPAddressesResponse.ProtoReflect.Descriptor instead.
+func (*GetIPAddressesResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetIPAddressesResponse) GetIpConfigurationStatus() []*IPConfigurationStatus {
+	if x != nil {
+		return x.IpConfigurationStatus
+	}
+	return nil
+}
+
+func (x *GetIPAddressesResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+type SecondaryIPConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpAddress string `protobuf:"bytes,1,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	NcVersion int64  `protobuf:"varint,2,opt,name=nc_version,json=ncVersion,proto3" json:"nc_version,omitempty"`
+}
+
+func (x *SecondaryIPConfig) Reset() {
+	*x = SecondaryIPConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SecondaryIPConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SecondaryIPConfig) ProtoMessage() {}
+
+func (x *SecondaryIPConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SecondaryIPConfig.ProtoReflect.Descriptor instead.
+func (*SecondaryIPConfig) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SecondaryIPConfig) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *SecondaryIPConfig) GetNcVersion() int64 {
+	if x != nil {
+		return x.NcVersion
+	}
+	return 0
+}
+
+type MultiTenancyInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	EncapType string `protobuf:"bytes,1,opt,name=encap_type,json=encapType,proto3" json:"encap_type,omitempty"`
+	Id        int64  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *MultiTenancyInfo) Reset() {
+	*x = MultiTenancyInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MultiTenancyInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiTenancyInfo) ProtoMessage() {}
+
+func (x *MultiTenancyInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiTenancyInfo.ProtoReflect.Descriptor instead.
+func (*MultiTenancyInfo) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *MultiTenancyInfo) GetEncapType() string {
+	if x != nil {
+		return x.EncapType
+	}
+	return ""
+}
+
+func (x *MultiTenancyInfo) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type Route struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IpAddress        string `protobuf:"bytes,1,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	GatewayIpAddress string `protobuf:"bytes,2,opt,name=gateway_ip_address,json=gatewayIpAddress,proto3" json:"gateway_ip_address,omitempty"`
+	InterfaceToUse   string `protobuf:"bytes,3,opt,name=interface_to_use,json=interfaceToUse,proto3" json:"interface_to_use,omitempty"`
+}
+
+func (x *Route) Reset() {
+	*x = Route{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Route) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Route) ProtoMessage() {}
+
+func (x *Route) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Route.ProtoReflect.Descriptor instead.
+func (*Route) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Route) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *Route) GetGatewayIpAddress() string {
+	if x != nil {
+		return x.GatewayIpAddress
+	}
+	return ""
+}
+
+func (x *Route) GetInterfaceToUse() string {
+	if x != nil {
+		return x.InterfaceToUse
+	}
+	return ""
+}
+
+type NetworkContainerRequestPolicies struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type         string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	EndpointType string `protobuf:"bytes,2,opt,name=endpoint_type,json=endpointType,proto3" json:"endpoint_type,omitempty"`
+	Settings     []byte `protobuf:"bytes,3,opt,name=settings,proto3" json:"settings,omitempty"`
+}
+
+func (x *NetworkContainerRequestPolicies) Reset() {
+	*x = NetworkContainerRequestPolicies{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NetworkContainerRequestPolicies) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NetworkContainerRequestPolicies) ProtoMessage() {}
+
+func (x *NetworkContainerRequestPolicies) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NetworkContainerRequestPolicies.ProtoReflect.Descriptor instead.
+func (*NetworkContainerRequestPolicies) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *NetworkContainerRequestPolicies) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *NetworkContainerRequestPolicies) GetEndpointType() string {
+	if x != nil {
+		return x.EndpointType
+	}
+	return ""
+}
+
+func (x *NetworkContainerRequestPolicies) GetSettings() []byte {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+type CreateNetworkContainerRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version                    string           `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	NetworkContainerType       string           `protobuf:"bytes,2,opt,name=network_container_type,json=networkContainerType,proto3" json:"network_container_type,omitempty"`
+	NetworkContainerId         string           `protobuf:"bytes,3,opt,name=network_container_id,json=networkContainerId,proto3" json:"network_container_id,omitempty"`
+	PrimaryInterfaceIdentifier string           `protobuf:"bytes,4,opt,name=primary_interface_identifier,json=primaryInterfaceIdentifier,proto3" json:"primary_interface_identifier,omitempty"`
+	AuthorizationToken         string           `protobuf:"bytes,5,opt,name=authorization_token,json=authorizationToken,proto3" json:"authorization_token,omitempty"`
+	LocalIpConfiguration       *IPConfiguration `protobuf:"bytes,6,opt,name=local_ip_configuration,json=localIpConfiguration,proto3" json:"local_ip_configuration,omitempty"`
+	OrchestratorContext        []byte           `protobuf:"bytes,7,opt,name=orchestrator_context,json=orchestratorContext,proto3" json:"orchestrator_context,omitempty"`
+	IpConfiguration            *IPConfiguration `protobuf:"bytes,8,opt,name=ip_configuration,json=ipConfiguration,proto3" json:"ip_configuration,omitempty"`
+	// keyed by secondary IP ID (uuid)
+	SecondaryIpConfigs         map[string]*SecondaryIPConfig      `protobuf:"bytes,9,rep,name=secondary_ip_configs,json=secondaryIpConfigs,proto3" json:"secondary_ip_configs,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	MultiTenancyInfo           *MultiTenancyInfo                  `protobuf:"bytes,10,opt,name=multi_tenancy_info,json=multiTenancyInfo,proto3" json:"multi_tenancy_info,omitempty"`
+	CnetAddressSpace           []*IPSubnet                        `protobuf:"bytes,11,rep,name=cnet_address_space,json=cnetAddressSpace,proto3" json:"cnet_address_space,omitempty"`
+	Routes                     []*Route                           `protobuf:"bytes,12,rep,name=routes,proto3" json:"routes,omitempty"`
+	AllowHostToNcCommunication bool                               `protobuf:"varint,13,opt,name=allow_host_to_nc_communication,json=allowHostToNcCommunication,proto3" json:"allow_host_to_nc_communication,omitempty"`
+	AllowNcToHostCommunication bool                               `protobuf:"varint,14,opt,name=allow_nc_to_host_communication,json=allowNcToHostCommunication,proto3" json:"allow_nc_to_host_communication,omitempty"`
+	EndpointPolicies           []*NetworkContainerRequestPolicies `protobuf:"bytes,15,rep,name=endpoint_policies,json=endpointPolicies,proto3" json:"endpoint_policies,omitempty"`
+	SubnetName                 string                             `protobuf:"bytes,16,opt,name=subnet_name,json=subnetName,proto3" json:"subnet_name,omitempty"`
+}
+
+func (x *CreateNetworkContainerRequest) Reset() {
+	*x = CreateNetworkContainerRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateNetworkContainerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateNetworkContainerRequest) ProtoMessage() {}
+
+func (x *CreateNetworkContainerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateNetworkContainerRequest.ProtoReflect.Descriptor instead.
+func (*CreateNetworkContainerRequest) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CreateNetworkContainerRequest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *CreateNetworkContainerRequest) GetNetworkContainerType() string {
+	if x != nil {
+		return x.NetworkContainerType
+	}
+	return ""
+}
+
+func (x *CreateNetworkContainerRequest) GetNetworkContainerId() string {
+	if x != nil {
+		return x.NetworkContainerId
+	}
+	return ""
+}
+
+func (x *CreateNetworkContainerRequest) GetPrimaryInterfaceIdentifier() string {
+	if x != nil {
+		return x.PrimaryInterfaceIdentifier
+	}
+	return ""
+}
+
+func (x *CreateNetworkContainerRequest) GetAuthorizationToken() string {
+	if x != nil {
+		return x.AuthorizationToken
+	}
+	return ""
+}
+
+func (x *CreateNetworkContainerRequest) GetLocalIpConfiguration() *IPConfiguration {
+	if x != nil {
+		return x.LocalIpConfiguration
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetOrchestratorContext() []byte {
+	if x != nil {
+		return x.OrchestratorContext
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetIpConfiguration() *IPConfiguration {
+	if x != nil {
+		return x.IpConfiguration
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetSecondaryIpConfigs() map[string]*SecondaryIPConfig {
+	if x != nil {
+		return x.SecondaryIpConfigs
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetMultiTenancyInfo() *MultiTenancyInfo {
+	if x != nil {
+		return x.MultiTenancyInfo
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetCnetAddressSpace() []*IPSubnet {
+	if x != nil {
+		return x.CnetAddressSpace
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetRoutes() []*Route {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetAllowHostToNcCommunication() bool {
+	if x != nil {
+		return x.AllowHostToNcCommunication
+	}
+	return false
+}
+
+func (x *CreateNetworkContainerRequest) GetAllowNcToHostCommunication() bool {
+	if x != nil {
+		return x.AllowNcToHostCommunication
+	}
+	return false
+}
+
+func (x *CreateNetworkContainerRequest) GetEndpointPolicies() []*NetworkContainerRequestPolicies {
+	if x != nil {
+		return x.EndpointPolicies
+	}
+	return nil
+}
+
+func (x *CreateNetworkContainerRequest) GetSubnetName() string {
+	if x != nil {
+		return x.SubnetName
+	}
+	return ""
+}
+
+type CreateNetworkContainerResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response *Response `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+}
+
+func (x *CreateNetworkContainerResponse) Reset() {
+	*x = CreateNetworkContainerResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateNetworkContainerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateNetworkContainerResponse) ProtoMessage() {}
+
+func (x *CreateNetworkContainerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateNetworkContainerResponse.ProtoReflect.Descriptor instead.
+func (*CreateNetworkContainerResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CreateNetworkContainerResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+type GetNetworkContainerRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NetworkContainerId  string `protobuf:"bytes,1,opt,name=network_container_id,json=networkContainerId,proto3" json:"network_container_id,omitempty"`
+	OrchestratorContext []byte `protobuf:"bytes,2,opt,name=orchestrator_context,json=orchestratorContext,proto3" json:"orchestrator_context,omitempty"`
+}
+
+func (x *GetNetworkContainerRequest) Reset() {
+	*x = GetNetworkContainerRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetNetworkContainerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetNetworkContainerRequest) ProtoMessage() {}
+
+func (x *GetNetworkContainerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetNetworkContainerRequest.ProtoReflect.Descriptor instead.
+func (*GetNetworkContainerRequest) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *GetNetworkContainerRequest) GetNetworkContainerId() string {
+	if x != nil {
+		return x.NetworkContainerId
+	}
+	return ""
+}
+
+func (x *GetNetworkContainerRequest) GetOrchestratorContext() []byte {
+	if x != nil {
+		return x.OrchestratorContext
+	}
+	return nil
+}
+
+type GetNetworkContainerResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NetworkContainerId         string            `protobuf:"bytes,1,opt,name=network_container_id,json=networkContainerId,proto3" json:"network_container_id,omitempty"`
+	IpConfiguration            *IPConfiguration  `protobuf:"bytes,2,opt,name=ip_configuration,json=ipConfiguration,proto3" json:"ip_configuration,omitempty"`
+	Routes                     []*Route          `protobuf:"bytes,3,rep,name=routes,proto3" json:"routes,omitempty"`
+	CnetAddressSpace           []*IPSubnet       `protobuf:"bytes,4,rep,name=cnet_address_space,json=cnetAddressSpace,proto3" json:"cnet_address_space,omitempty"`
+	MultiTenancyInfo           *MultiTenancyInfo `protobuf:"bytes,5,opt,name=multi_tenancy_info,json=multiTenancyInfo,proto3" json:"multi_tenancy_info,omitempty"`
+	PrimaryInterfaceIdentifier string            `protobuf:"bytes,6,opt,name=primary_interface_identifier,json=primaryInterfaceIdentifier,proto3" json:"primary_interface_identifier,omitempty"`
+	LocalIpConfiguration       *IPConfiguration  `protobuf:"bytes,7,opt,name=local_ip_configuration,json=localIpConfiguration,proto3" json:"local_ip_configuration,omitempty"`
+	Response                   *Response         `protobuf:"bytes,8,opt,name=response,proto3" json:"response,omitempty"`
+	AllowHostToNcCommunication bool              `protobuf:"varint,9,opt,name=allow_host_to_nc_communication,json=allowHostToNcCommunication,proto3" json:"allow_host_to_nc_communication,omitempty"`
+	AllowNcToHostCommunication bool              `protobuf:"varint,10,opt,name=allow_nc_to_host_communication,json=allowNcToHostCommunication,proto3" json:"allow_nc_to_host_communication,omitempty"`
+}
+
+func (x *GetNetworkContainerResponse) Reset() {
+	*x = GetNetworkContainerResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetNetworkContainerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetNetworkContainerResponse) ProtoMessage() {}
+
+func (x *GetNetworkContainerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetNetworkContainerResponse.ProtoReflect.Descriptor instead.
+func (*GetNetworkContainerResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *GetNetworkContainerResponse) GetNetworkContainerId() string {
+	if x != nil {
+		return x.NetworkContainerId
+	}
+	return ""
+}
+
+func (x *GetNetworkContainerResponse) GetIpConfiguration() *IPConfiguration {
+	if x != nil {
+		return x.IpConfiguration
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetRoutes() []*Route {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetCnetAddressSpace() []*IPSubnet {
+	if x != nil {
+		return x.CnetAddressSpace
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetMultiTenancyInfo() *MultiTenancyInfo {
+	if x != nil {
+		return x.MultiTenancyInfo
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetPrimaryInterfaceIdentifier() string {
+	if x != nil {
+		return x.PrimaryInterfaceIdentifier
+	}
+	return ""
+}
+
+func (x *GetNetworkContainerResponse) GetLocalIpConfiguration() *IPConfiguration {
+	if x != nil {
+		return x.LocalIpConfiguration
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *GetNetworkContainerResponse) GetAllowHostToNcCommunication() bool {
+	if x != nil {
+		return x.AllowHostToNcCommunication
+	}
+	return false
+}
+
+func (x *GetNetworkContainerResponse) GetAllowNcToHostCommunication() bool {
+	if x != nil {
+		return x.AllowNcToHostCommunication
+	}
+	return false
+}
+
+type DeleteNetworkContainerRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NetworkContainerId string `protobuf:"bytes,1,opt,name=network_container_id,json=networkContainerId,proto3" json:"network_container_id,omitempty"`
+}
+
+func (x *DeleteNetworkContainerRequest) Reset() {
+	*x = DeleteNetworkContainerRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteNetworkContainerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteNetworkContainerRequest) ProtoMessage() {}
+
+func (x *DeleteNetworkContainerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteNetworkContainerRequest.ProtoReflect.Descriptor instead.
+func (*DeleteNetworkContainerRequest) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *DeleteNetworkContainerRequest) GetNetworkContainerId() string {
+	if x != nil {
+		return x.NetworkContainerId
+	}
+	return ""
+}
+
+type DeleteNetworkContainerResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response *Response `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+}
+
+func (x *DeleteNetworkContainerResponse) Reset() {
+	*x = DeleteNetworkContainerResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cns_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteNetworkContainerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteNetworkContainerResponse) ProtoMessage() {}
+
+func (x *DeleteNetworkContainerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cns_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteNetworkContainerResponse.ProtoReflect.Descriptor instead.
+func (*DeleteNetworkContainerResponse) Descriptor() ([]byte, []int) {
+	return file_cns_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *DeleteNetworkContainerResponse) GetResponse() *Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+var File_cns_proto protoreflect.FileDescriptor
+
+var file_cns_proto_rawDesc = []byte{
+	0x0a, 0x09, 0x63, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c, 0x61, 0x7a, 0x75,
+	0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x45, 0x0a, 0x08, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e,
+	0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x72, 0x65, 0x74,
+	0x75, 0x72, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x22, 0x4e, 0x0a, 0x08, 0x49, 0x50, 0x53, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x12, 0x1d, 0x0a,
+	0x0a, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x23, 0x0a, 0x0d,
+	0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0c, 0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x4c, 0x65, 0x6e, 0x67, 0x74,
+	0x68, 0x22, 0x95, 0x01, 0x0a, 0x0f, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x33, 0x0a, 0x09, 0x69, 0x70, 0x5f, 0x73, 0x75, 0x62, 0x6e,
+	0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65,
+	0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x75, 0x62, 0x6e, 0x65, 0x74,
+	0x52, 0x08, 0x69, 0x70, 0x53, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x6e,
+	0x73, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x0a, 0x64, 0x6e, 0x73, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x12, 0x2c, 0x0a, 0x12, 0x67,
+	0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x5f, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x67, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79,
+	0x49, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x22, 0x5d, 0x0a, 0x0a, 0x48, 0x6f, 0x73,
+	0x74, 0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x18, 0x0a, 0x07, 0x67, 0x61, 0x74, 0x65, 0x77,
+	0x61, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x67, 0x61, 0x74, 0x65, 0x77, 0x61,
+	0x79, 0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x5f, 0x69, 0x70, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x49, 0x70,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x73, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x22, 0xff, 0x01, 0x0a, 0x09, 0x50, 0x6f, 0x64,
+	0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x3a, 0x0a, 0x0d, 0x70, 0x6f, 0x64, 0x5f, 0x69, 0x70,
+	0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53,
+	0x75, 0x62, 0x6e, 0x65, 0x74, 0x52, 0x0b, 0x70, 0x6f, 0x64, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x12, 0x6b, 0x0a, 0x23, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x63, 0x6f,
+	0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x5f,
+	0x69, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49,
+	0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x1f,
+	0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x50, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12,
+	0x49, 0x0a, 0x14, 0x68, 0x6f, 0x73, 0x74, 0x5f, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x5f,
+	0x69, 0x70, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x6f, 0x73,
+	0x74, 0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x11, 0x68, 0x6f, 0x73, 0x74, 0x50, 0x72, 0x69,
+	0x6d, 0x61, 0x72, 0x79, 0x49, 0x70, 0x49, 0x6e, 0x66, 0x6f, 0x22, 0xca, 0x01, 0x0a, 0x0f, 0x49,
+	0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2c,
+	0x0a, 0x12, 0x64, 0x65, 0x73, 0x69, 0x72, 0x65, 0x64, 0x5f, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x64, 0x65, 0x73, 0x69,
+	0x72, 0x65, 0x64, 0x49, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x28, 0x0a, 0x10,
+	0x70, 0x6f, 0x64, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x70, 0x6f, 0x64, 0x49, 0x6e, 0x74, 0x65, 0x72,
+	0x66, 0x61, 0x63, 0x65, 0x49, 0x64, 0x12, 0x2c, 0x0a, 0x12, 0x69, 0x6e, 0x66, 0x72, 0x61, 0x5f,
+	0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x10, 0x69, 0x6e, 0x66, 0x72, 0x61, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e,
+	0x65, 0x72, 0x49, 0x64, 0x12, 0x31, 0x0a, 0x14, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72,
+	0x61, 0x74, 0x6f, 0x72, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x13, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72,
+	0x43, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x22, 0xae, 0x01, 0x0a, 0x10, 0x49, 0x50, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x40, 0x0a, 0x10,
+	0x70, 0x6f, 0x64, 0x5f, 0x69, 0x70, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x5f, 0x6c, 0x69, 0x73, 0x74,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63,
+	0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x64, 0x49, 0x50, 0x49, 0x6e, 0x66, 0x6f, 0x52,
+	0x0d, 0x70, 0x6f, 0x64, 0x49, 0x70, 0x49, 0x6e, 0x66, 0x6f, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x32,
+	0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x72, 0x65, 0x74, 0x72, 0x79, 0x5f, 0x61, 0x66, 0x74, 0x65,
+	0x72, 0x5f, 0x6d, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x72, 0x65, 0x74, 0x72,
+	0x79, 0x41, 0x66, 0x74, 0x65, 0x72, 0x4d, 0x73, 0x22, 0x4e, 0x0a, 0x18, 0x52, 0x65, 0x6c, 0x65,
+	0x61, 0x73, 0x65, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63,
+	0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x08,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x4c, 0x0a, 0x15, 0x47, 0x65, 0x74, 0x49,
+	0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x33, 0x0a, 0x16, 0x69, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x5f, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x5f, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x13, 0x69, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x22, 0x8d, 0x01, 0x0a, 0x07, 0x50, 0x6f, 0x64, 0x49, 0x6e,
+	0x66, 0x6f, 0x12, 0x2c, 0x0a, 0x12, 0x69, 0x6e, 0x66, 0x72, 0x61, 0x5f, 0x63, 0x6f, 0x6e, 0x74,
+	0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10,
+	0x69, 0x6e, 0x66, 0x72, 0x61, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x64,
+	0x12, 0x21, 0x0a, 0x0c, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63,
+	0x65, 0x49, 0x64, 0x12, 0x31, 0x0a, 0x14, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61,
+	0x74, 0x6f, 0x72, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x13, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x43,
+	0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x22, 0xc8, 0x02, 0x0a, 0x15, 0x49, 0x50, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x13, 0x0a, 0x05, 0x6e, 0x63, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x63, 0x49, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72,
+	0x65, 0x73, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x30, 0x0a, 0x08, 0x70, 0x6f,
+	0x64, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61,
+	0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x64, 0x49,
+	0x6e, 0x66, 0x6f, 0x52, 0x07, 0x70, 0x6f, 0x64, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x4a, 0x0a, 0x13,
+	0x63, 0x6f, 0x6f, 0x6c, 0x64, 0x6f, 0x77, 0x6e, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x74,
+	0x69, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x11, 0x63, 0x6f, 0x6f, 0x6c, 0x64, 0x6f, 0x77, 0x6e, 0x53,
+	0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x57, 0x0a, 0x1a, 0x6c, 0x61, 0x73, 0x74,
+	0x5f, 0x73, 0x74, 0x61, 0x74, 0x65, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x6f,
+	0x6e, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x17, 0x6c, 0x61, 0x73, 0x74, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d,
+	0x65, 0x22, 0xa9, 0x01, 0x0a, 0x16, 0x47, 0x65, 0x74, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65,
+	0x73, 0x73, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x5b, 0x0a, 0x17,
+	0x69, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x52, 0x15, 0x69, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x32, 0x0a, 0x08, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a,
+	0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x51, 0x0a,
+	0x11, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6e, 0x63, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x6e, 0x63, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x22, 0x41, 0x0a, 0x10, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x79,
+	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1d, 0x0a, 0x0a, 0x65, 0x6e, 0x63, 0x61, 0x70, 0x5f, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x65, 0x6e, 0x63, 0x61, 0x70, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x02, 0x69, 0x64, 0x22, 0x7e, 0x0a, 0x05, 0x52, 0x6f, 0x75, 0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a,
+	0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x2c, 0x0a, 0x12, 0x67,
+	0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x5f, 0x69, 0x70, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x67, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79,
+	0x49, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x28, 0x0a, 0x10, 0x69, 0x6e, 0x74,
+	0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x5f, 0x74, 0x6f, 0x5f, 0x75, 0x73, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x54, 0x6f,
+	0x55, 0x73, 0x65, 0x22, 0x76, 0x0a, 0x1f, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f,
+	0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x50, 0x6f,
+	0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x65, 0x6e,
+	0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x65, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x73, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x08, 0x73, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x22, 0x8b, 0x09, 0x0a, 0x1d,
+	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e,
+	0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x34, 0x0a, 0x16, 0x6e, 0x65, 0x74, 0x77, 0x6f,
+	0x72, 0x6b, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x74, 0x79, 0x70,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x14, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b,
+	0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x54, 0x79, 0x70, 0x65, 0x12, 0x30, 0x0a,
+	0x14, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e,
+	0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x12, 0x6e, 0x65, 0x74,
+	0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x12,
+	0x40, 0x0a, 0x1c, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x66, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x1a, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x49, 0x6e,
+	0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65,
+	0x72, 0x12, 0x2f, 0x0a, 0x13, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x7a, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x12,
+	0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x6f, 0x6b,
+	0x65, 0x6e, 0x12, 0x53, 0x0a, 0x16, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x5f, 0x69, 0x70, 0x5f, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x14, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x31, 0x0a, 0x14, 0x6f, 0x72, 0x63, 0x68, 0x65,
+	0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x13, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61,
+	0x74, 0x6f, 0x72, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x12, 0x48, 0x0a, 0x10, 0x69, 0x70,
+	0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73,
+	0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x0f, 0x69, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x75, 0x0a, 0x14, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72,
+	0x79, 0x5f, 0x69, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x18, 0x09, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x43, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43,
+	0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e,
+	0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x12, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61,
+	0x72, 0x79, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x12, 0x4c, 0x0a, 0x12, 0x6d,
+	0x75, 0x6c, 0x74, 0x69, 0x5f, 0x74, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x79, 0x5f, 0x69, 0x6e, 0x66,
+	0x6f, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e,
+	0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x65, 0x6e, 0x61,
+	0x6e, 0x63, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x10, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x65,
+	0x6e, 0x61, 0x6e, 0x63, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x44, 0x0a, 0x12, 0x63, 0x6e, 0x65,
+	0x74, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x5f, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18,
+	0x0b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x52, 0x10, 0x63,
+	0x6e, 0x65, 0x74, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x53, 0x70, 0x61, 0x63, 0x65, 0x12,
+	0x2b, 0x0a, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x18, 0x0c, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52,
+	0x6f, 0x75, 0x74, 0x65, 0x52, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x12, 0x42, 0x0a, 0x1e,
+	0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x68, 0x6f, 0x73, 0x74, 0x5f, 0x74, 0x6f, 0x5f, 0x6e, 0x63,
+	0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0d,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x1a, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x48, 0x6f, 0x73, 0x74, 0x54,
+	0x6f, 0x4e, 0x63, 0x43, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x42, 0x0a, 0x1e, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x6e, 0x63, 0x5f, 0x74, 0x6f, 0x5f,
+	0x68, 0x6f, 0x73, 0x74, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x08, 0x52, 0x1a, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4e,
+	0x63, 0x54, 0x6f, 0x48, 0x6f, 0x73, 0x74, 0x43, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x5a, 0x0a, 0x11, 0x65, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74,
+	0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x2d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4e,
+	0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x10,
+	0x65, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73,
+	0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x10, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x6e, 0x65, 0x74, 0x4e, 0x61, 0x6d,
+	0x65, 0x1a, 0x66, 0x0a, 0x17, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x70,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03,
+	0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x35,
+	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x54, 0x0a, 0x1e, 0x43, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22,
+	0x81, 0x01, 0x0a, 0x1a, 0x47, 0x65, 0x74, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f,
+	0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x30,
+	0x0a, 0x14, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x12, 0x6e, 0x65,
+	0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x64,
+	0x12, 0x31, 0x0a, 0x14, 0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72,
+	0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x13,
+	0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x43, 0x6f, 0x6e, 0x74,
+	0x65, 0x78, 0x74, 0x22, 0xad, 0x05, 0x0a, 0x1b, 0x47, 0x65, 0x74, 0x4e, 0x65, 0x74, 0x77, 0x6f,
+	0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x30, 0x0a, 0x14, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x63,
+	0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x12, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x48, 0x0a, 0x10, 0x69, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49,
+	0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0f,
+	0x69, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x2b, 0x0a, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52,
+	0x6f, 0x75, 0x74, 0x65, 0x52, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x12, 0x44, 0x0a, 0x12,
+	0x63, 0x6e, 0x65, 0x74, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x5f, 0x73, 0x70, 0x61,
+	0x63, 0x65, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65,
+	0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x75, 0x62, 0x6e, 0x65, 0x74,
+	0x52, 0x10, 0x63, 0x6e, 0x65, 0x74, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x53, 0x70, 0x61,
+	0x63, 0x65, 0x12, 0x4c, 0x0a, 0x12, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x5f, 0x74, 0x65, 0x6e, 0x61,
+	0x6e, 0x63, 0x79, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e,
+	0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x75,
+	0x6c, 0x74, 0x69, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x10,
+	0x6d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x79, 0x49, 0x6e, 0x66, 0x6f,
+	0x12, 0x40, 0x0a, 0x1c, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x5f, 0x69, 0x6e, 0x74, 0x65,
+	0x72, 0x66, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x1a, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x49,
+	0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69,
+	0x65, 0x72, 0x12, 0x53, 0x0a, 0x16, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x5f, 0x69, 0x70, 0x5f, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x14, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x49, 0x70, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x32, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75, 0x72,
+	0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x42, 0x0a, 0x1e, 0x61,
+	0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x68, 0x6f, 0x73, 0x74, 0x5f, 0x74, 0x6f, 0x5f, 0x6e, 0x63, 0x5f,
+	0x63, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x1a, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x48, 0x6f, 0x73, 0x74, 0x54, 0x6f,
+	0x4e, 0x63, 0x43, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x42, 0x0a, 0x1e, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x6e, 0x63, 0x5f, 0x74, 0x6f, 0x5f, 0x68,
+	0x6f, 0x73, 0x74, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x1a, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4e, 0x63,
+	0x54, 0x6f, 0x48, 0x6f, 0x73, 0x74, 0x43, 0x6f, 0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x22, 0x51, 0x0a, 0x1d, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x65, 0x74,
+	0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x30, 0x0a, 0x14, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x5f,
+	0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x12, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61,
+	0x69, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x22, 0x54, 0x0a, 0x1e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x61, 0x7a, 0x75,
+	0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xfc, 0x04, 0x0a,
+	0x03, 0x43, 0x4e, 0x53, 0x12, 0x51, 0x0a, 0x10, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49,
+	0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65,
+	0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e,
+	0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x59, 0x0a, 0x10, 0x52, 0x65, 0x6c, 0x65, 0x61,
+	0x73, 0x65, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x2e, 0x61, 0x7a,
+	0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x61, 0x7a, 0x75,
+	0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73,
+	0x65, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x69, 0x0a, 0x1c, 0x47, 0x65, 0x74, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65,
+	0x73, 0x73, 0x65, 0x73, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x73, 0x12, 0x23, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76,
+	0x31, 0x2e, 0x47, 0x65, 0x74, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x65, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e,
+	0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x49, 0x50, 0x41, 0x64, 0x64, 0x72,
+	0x65, 0x73, 0x73, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x7b, 0x0a,
+	0x1e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4f, 0x72, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4e,
+	0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x12,
+	0x2b, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74,
+	0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x2c, 0x2e, 0x61,
+	0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x72, 0x65, 0x61,
+	0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e,
+	0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x6a, 0x0a, 0x13, 0x47, 0x65,
+	0x74, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65,
+	0x72, 0x12, 0x28, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31,
+	0x2e, 0x47, 0x65, 0x74, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61,
+	0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x29, 0x2e, 0x61, 0x7a,
+	0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x4e, 0x65,
+	0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x73, 0x0a, 0x16, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x12, 0x2b, 0x2e, 0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e,
+	0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x2c, 0x2e,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2e, 0x63, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x40, 0x5a, 0x3e, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x41, 0x7a, 0x75, 0x72, 0x65, 0x2f,
+	0x61, 0x7a, 0x75, 0x72, 0x65, 0x2d, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2d,
+	0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x69, 0x6e, 0x67, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2f, 0x63, 0x6e, 0x73, 0x2f, 0x76, 0x31, 0x3b, 0x63, 0x6e, 0x73, 0x76, 0x31, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_cns_proto_rawDescOnce sync.Once
+	file_cns_proto_rawDescData = file_cns_proto_rawDesc
+)
+
+func file_cns_proto_rawDescGZIP() []byte {
+	file_cns_proto_rawDescOnce.Do(func() {
+		file_cns_proto_rawDescData = protoimpl.X.CompressGZIP(file_cns_proto_rawDescData)
+	})
+	return file_cns_proto_rawDescData
+}
+
+var file_cns_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
+var file_cns_proto_goTypes = []interface{}{
+	(*Response)(nil),                        // 0: azure.cns.v1.Response
+	(*IPSubnet)(nil),                        // 1: azure.cns.v1.IPSubnet
+	(*IPConfiguration)(nil),                 // 2: azure.cns.v1.IPConfiguration
+	(*HostIPInfo)(nil),                      // 3: azure.cns.v1.HostIPInfo
+	(*PodIPInfo)(nil),                       // 4: azure.cns.v1.PodIPInfo
+	(*IPConfigRequest)(nil),                 // 5: azure.cns.v1.IPConfigRequest
+	(*IPConfigResponse)(nil),                // 6: azure.cns.v1.IPConfigResponse
+	(*ReleaseIPAddressResponse)(nil),        // 7: azure.cns.v1.ReleaseIPAddressResponse
+	(*GetIPAddressesRequest)(nil),           // 8: azure.cns.v1.GetIPAddressesRequest
+	(*PodInfo)(nil),                         // 9: azure.cns.v1.PodInfo
+	(*IPConfigurationStatus)(nil),           // 10: azure.cns.v1.IPConfigurationStatus
+	(*GetIPAddressesResponse)(nil),          // 11: azure.cns.v1.GetIPAddressesResponse
+	(*SecondaryIPConfig)(nil),               // 12: azure.cns.v1.SecondaryIPConfig
+	(*MultiTenancyInfo)(nil),                // 13: azure.cns.v1.MultiTenancyInfo
+	(*Route)(nil),                           // 14: azure.cns.v1.Route
+	(*NetworkContainerRequestPolicies)(nil), // 15: azure.cns.v1.NetworkContainerRequestPolicies
+	(*CreateNetworkContainerRequest)(nil),   // 16: azure.cns.v1.CreateNetworkContainerRequest
+	(*CreateNetworkContainerResponse)(nil),  // 17: azure.cns.v1.CreateNetworkContainerResponse
+	(*GetNetworkContainerRequest)(nil),      // 18: azure.cns.v1.GetNetworkContainerRequest
+	(*GetNetworkContainerResponse)(nil),     // 19: azure.cns.v1.GetNetworkContainerResponse
+	(*DeleteNetworkContainerRequest)(nil),   // 20: azure.cns.v1.DeleteNetworkContainerRequest
+	(*DeleteNetworkContainerResponse)(nil),  // 21: azure.cns.v1.DeleteNetworkContainerResponse
+	nil,                                     // 22: azure.cns.v1.CreateNetworkContainerRequest.SecondaryIpConfigsEntry
+	(*timestamppb.Timestamp)(nil),           // 23: google.protobuf.Timestamp
+}
+var file_cns_proto_depIdxs = []int32{
+	1,  // 0: azure.cns.v1.IPConfiguration.ip_subnet:type_name -> azure.cns.v1.IPSubnet
+	1,  // 1: azure.cns.v1.PodIPInfo.pod_ip_config:type_name -> azure.cns.v1.IPSubnet
+	2,  // 2: azure.cns.v1.PodIPInfo.network_container_primary_ip_config:type_name -> azure.cns.v1.IPConfiguration
+	3,  // 3: azure.cns.v1.PodIPInfo.host_primary_ip_info:type_name -> azure.cns.v1.HostIPInfo
+	4,  // 4: azure.cns.v1.IPConfigResponse.pod_ip_info_list:type_name -> azure.cns.v1.PodIPInfo
+	0,  // 5: azure.cns.v1.IPConfigResponse.response:type_name -> azure.cns.v1.Response
+	0,  // 6: azure.cns.v1.ReleaseIPAddressResponse.response:type_name -> azure.cns.v1.Response
+	9,  // 7: azure.cns.v1.IPConfigurationStatus.pod_info:type_name -> azure.cns.v1.PodInfo
+	23, // 8: azure.cns.v1.IPConfigurationStatus.cooldown_start_time:type_name -> google.protobuf.Timestamp
+	23, // 9: azure.cns.v1.IPConfigurationStatus.last_state_transition_time:type_name -> google.protobuf.Timestamp
+	10, // 10: azure.cns.v1.GetIPAddressesResponse.ip_configuration_status:type_name -> azure.cns.v1.IPConfigurationStatus
+	0,  // 11: azure.cns.v1.GetIPAddressesResponse.response:type_name -> azure.cns.v1.Response
+	2,  // 12: azure.cns.v1.CreateNetworkContainerRequest.local_ip_configuration:type_name -> azure.cns.v1.IPConfiguration
+	2,  // 13: azure.cns.v1.CreateNetworkContainerRequest.ip_configuration:type_name -> azure.cns.v1.IPConfiguration
+	22, // 14: azure.cns.v1.CreateNetworkContainerRequest.secondary_ip_configs:type_name -> azure.cns.v1.CreateNetworkContainerRequest.SecondaryIpConfigsEntry
+	13, // 15: azure.cns.v1.CreateNetworkContainerRequest.multi_tenancy_info:type_name -> azure.cns.v1.MultiTenancyInfo
+	1,  // 16: azure.cns.v1.CreateNetworkContainerRequest.cnet_address_space:type_name -> azure.cns.v1.IPSubnet
+	14, // 17: azure.cns.v1.CreateNetworkContainerRequest.routes:type_name -> azure.cns.v1.Route
+	15, // 18: azure.cns.v1.CreateNetworkContainerRequest.endpoint_policies:type_name -> azure.cns.v1.NetworkContainerRequestPolicies
+	0,  // 19: azure.cns.v1.CreateNetworkContainerResponse.response:type_name -> azure.cns.v1.Response
+	2,  // 20: azure.cns.v1.GetNetworkContainerResponse.ip_configuration:type_name -> azure.cns.v1.IPConfiguration
+	14, // 21: azure.cns.v1.GetNetworkContainerResponse.routes:type_name -> azure.cns.v1.Route
+	1,  // 22: azure.cns.v1.GetNetworkContainerResponse.cnet_address_space:type_name -> azure.cns.v1.IPSubnet
+	13, // 23: azure.cns.v1.GetNetworkContainerResponse.multi_tenancy_info:type_name -> azure.cns.v1.MultiTenancyInfo
+	2,  // 24: azure.cns.v1.GetNetworkContainerResponse.local_ip_configuration:type_name -> azure.cns.v1.IPConfiguration
+	0,  // 25: azure.cns.v1.GetNetworkContainerResponse.response:type_name -> azure.cns.v1.Response
+	0,  // 26: azure.cns.v1.DeleteNetworkContainerResponse.response:type_name -> azure.cns.v1.Response
+	12, // 27: azure.cns.v1.CreateNetworkContainerRequest.SecondaryIpConfigsEntry.value:type_name -> azure.cns.v1.SecondaryIPConfig
+	5,  // 28: azure.cns.v1.CNS.RequestIPAddress:input_type -> azure.cns.v1.IPConfigRequest
+	5,  // 29: azure.cns.v1.CNS.ReleaseIPAddress:input_type -> azure.cns.v1.IPConfigRequest
+	8,  // 30: azure.cns.v1.CNS.GetIPAddressesMatchingStates:input_type -> azure.cns.v1.GetIPAddressesRequest
+	16, // 31: azure.cns.v1.CNS.CreateOrUpdateNetworkContainer:input_type -> azure.cns.v1.CreateNetworkContainerRequest
+	18, // 32: azure.cns.v1.CNS.GetNetworkContainer:input_type -> azure.cns.v1.GetNetworkContainerRequest
+	20, // 33: azure.cns.v1.CNS.DeleteNetworkContainer:input_type -> azure.cns.v1.DeleteNetworkContainerRequest
+	6,  // 34: azure.cns.v1.CNS.RequestIPAddress:output_type -> azure.cns.v1.IPConfigResponse
+	7,  // 35: azure.cns.v1.CNS.ReleaseIPAddress:output_type -> azure.cns.v1.ReleaseIPAddressResponse
+	11, // 36: azure.cns.v1.CNS.GetIPAddressesMatchingStates:output_type -> azure.cns.v1.GetIPAddressesResponse
+	17, // 37: azure.cns.v1.CNS.CreateOrUpdateNetworkContainer:output_type -> azure.cns.v1.CreateNetworkContainerResponse
+	19, // 38: azure.cns.v1.CNS.GetNetworkContainer:output_type -> azure.cns.v1.GetNetworkContainerResponse
+	21, // 39: azure.cns.v1.CNS.DeleteNetworkContainer:output_type -> azure.cns.v1.DeleteNetworkContainerResponse
+	34, // [34:40] is the sub-list for method output_type
+	28, // [28:34] is the sub-list for method input_type
+	28, // [28:28] is the sub-list for extension type_name
+	28, // [28:28] is the sub-list for extension extendee
+	0,  // [0:28] is the sub-list for field type_name
+}
+
+func init() { file_cns_proto_init() }
+func file_cns_proto_init() {
+	if File_cns_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_cns_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Response); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IPSubnet); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IPConfiguration); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HostIPInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodIPInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IPConfigRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IPConfigResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReleaseIPAddressResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetIPAddressesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IPConfigurationStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetIPAddressesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SecondaryIPConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MultiTenancyInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Route); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NetworkContainerRequestPolicies); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateNetworkContainerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateNetworkContainerResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetNetworkContainerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetNetworkContainerResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteNetworkContainerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cns_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteNetworkContainerResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_cns_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   23,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_cns_proto_goTypes,
+		DependencyIndexes: file_cns_proto_depIdxs,
+		MessageInfos:      file_cns_proto_msgTypes,
+	}.Build()
+	File_cns_proto = out.File
+	file_cns_proto_rawDesc = nil
+	file_cns_proto_goTypes = nil
+	file_cns_proto_depIdxs = nil
+}
@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package cnsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CNSClient is the client API for CNS service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CNSClient interface {
+	// RequestIPAddress allocates an IP per address family to a pod, or returns the IPs the pod already has.
+	RequestIPAddress(ctx context.Context, in *IPConfigRequest, opts ...grpc.CallOption) (*IPConfigResponse, error)
+	// ReleaseIPAddress releases the IPs allocated to a pod.
+	ReleaseIPAddress(ctx context.Context, in *IPConfigRequest, opts ...grpc.CallOption) (*ReleaseIPAddressResponse, error)
+	// GetIPAddressesMatchingStates returns the IPs in any of the requested states.
+	GetIPAddressesMatchingStates(ctx context.Context, in *GetIPAddressesRequest, opts ...grpc.CallOption) (*GetIPAddressesResponse, error)
+	CreateOrUpdateNetworkContainer(ctx context.Context, in *CreateNetworkContainerRequest, opts ...grpc.CallOption) (*CreateNetworkContainerResponse, error)
+	GetNetworkContainer(ctx context.Context, in *GetNetworkContainerRequest, opts ...grpc.CallOption) (*GetNetworkContainerResponse, error)
+	DeleteNetworkContainer(ctx context.Context, in *DeleteNetworkContainerRequest, opts ...grpc.CallOption) (*DeleteNetworkContainerResponse, error)
+}
+
+type cNSClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCNSClient(cc grpc.ClientConnInterface) CNSClient {
+	return &cNSClient{cc}
+}
+
+func (c *cNSClient) RequestIPAddress(ctx context.Context, in *IPConfigRequest, opts ...grpc.CallOption) (*IPConfigResponse, error) {
+	out := new(IPConfigResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/RequestIPAddress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) ReleaseIPAddress(ctx context.Context, in *IPConfigRequest, opts ...grpc.CallOption) (*ReleaseIPAddressResponse, error) {
+	out := new(ReleaseIPAddressResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/ReleaseIPAddress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) GetIPAddressesMatchingStates(ctx context.Context, in *GetIPAddressesRequest, opts ...grpc.CallOption) (*GetIPAddressesResponse, error) {
+	out := new(GetIPAddressesResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/GetIPAddressesMatchingStates", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) CreateOrUpdateNetworkContainer(ctx context.Context, in *CreateNetworkContainerRequest, opts ...grpc.CallOption) (*CreateNetworkContainerResponse, error) {
+	out := new(CreateNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/CreateOrUpdateNetworkContainer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) GetNetworkContainer(ctx context.Context, in *GetNetworkContainerRequest, opts ...grpc.CallOption) (*GetNetworkContainerResponse, error) {
+	out := new(GetNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/GetNetworkContainer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) DeleteNetworkContainer(ctx context.Context, in *DeleteNetworkContainerRequest, opts ...grpc.CallOption) (*DeleteNetworkContainerResponse, error) {
+	out := new(DeleteNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, "/azure.cns.v1.CNS/DeleteNetworkContainer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CNSServer is the server API for CNS service.
+// All implementations must embed UnimplementedCNSServer
+// for forward compatibility
+type CNSServer interface {
+	// RequestIPAddress allocates an IP per address family to a pod, or returns the IPs the pod already has.
+	RequestIPAddress(context.Context, *IPConfigRequest) (*IPConfigResponse, error)
+	// ReleaseIPAddress releases the IPs allocated to a pod.
+	ReleaseIPAddress(context.Context, *IPConfigRequest) (*ReleaseIPAddressResponse, error)
+	// GetIPAddressesMatchingStates returns the IPs in any of the requested states.
+	GetIPAddressesMatchingStates(context.Context, *GetIPAddressesRequest) (*GetIPAddressesResponse, error)
+	CreateOrUpdateNetworkContainer(context.Context, *CreateNetworkContainerRequest) (*CreateNetworkContainerResponse, error)
+	GetNetworkContainer(context.Context, *GetNetworkContainerRequest) (*GetNetworkContainerResponse, error)
+	DeleteNetworkContainer(context.Context, *DeleteNetworkContainerRequest) (*DeleteNetworkContainerResponse, error)
+	mustEmbedUnimplementedCNSServer()
+}
+
+// UnimplementedCNSServer must be embedded to have forward compatible implementations.
+type UnimplementedCNSServer struct {
+}
+
+func (UnimplementedCNSServer) RequestIPAddress(context.Context, *IPConfigRequest) (*IPConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestIPAddress not implemented")
+}
+func (UnimplementedCNSServer) ReleaseIPAddress(context.Context, *IPConfigRequest) (*ReleaseIPAddressResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseIPAddress not implemented")
+}
+func (UnimplementedCNSServer) GetIPAddressesMatchingStates(context.Context, *GetIPAddressesRequest) (*GetIPAddressesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIPAddressesMatchingStates not implemented")
+}
+func (UnimplementedCNSServer) CreateOrUpdateNetworkContainer(context.Context, *CreateNetworkContainerRequest) (*CreateNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrUpdateNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) GetNetworkContainer(context.Context, *GetNetworkContainerRequest) (*GetNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) DeleteNetworkContainer(context.Context, *DeleteNetworkContainerRequest) (*DeleteNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) mustEmbedUnimplementedCNSServer() {}
+
+// UnsafeCNSServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CNSServer will
+// result in compilation errors.
+type UnsafeCNSServer interface {
+	mustEmbedUnimplementedCNSServer()
+}
+
+func RegisterCNSServer(s grpc.ServiceRegistrar, srv CNSServer) {
+	s.RegisterService(&CNS_ServiceDesc, srv)
+}
+
+func _CNS_RequestIPAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IPConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).RequestIPAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/RequestIPAddress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).RequestIPAddress(ctx, req.(*IPConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_ReleaseIPAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IPConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).ReleaseIPAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/ReleaseIPAddress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).ReleaseIPAddress(ctx, req.(*IPConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_GetIPAddressesMatchingStates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetIPAddressesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).GetIPAddressesMatchingStates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/GetIPAddressesMatchingStates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).GetIPAddressesMatchingStates(ctx, req.(*GetIPAddressesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_CreateOrUpdateNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).CreateOrUpdateNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/CreateOrUpdateNetworkContainer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).CreateOrUpdateNetworkContainer(ctx, req.(*CreateNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_GetNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).GetNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/GetNetworkContainer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).GetNetworkContainer(ctx, req.(*GetNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_DeleteNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).DeleteNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/azure.cns.v1.CNS/DeleteNetworkContainer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).DeleteNetworkContainer(ctx, req.(*DeleteNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CNS_ServiceDesc is the grpc.ServiceDesc for CNS service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CNS_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "azure.cns.v1.CNS",
+	HandlerType: (*CNSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RequestIPAddress",
+			Handler:    _CNS_RequestIPAddress_Handler,
+		},
+		{
+			MethodName: "ReleaseIPAddress",
+			Handler:    _CNS_ReleaseIPAddress_Handler,
+		},
+		{
+			MethodName: "GetIPAddressesMatchingStates",
+			Handler:    _CNS_GetIPAddressesMatchingStates_Handler,
+		},
+		{
+			MethodName: "CreateOrUpdateNetworkContainer",
+			Handler:    _CNS_CreateOrUpdateNetworkContainer_Handler,
+		},
+		{
+			MethodName: "GetNetworkContainer",
+			Handler:    _CNS_GetNetworkContainer_Handler,
+		},
+		{
+			MethodName: "DeleteNetworkContainer",
+			Handler:    _CNS_DeleteNetworkContainer_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cns.proto",
+}
@@ -8,6 +8,9 @@ type TlsSettings struct {
 	TLSCertificatePath string
 	TLSEndpoint        string
 	TLSPort            string
+	// TLSClientCAPath is a PEM file of the CAs whose client certificates are verified. When set, clients
+	// may present a certificate to authenticate with.
+	TLSClientCAPath string
 }
 
 func GetTlsCertificateRetriever(settings TlsSettings) (TlsCertificateRetriever, error) {
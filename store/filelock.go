@@ -0,0 +1,71 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"os"
+	"time"
+)
+
+// FileLock is a lock on a file which is shared by processes, and serializes access to a single resource without
+// locking a whole store. Unlike the lock file of a store, the lock is released by the operating system when the
+// process holding it exits, so a crashed process cannot leave it behind.
+type FileLock struct {
+	fileName string
+	file     *os.File
+}
+
+// NewFileLock creates a new FileLock on the given file, which is created if it does not exist.
+func NewFileLock(fileName string) *FileLock {
+	return &FileLock{fileName: fileName}
+}
+
+// Lock acquires the lock, retrying while another process holds it. Exclusive locks exclude all other holders,
+// while shared locks only exclude exclusive holders.
+func (l *FileLock) Lock(exclusive bool) error {
+	if l.file != nil {
+		return ErrFileLocked
+	}
+
+	file, err := os.OpenFile(l.fileName, os.O_CREATE|os.O_RDWR, os.FileMode(0o664))
+	if err != nil {
+		return err
+	}
+
+	for retry := 0; ; retry++ {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		if locked {
+			break
+		}
+
+		if retry == lockMaxRetries {
+			file.Close()
+			return ErrTimeoutLockingFile
+		}
+
+		time.Sleep(lockRetryDelay)
+	}
+
+	l.file = file
+
+	return nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return ErrFileNotLocked
+	}
+
+	err := unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+
+	return err
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that an exclusive lock excludes all other holders, and shared locks only exclude exclusive holders.
+func TestFileLockExcludesOtherHolders(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.lock")
+
+	lock1 := NewFileLock(fileName)
+	lock2 := NewFileLock(fileName)
+
+	if err := lock1.Lock(false); err != nil {
+		t.Fatalf("Failed to acquire shared lock %v", err)
+	}
+
+	if err := lock2.Lock(false); err != nil {
+		t.Fatalf("Failed to acquire second shared lock %v", err)
+	}
+
+	// The lock is held, so the exclusive lock cannot be acquired.
+	lock3 := NewFileLock(fileName)
+	if locked, err := tryLockFileName(fileName, true); err != nil || locked {
+		t.Fatalf("Acquired exclusive lock on shared lock, locked:%v err:%v", locked, err)
+	}
+
+	if err := lock1.Unlock(); err != nil {
+		t.Fatalf("Failed to release lock %v", err)
+	}
+
+	if err := lock2.Unlock(); err != nil {
+		t.Fatalf("Failed to release lock %v", err)
+	}
+
+	if err := lock3.Lock(true); err != nil {
+		t.Fatalf("Failed to acquire exclusive lock %v", err)
+	}
+
+	if locked, err := tryLockFileName(fileName, false); err != nil || locked {
+		t.Fatalf("Acquired shared lock on exclusive lock, locked:%v err:%v", locked, err)
+	}
+
+	if err := lock3.Lock(true); err != ErrFileLocked {
+		t.Fatalf("Locking a held lock returned %v", err)
+	}
+
+	if err := lock3.Unlock(); err != nil {
+		t.Fatalf("Failed to release lock %v", err)
+	}
+
+	if err := lock3.Unlock(); err != ErrFileNotLocked {
+		t.Fatalf("Unlocking a released lock returned %v", err)
+	}
+}
+
+// tryLockFileName tries to lock the file through a new open file, and releases the lock if it was acquired.
+func tryLockFileName(fileName string, exclusive bool) (bool, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	locked, err := tryLockFile(file, exclusive)
+	if locked {
+		err = unlockFile(file)
+	}
+
+	return locked, err
+}
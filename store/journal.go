@@ -0,0 +1,560 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+const (
+	// Extension added to the file name for the write-ahead journal.
+	journalExtension = ".journal"
+
+	// Number of journal records after which the journal is compacted into the snapshot.
+	journalCompactionThreshold = 1024
+
+	// Size of the journal record header, payload length followed by payload CRC32.
+	journalRecordHeaderSize = 8
+)
+
+// journalRecord is a single entry in the journal. A nil Value removes the key.
+type journalRecord struct {
+	Key   string           `json:"k"`
+	Value *json.RawMessage `json:"v"`
+}
+
+// journalFileStore is an implementation of IncrementalKeyValueStore using a JSON snapshot file and an
+// append-only journal. Each Write appends one checksummed record to the journal and fsyncs it, so a write
+// is either fully persisted or discarded on recovery. The journal is periodically compacted into the snapshot.
+// The journal is fsynced without holding the store lock, so writers append while another writer waits for the
+// disk, and one fsync makes the records of all of them durable.
+type journalFileStore struct {
+	fileName        string
+	journalFileName string
+	lockFileName    string
+	data            map[string]*json.RawMessage
+	journalRecords  int
+	inSync          bool
+	locked          bool
+	// compactPending is set when a torn record could not be cut from the journal, which is then compacted before
+	// the next record is appended after it.
+	compactPending bool
+	// appended counts the records appended to the journal, of which the first synced are durable.
+	appended uint64
+	synced   uint64
+	sync.Mutex
+	// flushMutex serializes the fsyncs of the journal. It is taken before the store lock.
+	flushMutex sync.Mutex
+}
+
+// NewJournalFileStore creates a new journalFileStore object, accessed as an IncrementalKeyValueStore.
+func NewJournalFileStore(fileName string) (IncrementalKeyValueStore, error) {
+	if fileName == "" {
+		fileName = defaultFileName
+	}
+
+	if platform.CNILockPath != "" {
+		err := os.MkdirAll(platform.CNILockPath, os.FileMode(0o664))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kvs := &journalFileStore{
+		fileName:        fileName,
+		journalFileName: fileName + journalExtension,
+		lockFileName:    platform.CNILockPath + filepath.Base(fileName) + lockExtension,
+		data:            make(map[string]*json.RawMessage),
+	}
+
+	return kvs, nil
+}
+
+// Read restores the value for the given key from persistent store.
+func (kvs *journalFileStore) Read(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	raw, ok := kvs.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	return json.Unmarshal(*raw, value)
+}
+
+// Write saves the given key value pair to persistent store.
+func (kvs *journalFileStore) Write(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	rawMessage := json.RawMessage(raw)
+	if err := kvs.stage(journalRecord{Key: key, Value: &rawMessage}); err != nil {
+		return err
+	}
+
+	return kvs.Sync()
+}
+
+// Delete removes the given key from persistent store.
+func (kvs *journalFileStore) Delete(key string) error {
+	if err := kvs.stage(journalRecord{Key: key}); err != nil {
+		return err
+	}
+
+	return kvs.Sync()
+}
+
+// Stage saves the given key value pair, or removes the key if value is nil, without waiting for it to be durable.
+func (kvs *journalFileStore) Stage(key string, value interface{}) error {
+	record := journalRecord{Key: key}
+	if value != nil {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		rawMessage := json.RawMessage(raw)
+		record.Value = &rawMessage
+	}
+
+	return kvs.stage(record)
+}
+
+// stage appends the record to the journal under the store lock.
+func (kvs *journalFileStore) stage(record journalRecord) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	return kvs.append(record)
+}
+
+// Sync fsyncs the journal, unless the records appended before the call were made durable by another Sync or a
+// compaction in the meantime. If the fsync fails, the written records may be lost from the page cache, so the
+// in-memory state is compacted into the snapshot instead.
+func (kvs *journalFileStore) Sync() error {
+	kvs.Mutex.Lock()
+	target := kvs.appended
+	kvs.Mutex.Unlock()
+
+	kvs.flushMutex.Lock()
+	defer kvs.flushMutex.Unlock()
+
+	kvs.Mutex.Lock()
+	if kvs.synced >= target {
+		kvs.Mutex.Unlock()
+		return nil
+	}
+	flushed := kvs.appended
+	kvs.Mutex.Unlock()
+
+	err := kvs.flushJournal()
+
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err != nil {
+		log.Errorf("Failed to sync journal %s, compacting it: %v", kvs.journalFileName, err)
+		if err := kvs.load(); err != nil {
+			kvs.compactPending = true
+			return fmt.Errorf("journal sync failed, and loading the journal failed with: %v", err)
+		}
+
+		if err := kvs.compact(); err != nil {
+			kvs.compactPending = true
+			return fmt.Errorf("journal sync failed, and compaction failed with: %v", err)
+		}
+
+		return nil
+	}
+
+	if flushed > kvs.synced {
+		kvs.synced = flushed
+	}
+
+	return nil
+}
+
+// flushJournal fsyncs the journal file.
+func (kvs *journalFileStore) flushJournal() error {
+	f, err := os.OpenFile(kvs.journalFileName, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		// the journal was removed, so there is nothing to flush
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open journal file: %v", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("journal sync failed with: %v", err)
+	}
+
+	return f.Close()
+}
+
+// Keys returns the sorted keys in persistent store.
+func (kvs *journalFileStore) Keys() ([]string, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(kvs.data))
+	for key := range kvs.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Flush compacts the journal into the snapshot.
+func (kvs *journalFileStore) Flush() error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	return kvs.compact()
+}
+
+// append writes the record to the journal and applies it to the in-memory state. The record is durable once the
+// journal is synced.
+func (kvs *journalFileStore) append(record journalRecord) error {
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	if kvs.compactPending {
+		if err := kvs.compact(); err != nil {
+			return fmt.Errorf("failed to compact journal with a torn record: %v", err)
+		}
+	}
+
+	payload, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, journalRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[journalRecordHeaderSize:], payload)
+
+	f, err := os.OpenFile(kvs.journalFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.FileMode(0o664))
+	if err != nil {
+		return fmt.Errorf("cannot open journal file: %v", err)
+	}
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("journal seek failed with: %v", err)
+	}
+
+	if _, err = f.Write(buf); err != nil {
+		kvs.discardTornRecord(f, offset)
+		f.Close()
+		return fmt.Errorf("journal write failed with: %v", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("journal close failed with: %v", err)
+	}
+
+	kvs.apply(record)
+	kvs.journalRecords++
+	kvs.appended++
+
+	if kvs.journalRecords >= journalCompactionThreshold {
+		if err := kvs.compact(); err != nil {
+			// the record is durable in the journal, compaction is retried on the next write
+			log.Errorf("Failed to compact journal %s: %v", kvs.journalFileName, err)
+		}
+	}
+
+	return nil
+}
+
+// discardTornRecord cuts the record which failed to be written at offset from the journal, so that the records
+// appended after it are not lost on recovery. If the journal cannot be truncated, it is compacted before the next write.
+func (kvs *journalFileStore) discardTornRecord(f *os.File, offset int64) {
+	err := f.Truncate(offset)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err != nil {
+		log.Errorf("Failed to discard torn record from journal %s: %v", kvs.journalFileName, err)
+		kvs.compactPending = true
+	}
+}
+
+func (kvs *journalFileStore) apply(record journalRecord) {
+	if record.Value == nil {
+		delete(kvs.data, record.Key)
+		return
+	}
+
+	kvs.data[record.Key] = record.Value
+}
+
+// load recovers the in-memory state from the snapshot and the journal if it is not in sync.
+// Replay stops at the first truncated or corrupt record, which is cut from the journal.
+func (kvs *journalFileStore) load() error {
+	if kvs.inSync {
+		return nil
+	}
+
+	data := make(map[string]*json.RawMessage)
+
+	b, err := ioutil.ReadFile(kvs.fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &data); err != nil {
+			return fmt.Errorf("failed to decode snapshot %s: %v", kvs.fileName, err)
+		}
+	}
+
+	journal, err := ioutil.ReadFile(kvs.journalFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	kvs.data = data
+	kvs.journalRecords = 0
+
+	offset := 0
+	for offset < len(journal) {
+		record, size, err := decodeJournalRecord(journal[offset:])
+		if err != nil {
+			log.Errorf("Discarding journal %s from offset %d: %v", kvs.journalFileName, offset, err)
+			if err := os.Truncate(kvs.journalFileName, int64(offset)); err != nil {
+				return fmt.Errorf("failed to truncate corrupt journal: %v", err)
+			}
+			break
+		}
+
+		kvs.apply(record)
+		kvs.journalRecords++
+		offset += size
+	}
+
+	kvs.inSync = true
+
+	return nil
+}
+
+// decodeJournalRecord decodes the record at the start of b and returns its encoded size.
+func decodeJournalRecord(b []byte) (journalRecord, int, error) {
+	var record journalRecord
+
+	if len(b) < journalRecordHeaderSize {
+		return record, 0, io.ErrUnexpectedEOF
+	}
+
+	length := int(binary.BigEndian.Uint32(b[0:4]))
+	checksum := binary.BigEndian.Uint32(b[4:8])
+	if len(b)-journalRecordHeaderSize < length {
+		return record, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := b[journalRecordHeaderSize : journalRecordHeaderSize+length]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return record, 0, fmt.Errorf("journal record checksum mismatch")
+	}
+
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return record, 0, err
+	}
+
+	return record, journalRecordHeaderSize + length, nil
+}
+
+// compact atomically replaces the snapshot with the in-memory state and truncates the journal.
+func (kvs *journalFileStore) compact() error {
+	buf, err := json.MarshalIndent(&kvs.data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	dir, file := filepath.Split(kvs.fileName)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := ioutil.TempFile(dir, file)
+	if err != nil {
+		return fmt.Errorf("cannot create temp file: %v", err)
+	}
+
+	tmpFileName := f.Name()
+
+	defer func() {
+		if err != nil {
+			// remove temp file after job is done
+			_ = os.Remove(tmpFileName)
+			// close is idempotent. just to catch if write returns error
+			f.Close()
+		}
+	}()
+
+	if _, err = f.Write(buf); err != nil {
+		return fmt.Errorf("temp file write failed with: %v", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("temp file sync failed with: %v", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("temp file close failed with: %v", err)
+	}
+
+	// atomic replace, the journal is only truncated once the snapshot holds all of its records
+	if err = platform.ReplaceFile(tmpFileName, kvs.fileName); err != nil {
+		return fmt.Errorf("rename temp file to snapshot file failed:%v", err)
+	}
+
+	// the rename must be durable before the journal is truncated
+	if err = platform.SyncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync snapshot directory: %v", err)
+	}
+
+	if err = os.Truncate(kvs.journalFileName, 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to truncate journal: %v", err)
+	}
+
+	kvs.journalRecords = 0
+	kvs.compactPending = false
+	kvs.synced = kvs.appended
+
+	return nil
+}
+
+// Lock locks the store for exclusive access.
+func (kvs *journalFileStore) Lock(block bool) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if kvs.locked {
+		return ErrStoreLocked
+	}
+
+	if err := acquireLockFile(kvs.lockFileName, block); err != nil {
+		return err
+	}
+
+	kvs.locked = true
+
+	return nil
+}
+
+// Unlock unlocks the store.
+func (kvs *journalFileStore) Unlock(forceUnlock bool) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if !forceUnlock && !kvs.locked {
+		return ErrStoreNotLocked
+	}
+
+	err := os.Remove(kvs.lockFileName)
+	if err != nil {
+		return err
+	}
+
+	kvs.inSync = false
+	kvs.locked = false
+
+	return nil
+}
+
+// GetModificationTime returns the latest modification time of the snapshot and the journal.
+func (kvs *journalFileStore) GetModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	var modTime time.Time
+	var statErr error
+	for _, fileName := range []string{kvs.fileName, kvs.journalFileName} {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			statErr = err
+			continue
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	if modTime.IsZero() {
+		log.Printf("os.stat() for file %v failed: %v", kvs.fileName, statErr)
+		return time.Time{}.UTC(), statErr
+	}
+
+	return modTime.UTC(), nil
+}
+
+// GetLockFileModificationTime returns the modification time of the lock file of the persistent store.
+func (kvs *journalFileStore) GetLockFileModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	info, err := os.Stat(kvs.lockFileName)
+	if err != nil {
+		log.Printf("os.stat() for file %v failed: %v", kvs.lockFileName, err)
+		return time.Time{}.UTC(), err
+	}
+
+	return info.ModTime().UTC(), nil
+}
+
+func (kvs *journalFileStore) GetLockFileName() string {
+	return kvs.lockFileName
+}
+
+func (kvs *journalFileStore) Remove() {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	for _, fileName := range []string{kvs.fileName, kvs.journalFileName} {
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			log.Errorf("could not remove file %s. Error: %v", fileName, err)
+		}
+	}
+
+	kvs.data = make(map[string]*json.RawMessage)
+	kvs.journalRecords = 0
+	kvs.inSync = false
+}
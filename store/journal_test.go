@@ -0,0 +1,293 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newTestJournalStore(t *testing.T) (IncrementalKeyValueStore, string) {
+	dir, err := ioutil.TempDir("", "journaltest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fileName := filepath.Join(dir, "journal.json")
+	kvs, err := NewJournalFileStore(fileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v", err)
+	}
+
+	return kvs, fileName
+}
+
+// reopen simulates a process restart by creating a new store over the same files.
+func reopen(t *testing.T, fileName string) IncrementalKeyValueStore {
+	kvs, err := NewJournalFileStore(fileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v", err)
+	}
+	return kvs
+}
+
+func TestJournalWritesAreRecovered(t *testing.T) {
+	kvs, fileName := newTestJournalStore(t)
+
+	if err := kvs.Write(testKey1, testType1{"test", 1}); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+	if err := kvs.Write(testKey2, testType1{"test", 2}); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+	if err := kvs.Write(testKey1, testType1{"updated", 3}); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+	if err := kvs.Delete(testKey2); err != nil {
+		t.Fatalf("Failed to delete from store %v", err)
+	}
+
+	kvs = reopen(t, fileName)
+
+	var value testType1
+	if err := kvs.Read(testKey1, &value); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+	if value != (testType1{"updated", 3}) {
+		t.Fatalf("Read value %+v does not match the last write", value)
+	}
+
+	if err := kvs.Read(testKey2, &value); err != ErrKeyNotFound {
+		t.Fatalf("Expected deleted key to not be found, got %v", err)
+	}
+
+	keys, err := kvs.Keys()
+	if err != nil {
+		t.Fatalf("Failed to list keys %v", err)
+	}
+	if len(keys) != 1 || keys[0] != testKey1 {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+}
+
+func TestJournalRecoversFromTruncatedWrite(t *testing.T) {
+	// truncating the last record in the header or in the payload discards only that record
+	for _, cut := range []int{1, journalRecordHeaderSize + 1} {
+		kvs, fileName := newTestJournalStore(t)
+
+		if err := kvs.Write(testKey1, testType1{"test", 1}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		info, err := os.Stat(fileName + journalExtension)
+		if err != nil {
+			t.Fatalf("Failed to stat journal %v", err)
+		}
+		goodSize := info.Size()
+
+		if err = kvs.Write(testKey2, testType1{"test", 2}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		// simulate a crash in the middle of the second write
+		if err = os.Truncate(fileName+journalExtension, goodSize+int64(cut)); err != nil {
+			t.Fatalf("Failed to truncate journal %v", err)
+		}
+
+		kvs = reopen(t, fileName)
+
+		var value testType1
+		if err = kvs.Read(testKey1, &value); err != nil {
+			t.Fatalf("Failed to read complete record after truncation %v", err)
+		}
+
+		if err = kvs.Read(testKey2, &value); err != ErrKeyNotFound {
+			t.Fatalf("Expected truncated record to be discarded, got %v", err)
+		}
+
+		// the torn record is cut from the journal so new writes are recoverable
+		if err = kvs.Write(testKey2, testType1{"test", 3}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		kvs = reopen(t, fileName)
+		if err = kvs.Read(testKey2, &value); err != nil || value != (testType1{"test", 3}) {
+			t.Fatalf("Expected write after recovery to be persisted, got %+v, %v", value, err)
+		}
+	}
+}
+
+func TestJournalDiscardsTornRecordOfFailedWrite(t *testing.T) {
+	// a torn record is cut from the journal, or the journal is compacted if it cannot be cut
+	for _, closeJournal := range []bool{false, true} {
+		kvs, fileName := newTestJournalStore(t)
+
+		if err := kvs.Write(testKey1, testType1{"test", 1}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		// simulate a write which failed after writing part of its record
+		f, err := os.OpenFile(fileName+journalExtension, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open journal %v", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatalf("Failed to stat journal %v", err)
+		}
+		if _, err = f.Write([]byte{0, 0, 1}); err != nil {
+			t.Fatalf("Failed to write to journal %v", err)
+		}
+		if closeJournal {
+			f.Close()
+		}
+		kvs.(*journalFileStore).discardTornRecord(f, info.Size())
+		f.Close()
+
+		if kvs.(*journalFileStore).compactPending != closeJournal {
+			t.Fatalf("Expected compaction pending to be %v", closeJournal)
+		}
+
+		if err = kvs.Write(testKey2, testType1{"test", 2}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+
+		kvs = reopen(t, fileName)
+		keys, err := kvs.Keys()
+		if err != nil {
+			t.Fatalf("Failed to list keys %v", err)
+		}
+		if len(keys) != 2 {
+			t.Fatalf("Expected the writes around the torn record to be recovered, got keys %v", keys)
+		}
+	}
+}
+
+func TestJournalDiscardsCorruptRecord(t *testing.T) {
+	kvs, fileName := newTestJournalStore(t)
+
+	if err := kvs.Write(testKey1, testType1{"test", 1}); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	journal, err := ioutil.ReadFile(fileName + journalExtension)
+	if err != nil {
+		t.Fatalf("Failed to read journal %v", err)
+	}
+
+	// flip a payload byte so the checksum no longer matches
+	journal[len(journal)-2] ^= 0xff
+	if err = ioutil.WriteFile(fileName+journalExtension, journal, 0o644); err != nil {
+		t.Fatalf("Failed to write journal %v", err)
+	}
+
+	kvs = reopen(t, fileName)
+
+	var value testType1
+	if err = kvs.Read(testKey1, &value); err != ErrKeyNotFound {
+		t.Fatalf("Expected corrupt record to be discarded, got %v", err)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	kvs, fileName := newTestJournalStore(t)
+
+	for i := 0; i < journalCompactionThreshold+1; i++ {
+		if err := kvs.Write(testKey1, testType1{"test", i}); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+	}
+
+	// compaction moved all but the last record into the snapshot
+	if _, err := os.Stat(fileName); err != nil {
+		t.Fatalf("Expected snapshot to exist after compaction %v", err)
+	}
+
+	journal, err := ioutil.ReadFile(fileName + journalExtension)
+	if err != nil {
+		t.Fatalf("Failed to read journal %v", err)
+	}
+	if _, size, err := decodeJournalRecord(journal); err != nil || size != len(journal) {
+		t.Fatalf("Expected one record in the journal after compaction, size %d, err %v", len(journal), err)
+	}
+
+	if err = kvs.Flush(); err != nil {
+		t.Fatalf("Failed to flush store %v", err)
+	}
+
+	kvs = reopen(t, fileName)
+
+	var value testType1
+	if err = kvs.Read(testKey1, &value); err != nil || value.Field2 != journalCompactionThreshold {
+		t.Fatalf("Expected last write to be recovered, got %+v, %v", value, err)
+	}
+}
+
+func TestJournalStagedRecordsAreSynced(t *testing.T) {
+	kvs, fileName := newTestJournalStore(t)
+
+	if err := kvs.Stage(testKey1, testType1{"staged", 1}); err != nil {
+		t.Fatalf("Failed to stage write %v", err)
+	}
+	if err := kvs.Stage(testKey2, testType1{"staged", 2}); err != nil {
+		t.Fatalf("Failed to stage write %v", err)
+	}
+	if err := kvs.Stage(testKey2, nil); err != nil {
+		t.Fatalf("Failed to stage delete %v", err)
+	}
+
+	// staged records are visible before they are synced
+	var value testType1
+	if err := kvs.Read(testKey1, &value); err != nil || value != (testType1{"staged", 1}) {
+		t.Fatalf("Expected staged write to be readable, got %+v, %v", value, err)
+	}
+
+	// concurrent syncs share the flushes of the journal
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- kvs.Sync()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to sync store %v", err)
+		}
+	}
+
+	kvs = reopen(t, fileName)
+
+	if err := kvs.Read(testKey1, &value); err != nil || value != (testType1{"staged", 1}) {
+		t.Fatalf("Expected staged write to be recovered, got %+v, %v", value, err)
+	}
+	if err := kvs.Read(testKey2, &value); err != ErrKeyNotFound {
+		t.Fatalf("Expected staged delete to be recovered, got %v", err)
+	}
+}
+
+func TestJournalSyncWithoutJournal(t *testing.T) {
+	kvs, _ := newTestJournalStore(t)
+
+	if err := kvs.Sync(); err != nil {
+		t.Fatalf("Expected sync of an empty store to succeed %v", err)
+	}
+
+	if err := kvs.Stage(testKey1, testType1{"staged", 1}); err != nil {
+		t.Fatalf("Failed to stage write %v", err)
+	}
+	kvs.Remove()
+
+	if err := kvs.Sync(); err != nil {
+		t.Fatalf("Expected sync of a removed store to succeed %v", err)
+	}
+}
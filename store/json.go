@@ -9,7 +9,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
 	"sync"
 	"time"
 
@@ -183,46 +182,7 @@ func (kvs *jsonFileStore) Lock(block bool) error {
 		return ErrStoreLocked
 	}
 
-	var lockFile *os.File
-	var err error
-	lockPerm := os.FileMode(0o664) + os.FileMode(os.ModeExclusive)
-
-	// Try to acquire the lock file.
-	var lockRetryCount uint
-	var modTimeCur time.Time
-	var modTimePrev time.Time
-	for lockRetryCount < lockMaxRetries {
-		lockFile, err = os.OpenFile(kvs.lockFileName, os.O_CREATE|os.O_EXCL|os.O_RDWR, lockPerm)
-		if err == nil {
-			break
-		}
-
-		if !block {
-			return ErrNonBlockingLockIsAlreadyLocked
-		}
-
-		// Reset the lock retry count if the timestamp for the lock file changes.
-		if fileInfo, err := os.Stat(kvs.lockFileName); err == nil {
-			modTimeCur = fileInfo.ModTime()
-			if !modTimeCur.Equal(modTimePrev) {
-				lockRetryCount = 0
-			}
-			modTimePrev = modTimeCur
-		}
-
-		time.Sleep(lockRetryDelay)
-
-		lockRetryCount++
-	}
-
-	if lockRetryCount == lockMaxRetries {
-		return ErrTimeoutLockingStore
-	}
-
-	defer lockFile.Close()
-
-	// Write the process ID for easy identification.
-	if _, err = lockFile.WriteString(strconv.Itoa(os.Getpid())); err != nil {
+	if err := acquireLockFile(kvs.lockFileName, block); err != nil {
 		return err
 	}
 
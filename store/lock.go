@@ -0,0 +1,55 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// acquireLockFile creates the lock file exclusively, retrying while it is held by another process.
+func acquireLockFile(lockFileName string, block bool) error {
+	var lockFile *os.File
+	var err error
+	lockPerm := os.FileMode(0o664) + os.FileMode(os.ModeExclusive)
+
+	// Try to acquire the lock file.
+	var lockRetryCount uint
+	var modTimeCur time.Time
+	var modTimePrev time.Time
+	for lockRetryCount < lockMaxRetries {
+		lockFile, err = os.OpenFile(lockFileName, os.O_CREATE|os.O_EXCL|os.O_RDWR, lockPerm)
+		if err == nil {
+			break
+		}
+
+		if !block {
+			return ErrNonBlockingLockIsAlreadyLocked
+		}
+
+		// Reset the lock retry count if the timestamp for the lock file changes.
+		if fileInfo, err := os.Stat(lockFileName); err == nil {
+			modTimeCur = fileInfo.ModTime()
+			if !modTimeCur.Equal(modTimePrev) {
+				lockRetryCount = 0
+			}
+			modTimePrev = modTimeCur
+		}
+
+		time.Sleep(lockRetryDelay)
+
+		lockRetryCount++
+	}
+
+	if lockRetryCount == lockMaxRetries {
+		return ErrTimeoutLockingStore
+	}
+
+	defer lockFile.Close()
+
+	// Write the process ID for easy identification.
+	_, err = lockFile.WriteString(strconv.Itoa(os.Getpid()))
+	return err
+}
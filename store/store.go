@@ -21,6 +21,19 @@ type KeyValueStore interface {
 	Remove()
 }
 
+// IncrementalKeyValueStore is a KeyValueStore which persists each key individually,
+// and can remove and enumerate keys.
+// Stage writes a key, or deletes it if value is nil, without waiting for the change to be durable, so callers
+// don't wait for the disk while they hold their own locks. Sync returns once the changes staged before it are
+// durable, and concurrent Syncs share the same flush.
+type IncrementalKeyValueStore interface {
+	KeyValueStore
+	Delete(key string) error
+	Keys() ([]string, error)
+	Stage(key string, value interface{}) error
+	Sync() error
+}
+
 var (
 	// Errors returned by KeyValueStore methods.
 	ErrKeyNotFound                    = fmt.Errorf("key not found")
@@ -29,4 +42,9 @@ var (
 	ErrStoreEmpty                     = fmt.Errorf("store is empty")
 	ErrTimeoutLockingStore            = fmt.Errorf("timed out locking store")
 	ErrNonBlockingLockIsAlreadyLocked = fmt.Errorf("attempted to perform non-blocking lock on an already locked store")
+
+	// Errors returned by FileLock methods.
+	ErrFileLocked         = fmt.Errorf("file is already locked")
+	ErrFileNotLocked      = fmt.Errorf("file is not locked")
+	ErrTimeoutLockingFile = fmt.Errorf("timed out locking file")
 )
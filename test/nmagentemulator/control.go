@@ -0,0 +1,64 @@
+package nmagentemulator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ControlPath is the prefix of the APIs which script the emulator:
+//
+//	GET    /emulator/state                       the joined networks and programmed NCs
+//	PUT    /emulator/faults/{api}                set the Fault in the body on the API
+//	DELETE /emulator/faults                      remove all faults
+//	PUT    /emulator/networkcontainers/{ncid}    set the programmed version of the NC to the Version in the body
+const ControlPath = "/emulator/"
+
+// State is the state of the emulated host.
+type State struct {
+	JoinedNetworks    []string
+	NetworkContainers []NetworkContainer
+}
+
+// LoadConfig reads the config the emulator starts with from a json file.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, errors.Wrap(err, "failed to read emulator config")
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, errors.Wrap(err, "failed to parse emulator config")
+	}
+	return config, nil
+}
+
+func (e *Emulator) serveControl(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ControlPath), "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "state":
+		writeJSON(w, State{JoinedNetworks: e.JoinedNetworks(), NetworkContainers: e.NetworkContainers()})
+	case r.Method == http.MethodPut && len(segments) == 2 && segments[0] == "faults":
+		var fault Fault
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.SetFault(API(segments[1]), fault)
+	case r.Method == http.MethodDelete && len(segments) == 1 && segments[0] == "faults":
+		e.ClearFaults()
+	case r.Method == http.MethodPut && len(segments) == 2 && segments[0] == "networkcontainers":
+		var nc NetworkContainer
+		if err := json.NewDecoder(r.Body).Decode(&nc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.SetNetworkContainerVersion(segments[1], nc.Version)
+	default:
+		http.NotFound(w, r)
+	}
+}
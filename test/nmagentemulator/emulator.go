@@ -0,0 +1,360 @@
+// Package nmagentemulator emulates the NMAgent and IMDS APIs CNS calls on the wireserver, so CNS can run off
+// Azure. CNS is pointed at the emulator by setting WireserverIP in the cns config to the address the emulator
+// listens on.
+package nmagentemulator
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// API is an NMAgent or IMDS API served by the emulator.
+type API string
+
+const (
+	JoinNetwork                API = "JoinNetwork"
+	PublishNetworkContainer    API = "PublishNetworkContainer"
+	UnpublishNetworkContainer  API = "UnpublishNetworkContainer"
+	GetNetworkContainerVersion API = "GetNetworkContainerVersion"
+	GetNcVersionList           API = "GetNcVersionList"
+	GetSupportedApis           API = "GetSupportedApis"
+	GetInterfaceInfo           API = "GetInterfaceInfo"
+)
+
+// Fault is a scripted delay or failure of an API.
+type Fault struct {
+	// DelayInMs is how long calls are held before they are answered.
+	DelayInMs int
+	// StatusCode is the HTTP status calls fail with, or 0 for calls to succeed after the delay.
+	StatusCode int
+	// Count is the number of calls the fault applies to, after which it is removed, or 0 for all calls.
+	Count int
+}
+
+// NetworkContainer is an NC programmed on the emulated host.
+type NetworkContainer struct {
+	ID          string
+	InterfaceID string
+	// Version is the NC version reported as programmed.
+	Version string
+}
+
+// Interface is the primary interface of the emulated host.
+type Interface struct {
+	MacAddress   string
+	Subnet       string
+	PrimaryIP    string
+	SecondaryIPs []string
+}
+
+// Config is the state the emulator starts with.
+type Config struct {
+	SupportedApis     []string
+	PrimaryInterface  Interface
+	NetworkContainers []NetworkContainer
+	Faults            map[API]Fault
+}
+
+// DefaultConfig is the state of a host with a single interface, which has not joined any networks.
+func DefaultConfig() Config {
+	return Config{
+		SupportedApis: []string{"NetworkManagement", "NetworkManagementDNSSupport", "NetworkManagementMultiTenancy"},
+		PrimaryInterface: Interface{
+			MacAddress: "000D3A6E5A5B",
+			Subnet:     "10.240.0.0/16",
+			PrimaryIP:  "10.240.0.4",
+		},
+	}
+}
+
+// Emulator serves the NMAgent and IMDS APIs from in-memory state.
+type Emulator struct {
+	mu                sync.Mutex
+	supportedApis     []string
+	primaryInterface  Interface
+	joinedNetworks    map[string]struct{}
+	networkContainers map[string]NetworkContainer
+	faults            map[API]Fault
+}
+
+// New creates an emulator with the state in config.
+func New(config Config) *Emulator {
+	e := &Emulator{
+		supportedApis:     config.SupportedApis,
+		primaryInterface:  config.PrimaryInterface,
+		joinedNetworks:    map[string]struct{}{},
+		networkContainers: map[string]NetworkContainer{},
+		faults:            map[API]Fault{},
+	}
+	for _, nc := range config.NetworkContainers {
+		e.networkContainers[nc.ID] = nc
+	}
+	for api, fault := range config.Faults {
+		e.faults[api] = fault
+	}
+	return e
+}
+
+// SetFault sets the fault of api, replacing any previous fault of the api.
+func (e *Emulator) SetFault(api API, fault Fault) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults[api] = fault
+}
+
+// ClearFaults removes the faults of all APIs.
+func (e *Emulator) ClearFaults() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults = map[API]Fault{}
+}
+
+// SetNetworkContainerVersion sets the version reported as programmed for the NC, adding the NC if it is not
+// programmed yet.
+func (e *Emulator) SetNetworkContainerVersion(ncID, version string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	nc := e.networkContainers[ncID]
+	nc.ID = ncID
+	nc.Version = version
+	e.networkContainers[ncID] = nc
+}
+
+// NetworkContainers returns the NCs programmed on the emulated host, sorted by ID.
+func (e *Emulator) NetworkContainers() []NetworkContainer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ncs := make([]NetworkContainer, 0, len(e.networkContainers))
+	for _, nc := range e.networkContainers {
+		ncs = append(ncs, nc)
+	}
+	sort.Slice(ncs, func(i, j int) bool { return ncs[i].ID < ncs[j].ID })
+	return ncs
+}
+
+// JoinedNetworks returns the networks the emulated host joined, sorted.
+func (e *Emulator) JoinedNetworks() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	networks := make([]string, 0, len(e.joinedNetworks))
+	for network := range e.joinedNetworks {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// ServeHTTP serves the wireserver plugin APIs, and the scripting APIs under ControlPath.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, ControlPath) {
+		e.serveControl(w, r)
+		return
+	}
+
+	// the wireserver takes the API in the type query parameter, but join network URLs may also carry it in the path
+	apiPath := r.URL.Path
+	if strings.TrimSuffix(apiPath, "/") == "/machine/plugins" {
+		apiPath = r.URL.Query().Get("type")
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(strings.Trim(apiPath, "/"), "NetworkManagement"), "/"), "/")
+
+	api, handler := e.route(r.Method, segments)
+	if handler == nil {
+		log.Printf("[nmagentemulator] No API for %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	log.Printf("[nmagentemulator] %s %s", api, r.URL)
+
+	if fault, ok := e.takeFault(api); ok {
+		time.Sleep(time.Duration(fault.DelayInMs) * time.Millisecond)
+		if fault.StatusCode != 0 {
+			log.Printf("[nmagentemulator] Failing %s with %d", api, fault.StatusCode)
+			w.WriteHeader(fault.StatusCode)
+			return
+		}
+	}
+	handler(w, segments)
+}
+
+// route returns the API and the handler of a request to the API at path segments.
+func (e *Emulator) route(method string, segments []string) (API, func(http.ResponseWriter, []string)) {
+	switch {
+	case len(segments) == 1 && segments[0] == "GetSupportedApis":
+		return GetSupportedApis, e.getSupportedApis
+	case len(segments) == 1 && segments[0] == "getinterfaceinfov1":
+		return GetInterfaceInfo, e.getInterfaceInfo
+	case len(segments) >= 2 && segments[0] == "joinedVirtualNetworks" && method == http.MethodPost:
+		return JoinNetwork, e.joinNetwork
+	case len(segments) >= 2 && segments[0] == "interfaces" && segments[1] == "api-version":
+		return GetNcVersionList, e.getNcVersionList
+	case len(segments) >= 5 && segments[0] == "interfaces" && segments[2] == "networkContainers":
+		switch {
+		// IMDS queries the programmed version on the publish URL
+		case segments[4] == "version" || method == http.MethodGet:
+			return GetNetworkContainerVersion, e.getNetworkContainerVersion
+		case segments[len(segments)-2] == "method" && segments[len(segments)-1] == http.MethodDelete:
+			return UnpublishNetworkContainer, e.unpublishNetworkContainer
+		case method == http.MethodPost:
+			return PublishNetworkContainer, e.publishNetworkContainer
+		}
+	}
+	return "", nil
+}
+
+// takeFault returns the fault of api, counting the call against it.
+func (e *Emulator) takeFault(api API) (Fault, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fault, ok := e.faults[api]
+	if !ok {
+		return fault, false
+	}
+	switch {
+	case fault.Count == 1:
+		delete(e.faults, api)
+	case fault.Count > 1:
+		fault.Count--
+		e.faults[api] = fault
+	}
+	return fault, true
+}
+
+type supportedApisResponse struct {
+	XMLName       xml.Name `xml:"SupportedApis"`
+	SupportedApis []string `xml:"type"`
+}
+
+func (e *Emulator) getSupportedApis(w http.ResponseWriter, _ []string) {
+	e.mu.Lock()
+	response := supportedApisResponse{SupportedApis: e.supportedApis}
+	e.mu.Unlock()
+	writeXML(w, response)
+}
+
+type interfacesResponse struct {
+	XMLName   xml.Name            `xml:"Interfaces"`
+	Interface []interfaceResponse `xml:"Interface"`
+}
+
+type interfaceResponse struct {
+	MacAddress string           `xml:"MacAddress,attr"`
+	IsPrimary  bool             `xml:"IsPrimary,attr"`
+	IPSubnet   []subnetResponse `xml:"IPSubnet"`
+}
+
+type subnetResponse struct {
+	Prefix    string              `xml:"Prefix,attr"`
+	IPAddress []ipAddressResponse `xml:"IPAddress"`
+}
+
+type ipAddressResponse struct {
+	Address   string `xml:"Address,attr"`
+	IsPrimary bool   `xml:"IsPrimary,attr"`
+}
+
+func (e *Emulator) getInterfaceInfo(w http.ResponseWriter, _ []string) {
+	e.mu.Lock()
+	primary := e.primaryInterface
+	e.mu.Unlock()
+
+	subnet := subnetResponse{Prefix: primary.Subnet}
+	subnet.IPAddress = append(subnet.IPAddress, ipAddressResponse{Address: primary.PrimaryIP, IsPrimary: true})
+	for _, ip := range primary.SecondaryIPs {
+		subnet.IPAddress = append(subnet.IPAddress, ipAddressResponse{Address: ip})
+	}
+	writeXML(w, interfacesResponse{
+		Interface: []interfaceResponse{{MacAddress: primary.MacAddress, IsPrimary: true, IPSubnet: []subnetResponse{subnet}}},
+	})
+}
+
+// joinNetwork handles joinedVirtualNetworks/{vnet}/api-version/{version}.
+func (e *Emulator) joinNetwork(w http.ResponseWriter, segments []string) {
+	e.mu.Lock()
+	e.joinedNetworks[segments[1]] = struct{}{}
+	e.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// publishNetworkContainer handles interfaces/{interface}/networkContainers/{nc}/authenticationToken/{token}/...
+// The NC is programmed at version 0 until its version is set.
+func (e *Emulator) publishNetworkContainer(w http.ResponseWriter, segments []string) {
+	e.mu.Lock()
+	nc, ok := e.networkContainers[segments[3]]
+	if !ok {
+		nc = NetworkContainer{ID: segments[3], Version: "0"}
+	}
+	nc.InterfaceID = segments[1]
+	e.networkContainers[nc.ID] = nc
+	e.mu.Unlock()
+	writeJSON(w, map[string]string{"httpStatusCode": strconv.Itoa(http.StatusOK)})
+}
+
+// unpublishNetworkContainer handles interfaces/{interface}/networkContainers/{nc}/.../method/DELETE.
+func (e *Emulator) unpublishNetworkContainer(w http.ResponseWriter, segments []string) {
+	e.mu.Lock()
+	delete(e.networkContainers, segments[3])
+	e.mu.Unlock()
+	writeJSON(w, map[string]string{"httpStatusCode": strconv.Itoa(http.StatusOK)})
+}
+
+// getNetworkContainerVersion handles interfaces/{interface}/networkContainers/{nc}/.... NMAgent answers queries of
+// NCs which are not programmed with a 404 in the body of the response, which CNS treats as not programmed yet.
+func (e *Emulator) getNetworkContainerVersion(w http.ResponseWriter, segments []string) {
+	e.mu.Lock()
+	nc, ok := e.networkContainers[segments[3]]
+	e.mu.Unlock()
+
+	statusCode := http.StatusOK
+	if !ok {
+		statusCode = http.StatusNotFound
+	}
+	writeJSON(w, map[string]string{
+		"httpStatusCode":     strconv.Itoa(statusCode),
+		"httpResponseCode":   strconv.Itoa(statusCode),
+		"networkContainerId": segments[3],
+		"version":            nc.Version,
+	})
+}
+
+type containerInfo struct {
+	NetworkContainerID string `json:"networkContainerId"`
+	Version            string `json:"version"`
+}
+
+// getNcVersionList handles interfaces/api-version/{version}.
+func (e *Emulator) getNcVersionList(w http.ResponseWriter, _ []string) {
+	containers := []containerInfo{}
+	for _, nc := range e.NetworkContainers() {
+		containers = append(containers, containerInfo{NetworkContainerID: nc.ID, Version: nc.Version})
+	}
+	writeJSON(w, struct {
+		ResponseCode string          `json:"httpStatusCode"`
+		Containers   []containerInfo `json:"networkContainers"`
+	}{
+		ResponseCode: strconv.Itoa(http.StatusOK),
+		Containers:   containers,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("[nmagentemulator] Failed to write response: %v", err)
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("[nmagentemulator] Failed to write response: %v", err)
+	}
+}
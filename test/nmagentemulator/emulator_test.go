@@ -0,0 +1,142 @@
+package nmagentemulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/imdsclient"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/nmagentclient"
+	acncommon "github.com/Azure/azure-container-networking/common"
+)
+
+func init() {
+	logger.InitLogger("testlogs", 0, 0, "./")
+	acncommon.InitHttpClient(5, 5)
+}
+
+// newTestServer serves the emulator, and points the CNS clients at it.
+func newTestServer(t *testing.T, config Config) (*Emulator, string) {
+	t.Helper()
+	e := New(config)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	wireserverIP := nmagentclient.WireserverIP
+	nmagentclient.WireserverIP = host
+	t.Cleanup(func() { nmagentclient.WireserverIP = wireserverIP })
+	return e, host
+}
+
+func TestPublishAndUnpublishNetworkContainer(t *testing.T) {
+	e, host := newTestServer(t, DefaultConfig())
+
+	joinURL := fmt.Sprintf("http://%s/joinedVirtualNetworks/vnet1/api-version/1", host)
+	if resp, err := nmagentclient.JoinNetwork("vnet1", joinURL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to join network, got %+v, %v", resp, err)
+	}
+	if !reflect.DeepEqual(e.JoinedNetworks(), []string{"vnet1"}) {
+		t.Fatalf("Expected vnet1 to be joined, got %v", e.JoinedNetworks())
+	}
+
+	publishURL := fmt.Sprintf("http://%s/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/eth0/networkContainers/nc1/authenticationToken/token/api-version/1", host)
+	if resp, err := nmagentclient.PublishNetworkContainer("nc1", publishURL, []byte("{}")); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to publish NC, got %+v, %v", resp, err)
+	}
+	expected := []NetworkContainer{{ID: "nc1", InterfaceID: "eth0", Version: "0"}}
+	if !reflect.DeepEqual(e.NetworkContainers(), expected) {
+		t.Fatalf("Expected NC %+v to be programmed, got %+v", expected, e.NetworkContainers())
+	}
+
+	// IMDS queries the programmed version on the publish URL
+	e.SetNetworkContainerVersion("nc1", "2")
+	version, err := (&imdsclient.ImdsClient{}).GetNetworkContainerInfoFromHost("nc1", "eth0", "token", "1")
+	if err != nil || version.ProgrammedVersion != "2" {
+		t.Fatalf("Expected programmed version 2, got %+v, %v", version, err)
+	}
+
+	if resp, err := nmagentclient.UnpublishNetworkContainer("nc1", publishURL+"/method/DELETE"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to unpublish NC, got %+v, %v", resp, err)
+	}
+	if len(e.NetworkContainers()) != 0 {
+		t.Fatalf("Expected no NCs after unpublish, got %+v", e.NetworkContainers())
+	}
+}
+
+func TestGetNcVersionListAndSupportedApis(t *testing.T) {
+	config := DefaultConfig()
+	config.NetworkContainers = []NetworkContainer{{ID: "nc1", Version: "1"}, {ID: "nc2", Version: "3"}}
+	_, _ = newTestServer(t, config)
+
+	client, err := nmagentclient.NewNMAgentClient("")
+	if err != nil {
+		t.Fatalf("Failed to create nmagent client: %v", err)
+	}
+	versions := client.GetNcVersionListWithOutToken([]string{"nc1", "nc2", "nc3"})
+	if !reflect.DeepEqual(versions, map[string]int{"nc1": 1, "nc2": 3}) {
+		t.Fatalf("Expected versions of nc1 and nc2, got %v", versions)
+	}
+
+	apis, err := nmagentclient.GetNmAgentSupportedApis(http.DefaultClient, "")
+	if err != nil || !reflect.DeepEqual(apis, config.SupportedApis) {
+		t.Fatalf("Expected supported apis %v, got %v, %v", config.SupportedApis, apis, err)
+	}
+
+	iface, err := (&imdsclient.ImdsClient{}).GetPrimaryInterfaceInfoFromHost()
+	if err != nil || iface.PrimaryIP != config.PrimaryInterface.PrimaryIP || iface.Subnet != config.PrimaryInterface.Subnet {
+		t.Fatalf("Expected primary interface %+v, got %+v, %v", config.PrimaryInterface, iface, err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	e, host := newTestServer(t, DefaultConfig())
+	client, err := nmagentclient.NewNMAgentClient("")
+	if err != nil {
+		t.Fatalf("Failed to create nmagent client: %v", err)
+	}
+
+	// faults which apply to a number of calls are removed after them
+	e.SetFault(GetNcVersionList, Fault{StatusCode: http.StatusInternalServerError, Count: 2})
+	for i := 0; i < 2; i++ {
+		if versions := client.GetNcVersionListWithOutToken([]string{"nc1"}); versions != nil {
+			t.Fatalf("Expected call %d to fail, got %v", i, versions)
+		}
+	}
+	if versions := client.GetNcVersionListWithOutToken([]string{"nc1"}); versions == nil {
+		t.Fatalf("Expected the fault to be removed after 2 calls")
+	}
+
+	// faults are scripted over http too
+	body, _ := json.Marshal(Fault{DelayInMs: 100})
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s%sfaults/%s", host, ControlPath, GetSupportedApis), bytes.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to set fault, got %+v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	if _, err := nmagentclient.GetNmAgentSupportedApis(http.DefaultClient, ""); err != nil {
+		t.Fatalf("Expected delayed call to succeed, got %v", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("Expected the call to be delayed")
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s%sfaults", host, ControlPath), nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected to clear faults, got %+v, %v", resp, err)
+	}
+	resp.Body.Close()
+	if _, ok := e.takeFault(GetSupportedApis); ok {
+		t.Fatalf("Expected faults to be cleared")
+	}
+}
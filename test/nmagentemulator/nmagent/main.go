@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Azure/azure-container-networking/test/nmagentemulator"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:9000", "address to serve the emulated wireserver on")
+	configPath := flag.String("config", "", "json file with the state and faults the emulator starts with")
+	flag.Parse()
+
+	config := nmagentemulator.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if config, err = nmagentemulator.LoadConfig(*configPath); err != nil {
+			fmt.Printf("Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("starting nmagent emulator on %s, set WireserverIP in the cns config to %s ....\n", *listen, *listen)
+	if err := http.ListenAndServe(*listen, nmagentemulator.New(config)); err != nil {
+		fmt.Printf("nmagent emulator failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -26,6 +26,11 @@ const (
 	FlagFollow      = "follow"
 	FlagLogFilePath = "log-file"
 
+	// CNI GC Flags
+	FlagConflist         = "conflist"
+	FlagValidAttachments = "valid-attachments"
+	FlagDryRun           = "dry-run"
+
 	// tenancy flags
 	Singletenancy = "singletenancy"
 	Multitenancy  = "multitenancy"
@@ -59,6 +64,7 @@ const (
 	DefaultSrcDirLinux      = "/output/"
 	DefaultBinDirLinux      = "/opt/cni/bin/"
 	DefaultConflistDirLinux = "/etc/cni/net.d/"
+	DefaultConflistLinux    = DefaultConflistDirLinux + "10-azure.conflist"
 	DefaultLogFile          = "/var/log/azure-vnet.log"
 	Transparent             = "transparent"
 	Bridge                  = "bridge"
@@ -88,6 +94,7 @@ var (
 		FlagConflistDirectory:        DefaultConflistDirLinux,
 		FlagVersion:                  Packaged,
 		FlagLogFilePath:              DefaultLogFile,
+		FlagConflist:                 DefaultConflistLinux,
 		EnvCNILogFile:                EnvCNILogFile,
 		EnvCNISourceDir:              DefaultSrcDirLinux,
 		EnvCNIDestinationBinDir:      DefaultBinDirLinux,
@@ -96,6 +103,7 @@ var (
 
 	DefaultToggles = map[string]bool{
 		FlagFollow: false,
+		FlagDryRun: false,
 	}
 )
 
@@ -20,5 +20,6 @@ func CNICmd() *cobra.Command {
 	cmd.AddCommand(InstallCmd())
 	cmd.AddCommand(LogsCmd())
 	cmd.AddCommand(ManagerCmd())
+	cmd.AddCommand(GCCmd())
 	return cmd
 }
@@ -0,0 +1,68 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	ccn "github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cni/client"
+	c "github.com/Azure/azure-container-networking/tools/acncli/api"
+	i "github.com/Azure/azure-container-networking/tools/acncli/installer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/utils/exec"
+)
+
+// GCCmd removes the Azure CNI endpoints which the container runtime no longer knows about
+func GCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: fmt.Sprintf("Removes the stale endpoints of %s and releases their IPs", c.AzureCNIBin),
+		Long: "The gc command removes the endpoints, veths and rules of the pods which are not in the valid attachments file, " +
+			"and releases their IPs. The file is a JSON list of the attachments the container runtime knows about, " +
+			`such as [{"containerID": "3f813b029429", "ifname": "eth0"}]`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			netconfig, conflist, _, err := i.LoadConf(viper.GetString(c.FlagConflist))
+			if err != nil {
+				return err
+			}
+
+			attachmentsFile := viper.GetString(c.FlagValidAttachments)
+			if attachmentsFile == "" {
+				return fmt.Errorf("No valid attachments supplied, please use --%s and try again", c.FlagValidAttachments)
+			}
+
+			b, err := ioutil.ReadFile(attachmentsFile)
+			if err != nil {
+				return err
+			}
+
+			// an empty list is valid, and removes every endpoint
+			validAttachments := []ccn.Attachment{}
+			if err := json.Unmarshal(b, &validAttachments); err != nil {
+				return fmt.Errorf("Failed to decode valid attachments from %s: %w", attachmentsFile, err)
+			}
+
+			// the plugin config in a conflist inherits the name and version of the conflist
+			netconfig.Name = conflist.Name
+			netconfig.CNIVersion = conflist.CniVersion
+			netconfig.ValidAttachments = validAttachments
+			netconfig.GCDryRun = viper.GetBool(c.FlagDryRun)
+
+			result, err := client.New(exec.New()).GC(&netconfig)
+			if err != nil {
+				return err
+			}
+
+			c.PrettyPrint(result)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(c.FlagConflist, c.Defaults[c.FlagConflist], "Path of the Azure CNI conflist")
+	cmd.Flags().String(c.FlagValidAttachments, "", "Path of a JSON file with the attachments of the container runtime, which are kept")
+	cmd.Flags().Bool(c.FlagDryRun, c.DefaultToggles[c.FlagDryRun], "Print the endpoints which would be removed without removing them")
+
+	return cmd
+}